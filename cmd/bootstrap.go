@@ -28,26 +28,30 @@ var bootstrapCmd = &cobra.Command{
 	Use:   "bootstrap",
 	Short: "Bootstrap your development environment with Nix",
 	Long:  "Bootstrap command sets up your development environment by installing Nix and configuring your home directory with the necessary tools and configuration files.",
-	Run: func(cmd *cobra.Command, args []string) {
-		if dryRun {
-			fmt.Fprintln(cmd.OutOrStdout(), "Running in dry-run mode - no actual installations will be performed")
-		}
-
-		// Get the current working directory to locate templates
-		cwd, err := os.Getwd()
-		if err != nil {
-			fmt.Fprintf(cmd.ErrOrStderr(), "Failed to get current directory: %v\n", err)
-			return
-		}
-		templatesFS := fsDirWrapper{fsys: os.DirFS(cwd)}
-		err = system.RunBootstrapWithHome(templatesFS, cmd.OutOrStdout(), dryRun)
-		if err != nil {
-			fmt.Fprintf(cmd.ErrOrStderr(), "Bootstrap failed: %v\n", err)
-			return
-		}
-	},
+	RunE:  lockedIf(func() bool { return !dryRun }, logged("bootstrap", diagnosed(runBootstrap))),
 }
 
 func init() {
 	bootstrapCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show what would be installed without actually installing")
+	addLockFlags(bootstrapCmd)
+}
+
+func runBootstrap(cmd *cobra.Command, args []string) error {
+	out := progressOutput(cmd)
+	result := system.NewOperationResult("bootstrap")
+	if dryRun {
+		fmt.Fprintln(out, "Running in dry-run mode - no actual installations will be performed")
+	}
+
+	// Get the current working directory to locate templates
+	cwd, err := os.Getwd()
+	if err != nil {
+		return finishOperation(cmd, result, fmt.Errorf("failed to get current directory: %w", err))
+	}
+	templatesFS := fsDirWrapper{fsys: os.DirFS(cwd)}
+	err = result.RunPhase("bootstrap", func() error { return system.RunBootstrapWithHome(templatesFS, out, dryRun) })
+	if err != nil {
+		return finishOperation(cmd, result, fmt.Errorf("bootstrap failed: %w", err))
+	}
+	return finishOperation(cmd, result, nil)
 }
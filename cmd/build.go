@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"fmt"
+
+	"camp/internal/system"
+
+	"github.com/spf13/cobra"
+)
+
+// buildResultInspector is a variable that can be overridden in tests
+var buildResultInspector = system.InspectBuildResult
+
+var buildCmd = &cobra.Command{
+	Use:   "build",
+	Short: "Build the development environment without activating it",
+	Long: `Build the development environment without activating it.
+
+This command:
+  1. Prepares the environment (copies files and renders templates with current config)
+  2. Runs only the build step of the active backend:
+     - macOS: darwin-rebuild build
+     - Linux: home-manager build
+     - NixOS: nixos-rebuild build
+     - Profile: nix build of the package profile
+  3. Leaves a 'result' link in ~/.camp/state and prints the store path
+     and closure size of the build
+
+Use it to check that a configuration change builds before switching to it,
+for example in CI. The command exits with a non-zero status if the build fails.
+Nix output is summarized as it runs; use --verbose to see it as is.
+
+Prerequisites:
+  - Nix package manager must be installed with flakes enabled`,
+	RunE: locked(runBuild),
+}
+
+var verboseBuild bool
+
+func init() {
+	envCmd.AddCommand(buildCmd)
+	addLockFlags(buildCmd)
+	buildCmd.Flags().BoolVarP(&verboseBuild, "verbose", "v", false, "Show the raw output of Nix instead of a progress summary")
+}
+
+// buildOutput is the machine-readable output of camp env build
+type buildOutput struct {
+	*system.OperationResult
+	*system.BuildResult
+	ResultLink string `json:"result_link,omitempty"`
+}
+
+func runBuild(cmd *cobra.Command, args []string) error {
+	// Get current user context
+	user := currentUser()
+	out := progressOutput(cmd)
+	output := buildOutput{OperationResult: system.NewOperationResult("build")}
+	result := output.OperationResult
+	finish := func(err error) error {
+		result.Finish(err)
+		return printResult(cmd, output, err)
+	}
+
+	backend, err := backendSelector(user)
+	if err != nil {
+		return finish(fmt.Errorf("failed to select backend: %w", err))
+	}
+	result.Backend = backend.Name()
+
+	fmt.Fprintf(out, "Starting environment build...\n")
+	fmt.Fprintf(out, "Backend: %s\n\n", backend.Name())
+
+	// Prepare environment (copy files and render templates)
+	fmt.Fprintf(out, "Preparing environment...\n")
+	if err := result.RunPhase("prepare", func() error { return backend.Prepare(user) }); err != nil {
+		return finish(fmt.Errorf("failed to prepare environment: %w", err))
+	}
+	fmt.Fprintf(out, "✓ Environment prepared successfully\n\n")
+
+	// Build without activating
+	fmt.Fprintf(out, "Executing build command...\n")
+	build := func() error { return backend.Build(user) }
+	if err := result.RunPhase("build", func() error { return runNix(cmd, verboseBuild, build) }); err != nil {
+		return finish(fmt.Errorf("build failed: %w", err))
+	}
+
+	buildResult, err := buildResultInspector(user)
+	if err != nil {
+		return finish(fmt.Errorf("failed to inspect build result: %w", err))
+	}
+	output.BuildResult = buildResult
+	output.ResultLink = system.ResultLink(user)
+
+	fmt.Fprintf(out, "\n✓ Environment built successfully!\n")
+	fmt.Fprintf(out, "Store path: %s\n", buildResult.StorePath)
+	fmt.Fprintf(out, "Closure size: %s\n", system.FormatBytes(buildResult.ClosureSize))
+	fmt.Fprintf(out, "Result link: %s\n", output.ResultLink)
+	return finish(nil)
+}
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"camp/internal/system"
+
+	"github.com/spf13/cobra"
+)
+
+// withBuildResult replaces the build result inspector with one returning the given result
+func withBuildResult(t *testing.T, result *system.BuildResult, err error) {
+	t.Helper()
+	original := buildResultInspector
+	buildResultInspector = func(user *system.User) (*system.BuildResult, error) {
+		return result, err
+	}
+	t.Cleanup(func() { buildResultInspector = original })
+}
+
+func TestBuildCommand(t *testing.T) {
+	t.Run("command is subcommand of env", func(t *testing.T) {
+		found := false
+		for _, cmd := range envCmd.Commands() {
+			if cmd.Use == "build" {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Error("build command should be registered as subcommand of env")
+		}
+	})
+
+	t.Run("builds without switching", func(t *testing.T) {
+		fake := &system.FakeBackend{}
+		withFakeBackend(t, fake)
+		withBuildResult(t, &system.BuildResult{
+			StorePath:   "/nix/store/abc-home-manager-generation",
+			ClosureSize: 2048,
+		}, nil)
+
+		var output bytes.Buffer
+		cmd := &cobra.Command{RunE: buildCmd.RunE}
+		cmd.SetOut(&output)
+		cmd.SetArgs([]string{})
+
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("Expected build to succeed, got: %v", err)
+		}
+
+		if strings.Join(fake.Calls, ",") != "prepare,build" {
+			t.Errorf("Expected calls 'prepare,build', got %v", fake.Calls)
+		}
+
+		outputStr := output.String()
+		if !strings.Contains(outputStr, "Store path: /nix/store/abc-home-manager-generation") {
+			t.Errorf("Expected store path in output, got:\n%s", outputStr)
+		}
+		if !strings.Contains(outputStr, "Closure size: 2.0 KiB") {
+			t.Errorf("Expected closure size in output, got:\n%s", outputStr)
+		}
+	})
+
+	t.Run("fails when build fails", func(t *testing.T) {
+		fake := &system.FakeBackend{BuildErr: errors.New("attribute 'foo' missing")}
+		withFakeBackend(t, fake)
+		withBuildResult(t, nil, errors.New("should not be called"))
+
+		cmd := &cobra.Command{RunE: buildCmd.RunE}
+		cmd.SetOut(&bytes.Buffer{})
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SetArgs([]string{})
+
+		err := cmd.Execute()
+		if err == nil || !strings.Contains(err.Error(), "build failed") {
+			t.Errorf("Expected build error, got: %v", err)
+		}
+	})
+}
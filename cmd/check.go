@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"fmt"
+
+	"camp/internal/system"
+
+	"github.com/spf13/cobra"
+)
+
+// environmentChecker is a variable that can be overridden in tests
+var environmentChecker = system.CheckEnvironment
+
+// argSchemaRefresher is a variable that can be overridden in tests
+var argSchemaRefresher = system.RefreshArgSchemas
+
+var checkCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Evaluate the configuration and report errors against camp.yml",
+	Long: `Evaluate the development environment configuration without building it.
+
+This command:
+  1. Fetches the argument schemas published by your flakes (camp.args.json
+     or a campArgs output) and checks the args of camp.yml against them
+  2. Prepares the environment (copies files and renders templates with current config)
+  3. Evaluates the configuration of the active backend with Nix
+  4. Maps common evaluation errors (missing attribute, wrong argument,
+     infinite recursion) back to the package, flake, output or argument
+     in camp.yml that caused them, with its line number
+
+The command exits with a non-zero status if the evaluation fails.
+
+Prerequisites:
+  - Nix package manager must be installed with flakes enabled`,
+	RunE: locked(runCheck),
+}
+
+func init() {
+	envCmd.AddCommand(checkCmd)
+	addLockFlags(checkCmd)
+}
+
+func runCheck(cmd *cobra.Command, args []string) error {
+	// Get current user context
+	user := currentUser()
+	out := progressOutput(cmd)
+
+	backend, err := backendSelector(user)
+	if err != nil {
+		return fmt.Errorf("failed to select backend: %w", err)
+	}
+
+	if ignored := system.IgnoredFlakes(user, backend.Name()); len(ignored) > 0 {
+		warnIgnoredFlakes(cmd.ErrOrStderr(), ignored, backend.Name())
+	}
+
+	// Fetch the schemas first, so the environment is rendered with their defaults
+	fmt.Fprintf(out, "Checking flake arguments...\n")
+	schemas, err := argSchemaRefresher(cmd.Context(), user)
+	if err != nil {
+		fmt.Fprintf(cmd.ErrOrStderr(), "⚠️  Could not fetch every argument schema: %v\n", err)
+	}
+	argIssues, err := system.CheckFlakeArgs(user, schemas)
+	if err != nil {
+		return fmt.Errorf("check failed: %w", err)
+	}
+
+	// Prepare environment (copy files and render templates)
+	fmt.Fprintf(out, "Preparing environment...\n")
+	if err := backend.Prepare(user); err != nil {
+		return fmt.Errorf("failed to prepare environment: %w", err)
+	}
+
+	fmt.Fprintf(out, "Evaluating configuration...\n")
+	result, err := environmentChecker(user)
+	if err != nil {
+		return fmt.Errorf("check failed: %w", err)
+	}
+
+	// Argument problems come first, they often explain the evaluation errors
+	if len(argIssues) > 0 {
+		result.Passed = false
+		result.Issues = append(argIssues, result.Issues...)
+	}
+
+	if result.Passed {
+		fmt.Fprintf(out, "\n✓ Configuration evaluates successfully\n")
+		return printResult(cmd, result, nil)
+	}
+
+	fmt.Fprintf(out, "\n❌ Configuration has %d error(s):\n\n", len(result.Issues))
+	for _, issue := range result.Issues {
+		if issue.Line > 0 {
+			fmt.Fprintf(out, "  %s:%d: %s\n", result.ConfigPath, issue.Line, issue.Entry)
+		} else {
+			fmt.Fprintf(out, "  %s: could not be attributed to an entry\n", result.ConfigPath)
+		}
+		fmt.Fprintf(out, "    %s\n", issue.Error.Message)
+	}
+	return printResult(cmd, result, &system.ConfigError{Err: fmt.Errorf("configuration check failed")})
+}
@@ -0,0 +1,169 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"camp/internal/system"
+
+	"github.com/spf13/cobra"
+)
+
+// withCheckResult replaces the environment checker with one returning the given result
+func withCheckResult(t *testing.T, result *system.CheckResult) {
+	t.Helper()
+	original := environmentChecker
+	environmentChecker = func(user *system.User) (*system.CheckResult, error) {
+		return result, nil
+	}
+	t.Cleanup(func() { environmentChecker = original })
+	withArgSchemas(t, nil)
+}
+
+// withArgSchemas replaces the fetching of argument schemas with the given schemas
+func withArgSchemas(t *testing.T, schemas map[string]system.ArgSchema) {
+	t.Helper()
+	original := argSchemaRefresher
+	argSchemaRefresher = func(ctx context.Context, user *system.User) (map[string]system.ArgSchema, error) {
+		return schemas, nil
+	}
+	t.Cleanup(func() { argSchemaRefresher = original })
+}
+
+func TestCheckCommand(t *testing.T) {
+	t.Run("command is subcommand of env", func(t *testing.T) {
+		found := false
+		for _, cmd := range envCmd.Commands() {
+			if cmd.Use == "check" {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Error("check command should be registered as subcommand of env")
+		}
+	})
+
+	t.Run("passing check", func(t *testing.T) {
+		withFakeBackend(t, &system.FakeBackend{})
+		withCheckResult(t, &system.CheckResult{Passed: true})
+
+		var output bytes.Buffer
+		cmd := &cobra.Command{RunE: checkCmd.RunE}
+		cmd.SetOut(&output)
+		cmd.SetArgs([]string{})
+
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("Expected check to succeed, got: %v", err)
+		}
+		if !strings.Contains(output.String(), "✓ Configuration evaluates successfully") {
+			t.Errorf("Expected success message, got:\n%s", output.String())
+		}
+	})
+
+	t.Run("failing check reports camp.yml lines", func(t *testing.T) {
+		withFakeBackend(t, &system.FakeBackend{})
+		withCheckResult(t, &system.CheckResult{
+			ConfigPath: "/home/test/.camp/camp.yml",
+			Issues: []system.ConfigIssue{
+				{
+					Line:  6,
+					Entry: "package 'ripgrepp'",
+					Error: system.NixError{Kind: system.NixErrorMissingAttribute, Message: "attribute 'ripgrepp' missing"},
+				},
+				{
+					Error: system.NixError{Kind: system.NixErrorOther, Message: "undefined variable 'pkgz'"},
+				},
+			},
+		})
+
+		var output bytes.Buffer
+		cmd := &cobra.Command{RunE: checkCmd.RunE}
+		cmd.SetOut(&output)
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SetArgs([]string{})
+
+		if err := cmd.Execute(); err == nil {
+			t.Fatal("Expected check to fail")
+		}
+
+		outputStr := output.String()
+		expected := []string{
+			"/home/test/.camp/camp.yml:6: package 'ripgrepp'",
+			"attribute 'ripgrepp' missing",
+			"could not be attributed to an entry",
+			"undefined variable 'pkgz'",
+		}
+		for _, phrase := range expected {
+			if !strings.Contains(outputStr, phrase) {
+				t.Errorf("Expected output to contain %q, got:\n%s", phrase, outputStr)
+			}
+		}
+	})
+	t.Run("fails while another command holds the lock", func(t *testing.T) {
+		user := withTestHome(t)
+		fake := &system.FakeBackend{}
+		withFakeBackend(t, fake)
+		withCheckResult(t, &system.CheckResult{Passed: true})
+		withLockFlags(t, false, defaultLockWaitTimeout)
+
+		holder, err := system.AcquireLock(user, "camp env rebuild", 0, &bytes.Buffer{})
+		if err != nil {
+			t.Fatalf("AcquireLock() failed: %v", err)
+		}
+		defer holder.Release()
+
+		cmd := &cobra.Command{RunE: checkCmd.RunE}
+		cmd.SetOut(&bytes.Buffer{})
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SetArgs([]string{})
+
+		if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), "locked by 'camp env rebuild'") {
+			t.Fatalf("Expected a lock error, got: %v", err)
+		}
+		if len(fake.Calls) != 0 {
+			t.Errorf("Expected the environment not to be prepared, got %v", fake.Calls)
+		}
+	})
+	t.Run("flake arguments are checked against their schema", func(t *testing.T) {
+		user := withTestHome(t)
+		withFakeBackend(t, &system.FakeBackend{})
+		withCheckResult(t, &system.CheckResult{Passed: true, ConfigPath: system.ConfigPath(user.HomeDir)})
+		withArgSchemas(t, map[string]system.ArgSchema{
+			"tools": {"enableDevTools": {Type: system.ArgTypeBool, Default: false}},
+		})
+
+		configPath := system.ConfigPath(user.HomeDir)
+		if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
+			t.Fatalf("Failed to create camp directory: %v", err)
+		}
+		config := "flakes:\n  - name: tools\n    url: github:team/tools\n    args:\n      enableDevTols: true\n    outputs:\n      - name: homeManagerModules.default\n        type: home\n"
+		if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+		user.Flakes = []system.Flake{{
+			Name:    "tools",
+			URL:     "github:team/tools",
+			Args:    map[string]interface{}{"enableDevTols": true},
+			Outputs: []system.FlakeOutput{{Name: "homeManagerModules.default", Type: system.OutputTypeHome}},
+		}}
+
+		var output bytes.Buffer
+		cmd := &cobra.Command{RunE: checkCmd.RunE}
+		cmd.SetOut(&output)
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SetArgs([]string{})
+
+		if err := cmd.Execute(); err == nil {
+			t.Fatal("Expected check to fail")
+		}
+		expected := configPath + ":5: flake 'tools' argument 'enableDevTols'\n    unknown argument 'enableDevTols' - did you mean 'enableDevTools'?"
+		if !strings.Contains(output.String(), expected) {
+			t.Errorf("Expected output to contain %q, got:\n%s", expected, output.String())
+		}
+	})
+}
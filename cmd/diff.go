@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"camp/internal/system"
+
+	"github.com/spf13/cobra"
+)
+
+// generationDiffer is a variable that can be overridden in tests
+var generationDiffer = system.DiffGenerations
+
+var diffCmd = &cobra.Command{
+	Use:   "diff [genA] [genB]",
+	Short: "Show the package changes between two generations",
+	Long: `Show the packages added, removed and upgraded between two generations,
+and how the closure size changed.
+
+Without arguments, shows the changes made by the rebuild that created the
+current generation. With one generation, compares it to the current one.
+
+Examples:
+  camp env diff          # Changes made by the last rebuild
+  camp env diff 41       # Changes from generation 41 to the current one
+  camp env diff 41 43    # Changes from generation 41 to generation 43`,
+	Args: cobra.MaximumNArgs(2),
+	RunE: runDiff,
+}
+
+func init() {
+	envCmd.AddCommand(diffCmd)
+}
+
+func runDiff(cmd *cobra.Command, args []string) error {
+	// Get current user context
+	user := currentUser()
+
+	ids := make([]int, len(args))
+	for i, arg := range args {
+		id, err := strconv.Atoi(arg)
+		if err != nil {
+			return &usageError{fmt.Errorf("invalid generation '%s' - must be a number", arg)}
+		}
+		ids[i] = id
+	}
+
+	backend, err := backendSelector(user)
+	if err != nil {
+		return fmt.Errorf("failed to select backend: %w", err)
+	}
+	gens, err := backend.Generations(user)
+	if err != nil {
+		return err
+	}
+
+	current := system.CurrentGeneration(gens)
+	if current == nil {
+		return fmt.Errorf("no current generation found - run 'camp env rebuild' first")
+	}
+
+	// Resolve the generations to compare, defaulting to the last rebuild
+	to := current
+	if len(ids) == 2 {
+		if to, err = system.FindGeneration(gens, ids[1]); err != nil {
+			return err
+		}
+	}
+	var from *system.Generation
+	if len(ids) > 0 {
+		if from, err = system.FindGeneration(gens, ids[0]); err != nil {
+			return err
+		}
+	}
+
+	// Reuse the summary stored by the rebuild that created the generation
+	diff, err := system.LoadGenerationDiff(user, backend.Name(), to.ID)
+	if err != nil {
+		return err
+	}
+	if diff == nil || (from != nil && diff.From != from.ID) {
+		if from == nil {
+			previous, err := generationBefore(gens, to.ID)
+			if err != nil {
+				return err
+			}
+			from = previous
+		}
+		if diff, err = generationDiffer(*from, *to); err != nil {
+			return err
+		}
+	}
+
+	if jsonOutput() {
+		return printResult(cmd, diff, nil)
+	}
+	printClosureDiff(cmd.OutOrStdout(), diff)
+	return nil
+}
+
+// generationBefore returns the newest generation older than id
+func generationBefore(gens []system.Generation, id int) (*system.Generation, error) {
+	var before *system.Generation
+	for i := range gens {
+		if gens[i].ID < id && (before == nil || gens[i].ID > before.ID) {
+			before = &gens[i]
+		}
+	}
+	if before == nil {
+		return nil, fmt.Errorf("generation %d has no previous generation to compare with", id)
+	}
+	return before, nil
+}
+
+// summarizeRebuild prints and stores the package changes between the
+// generation active before a rebuild and the new one. Failing to compute
+// them is reported as a warning, the rebuild itself succeeded
+func summarizeRebuild(out io.Writer, user *system.User, backend system.Backend, previous *system.Generation, result *system.OperationResult) {
+	if previous == nil {
+		// First generation, nothing to compare with
+		return
+	}
+	gens, err := backend.Generations(user)
+	if err != nil {
+		result.AddWarning("diff", err)
+		return
+	}
+	current := system.CurrentGeneration(gens)
+	if current == nil || current.ID == previous.ID {
+		return
+	}
+
+	diff, err := generationDiffer(*previous, *current)
+	if err != nil {
+		result.AddWarning("diff", err)
+		fmt.Fprintf(out, "⚠️  Could not compute package changes: %v\n", err)
+		return
+	}
+	result.Changes = diff
+	if err := system.SaveGenerationDiff(user, backend.Name(), diff); err != nil {
+		result.AddWarning("diff", err)
+	}
+
+	fmt.Fprintln(out)
+	printClosureDiff(out, diff)
+}
+
+// printClosureDiff prints the package changes between two generations
+func printClosureDiff(out io.Writer, diff *system.ClosureDiff) {
+	fmt.Fprintf(out, "Changes (generation %d → %d):\n", diff.From, diff.To)
+	if diff.Empty() {
+		fmt.Fprintf(out, "  No package changes\n")
+	}
+
+	printChanges := func(title string, changes []system.PackageChange, describe func(system.PackageChange) string) {
+		if len(changes) == 0 {
+			return
+		}
+		fmt.Fprintf(out, "  %s:\n", title)
+		for _, change := range changes {
+			fmt.Fprintf(out, "    %s %s (%s)\n", change.Name, describe(change), system.FormatSizeDelta(change.SizeDelta))
+		}
+	}
+	printChanges("Upgraded", diff.Upgraded, func(change system.PackageChange) string {
+		return strings.Join(change.OldVersions, ", ") + " → " + strings.Join(change.NewVersions, ", ")
+	})
+	printChanges("Added", diff.Added, func(change system.PackageChange) string {
+		return strings.Join(change.NewVersions, ", ")
+	})
+	printChanges("Removed", diff.Removed, func(change system.PackageChange) string {
+		return strings.Join(change.OldVersions, ", ")
+	})
+
+	fmt.Fprintf(out, "  Closure size: %s → %s (%s)\n",
+		system.FormatBytes(diff.FromClosureSize), system.FormatBytes(diff.ToClosureSize), system.FormatSizeDelta(diff.ClosureSizeDelta))
+}
@@ -0,0 +1,176 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"camp/internal/system"
+
+	"github.com/spf13/cobra"
+)
+
+// switchingBackend is a fake backend whose Switch activates a new generation
+type switchingBackend struct {
+	*system.FakeBackend
+}
+
+func (b *switchingBackend) Switch(user *system.User) error {
+	if err := b.FakeBackend.Switch(user); err != nil {
+		return err
+	}
+	next := system.Generation{ID: 1, Current: true}
+	for i := range b.GenerationList {
+		b.GenerationList[i].Current = false
+		next.ID = b.GenerationList[i].ID + 1
+	}
+	next.Path = fmt.Sprintf("/profiles/gen-%d", next.ID)
+	b.GenerationList = append(b.GenerationList, next)
+	return nil
+}
+
+// withGenerationDiffer replaces the generation differ with one returning diff
+func withGenerationDiffer(t *testing.T, diff *system.ClosureDiff, err error) *[][2]int {
+	t.Helper()
+	var compared [][2]int
+	original := generationDiffer
+	generationDiffer = func(from, to system.Generation) (*system.ClosureDiff, error) {
+		compared = append(compared, [2]int{from.ID, to.ID})
+		if diff == nil {
+			return nil, err
+		}
+		result := *diff
+		result.From, result.To = from.ID, to.ID
+		return &result, err
+	}
+	t.Cleanup(func() { generationDiffer = original })
+	return &compared
+}
+
+var testClosureDiff = &system.ClosureDiff{
+	Added:            []system.PackageChange{{Name: "hello", NewVersions: []string{"2.12.1"}, SizeDelta: 102400}},
+	Removed:          []system.PackageChange{{Name: "oldtool", OldVersions: []string{"1.0"}, SizeDelta: -10240}},
+	Upgraded:         []system.PackageChange{{Name: "firefox", OldVersions: []string{"120.0"}, NewVersions: []string{"121.0"}, SizeDelta: 3355443}},
+	FromClosureSize:  1 << 30,
+	ToClosureSize:    1<<30 + 3<<20,
+	ClosureSizeDelta: 3 << 20,
+}
+
+// runDiffCommand runs camp env diff with the given arguments
+func runDiffCommand(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	var output bytes.Buffer
+	cmd := &cobra.Command{RunE: diffCmd.RunE}
+	cmd.SetOut(&output)
+	cmd.SetErr(&bytes.Buffer{})
+	cmd.SilenceUsage = true
+	cmd.SetArgs(args)
+	err := cmd.Execute()
+	return output.String(), err
+}
+
+func TestRebuildPrintsChangeSummary(t *testing.T) {
+	withTestHome(t)
+	fake := &switchingBackend{&system.FakeBackend{GenerationList: []system.Generation{{ID: 1, Path: "/profiles/gen-1", Current: true}}}}
+	original := backendSelector
+	backendSelector = func(user *system.User) (system.Backend, error) { return fake, nil }
+	t.Cleanup(func() { backendSelector = original })
+	compared := withGenerationDiffer(t, testClosureDiff, nil)
+
+	var output bytes.Buffer
+	cmd := &cobra.Command{RunE: rebuildCmd.RunE}
+	cmd.SetOut(&output)
+	cmd.SetArgs([]string{})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("Expected rebuild to succeed, got: %v", err)
+	}
+
+	if len(*compared) != 1 || (*compared)[0] != [2]int{1, 2} {
+		t.Errorf("Expected generations 1 and 2 to be compared, got %v", *compared)
+	}
+	for _, want := range []string{
+		"Changes (generation 1 → 2):",
+		"firefox 120.0 → 121.0 (+3.2 MiB)",
+		"hello 2.12.1 (+100.0 KiB)",
+		"oldtool 1.0 (-10.0 KiB)",
+		"Closure size: 1.0 GiB → 1.0 GiB (+3.0 MiB)",
+	} {
+		if !strings.Contains(output.String(), want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, output.String())
+		}
+	}
+
+	// The summary is stored and shown again by camp env diff without recomputing it
+	output.Reset()
+	diffOutput, err := runDiffCommand(t)
+	if err != nil {
+		t.Fatalf("Expected diff to succeed, got: %v", err)
+	}
+	if !strings.Contains(diffOutput, "Changes (generation 1 → 2):") || len(*compared) != 1 {
+		t.Errorf("Expected stored summary to be shown, got:\n%s (compared %v)", diffOutput, *compared)
+	}
+}
+
+func TestRebuildChangeSummaryFailure(t *testing.T) {
+	withTestHome(t)
+	fake := &switchingBackend{&system.FakeBackend{GenerationList: []system.Generation{{ID: 1, Current: true}}}}
+	original := backendSelector
+	backendSelector = func(user *system.User) (system.Backend, error) { return fake, nil }
+	t.Cleanup(func() { backendSelector = original })
+	withGenerationDiffer(t, nil, errors.New("nix store diff-closures failed"))
+
+	var output bytes.Buffer
+	cmd := &cobra.Command{RunE: rebuildCmd.RunE}
+	cmd.SetOut(&output)
+	cmd.SetArgs([]string{})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("A failing summary should not fail the rebuild, got: %v", err)
+	}
+	if !strings.Contains(output.String(), "Could not compute package changes") {
+		t.Errorf("Expected warning, got:\n%s", output.String())
+	}
+}
+
+func TestDiffCommand(t *testing.T) {
+	gens := []system.Generation{{ID: 3}, {ID: 5}, {ID: 7, Current: true}}
+
+	tests := []struct {
+		name     string
+		args     []string
+		compared [2]int
+		wantErr  string
+	}{
+		{name: "defaults to the last rebuild", args: nil, compared: [2]int{5, 7}},
+		{name: "compares to the current generation", args: []string{"3"}, compared: [2]int{3, 7}},
+		{name: "compares two generations", args: []string{"3", "5"}, compared: [2]int{3, 5}},
+		{name: "unknown generation", args: []string{"4"}, wantErr: "generation 4 not found"},
+		{name: "invalid generation", args: []string{"latest"}, wantErr: "must be a number"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withTestHome(t)
+			withFakeBackend(t, &system.FakeBackend{GenerationList: gens})
+			compared := withGenerationDiffer(t, testClosureDiff, nil)
+
+			output, err := runDiffCommand(t, tt.args...)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Expected error containing '%s', got: %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected diff to succeed, got: %v", err)
+			}
+			if len(*compared) != 1 || (*compared)[0] != tt.compared {
+				t.Errorf("Expected %v to be compared, got %v", tt.compared, *compared)
+			}
+			if !strings.Contains(output, "Upgraded:") {
+				t.Errorf("Expected summary, got:\n%s", output)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	"camp/internal/system"
+
+	"github.com/spf13/cobra"
+)
+
+var doctorFix bool
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check the health of the development environment",
+	Long: `Check the health of the development environment.
+
+Reports on:
+  - Nix: installed, its version, flakes enabled, daemon or single-user install
+  - The tools of the backend (home-manager, nixos-rebuild, darwin-rebuild)
+  - direnv installed and hooked into your shell
+  - ~/.camp: directories, camp.yml validity and executable scripts
+  - Stale .backup files left by home-manager
+  - USER and SHELL environment variables
+
+Each check passes, warns or fails. With --fix, problems that can be fixed
+safely are fixed: missing ~/.camp directories and camp.yml are created,
+scripts are made executable, flakes are enabled in ~/.config/nix/nix.conf
+and stale backups are moved to ~/.camp/state/backups.
+
+The command exits with a non-zero status if any check fails.`,
+	RunE: lockedIf(func() bool { return doctorFix }, runDoctor),
+}
+
+func init() {
+	doctorCmd.Flags().BoolVar(&doctorFix, "fix", false, "Fix the problems that can be fixed safely")
+	addLockFlags(doctorCmd)
+}
+
+func runDoctor(cmd *cobra.Command, args []string) error {
+	// Get current user context
+	user := currentUser()
+	report := system.RunDoctor(user, doctorFix)
+
+	var err error
+	if !report.Healthy() {
+		err = fmt.Errorf("%d check(s) failed", report.Failed)
+	}
+	if jsonOutput() {
+		return printResult(cmd, report, err)
+	}
+
+	printHealthReport(cmd.OutOrStdout(), report)
+	return err
+}
+
+// printHealthReport prints the outcome of each check and a summary
+func printHealthReport(out io.Writer, report *system.HealthReport) {
+	fixable := 0
+	for _, check := range report.Checks {
+		marker := map[string]string{
+			system.HealthPass: "✓",
+			system.HealthWarn: "⚠️ ",
+			system.HealthFail: "✗",
+		}[check.Status]
+		fmt.Fprintf(out, "%s %-8s %s\n", marker, check.Name, check.Message)
+		for _, detail := range check.Details {
+			fmt.Fprintf(out, "           - %s\n", detail)
+		}
+		if check.Fixed {
+			fmt.Fprintf(out, "           Fixed by camp doctor --fix\n")
+		}
+		if check.Status != system.HealthPass && check.Suggestion != "" {
+			fmt.Fprintf(out, "           Fix: %s\n", check.Suggestion)
+		}
+		if check.Status != system.HealthPass && check.Fixable {
+			fixable++
+		}
+	}
+
+	fmt.Fprintf(out, "\n%d passed, %d warning(s), %d failed\n", report.Passed, report.Warnings, report.Failed)
+	if fixable > 0 && !doctorFix {
+		fmt.Fprintf(out, "Run 'camp doctor --fix' to fix %d problem(s) automatically.\n", fixable)
+	}
+}
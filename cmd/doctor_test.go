@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"camp/internal/system"
+)
+
+func TestPrintHealthReport(t *testing.T) {
+	report := &system.HealthReport{
+		Checks: []system.HealthCheck{
+			{Name: "nix", Status: system.HealthPass, Message: "Nix 2.24.10 installed"},
+			{Name: "backups", Status: system.HealthWarn, Message: "1 stale .backup file(s) left by home-manager", Details: []string{"/home/alice/.bashrc.backup"}, Suggestion: "Review and delete them", Fixable: true},
+			{Name: "env", Status: system.HealthFail, Message: "USER is not set", Suggestion: "Run 'export USER=$(id -un)'"},
+		},
+		Passed:   1,
+		Warnings: 1,
+		Failed:   1,
+	}
+
+	var output bytes.Buffer
+	printHealthReport(&output, report)
+
+	expected := []string{
+		"✓ nix      Nix 2.24.10 installed",
+		"⚠️  backups  1 stale .backup file(s) left by home-manager",
+		"- /home/alice/.bashrc.backup",
+		"Fix: Review and delete them",
+		"✗ env      USER is not set",
+		"1 passed, 1 warning(s), 1 failed",
+		"Run 'camp doctor --fix' to fix 1 problem(s) automatically.",
+	}
+	for _, want := range expected {
+		if !strings.Contains(output.String(), want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, output.String())
+		}
+	}
+	if strings.Contains(output.String(), "Fix: Nix") {
+		t.Errorf("Expected no suggestion for passing checks, got:\n%s", output.String())
+	}
+}
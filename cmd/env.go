@@ -21,8 +21,28 @@ var envCmd = &cobra.Command{
 			return
 		}
 
+		if jsonOutput() {
+			info := system.EnvironmentInfo{
+				OS:           sysInfo.OS,
+				Architecture: sysInfo.Architecture,
+				Distribution: sysInfo.Distribution,
+				DirenvVars:   []system.EnvVar{},
+			}
+			// A missing .envrc just means there are no direnv variables
+			if envVars, err := readDirenvVars(); err == nil && envVars != nil {
+				info.DirenvVars = envVars
+			}
+			if err := writeJSON(cmd.OutOrStdout(), info); err != nil {
+				fmt.Fprintf(cmd.ErrOrStderr(), "Error: %v\n", err)
+			}
+			return
+		}
+
 		fmt.Fprintf(cmd.OutOrStdout(), "Architecture: %s\n", sysInfo.Architecture)
 		fmt.Fprintf(cmd.OutOrStdout(), "OS: %s\n", sysInfo.OS)
+		if sysInfo.Distribution != "" {
+			fmt.Fprintf(cmd.OutOrStdout(), "Distribution: %s\n", sysInfo.Distribution)
+		}
 
 		err = printDirenvVars(cmd.OutOrStdout())
 		if err != nil {
@@ -31,23 +51,27 @@ var envCmd = &cobra.Command{
 	},
 }
 
-func printDirenvVars(out io.Writer) error {
+// readDirenvVars returns the variables exported by .envrc in the current directory
+func readDirenvVars() ([]system.EnvVar, error) {
 	file, err := os.Open(".envrc")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return system.GetExportedVars(file)
+}
+
+func printDirenvVars(out io.Writer) error {
+	envVars, err := readDirenvVars()
 	if err != nil {
 		return err
-	} else {
-		defer file.Close()
-		envVars, err := system.GetExportedVars(file)
-		if err != nil {
-			return err
-		}
+	}
 
-		if len(envVars) > 0 {
-			fmt.Fprintf(out, "\nDirenv variables:\n")
-			for _, envVar := range envVars {
-				fmt.Fprintf(out, "%s=%s\n", envVar.Name, envVar.Value)
-			}
+	if len(envVars) > 0 {
+		fmt.Fprintf(out, "\nDirenv variables:\n")
+		for _, envVar := range envVars {
+			fmt.Fprintf(out, "%s=%s\n", envVar.Name, envVar.Value)
 		}
-		return nil
 	}
+	return nil
 }
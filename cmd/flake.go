@@ -0,0 +1,372 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"camp/internal/system"
+
+	"github.com/spf13/cobra"
+)
+
+var flakeCmd = &cobra.Command{
+	Use:   "flake",
+	Short: "Inspect and list the flakes integrated in your environment",
+	Long:  "Inspect external Nix flakes, before adding them to camp.yml or once they are configured.",
+}
+
+var flakeInspectCmd = &cobra.Command{
+	Use:   "inspect <url|name>",
+	Short: "List the modules a flake exposes and suggest a camp.yml entry",
+	Long: `List the home-manager, nix-darwin and NixOS modules a flake exposes.
+
+The argument is either a flake URL (e.g. github:team/tools) or the name of a
+flake already in camp.yml. The outputs are listed with 'nix flake show' and
+each module is evaluated to find out whether it is a function expecting the
+userName, hostName and home arguments camp passes to flake outputs.
+
+For a flake that isn't in camp.yml yet, a ready-to-use flakes entry importing
+those modules is printed, and you are offered to add it to camp.yml. Modules
+taking camp's arguments are called with them; plain modules are imported
+as-is with 'call: false'. Use --write to add the entry without asking.
+
+Prerequisites:
+  - Nix package manager must be installed with flakes enabled`,
+	Args: cobra.ExactArgs(1),
+	RunE: runFlakeInspect,
+}
+
+var flakeListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the flakes of camp.yml and whether they apply to this machine",
+	Long: `List the flakes of camp.yml and their outputs, with whether each one is
+active on this machine and why.
+
+Flakes and outputs with 'enabled: false', or whose 'when' block (platform,
+arch, hostname) doesn't match this machine, are inactive: they are left out
+of the rendered flake.nix, not even fetched as inputs.`,
+	Args: cobra.NoArgs,
+	RunE: runFlakeList,
+}
+
+var flakeDevelopCmd = &cobra.Command{
+	Use:   "develop [name] [path]",
+	Short: "Use a local checkout of a flake of camp.yml in the next rebuilds",
+	Long: `Use a local checkout of a flake of camp.yml instead of its URL, to try
+changes to the flake without pushing them.
+
+The override is recorded in ~/.camp/state: the next rebuilds render the flake
+input as 'path:<dir>' and ignore its rev, ref, dir and host. Edits to the
+checkout make the environment out of date, so 'camp env rebuild' picks them
+up. camp.yml is left untouched. The entry of the flake in flake.lock is saved
+and put back by --reset, so the flake returns to its locked revision.
+
+  camp flake develop tools ~/src/tools   Use ~/src/tools for the flake 'tools'
+  camp flake develop --reset tools       Go back to the URL of camp.yml
+  camp flake develop                     List the active overrides
+
+'camp env status' and 'camp env rebuild' warn while an override is active.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		switch {
+		case flakeDevelopReset && len(args) != 1:
+			return &usageError{fmt.Errorf("--reset expects the name of the flake")}
+		case !flakeDevelopReset && len(args) == 1:
+			return &usageError{fmt.Errorf("expected the path of the checkout of flake '%s'", args[0])}
+		case len(args) > 2:
+			return &usageError{fmt.Errorf("expected at most 2 arguments, got %d", len(args))}
+		}
+		return nil
+	},
+	RunE: locked(runFlakeDevelop),
+}
+
+var (
+	flakeInspectWrite bool
+	flakeInspectName  string
+	flakeDevelopReset bool
+)
+
+func init() {
+	flakeCmd.AddCommand(flakeInspectCmd)
+	flakeCmd.AddCommand(flakeListCmd)
+	flakeCmd.AddCommand(flakeDevelopCmd)
+	flakeDevelopCmd.Flags().BoolVar(&flakeDevelopReset, "reset", false, "Remove the override of the flake")
+	addLockFlags(flakeDevelopCmd)
+	flakeInspectCmd.Flags().BoolVar(&flakeInspectWrite, "write", false, "Add the suggested entry to camp.yml without asking")
+	flakeInspectCmd.Flags().StringVar(&flakeInspectName, "name", "", "Name of the suggested entry (default: derived from the URL)")
+	addLockFlags(flakeInspectCmd)
+}
+
+// flakeInspectOutput is the machine-readable output of camp flake inspect
+type flakeInspectOutput struct {
+	*system.FlakeInspection
+	Configured bool   `json:"configured"`      // Whether the flake is already in camp.yml
+	Entry      string `json:"entry,omitempty"` // Suggested camp.yml entry
+}
+
+func runFlakeInspect(cmd *cobra.Command, args []string) error {
+	user := currentUser()
+	out := cmd.OutOrStdout()
+
+	// A name refers to a flake of camp.yml, anything else is a URL to inspect
+	url, configured := args[0], false
+	for _, flake := range user.Flakes {
+		if flake.Name == args[0] {
+			url, configured = flake.FlakeURL(), true
+			break
+		}
+	}
+	ref, err := system.ParseFlakeRef(url)
+	if err != nil {
+		return &usageError{fmt.Errorf("invalid flake URL: %w", err)}
+	}
+
+	inspection, err := system.InspectFlake(cmd.Context(), ref.String())
+	if err != nil {
+		return err
+	}
+
+	output := flakeInspectOutput{FlakeInspection: inspection, Configured: configured}
+	var suggestion system.Flake
+	if !configured {
+		name := flakeInspectName
+		if name == "" {
+			name = system.DefaultFlakeName(ref)
+		}
+		suggestion = system.SuggestFlake(name, inspection, systemModuleKind(user))
+		if len(suggestion.Outputs) > 0 {
+			if output.Entry, err = system.FlakeEntryYAML(suggestion); err != nil {
+				return err
+			}
+		}
+	}
+
+	if jsonOutput() {
+		if output.Entry != "" && flakeInspectWrite {
+			if err := addFlakeToConfig(cmd, user, suggestion); err != nil {
+				return err
+			}
+		}
+		return printResult(cmd, output, nil)
+	}
+
+	fmt.Fprintf(out, "Flake: %s\n", inspection.URL)
+	fmt.Fprintf(out, "Outputs: %s\n\n", strings.Join(inspection.Outputs, ", "))
+	printFlakeModules(out, inspection.Modules)
+
+	switch {
+	case configured:
+		fmt.Fprintf(out, "\nThis flake is configured in camp.yml as '%s'.\n", args[0])
+		return nil
+	case output.Entry == "":
+		fmt.Fprintf(out, "\nThis flake has no home-manager module, nor system module for your backend, to import.\n")
+		return nil
+	}
+
+	fmt.Fprintf(out, "\nSuggested camp.yml entry:\n\n%s\n", output.Entry)
+	if !flakeInspectWrite && !confirm(cmd, "Add this entry to camp.yml?") {
+		return nil
+	}
+	if err := addFlakeToConfig(cmd, user, suggestion); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "✓ Added flake '%s' to %s\n", suggestion.Name, system.ConfigPath(user.HomeDir))
+	fmt.Fprintf(out, "\nNext step: Run 'camp env rebuild' to apply it.\n")
+	return nil
+}
+
+// addFlakeToConfig adds a flake to camp.yml, holding the camp lock so that
+// running commands don't read the file while it is rewritten. The inspection
+// itself runs without the lock
+func addFlakeToConfig(cmd *cobra.Command, user *system.User, flake system.Flake) error {
+	return withLock(cmd, func() error {
+		return system.AddFlakeToConfig(system.ConfigPath(user.HomeDir), flake)
+	})
+}
+
+// flakeListEntry is the machine-readable status of a flake of camp.yml
+type flakeListEntry struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	system.FlakeStatus
+	Outputs []flakeListOutput `json:"outputs"`
+}
+
+// flakeListOutput is the machine-readable status of a flake output
+type flakeListOutput struct {
+	Name string                 `json:"name"`
+	Type system.FlakeOutputType `json:"type"`
+	Call bool                   `json:"call"`
+	system.FlakeStatus
+}
+
+func runFlakeList(cmd *cobra.Command, args []string) error {
+	user := currentUser()
+
+	entries := []flakeListEntry{}
+	for _, flake := range user.Flakes {
+		entry := flakeListEntry{Name: flake.Name, URL: flake.FlakeURL(), FlakeStatus: flake.Status(user), Outputs: []flakeListOutput{}}
+		for _, output := range flake.Outputs {
+			status := output.Status(user)
+			// Outputs of an inactive flake aren't imported, whatever their own conditions
+			if !entry.Active && status.Active {
+				status = system.FlakeStatus{Reason: "flake is inactive"}
+			}
+			entry.Outputs = append(entry.Outputs, flakeListOutput{Name: output.Name, Type: output.Type, Call: output.Calls(), FlakeStatus: status})
+		}
+		entries = append(entries, entry)
+	}
+
+	if jsonOutput() {
+		return printResult(cmd, entries, nil)
+	}
+
+	out := cmd.OutOrStdout()
+	if len(entries) == 0 {
+		fmt.Fprintf(out, "No flakes configured in %s\n", system.ConfigPath(user.HomeDir))
+		return nil
+	}
+
+	fmt.Fprintf(out, "Flakes on %s (%s/%s):\n\n", user.HostName, user.Platform, user.Architecture)
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FLAKE\tSTATUS\tREASON")
+	for _, entry := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", entry.Name, describeActive(entry.Active), entry.Reason)
+		for _, output := range entry.Outputs {
+			fmt.Fprintf(w, "  %s\t%s\t%s\n", output.Name, describeActive(output.Active), output.Reason)
+		}
+	}
+	w.Flush()
+	return nil
+}
+
+func runFlakeDevelop(cmd *cobra.Command, args []string) error {
+	user := currentUser()
+	out := cmd.OutOrStdout()
+
+	switch {
+	case flakeDevelopReset:
+		if err := system.ResetFlakeOverride(user, args[0]); err != nil {
+			return err
+		}
+		if jsonOutput() {
+			return printResult(cmd, system.ActiveFlakeOverrides(user), nil)
+		}
+		fmt.Fprintf(out, "✓ Flake '%s' uses its URL of camp.yml again\n", args[0])
+	case len(args) == 2:
+		override, err := system.SetFlakeOverride(user, args[0], args[1], time.Now())
+		if err != nil {
+			return err
+		}
+		if jsonOutput() {
+			return printResult(cmd, system.ActiveFlakeOverrides(user), nil)
+		}
+		fmt.Fprintf(out, "✓ Flake '%s' now uses %s\n", override.Flake, override.URL())
+		fmt.Fprintf(out, "Undo with 'camp flake develop --reset %s'.\n", override.Flake)
+	default:
+		overrides := system.ActiveFlakeOverrides(user)
+		if jsonOutput() {
+			return printResult(cmd, overrides, nil)
+		}
+		if len(overrides) == 0 {
+			fmt.Fprintf(out, "No flake is overridden by a local checkout\n")
+			return nil
+		}
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "FLAKE\tCHECKOUT\tSINCE")
+		for _, override := range overrides {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", override.Flake, override.Path, override.CreatedAt.Format("2006-01-02 15:04:05"))
+		}
+		w.Flush()
+		return nil
+	}
+
+	fmt.Fprintf(out, "\nNext step: Run 'camp env rebuild' to apply it.\n")
+	return nil
+}
+
+// warnFlakeOverrides prints a warning for every flake replaced by a local checkout
+func warnFlakeOverrides(out io.Writer, overrides []system.FlakeOverride) {
+	for _, override := range overrides {
+		fmt.Fprintf(out, "⚠️  Flake '%s' is overridden by the local checkout %s (camp flake develop --reset %s to undo)\n", override.Flake, override.Path, override.Flake)
+	}
+}
+
+// warnIgnoredFlakes prints a warning listing the flakes the backend doesn't apply
+func warnIgnoredFlakes(out io.Writer, flakes []system.Flake, backend string) {
+	names := make([]string, 0, len(flakes))
+	for _, flake := range flakes {
+		names = append(names, flake.Name)
+	}
+	fmt.Fprintf(out, "⚠️  The %s backend only installs packages, the outputs of these flakes are not applied: %s\n", backend, strings.Join(names, ", "))
+}
+
+// describeActive returns the status column of camp flake list
+func describeActive(active bool) string {
+	if active {
+		return "active"
+	}
+	return "inactive"
+}
+
+// systemModuleKind returns the kind of system modules the backend of the user imports, if any
+func systemModuleKind(user *system.User) string {
+	backend, err := system.ResolveBackendName(user)
+	if err != nil {
+		return ""
+	}
+	switch backend {
+	case "darwin":
+		return "nix-darwin"
+	case "nixos":
+		return "nixos"
+	}
+	return ""
+}
+
+// printFlakeModules prints a table of the modules of a flake
+func printFlakeModules(out io.Writer, modules []system.FlakeModule) {
+	if len(modules) == 0 {
+		fmt.Fprintf(out, "No home-manager, nix-darwin or NixOS modules found\n")
+		return
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "OUTPUT\tKIND\tTYPE\tARGUMENTS")
+	for _, module := range modules {
+		arguments := "not a function"
+		switch {
+		case module.CampArgs:
+			arguments = "camp (" + strings.Join(module.Args, ", ") + ")"
+		case module.Function:
+			arguments = "module (" + strings.Join(module.Args, ", ") + ")"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", module.Output, module.Kind, module.Type, arguments)
+	}
+	w.Flush()
+}
+
+// confirm asks a yes/no question on the command's input. Anything but yes,
+// including the end of a non-interactive input, is a no
+func confirm(cmd *cobra.Command, question string) bool {
+	in := cmd.InOrStdin()
+	if file, ok := in.(*os.File); ok {
+		if info, err := file.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+			return false
+		}
+	}
+
+	fmt.Fprintf(cmd.OutOrStdout(), "%s [y/N]: ", question)
+	response, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && response == "" {
+		fmt.Fprintln(cmd.OutOrStdout())
+		return false
+	}
+	response = strings.TrimSpace(strings.ToLower(response))
+	return response == "y" || response == "yes"
+}
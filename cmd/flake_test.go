@@ -0,0 +1,315 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"camp/internal/system"
+	"camp/internal/utils"
+
+	"github.com/spf13/cobra"
+)
+
+// withFakeFlake makes nix describe a flake with a camp module and a plain home-manager module
+func withFakeFlake(t *testing.T) *utils.FakeRunner {
+	t.Helper()
+	fake := withFakeRunner(t)
+	fake.Respond = func(command utils.Command) (string, error) {
+		if strings.Contains(strings.Join(command.Args, " "), "flake show") {
+			return `{"homeManagerModules": {"type": "unknown"}, "packages": {}}`, nil
+		}
+		return `{"default": ["home", "hostName", "userName"], "plain": ["config", "pkgs"]}`, nil
+	}
+	return fake
+}
+
+func TestFlakeInspectCommand(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      []string
+		input     string
+		write     bool
+		json      bool
+		config    string
+		wantURL   string
+		locked    bool // Whether another command holds the camp lock
+		wantAdded bool
+		wantOut   []string
+		wantErr   string
+	}{
+		{
+			name:      "confirmed",
+			args:      []string{"github:team/tools"},
+			input:     "y\n",
+			wantURL:   "github:team/tools",
+			wantAdded: true,
+			wantOut:   []string{"homeManagerModules.default  home-manager  home  camp (home, hostName, userName)", "Suggested camp.yml entry:", "✓ Added flake 'tools'"},
+		},
+		{
+			name:    "declined",
+			args:    []string{"github:team/tools"},
+			input:   "n\n",
+			wantURL: "github:team/tools",
+			wantOut: []string{"homeManagerModules.plain    home-manager  home  module (config, pkgs)", "Add this entry to camp.yml? [y/N]"},
+		},
+		{
+			name:      "write",
+			args:      []string{"github:team/tools"},
+			write:     true,
+			wantURL:   "github:team/tools",
+			wantAdded: true,
+		},
+		{
+			name:      "json write",
+			args:      []string{"github:team/tools"},
+			write:     true,
+			json:      true,
+			wantURL:   "github:team/tools",
+			wantAdded: true,
+		},
+		{
+			name:    "write while locked",
+			args:    []string{"github:team/tools"},
+			write:   true,
+			locked:  true,
+			wantURL: "github:team/tools",
+			wantErr: "locked by 'camp env rebuild'",
+		},
+		{
+			name:    "configured name",
+			args:    []string{"tools"},
+			config:  "flakes:\n  - name: tools\n    url: github:team/tools\n    ref: v2\n    outputs:\n      - name: homeManagerModules.default\n        type: home\n",
+			wantURL: "github:team/tools/v2",
+			wantOut: []string{"This flake is configured in camp.yml as 'tools'."},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := withTestHome(t)
+			fake := withFakeFlake(t)
+			configPath := system.ConfigPath(user.HomeDir)
+			if tt.config != "" {
+				if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
+					t.Fatalf("Failed to create camp directory: %v", err)
+				}
+				if err := os.WriteFile(configPath, []byte(tt.config), 0644); err != nil {
+					t.Fatalf("Failed to write config: %v", err)
+				}
+				config, err := system.LoadUserConfig(user.HomeDir)
+				if err != nil {
+					t.Fatalf("Failed to load config: %v", err)
+				}
+				user.Flakes = config.Flakes
+			}
+
+			originalWrite, originalName, originalFormat := flakeInspectWrite, flakeInspectName, outputFormat
+			flakeInspectWrite = tt.write
+			if tt.json {
+				outputFormat = outputJSON
+			}
+			t.Cleanup(func() {
+				flakeInspectWrite, flakeInspectName, outputFormat = originalWrite, originalName, originalFormat
+			})
+
+			if tt.locked {
+				withLockFlags(t, false, defaultLockWaitTimeout)
+				holder, err := system.AcquireLock(user, "camp env rebuild", 0, &bytes.Buffer{})
+				if err != nil {
+					t.Fatalf("AcquireLock() failed: %v", err)
+				}
+				defer holder.Release()
+			}
+
+			var output bytes.Buffer
+			cmd := &cobra.Command{RunE: flakeInspectCmd.RunE, Args: flakeInspectCmd.Args}
+			cmd.SetOut(&output)
+			cmd.SetErr(&output)
+			cmd.SetIn(strings.NewReader(tt.input))
+			cmd.SetArgs(tt.args)
+			err := cmd.Execute()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+				}
+			} else if err != nil {
+				t.Fatalf("Execute() failed: %v\n%s", err, output.String())
+			}
+
+			if len(fake.Calls) != 2 || !strings.HasSuffix(fake.Calls[0].String(), "flake show --json "+tt.wantURL) {
+				t.Errorf("Expected the flake to be inspected at %s, got %v", tt.wantURL, fake.Commands())
+			}
+			for _, want := range tt.wantOut {
+				if !strings.Contains(output.String(), want) {
+					t.Errorf("Expected output to contain %q, got:\n%s", want, output.String())
+				}
+			}
+			if tt.json {
+				var result flakeInspectOutput
+				if err := json.Unmarshal(output.Bytes(), &result); err != nil {
+					t.Fatalf("Expected JSON output: %v\n%s", err, output.String())
+				}
+				if len(result.Modules) != 2 || !result.Modules[0].CampArgs || !strings.Contains(result.Entry, "name: tools") {
+					t.Errorf("Unexpected inspection: %+v", result)
+				}
+			}
+
+			content, _ := os.ReadFile(configPath)
+			if added := strings.Contains(string(content), "url: github:team/tools\n    outputs:\n      - name: homeManagerModules.default"); added != tt.wantAdded {
+				t.Errorf("Expected flake added=%v, got camp.yml:\n%s", tt.wantAdded, content)
+			}
+			if strings.Contains(string(content), "homeManagerModules.plain") {
+				t.Errorf("Expected modules without camp's arguments to be left out, got:\n%s", content)
+			}
+		})
+	}
+}
+
+func TestFlakeListCommand(t *testing.T) {
+	tests := []struct {
+		name string
+		json bool
+	}{
+		{name: "table"},
+		{name: "json", json: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := withTestHome(t)
+			user.HostName, user.Platform, user.Architecture = "laptop", "linux", "amd64"
+			disabled := false
+			user.Flakes = []system.Flake{
+				{Name: "tools", URL: "github:team/tools", Outputs: []system.FlakeOutput{
+					{Name: "homeManagerModules.default", Type: system.OutputTypeHome},
+					{Name: "darwinModules.default", Type: system.OutputTypeSystem, When: &system.FlakeCondition{Platform: "darwin"}},
+				}},
+				{Name: "work", URL: "github:corp/work", When: &system.FlakeCondition{HostName: "work-*"}, Outputs: []system.FlakeOutput{
+					{Name: "homeManagerModules.default", Type: system.OutputTypeHome},
+				}},
+				{Name: "old", URL: "github:team/old", Enabled: &disabled, Outputs: []system.FlakeOutput{
+					{Name: "homeManagerModules.default", Type: system.OutputTypeHome},
+				}},
+			}
+
+			originalFormat := outputFormat
+			if tt.json {
+				outputFormat = outputJSON
+			}
+			t.Cleanup(func() { outputFormat = originalFormat })
+
+			var output bytes.Buffer
+			cmd := &cobra.Command{RunE: flakeListCmd.RunE}
+			cmd.SetOut(&output)
+			cmd.SetArgs([]string{})
+			if err := cmd.Execute(); err != nil {
+				t.Fatalf("Execute() failed: %v\n%s", err, output.String())
+			}
+
+			if tt.json {
+				var entries []flakeListEntry
+				if err := json.Unmarshal(output.Bytes(), &entries); err != nil {
+					t.Fatalf("Expected JSON output: %v\n%s", err, output.String())
+				}
+				if len(entries) != 3 || !entries[0].Active || entries[1].Active || entries[2].Reason != "disabled (enabled: false)" {
+					t.Errorf("Unexpected entries: %+v", entries)
+				}
+				if entries[0].Outputs[1].Active || entries[1].Outputs[0].Reason != "flake is inactive" {
+					t.Errorf("Unexpected outputs: %+v", entries)
+				}
+				return
+			}
+
+			expected := []string{
+				"Flakes on laptop (linux/amd64):",
+				"tools                         active    no conditions",
+				"  darwinModules.default       inactive  platform is linux, not darwin",
+				"work                          inactive  hostname 'laptop' doesn't match 'work-*'",
+				"old                           inactive  disabled (enabled: false)",
+			}
+			for _, want := range expected {
+				if !strings.Contains(output.String(), want) {
+					t.Errorf("Expected output to contain %q, got:\n%s", want, output.String())
+				}
+			}
+		})
+	}
+}
+
+func TestFlakeDevelopCommand(t *testing.T) {
+	user := withTestHome(t)
+	user.Backend = system.BackendProfile
+	user.Flakes = []system.Flake{{Name: "tools", URL: "github:team/tools", Outputs: []system.FlakeOutput{
+		{Name: "homeManagerModules.default", Type: system.OutputTypeHome},
+	}}}
+	checkout := t.TempDir()
+	if err := os.WriteFile(filepath.Join(checkout, "flake.nix"), []byte("{ outputs = _: { }; }\n"), 0644); err != nil {
+		t.Fatalf("Failed to write flake.nix: %v", err)
+	}
+
+	run := func(t *testing.T, command *cobra.Command, args ...string) (string, string, error) {
+		t.Helper()
+		flakeDevelopReset = false
+		t.Cleanup(func() { flakeDevelopReset = false })
+		var stdout, stderr bytes.Buffer
+		cmd := &cobra.Command{Args: command.Args, RunE: command.RunE}
+		cmd.Flags().BoolVar(&flakeDevelopReset, "reset", false, "")
+		cmd.SetOut(&stdout)
+		cmd.SetErr(&stderr)
+		cmd.SetArgs(args)
+		err := cmd.Execute()
+		return stdout.String(), stderr.String(), err
+	}
+
+	if _, _, err := run(t, flakeDevelopCmd, "tools"); err == nil || !strings.Contains(err.Error(), "expected the path of the checkout") {
+		t.Errorf("Expected a usage error without path, got %v", err)
+	}
+
+	output, _, err := run(t, flakeDevelopCmd, "tools", checkout)
+	if err != nil {
+		t.Fatalf("Expected develop to succeed, got: %v", err)
+	}
+	if !strings.Contains(output, "✓ Flake 'tools' now uses path:"+checkout) {
+		t.Errorf("Expected confirmation, got:\n%s", output)
+	}
+
+	output, _, err = run(t, flakeDevelopCmd)
+	if err != nil || !strings.Contains(output, "tools  "+checkout) {
+		t.Errorf("Expected the override to be listed, got %v:\n%s", err, output)
+	}
+
+	// Status warns about the override
+	_, stderr, err := run(t, statusCmd)
+	if err != nil {
+		t.Fatalf("Expected status to succeed, got: %v", err)
+	}
+	if !strings.Contains(stderr, "1 flake(s) use a local checkout") || !strings.Contains(stderr, "camp flake develop --reset tools") {
+		t.Errorf("Expected a warning about the override, got:\n%s", stderr)
+	}
+
+	output, _, err = run(t, flakeDevelopCmd, "--reset", "tools")
+	if err != nil || !strings.Contains(output, "uses its URL of camp.yml again") {
+		t.Errorf("Expected the override to be reset, got %v:\n%s", err, output)
+	}
+	if _, stderr, _ := run(t, statusCmd); strings.Contains(stderr, "local checkout") {
+		t.Errorf("Expected no warning once reset, got:\n%s", stderr)
+	}
+
+	// Overrides aren't changed while another command, e.g. a rebuild, runs
+	withLockFlags(t, false, defaultLockWaitTimeout)
+	holder, err := system.AcquireLock(user, "camp env rebuild", 0, &bytes.Buffer{})
+	if err != nil {
+		t.Fatalf("AcquireLock() failed: %v", err)
+	}
+	defer holder.Release()
+	if _, _, err := run(t, flakeDevelopCmd, "tools", checkout); err == nil || !strings.Contains(err.Error(), "locked by 'camp env rebuild'") {
+		t.Errorf("Expected a lock error, got %v", err)
+	}
+	if overrides := system.ActiveFlakeOverrides(user); len(overrides) != 0 {
+		t.Errorf("Expected no override to be recorded, got %+v", overrides)
+	}
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	"camp/internal/system"
+	"camp/internal/utils"
+
+	"github.com/spf13/cobra"
+)
+
+// hintOutputLimit is how much of the end of an operation's output is matched against hints
+const hintOutputLimit = 64 * 1024
+
+// operationOutput holds the end of the output of the running operation (see diagnosed)
+var operationOutput *utils.TailBuffer
+
+// hintedError is an error printed along with the hints matching it
+type hintedError struct {
+	err   error
+	hints []system.Hint
+}
+
+func (e *hintedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *hintedError) Unwrap() error {
+	return e.err
+}
+
+// diagnosed records the output of an operation and of the commands it runs,
+// so that finishOperation can diagnose failures with the hint catalogue
+func diagnosed(run func(cmd *cobra.Command, args []string) error) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		tail := utils.NewTailBuffer(hintOutputLimit)
+		out, errOut := cmd.OutOrStdout(), cmd.ErrOrStderr()
+		stdout, stderr := utils.Stdout, utils.Stderr
+		cmd.SetOut(io.MultiWriter(out, tail))
+		cmd.SetErr(io.MultiWriter(errOut, tail))
+		utils.Stdout = io.MultiWriter(stdout, tail)
+		utils.Stderr = io.MultiWriter(stderr, tail)
+		restoreRaw := utils.TeeRawOutput(tail)
+		operationOutput = tail
+
+		defer func() {
+			cmd.SetOut(out)
+			cmd.SetErr(errOut)
+			utils.Stdout, utils.Stderr = stdout, stderr
+			restoreRaw()
+			operationOutput = nil
+		}()
+		return run(cmd, args)
+	}
+}
+
+// diagnose returns the hints matching a failed operation's error and output
+func diagnose(cmd *cobra.Command, err error) []system.Hint {
+	hints, loadErr := system.LoadHints(currentUser())
+	if loadErr != nil {
+		fmt.Fprintf(cmd.ErrOrStderr(), "⚠️  Using built-in hints only: %v\n", loadErr)
+	}
+
+	output := err.Error()
+	if operationOutput != nil {
+		output = operationOutput.String() + "\n" + output
+	}
+	return system.MatchHints(hints, output)
+}
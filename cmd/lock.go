@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"camp/internal/system"
+
+	"github.com/spf13/cobra"
+)
+
+// defaultLockWaitTimeout is how long --wait waits for the lock without --wait-timeout
+const defaultLockWaitTimeout = 10 * time.Minute
+
+var (
+	lockWait        bool
+	lockWaitTimeout time.Duration
+)
+
+// addLockFlags adds the flags controlling how a locked command waits for the lock
+func addLockFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&lockWait, "wait", false, "Wait for another running camp command to finish instead of failing")
+	cmd.Flags().DurationVar(&lockWaitTimeout, "wait-timeout", defaultLockWaitTimeout, "How long --wait waits for the other command")
+}
+
+// locked wraps a command modifying ~/.camp so that it holds the camp lock while it
+// runs. Commands started while the lock is held fail, or wait for it with --wait
+func locked(run func(cmd *cobra.Command, args []string) error) func(cmd *cobra.Command, args []string) error {
+	return lockedIf(func() bool { return true }, run)
+}
+
+// lockedIf wraps a command like locked, only taking the lock when needed returns true
+// (e.g. not for a dry run)
+func lockedIf(needed func() bool, run func(cmd *cobra.Command, args []string) error) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		if !needed() {
+			return run(cmd, args)
+		}
+		return withLock(cmd, func() error { return run(cmd, args) })
+	}
+}
+
+// withLock runs fn holding the camp lock, for commands that only modify ~/.camp
+// in part of their run (e.g. after asking for confirmation)
+func withLock(cmd *cobra.Command, fn func() error) error {
+	var wait time.Duration
+	if lockWait {
+		wait = lockWaitTimeout
+	}
+	lock, err := system.AcquireLock(currentUser(), lockCommandName(cmd), wait, progressOutput(cmd))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := lock.Release(); err != nil {
+			fmt.Fprintf(cmd.ErrOrStderr(), "⚠️  Failed to release the lock: %v\n", err)
+		}
+	}()
+	return fn()
+}
+
+// lockCommandName returns the name recorded as the holder of the lock, e.g. "camp env rebuild"
+func lockCommandName(cmd *cobra.Command) string {
+	if cmd.HasParent() {
+		return cmd.CommandPath()
+	}
+	return "camp " + cmd.Name()
+}
@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"camp/internal/system"
+
+	"github.com/spf13/cobra"
+)
+
+// withLockFlags sets --wait and --wait-timeout for the duration of a test
+func withLockFlags(t *testing.T, wait bool, timeout time.Duration) {
+	t.Helper()
+	originalWait, originalTimeout := lockWait, lockWaitTimeout
+	lockWait, lockWaitTimeout = wait, timeout
+	t.Cleanup(func() { lockWait, lockWaitTimeout = originalWait, originalTimeout })
+}
+
+func TestLockedCommand(t *testing.T) {
+	t.Run("fails while another command holds the lock", func(t *testing.T) {
+		fake := &system.FakeBackend{}
+		user := withTestHome(t)
+		withFakeBackend(t, fake)
+		withLockFlags(t, false, defaultLockWaitTimeout)
+
+		holder, err := system.AcquireLock(user, "camp env update", 0, &bytes.Buffer{})
+		if err != nil {
+			t.Fatalf("AcquireLock() failed: %v", err)
+		}
+		defer holder.Release()
+
+		cmd := &cobra.Command{RunE: rebuildCmd.RunE}
+		cmd.SetOut(&bytes.Buffer{})
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SetArgs([]string{})
+
+		err = cmd.Execute()
+		if err == nil || !strings.Contains(err.Error(), "locked by 'camp env update'") {
+			t.Fatalf("Expected a lock error naming the holder, got: %v", err)
+		}
+		if code := exitCode(err); code != system.ExitLocked {
+			t.Errorf("Expected exit code %d, got %d", system.ExitLocked, code)
+		}
+		if len(fake.Calls) != 0 {
+			t.Errorf("Expected the backend not to be called, got %v", fake.Calls)
+		}
+	})
+
+	t.Run("waits for the lock with --wait", func(t *testing.T) {
+		fake := &system.FakeBackend{}
+		user := withTestHome(t)
+		withFakeBackend(t, fake)
+		withLockFlags(t, true, 5*time.Second)
+
+		holder, err := system.AcquireLock(user, "camp env update", 0, &bytes.Buffer{})
+		if err != nil {
+			t.Fatalf("AcquireLock() failed: %v", err)
+		}
+		time.AfterFunc(50*time.Millisecond, func() { holder.Release() })
+
+		var output bytes.Buffer
+		cmd := &cobra.Command{RunE: rebuildCmd.RunE}
+		cmd.SetOut(&output)
+		cmd.SetArgs([]string{})
+
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("Expected rebuild to succeed once the lock is released, got: %v", err)
+		}
+		if !strings.Contains(output.String(), "Waiting for 'camp env update'") {
+			t.Errorf("Expected a waiting message, got:\n%s", output.String())
+		}
+		lock, err := system.AcquireLock(user, "camp env update", 0, &bytes.Buffer{})
+		if err != nil {
+			t.Fatalf("Expected the lock to be released after the rebuild, got: %v", err)
+		}
+		lock.Release()
+	})
+
+	t.Run("dry runs don't take the lock", func(t *testing.T) {
+		user := withTestHome(t)
+		run := lockedIf(func() bool { return false }, func(cmd *cobra.Command, args []string) error { return nil })
+		if err := run(&cobra.Command{}, nil); err != nil {
+			t.Errorf("Expected the command to run, got: %v", err)
+		}
+		if _, err := os.Stat(system.LockPath(user)); !os.IsNotExist(err) {
+			t.Errorf("Expected no lock file, got: %v", err)
+		}
+	})
+}
@@ -0,0 +1,222 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	"camp/internal/system"
+
+	"github.com/spf13/cobra"
+)
+
+var flakeLockCmd = &cobra.Command{
+	Use:   "lock",
+	Short: "Browse and restore the history of flake.lock",
+	Long: `Browse and restore the history of flake.lock.
+
+A snapshot of ~/.camp/nix/flake.lock is saved after every successful update
+and rebuild that changed it. When an update breaks the environment, restore
+the snapshot from before it:
+
+  camp env lock list                           # List the snapshots
+  camp env lock show 20240501-101500           # Show the inputs of a snapshot
+  camp env lock restore 20240501-101500        # Restore it
+  camp env lock restore 20240501-101500 --rebuild
+
+Old snapshots are pruned according to the 'lock_history' setting in camp.yml.`,
+}
+
+var flakeLockListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the flake.lock snapshots",
+	Args:  cobra.NoArgs,
+	RunE:  runFlakeLockList,
+}
+
+var flakeLockShowCmd = &cobra.Command{
+	Use:   "show <id>",
+	Short: "Show the inputs of a flake.lock snapshot",
+	Long: `Show the inputs locked by a flake.lock snapshot, and the changes restoring
+it would make to the current flake.lock.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runFlakeLockShow,
+}
+
+var flakeLockRestoreCmd = &cobra.Command{
+	Use:   "restore <id>",
+	Short: "Restore a flake.lock snapshot",
+	Long: `Restore a flake.lock snapshot and re-render the environment.
+
+The current flake.lock is saved in the history first, so a restore can be
+undone by restoring that snapshot. With --rebuild, the environment is rebuilt
+with the restored inputs right away; otherwise run 'camp env rebuild' to
+activate them.`,
+	Args: cobra.ExactArgs(1),
+	RunE: locked(logged("lock-restore", diagnosed(runFlakeLockRestore))),
+}
+
+var restoreRebuild bool
+
+func init() {
+	envCmd.AddCommand(flakeLockCmd)
+	flakeLockCmd.AddCommand(flakeLockListCmd)
+	flakeLockCmd.AddCommand(flakeLockShowCmd)
+	flakeLockCmd.AddCommand(flakeLockRestoreCmd)
+	addLockFlags(flakeLockRestoreCmd)
+	flakeLockRestoreCmd.Flags().BoolVar(&restoreRebuild, "rebuild", false, "Rebuild the environment after restoring")
+}
+
+func runFlakeLockList(cmd *cobra.Command, args []string) error {
+	user := currentUser()
+	snapshots, err := system.ListLockSnapshots(user)
+	if err != nil {
+		return err
+	}
+	if jsonOutput() {
+		return printResult(cmd, snapshots, nil)
+	}
+
+	out := cmd.OutOrStdout()
+	if len(snapshots) == 0 {
+		fmt.Fprintf(out, "No flake.lock snapshots found in %s\n", system.LockHistoryDir(user))
+		return nil
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tCREATED\tCOMMAND\tNIXPKGS\t")
+	for _, snapshot := range snapshots {
+		nixpkgs := "-"
+		if lock, err := readSnapshotLock(user, snapshot.ID); err == nil {
+			if input, ok := lock.Inputs()["nixpkgs"]; ok {
+				nixpkgs = input.Describe()
+			}
+		}
+		current := ""
+		if snapshot.Current {
+			current = "(current)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", snapshot.ID, snapshot.CreatedAt.Format("2006-01-02 15:04:05"), snapshot.Command, nixpkgs, current)
+	}
+	return w.Flush()
+}
+
+// flakeLockShowOutput is the machine-readable output of camp env lock show
+type flakeLockShowOutput struct {
+	system.LockSnapshot
+	Inputs  []system.LockedInput `json:"inputs"`
+	Changes []system.InputChange `json:"changes"` // Changes restoring the snapshot would make to flake.lock
+}
+
+func runFlakeLockShow(cmd *cobra.Command, args []string) error {
+	user := currentUser()
+	snapshot, content, err := system.ReadLockSnapshot(user, args[0])
+	if err != nil {
+		return err
+	}
+	lock, err := system.ParseFlakeLock(content)
+	if err != nil {
+		return err
+	}
+	current, err := system.ReadFlakeLock(system.FlakeLockPath(user))
+	if err != nil {
+		return err
+	}
+
+	output := flakeLockShowOutput{LockSnapshot: snapshot, Inputs: sortedInputs(lock), Changes: system.DiffFlakeLocks(current, lock)}
+	if output.Changes == nil {
+		output.Changes = []system.InputChange{}
+	}
+	if jsonOutput() {
+		return printResult(cmd, output, nil)
+	}
+
+	out := cmd.OutOrStdout()
+	fmt.Fprintf(out, "Snapshot: %s (after %s, %s)\n\n", snapshot.ID, snapshot.Command, snapshot.CreatedAt.Format("2006-01-02 15:04:05"))
+	printLockedInputs(out, output.Inputs)
+	fmt.Fprintln(out)
+	if snapshot.Current {
+		fmt.Fprintf(out, "This snapshot is the current flake.lock\n")
+		return nil
+	}
+	fmt.Fprintf(out, "Restoring it would make these changes to the current flake.lock:\n")
+	printInputChanges(out, output.Changes)
+	return nil
+}
+
+func runFlakeLockRestore(cmd *cobra.Command, args []string) error {
+	user := currentUser()
+	out := progressOutput(cmd)
+	result := system.NewOperationResult("lock-restore")
+
+	// Restore the snapshot, saving the current flake.lock first
+	fmt.Fprintf(out, "Restoring flake.lock snapshot %s...\n", args[0])
+	var before *system.FlakeLock
+	err := result.RunPhase("restore", func() error {
+		var err error
+		if before, err = system.ReadFlakeLock(system.FlakeLockPath(user)); err != nil {
+			return err
+		}
+		_, err = system.RestoreLockSnapshot(user, args[0])
+		return err
+	})
+	if err != nil {
+		return finishOperation(cmd, result, err)
+	}
+	if after, err := system.ReadFlakeLock(system.FlakeLockPath(user)); err == nil {
+		result.Inputs = system.DiffFlakeLocks(before, after)
+		printInputChanges(out, result.Inputs)
+	}
+	fmt.Fprintf(out, "✓ flake.lock restored\n\n")
+
+	// The rebuild re-renders the environment on its own
+	if restoreRebuild {
+		return rebuild(cmd, user, result)
+	}
+
+	fmt.Fprintf(out, "Preparing environment...\n")
+	if err := result.RunPhase("prepare", func() error { return system.PrepareEnvironment(user) }); err != nil {
+		return finishOperation(cmd, result, fmt.Errorf("failed to prepare environment: %w", err))
+	}
+	fmt.Fprintf(out, "✓ Environment prepared successfully\n")
+	fmt.Fprintf(out, "\nNext step: Run 'camp env rebuild' to apply the restored inputs.\n")
+	return finishOperation(cmd, result, nil)
+}
+
+// snapshotFlakeLock saves flake.lock in the lock history after a successful operation.
+// A failure is only a warning, the operation itself succeeded
+func snapshotFlakeLock(result *system.OperationResult, user *system.User, command string) {
+	if _, err := system.SnapshotFlakeLock(user, command); err != nil {
+		result.AddWarning("lock-history", err)
+	}
+}
+
+// readSnapshotLock parses the flake.lock of a snapshot
+func readSnapshotLock(user *system.User, id string) (*system.FlakeLock, error) {
+	_, content, err := system.ReadLockSnapshot(user, id)
+	if err != nil {
+		return nil, err
+	}
+	return system.ParseFlakeLock(content)
+}
+
+// sortedInputs returns the inputs of a flake.lock sorted by name
+func sortedInputs(lock *system.FlakeLock) []system.LockedInput {
+	inputs := []system.LockedInput{}
+	for _, input := range lock.Inputs() {
+		inputs = append(inputs, input)
+	}
+	sort.Slice(inputs, func(i, j int) bool { return inputs[i].Name < inputs[j].Name })
+	return inputs
+}
+
+// printLockedInputs prints a table of locked flake inputs
+func printLockedInputs(out io.Writer, inputs []system.LockedInput) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "INPUT\tSOURCE\tLOCKED")
+	for _, input := range inputs {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", input.Name, input.Source, input.Describe())
+	}
+	w.Flush()
+}
@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"camp/internal/system"
+
+	"github.com/spf13/cobra"
+)
+
+// withTestFlakeLock writes a flake.lock locking nixpkgs at nixpkgsRev for user
+func withTestFlakeLock(t *testing.T, user *system.User, nixpkgsRev string) {
+	t.Helper()
+	if err := os.MkdirAll(user.NixDir(), 0755); err != nil {
+		t.Fatalf("Failed to create nix directory: %v", err)
+	}
+	if err := os.WriteFile(system.FlakeLockPath(user), []byte(updateTestLock(nixpkgsRev, nixpkgsRev)), 0644); err != nil {
+		t.Fatalf("Failed to write flake.lock: %v", err)
+	}
+}
+
+func TestRebuildSnapshotsFlakeLock(t *testing.T) {
+	user := withTestHome(t)
+	withFakeBackend(t, &system.FakeBackend{})
+	withTestFlakeLock(t, user, strings.Repeat("a", 40))
+
+	cmd := &cobra.Command{RunE: rebuildCmd.RunE}
+	cmd.SetOut(&bytes.Buffer{})
+	cmd.SetArgs([]string{})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("Expected rebuild to succeed, got: %v", err)
+	}
+
+	snapshots, err := system.ListLockSnapshots(user)
+	if err != nil {
+		t.Fatalf("ListLockSnapshots() failed: %v", err)
+	}
+	if len(snapshots) != 1 || snapshots[0].Command != "rebuild" || !snapshots[0].Current {
+		t.Errorf("Expected a current snapshot taken by the rebuild, got %+v", snapshots)
+	}
+}
+
+func TestFlakeLockCommands(t *testing.T) {
+	oldRev, newRev := strings.Repeat("a", 40), strings.Repeat("b", 40)
+	user := withTestHome(t)
+	withTestFlakeLock(t, user, oldRev)
+	old, err := system.SnapshotFlakeLock(user, "update")
+	if err != nil {
+		t.Fatalf("SnapshotFlakeLock() failed: %v", err)
+	}
+	withTestFlakeLock(t, user, newRev)
+	if _, err := system.SnapshotFlakeLock(user, "update"); err != nil {
+		t.Fatalf("SnapshotFlakeLock() failed: %v", err)
+	}
+
+	run := func(t *testing.T, command *cobra.Command, args ...string) string {
+		t.Helper()
+		var output bytes.Buffer
+		cmd := &cobra.Command{RunE: command.RunE}
+		cmd.SetOut(&output)
+		cmd.SetErr(&output)
+		cmd.SetArgs(args)
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("Execute() failed: %v\n%s", err, output.String())
+		}
+		return output.String()
+	}
+
+	t.Run("list", func(t *testing.T) {
+		output := run(t, flakeLockListCmd)
+		lines := strings.Split(strings.TrimSpace(output), "\n")
+		if len(lines) != 3 || !strings.HasPrefix(lines[0], "ID") {
+			t.Fatalf("Expected a header and two snapshots, got:\n%s", output)
+		}
+		if !strings.Contains(lines[1], "bbbbbbb (2024-05-01)") || !strings.Contains(lines[1], "(current)") {
+			t.Errorf("Expected the newest snapshot to be current, got:\n%s", output)
+		}
+		if !strings.HasPrefix(lines[2], old.ID) || strings.Contains(lines[2], "(current)") {
+			t.Errorf("Expected the oldest snapshot last, got:\n%s", output)
+		}
+	})
+
+	t.Run("show", func(t *testing.T) {
+		output := run(t, flakeLockShowCmd, old.ID)
+		for _, want := range []string{"Snapshot: " + old.ID + " (after update", "nixpkgs       bbbbbbb (2024-05-01)  aaaaaaa (2024-05-01)"} {
+			if !strings.Contains(output, want) {
+				t.Errorf("Expected output to contain %q, got:\n%s", want, output)
+			}
+		}
+	})
+
+	t.Run("show as JSON", func(t *testing.T) {
+		withJSONOutput(t)
+		var shown flakeLockShowOutput
+		if err := json.Unmarshal([]byte(run(t, flakeLockShowCmd, old.ID)), &shown); err != nil {
+			t.Fatalf("Expected JSON output: %v", err)
+		}
+		if shown.ID != old.ID || len(shown.Inputs) != 2 || len(shown.Changes) != 2 {
+			t.Errorf("Unexpected JSON output: %+v", shown)
+		}
+	})
+
+	t.Run("restore and rebuild", func(t *testing.T) {
+		fake := &system.FakeBackend{}
+		withFakeBackend(t, fake)
+		restoreRebuild = true
+		t.Cleanup(func() { restoreRebuild = false })
+
+		output := run(t, flakeLockRestoreCmd, old.ID)
+		if content, _ := os.ReadFile(system.FlakeLockPath(user)); !strings.Contains(string(content), oldRev) {
+			t.Errorf("Expected flake.lock to be restored, got:\n%s", content)
+		}
+		if !strings.Contains(output, "✓ flake.lock restored") || !strings.Contains(strings.Join(fake.Calls, ","), "switch") {
+			t.Errorf("Expected the restore to rebuild, got calls %v and output:\n%s", fake.Calls, output)
+		}
+
+		// The restored content is already in the history, it isn't saved again
+		snapshots, _ := system.ListLockSnapshots(user)
+		if len(snapshots) != 2 || !snapshots[1].Current || snapshots[1].ID != old.ID {
+			t.Errorf("Expected the restored snapshot to be the current one, got %+v", snapshots)
+		}
+	})
+}
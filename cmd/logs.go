@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"camp/internal/system"
+	"camp/internal/utils"
+
+	"github.com/spf13/cobra"
+)
+
+var logsCmd = &cobra.Command{
+	Use:   "logs [id]",
+	Short: "Show the logs of past camp operations",
+	Long: `Show the logs of past camp operations.
+
+Every rebuild, update, bootstrap and nuke run is logged to ~/.camp/logs with
+the command, the hash of camp.yml, the duration and the exit status. Logs are
+rotated according to the 'logs' setting in camp.yml.
+
+Examples:
+  camp logs                          # Show the most recent log
+  camp logs --list                   # List all logs
+  camp logs 20240501-101500-rebuild  # Show a specific log`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runLogs,
+}
+
+var (
+	logsLast bool
+	logsList bool
+)
+
+func init() {
+	logsCmd.Flags().BoolVar(&logsLast, "last", false, "Show the most recent log (default)")
+	logsCmd.Flags().BoolVar(&logsList, "list", false, "List all logs")
+}
+
+func runLogs(cmd *cobra.Command, args []string) error {
+	user := currentUser()
+
+	if logsList {
+		if jsonOutput() {
+			entries, err := system.ListLogs(user)
+			if err != nil {
+				return err
+			}
+			return printResult(cmd, entries, nil)
+		}
+		return listLogs(cmd.OutOrStdout(), user)
+	}
+
+	// Show the requested log, or the most recent one
+	id := ""
+	if len(args) == 1 && !logsLast {
+		id = args[0]
+	} else {
+		entries, err := system.ListLogs(user)
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			if jsonOutput() {
+				return fmt.Errorf("no logs found in %s", system.LogsDir(user))
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "No logs found in %s\n", system.LogsDir(user))
+			return nil
+		}
+		id = entries[0].ID
+	}
+
+	entry, content, err := system.ReadLog(user, id)
+	if err != nil {
+		return err
+	}
+	if jsonOutput() {
+		return printResult(cmd, logOutput{LogEntry: entry, Content: content}, nil)
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "Log: %s (%s)\n", entry.ID, system.FormatLogStatus(entry))
+	fmt.Fprint(cmd.OutOrStdout(), content)
+	return nil
+}
+
+// logOutput is the machine-readable output of camp logs for a single log
+type logOutput struct {
+	system.LogEntry
+	Content string `json:"content"`
+}
+
+// listLogs prints a table of the available logs, newest first
+func listLogs(out io.Writer, user *system.User) error {
+	entries, err := system.ListLogs(user)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		fmt.Fprintf(out, "No logs found in %s\n", system.LogsDir(user))
+		return nil
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tCOMMAND\tSTARTED\tDURATION\tSTATUS")
+	for _, entry := range entries {
+		duration := "-"
+		if entry.Duration > 0 {
+			duration = (time.Duration(entry.Duration * float64(time.Second))).Round(time.Second).String()
+		}
+		started := "-"
+		if !entry.StartedAt.IsZero() {
+			started = entry.StartedAt.Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", entry.ID, entry.Command, started, duration, system.FormatLogStatus(entry))
+	}
+	return w.Flush()
+}
+
+// logged wraps a command so that its output, including the output of the
+// external commands it runs, is also written to an operation log. Failing
+// to write the log never fails the command itself
+func logged(name string, run func(cmd *cobra.Command, args []string) error) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		user := currentUser()
+		opLog, err := system.StartOperationLog(user, name, args)
+		if err != nil {
+			fmt.Fprintf(cmd.ErrOrStderr(), "⚠️  Operation log disabled: %v\n", err)
+			return run(cmd, args)
+		}
+
+		// Tee command output and the output of external commands into the log
+		out, errOut := cmd.OutOrStdout(), cmd.ErrOrStderr()
+		stdout, stderr := utils.Stdout, utils.Stderr
+		cmd.SetOut(io.MultiWriter(out, opLog))
+		cmd.SetErr(io.MultiWriter(errOut, opLog))
+		utils.Stdout = io.MultiWriter(stdout, opLog)
+		utils.Stderr = io.MultiWriter(stderr, opLog)
+		restoreRaw := utils.TeeRawOutput(opLog)
+
+		runErr := run(cmd, args)
+
+		cmd.SetOut(out)
+		cmd.SetErr(errOut)
+		utils.Stdout, utils.Stderr = stdout, stderr
+		restoreRaw()
+
+		if err := opLog.Finish(runErr, user.Logs); err != nil {
+			fmt.Fprintf(errOut, "⚠️  Failed to write operation log: %v\n", err)
+		}
+		if runErr != nil {
+			fmt.Fprintf(errOut, "Log written to %s\n", opLog.Path())
+		}
+		return runErr
+	}
+}
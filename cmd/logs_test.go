@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"camp/internal/utils"
+
+	"github.com/spf13/cobra"
+)
+
+// runLogsCommand runs camp logs with the given flags and arguments
+func runLogsCommand(t *testing.T, list, last bool, args ...string) (string, error) {
+	t.Helper()
+	logsList, logsLast = list, last
+	t.Cleanup(func() { logsList, logsLast = false, false })
+
+	var output bytes.Buffer
+	cmd := &cobra.Command{RunE: logsCmd.RunE}
+	cmd.SetOut(&output)
+	cmd.SetErr(&bytes.Buffer{})
+	cmd.SetArgs(args)
+	err := cmd.Execute()
+	return output.String(), err
+}
+
+func TestLogsCommand(t *testing.T) {
+	t.Run("command is registered on root", func(t *testing.T) {
+		found := false
+		for _, cmd := range rootCmd.Commands() {
+			if cmd.Name() == "logs" {
+				found = true
+			}
+		}
+		if !found {
+			t.Error("logs command should be registered as subcommand of root")
+		}
+	})
+
+	t.Run("no logs", func(t *testing.T) {
+		withTestHome(t)
+		output, err := runLogsCommand(t, false, false)
+		if err != nil {
+			t.Fatalf("Expected logs to succeed, got: %v", err)
+		}
+		if !strings.Contains(output, "No logs found") {
+			t.Errorf("Expected empty message, got:\n%s", output)
+		}
+	})
+
+	t.Run("logged commands can be listed and shown", func(t *testing.T) {
+		withTestHome(t)
+
+		// Output of external commands goes through utils.Stdout
+		run := logged("rebuild", func(cmd *cobra.Command, args []string) error {
+			cmd.Println("preparing")
+			utils.Stdout.Write([]byte("nix output\n"))
+			return errors.New("rebuild failed")
+		})
+		cmd := &cobra.Command{RunE: run}
+		cmd.SetOut(&bytes.Buffer{})
+		var errOut bytes.Buffer
+		cmd.SetErr(&errOut)
+		cmd.SilenceErrors = true
+		cmd.SetArgs([]string{})
+		if err := cmd.Execute(); err == nil {
+			t.Fatal("Expected wrapped command error to be returned")
+		}
+		if !strings.Contains(errOut.String(), "Log written to") {
+			t.Errorf("Expected log location on failure, got:\n%s", errOut.String())
+		}
+
+		output, err := runLogsCommand(t, true, false)
+		if err != nil {
+			t.Fatalf("Expected logs --list to succeed, got: %v", err)
+		}
+		if !strings.Contains(output, "rebuild") || !strings.Contains(output, "failed, exit status 1") {
+			t.Errorf("Expected failed rebuild in list, got:\n%s", output)
+		}
+
+		output, err = runLogsCommand(t, false, true)
+		if err != nil {
+			t.Fatalf("Expected logs --last to succeed, got: %v", err)
+		}
+		for _, want := range []string{"preparing", "nix output", "# camp rebuild"} {
+			if !strings.Contains(output, want) {
+				t.Errorf("Expected last log to contain %q, got:\n%s", want, output)
+			}
+		}
+	})
+
+	t.Run("unknown id", func(t *testing.T) {
+		withTestHome(t)
+		if _, err := runLogsCommand(t, false, false, "nope"); err == nil {
+			t.Error("Expected error for unknown log id")
+		}
+	})
+}
@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"os"
+	"testing"
+
+	"camp/internal/system"
+	"camp/internal/utils"
+)
+
+func TestMain(m *testing.M) {
+	// Keep the logs and state written by command tests out of the real ~/.camp
+	testHome, err := os.MkdirTemp("", "camp-cmd-test")
+	if err != nil {
+		panic(err)
+	}
+	currentUser = func() *system.User {
+		user := system.NewUser()
+		user.HomeDir = testHome
+		return user
+	}
+
+	code := m.Run()
+	os.RemoveAll(testHome)
+	os.Exit(code)
+}
+
+// withTestHome makes commands operate on a user with an empty home directory
+func withTestHome(t *testing.T) *system.User {
+	t.Helper()
+	user := &system.User{Name: "testuser", HomeDir: t.TempDir()}
+	original := currentUser
+	currentUser = func() *system.User { return user }
+	t.Cleanup(func() { currentUser = original })
+	return user
+}
+
+// withFakeRunner makes commands record the external commands they run instead of running them
+func withFakeRunner(t *testing.T) *utils.FakeRunner {
+	t.Helper()
+	fake := &utils.FakeRunner{}
+	original := utils.DefaultRunner
+	utils.DefaultRunner = fake
+	t.Cleanup(func() { utils.DefaultRunner = original })
+	return fake
+}
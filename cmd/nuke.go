@@ -2,11 +2,12 @@ package cmd
 
 import (
 	"bufio"
+	"context"
 	"fmt"
-	"os/exec"
 	"strings"
 
 	"camp/internal/system"
+	"camp/internal/utils"
 
 	"github.com/spf13/cobra"
 )
@@ -39,53 +40,66 @@ var (
 
 func init() {
 	envCmd.AddCommand(nukeCmd)
+	addLockFlags(nukeCmd)
 	nukeCmd.Flags().BoolVarP(&skipConfirmation, "yes", "y", false, "Skip confirmation prompt")
 }
 
 func runNuke(cmd *cobra.Command, args []string) error {
+	out := progressOutput(cmd)
+	result := system.NewOperationResult("nuke")
+
 	// Check if Nix is installed
 	if !nixInstalledChecker() {
-		return fmt.Errorf("nix is not installed. No need to run nuke")
+		return finishOperation(cmd, result, fmt.Errorf("nix is not installed. No need to run nuke"))
 	}
 
 	// Prompt user for confirmation (unless --yes flag is used)
 	if !skipConfirmation {
-		fmt.Fprintf(cmd.OutOrStdout(), "⚠️  WARNING: This will completely remove camp and Nix from your system!\n\n")
-		fmt.Fprintf(cmd.OutOrStdout(), "This will delete:\n")
-		fmt.Fprintf(cmd.OutOrStdout(), "  • Nix package manager\n")
-		fmt.Fprintf(cmd.OutOrStdout(), "  • All camp configuration (~/.camp/)\n")
-		fmt.Fprintf(cmd.OutOrStdout(), "  • home-manager configuration and state\n")
-		fmt.Fprintf(cmd.OutOrStdout(), "  • Nix state directories\n\n")
-		fmt.Fprintf(cmd.OutOrStdout(), "Are you sure you want to continue? [y/N]: ")
+		fmt.Fprintf(out, "⚠️  WARNING: This will completely remove camp and Nix from your system!\n\n")
+		fmt.Fprintf(out, "This will delete:\n")
+		fmt.Fprintf(out, "  • Nix package manager\n")
+		fmt.Fprintf(out, "  • All camp configuration (~/.camp/)\n")
+		fmt.Fprintf(out, "  • home-manager configuration and state\n")
+		fmt.Fprintf(out, "  • Nix state directories\n\n")
+		fmt.Fprintf(out, "Are you sure you want to continue? [y/N]: ")
 
 		reader := bufio.NewReader(cmd.InOrStdin())
 		response, err := reader.ReadString('\n')
 		if err != nil {
-			return fmt.Errorf("failed to read confirmation: %w", err)
+			return finishOperation(cmd, result, fmt.Errorf("failed to read confirmation: %w", err))
 		}
 
 		response = strings.TrimSpace(strings.ToLower(response))
 		if response != "y" && response != "yes" {
-			fmt.Fprintf(cmd.OutOrStdout(), "\nNuke operation cancelled.\n")
-			return nil
+			fmt.Fprintf(out, "\nNuke operation cancelled.\n")
+			return finishOperation(cmd, result, nil)
 		}
 	}
 
-	// Get current user context
-	user := system.NewUser()
+	// Lock and log once confirmed, so that the prompt doesn't block other commands
+	return withLock(cmd, func() error {
+		return logged("nuke", func(cmd *cobra.Command, args []string) error {
+			return nukeEnvironment(cmd, result)
+		})(cmd, args)
+	})
+}
+
+// nukeEnvironment erases the environment of the current user, holding the lock
+func nukeEnvironment(cmd *cobra.Command, result *system.OperationResult) error {
+	out := progressOutput(cmd)
+	user := currentUser()
 
 	// Execute nuke
-	fmt.Fprintf(cmd.OutOrStdout(), "\nStarting nuke process...\n")
-	if err := system.NukeEnvironment(user, cmd.OutOrStdout()); err != nil {
-		return fmt.Errorf("nuke failed: %w", err)
+	fmt.Fprintf(out, "\nStarting nuke process...\n")
+	if err := system.NukeEnvironment(user, out, result); err != nil {
+		return finishOperation(cmd, result, fmt.Errorf("nuke failed: %w", err))
 	}
 
-	fmt.Fprintf(cmd.OutOrStdout(), "\n✓ Your camp environment was erased. Please restart your terminal to complete the process.\n")
-	return nil
+	fmt.Fprintf(out, "\n✓ Your camp environment was erased. Please restart your terminal to complete the process.\n")
+	return finishOperation(cmd, result, nil)
 }
 
 func isNixInstalled() bool {
-	cmd := exec.Command("nix", "--version")
-	err := cmd.Run()
+	_, err := utils.Run(context.Background(), utils.Command{Name: "nix", Args: []string{"--version"}, Capture: true})
 	return err == nil
 }
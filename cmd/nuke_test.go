@@ -2,9 +2,12 @@ package cmd
 
 import (
 	"bytes"
+	"os"
 	"strings"
 	"testing"
 
+	"camp/internal/system"
+
 	"github.com/spf13/cobra"
 )
 
@@ -152,6 +155,45 @@ func TestNukeCommandConfirmation(t *testing.T) {
 			t.Errorf("Expected output to contain cancellation message, got:\n%s", outputStr)
 		}
 	})
+
+	t.Run("prompts before taking the lock", func(t *testing.T) {
+		user := withTestHome(t)
+		withLockFlags(t, false, defaultLockWaitTimeout)
+		originalChecker := nixInstalledChecker
+		nixInstalledChecker = func() bool { return true }
+		defer func() { nixInstalledChecker = originalChecker }()
+
+		holder, err := system.AcquireLock(user, "camp env rebuild", 0, &bytes.Buffer{})
+		if err != nil {
+			t.Fatalf("AcquireLock() failed: %v", err)
+		}
+		defer holder.Release()
+
+		nuke := func(answer string) (string, error) {
+			var output bytes.Buffer
+			cmd := &cobra.Command{RunE: nukeCmd.RunE}
+			cmd.SetOut(&output)
+			cmd.SetErr(&bytes.Buffer{})
+			cmd.SetIn(strings.NewReader(answer))
+			cmd.SetArgs([]string{})
+			err := cmd.Execute()
+			return output.String(), err
+		}
+
+		// Answering the prompt doesn't wait for the other command
+		output, err := nuke("n\n")
+		if err != nil || !strings.Contains(output, "cancelled") {
+			t.Errorf("Expected the nuke to be cancelled, got %v:\n%s", err, output)
+		}
+
+		// Once confirmed, the nuke needs the lock
+		if _, err := nuke("y\n"); err == nil || !strings.Contains(err.Error(), "locked by 'camp env rebuild'") {
+			t.Errorf("Expected a lock error, got: %v", err)
+		}
+		if _, err := os.Stat(system.LockPath(user)); err != nil {
+			t.Errorf("Expected ~/.camp to be left alone, got %v", err)
+		}
+	})
 }
 
 func TestNukeCommandOutputFormat(t *testing.T) {
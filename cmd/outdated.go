@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"camp/internal/system"
+
+	"github.com/spf13/cobra"
+)
+
+var outdatedCmd = &cobra.Command{
+	Use:   "outdated",
+	Short: "Report how far behind their upstream the locked flake inputs are",
+	Long: `Report how far behind their upstream the inputs locked in flake.lock are,
+without updating anything.
+
+Each input's upstream is asked for its latest revision:
+  - GitHub, GitLab, tarball and registry inputs with 'nix flake metadata'
+  - Remote git inputs with 'git ls-remote'
+  - Local git inputs by reading the repository
+  - path: inputs by comparing the modification time of their files
+
+The commits behind are counted with the GitHub compare API for inputs on
+github.com (set GITHUB_TOKEN to raise its rate limit), and by fetching the
+history without files into ~/.camp/state/git for other git repositories.
+When the count isn't available, e.g. after a force push, BEHIND says so.
+
+Results for remote inputs are cached for 6 hours in ~/.camp/state; use
+--refresh to query upstream again. Use --json (or --output json) for
+dashboards.`,
+	Args: cobra.NoArgs,
+	RunE: runOutdated,
+}
+
+var outdatedRefresh bool
+
+func init() {
+	envCmd.AddCommand(outdatedCmd)
+	outdatedCmd.Flags().BoolVar(&outdatedRefresh, "refresh", false, "Query upstream again instead of using cached results")
+	addJSONFlag(outdatedCmd)
+}
+
+func runOutdated(cmd *cobra.Command, args []string) error {
+	user := currentUser()
+
+	statuses, err := system.CheckOutdatedInputs(cmd.Context(), user, outdatedRefresh, time.Now())
+	if err != nil {
+		return err
+	}
+
+	// Inputs that couldn't be checked make the command fail, after reporting the others
+	failed := 0
+	for _, status := range statuses {
+		if status.Error != "" {
+			failed++
+		}
+	}
+	if failed > 0 {
+		err = fmt.Errorf("failed to check %d of %d flake inputs", failed, len(statuses))
+	}
+
+	if jsonOutput() {
+		return printResult(cmd, statuses, err)
+	}
+	printOutdated(cmd.OutOrStdout(), statuses)
+	return err
+}
+
+// printOutdated prints a table of the locked inputs and how far behind upstream they are
+func printOutdated(out io.Writer, statuses []system.InputStatus) {
+	if len(statuses) == 0 {
+		fmt.Fprintf(out, "No flake inputs locked yet - run 'camp env rebuild' or 'camp env update' first\n")
+		return
+	}
+
+	cached := false
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "INPUT\tLOCKED\tAGE\tLATEST\tBEHIND")
+	for _, status := range statuses {
+		locked := system.LockedInput{Rev: status.Rev, LastModified: status.LastModified}
+		fmt.Fprintf(w, "%s\t%s\t%dd\t%s\t%s\n", status.Input, locked.Describe(), status.AgeDays, status.Latest(), describeBehind(status))
+		cached = cached || status.Cached
+	}
+	w.Flush()
+
+	if cached {
+		fmt.Fprintf(out, "\nSome results are cached; use --refresh to query upstream again.\n")
+	}
+}
+
+// describeBehind returns how far behind upstream an input is, in commits when they are known.
+// Inputs with revisions whose commits couldn't be counted say so
+func describeBehind(status system.InputStatus) string {
+	switch {
+	case status.Error != "":
+		return "error: " + status.Error
+	case status.UpToDate:
+		return "up to date"
+	case status.CommitsBehind != nil:
+		return fmt.Sprintf("%d commits", *status.CommitsBehind)
+	}
+
+	behind := "outdated"
+	if status.LatestModified != nil && status.LatestModified.After(status.LastModified) {
+		behind = fmt.Sprintf("%d days newer", int(status.LatestModified.Sub(status.LastModified).Hours()/24))
+	}
+	if status.Rev != "" {
+		behind += ", commits unknown"
+	}
+	return behind
+}
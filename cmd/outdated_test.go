@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"camp/internal/system"
+
+	"github.com/spf13/cobra"
+)
+
+// withGitHubAPI serves the GitHub compare API with the given response, or fails it for an empty one
+func withGitHubAPI(t *testing.T, response string) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if response == "" {
+			http.Error(w, "rate limited", http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(response))
+	}))
+	t.Cleanup(server.Close)
+	original := system.GitHubAPIURL
+	system.GitHubAPIURL = server.URL
+	t.Cleanup(func() { system.GitHubAPIURL = original })
+}
+
+func TestOutdatedCommand(t *testing.T) {
+	oldRev, newRev := strings.Repeat("a", 40), strings.Repeat("b", 40)
+	tests := []struct {
+		name     string
+		json     bool
+		compare  string
+		expected string
+	}{
+		{name: "table", compare: `{"ahead_by": 1234}`, expected: "bbbbbbb (2024-05-20)  1234 commits"},
+		{name: "unknown commit count", expected: "bbbbbbb (2024-05-20)  19 days newer, commits unknown"},
+		{name: "json", json: true, compare: `{"ahead_by": 1234}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := withTestHome(t)
+			withTestFlakeLock(t, user, oldRev)
+			fake := withFakeRunner(t)
+			fake.Output = `{"revision": "` + newRev + `", "lastModified": 1716163200}`
+			withGitHubAPI(t, tt.compare)
+
+			if tt.json {
+				withJSONOutput(t)
+			}
+
+			var output bytes.Buffer
+			cmd := &cobra.Command{RunE: outdatedCmd.RunE}
+			cmd.SetOut(&output)
+			cmd.SetArgs([]string{})
+			if err := cmd.Execute(); err != nil {
+				t.Fatalf("Execute() failed: %v\n%s", err, output.String())
+			}
+			if len(fake.Calls) != 2 || !strings.Contains(fake.Calls[0].String(), "flake metadata --json --refresh github:nix-community/home-manager") {
+				t.Errorf("Expected nix flake metadata to run for each input, got %v", fake.Commands())
+			}
+
+			if tt.json {
+				var statuses []system.InputStatus
+				if err := json.Unmarshal(output.Bytes(), &statuses); err != nil {
+					t.Fatalf("Expected JSON output: %v\n%s", err, output.String())
+				}
+				if len(statuses) != 2 || statuses[1].Input != "nixpkgs" || statuses[1].UpToDate || statuses[1].LatestRev != newRev ||
+					statuses[1].CommitsBehind == nil || *statuses[1].CommitsBehind != 1234 {
+					t.Errorf("Unexpected statuses: %+v", statuses)
+				}
+				return
+			}
+			if !strings.Contains(output.String(), "nixpkgs       aaaaaaa (2024-05-01)") || !strings.Contains(output.String(), tt.expected) {
+				t.Errorf("Expected nixpkgs to be reported behind, got:\n%s", output.String())
+			}
+		})
+	}
+}
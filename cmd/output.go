@@ -0,0 +1,199 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"camp/internal/system"
+	"camp/internal/utils"
+
+	"github.com/spf13/cobra"
+)
+
+// Output formats accepted by --output
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// outputFormat is set by the global --output flag
+var outputFormat = outputText
+
+// usageError reports invalid command line flags
+type usageError struct {
+	err error
+}
+
+func (e *usageError) Error() string {
+	return e.err.Error()
+}
+
+func (e *usageError) Unwrap() error {
+	return e.err
+}
+
+// reportedError marks an error that was already printed as part of a JSON result
+type reportedError struct {
+	err error
+}
+
+func (e *reportedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *reportedError) Unwrap() error {
+	return e.err
+}
+
+// errorResult is printed for failures of commands without their own result type
+type errorResult struct {
+	Error    string `json:"error"`
+	ExitCode int    `json:"exit_code"`
+}
+
+// exitCode returns the exit code of camp for an error returned by a command
+func exitCode(err error) int {
+	var usageErr *usageError
+	if errors.As(err, &usageErr) {
+		return system.ExitUsage
+	}
+	return system.ExitCode(err)
+}
+
+// setupOutput validates --output and, for JSON output, moves the output of
+// external commands to stderr so that stdout only holds the JSON result
+func setupOutput(cmd *cobra.Command, args []string) error {
+	switch outputFormat {
+	case outputText:
+		return nil
+	case outputJSON:
+		// Errors are reported in the JSON result instead of the usage
+		cmd.Root().SilenceUsage = true
+		utils.Stdout = utils.Stderr
+		return nil
+	default:
+		return &usageError{fmt.Errorf("invalid output format '%s' - must be one of: %s, %s", outputFormat, outputText, outputJSON)}
+	}
+}
+
+// jsonFlag is the value of a --json flag, an alias of --output json. It sets
+// the output format while flags are parsed, so that setupOutput applies to it
+type jsonFlag struct{}
+
+func (jsonFlag) String() string { return "false" }
+func (jsonFlag) Type() string   { return "bool" }
+
+func (jsonFlag) Set(value string) error {
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return err
+	}
+	if enabled {
+		outputFormat = outputJSON
+	}
+	return nil
+}
+
+// addJSONFlag adds --json to a command, as a shorthand for --output json
+func addJSONFlag(cmd *cobra.Command) {
+	cmd.Flags().VarPF(jsonFlag{}, "json", "", "Print the result as JSON, like --output json").NoOptDefVal = "true"
+}
+
+// jsonOutput reports whether results must be printed as JSON
+func jsonOutput() bool {
+	return outputFormat == outputJSON
+}
+
+// progressOutput returns where human readable progress messages go: stdout,
+// or stderr with JSON output so they don't mix with the result
+func progressOutput(cmd *cobra.Command) io.Writer {
+	if jsonOutput() {
+		return cmd.ErrOrStderr()
+	}
+	return cmd.OutOrStdout()
+}
+
+// statusOutput returns the terminal progress output goes to, for live status
+// lines, or nil when that output isn't a terminal
+func statusOutput() io.Writer {
+	file := os.Stdout
+	if jsonOutput() {
+		file = os.Stderr
+	}
+	if info, err := file.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return nil
+	}
+	return file
+}
+
+// runNix runs fn, rendering the output of the Nix commands it runs as
+// progress unless verbose is set
+func runNix(cmd *cobra.Command, verbose bool, fn func() error) error {
+	if verbose {
+		return fn()
+	}
+	return system.WithProgress(progressOutput(cmd), statusOutput(), fn)
+}
+
+// writeJSON prints v as indented JSON on the command's stdout
+func writeJSON(out io.Writer, v any) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		return fmt.Errorf("failed to encode JSON output: %w", err)
+	}
+	return nil
+}
+
+// printResult prints the result of a command with JSON output and returns err.
+// Errors printed as part of the result are marked so they aren't reported twice
+func printResult(cmd *cobra.Command, result any, err error) error {
+	if !jsonOutput() {
+		return err
+	}
+	if writeErr := writeJSON(cmd.OutOrStdout(), result); writeErr != nil {
+		return writeErr
+	}
+	if err != nil {
+		return &reportedError{err}
+	}
+	return nil
+}
+
+// finishOperation records the outcome of an operation, along with hints on
+// how to fix a failure, and prints its result with JSON output
+func finishOperation(cmd *cobra.Command, result *system.OperationResult, err error) error {
+	result.Finish(err)
+	if err == nil {
+		return printResult(cmd, result, nil)
+	}
+
+	result.Hints = diagnose(cmd, err)
+	if len(result.Hints) > 0 {
+		err = &hintedError{err: err, hints: result.Hints}
+	}
+	return printResult(cmd, result, err)
+}
+
+// reportError prints an error returned by a command: as JSON on stdout with
+// JSON output (unless it is already part of the result), on stderr otherwise
+// followed by the hints matching it
+func reportError(stdout, stderr io.Writer, err error) {
+	var reported *reportedError
+	switch {
+	case errors.As(err, &reported):
+		return
+	case jsonOutput():
+		writeJSON(stdout, errorResult{Error: err.Error(), ExitCode: exitCode(err)})
+	default:
+		fmt.Fprintln(stderr, err)
+		var hinted *hintedError
+		if errors.As(err, &hinted) {
+			system.PrintHints(stderr, hinted.hints)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"camp/internal/system"
+	"camp/internal/utils"
+
+	"github.com/spf13/cobra"
+)
+
+// withJSONOutput enables --output json for the duration of a test
+func withJSONOutput(t *testing.T) {
+	t.Helper()
+	original := outputFormat
+	outputFormat = outputJSON
+	t.Cleanup(func() { outputFormat = original })
+}
+
+func TestSetupOutput(t *testing.T) {
+	original := outputFormat
+	t.Cleanup(func() { outputFormat = original })
+
+	for _, format := range []string{outputText, outputJSON} {
+		outputFormat = format
+		if err := setupOutput(&cobra.Command{}, nil); err != nil {
+			t.Errorf("Expected format '%s' to be accepted, got: %v", format, err)
+		}
+	}
+
+	outputFormat = "yaml"
+	err := setupOutput(&cobra.Command{}, nil)
+	if err == nil || exitCode(err) != system.ExitUsage {
+		t.Errorf("Expected usage error for unknown format, got: %v", err)
+	}
+}
+
+func TestJSONFlag(t *testing.T) {
+	originalFormat, originalStdout := outputFormat, utils.Stdout
+	t.Cleanup(func() { outputFormat, utils.Stdout = originalFormat, originalStdout })
+
+	// --json is applied before setupOutput, like --output json
+	var format string
+	cmd := &cobra.Command{
+		PersistentPreRunE: setupOutput,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			format = outputFormat
+			return nil
+		},
+	}
+	addJSONFlag(cmd)
+	cmd.SetOut(&bytes.Buffer{})
+	cmd.SetArgs([]string{"--json"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("Execute() failed: %v", err)
+	}
+	if format != outputJSON {
+		t.Errorf("Expected --json to select JSON output, got '%s'", format)
+	}
+	if !cmd.SilenceUsage || utils.Stdout != utils.Stderr {
+		t.Error("Expected the JSON output setup to apply")
+	}
+}
+
+func TestRebuildCommandJSONOutput(t *testing.T) {
+	t.Run("reports phases on success", func(t *testing.T) {
+		withJSONOutput(t)
+		withTestHome(t)
+		withFakeBackend(t, &system.FakeBackend{})
+
+		var stdout, stderr bytes.Buffer
+		cmd := &cobra.Command{RunE: rebuildCmd.RunE}
+		cmd.SetOut(&stdout)
+		cmd.SetErr(&stderr)
+		cmd.SetArgs([]string{})
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("Expected rebuild to succeed, got: %v", err)
+		}
+
+		var result system.OperationResult
+		if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+			t.Fatalf("Expected JSON on stdout, got %q: %v", stdout.String(), err)
+		}
+		if !result.Success || result.Backend != "fake" || result.ExitCode != system.ExitSuccess {
+			t.Errorf("Unexpected result: %+v", result)
+		}
+		if len(result.Phases) != 2 || result.Phases[0].Name != "prepare" || result.Phases[1].Name != "switch" {
+			t.Errorf("Expected prepare and switch phases, got %+v", result.Phases)
+		}
+		if !strings.Contains(stderr.String(), "Starting environment rebuild") {
+			t.Errorf("Expected progress on stderr, got:\n%s", stderr.String())
+		}
+	})
+
+	t.Run("reports failures in the result", func(t *testing.T) {
+		withJSONOutput(t)
+		withTestHome(t)
+		withFakeBackend(t, &system.FakeBackend{SwitchErr: errors.New("boom")})
+
+		var stdout bytes.Buffer
+		cmd := &cobra.Command{RunE: rebuildCmd.RunE}
+		cmd.SetOut(&stdout)
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SilenceErrors = true
+		cmd.SilenceUsage = true
+		cmd.SetArgs([]string{})
+		err := cmd.Execute()
+		if err == nil {
+			t.Fatal("Expected rebuild to fail")
+		}
+
+		var result system.OperationResult
+		if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+			t.Fatalf("Expected JSON on stdout, got %q: %v", stdout.String(), err)
+		}
+		if result.Success || result.Error != "rebuild failed: boom" || result.ExitCode != system.ExitFailure {
+			t.Errorf("Unexpected result: %+v", result)
+		}
+		if last := result.Phases[len(result.Phases)-1]; last.Name != "switch" || last.Status != system.PhaseFailed {
+			t.Errorf("Expected failed switch phase, got %+v", last)
+		}
+
+		// The error is part of the result and must not be printed again
+		var reportOut bytes.Buffer
+		reportError(&reportOut, &reportOut, err)
+		if reportOut.Len() != 0 {
+			t.Errorf("Expected reported error to be skipped, got %q", reportOut.String())
+		}
+	})
+}
+
+func TestReportError(t *testing.T) {
+	t.Run("text output", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		reportError(&stdout, &stderr, errors.New("boom"))
+		if stdout.Len() != 0 || strings.TrimSpace(stderr.String()) != "boom" {
+			t.Errorf("Expected error on stderr, got stdout %q and stderr %q", stdout.String(), stderr.String())
+		}
+	})
+
+	t.Run("json output", func(t *testing.T) {
+		withJSONOutput(t)
+		var stdout, stderr bytes.Buffer
+		reportError(&stdout, &stderr, &usageError{errors.New("unknown flag: --nope")})
+
+		var result errorResult
+		if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+			t.Fatalf("Expected JSON error, got %q: %v", stdout.String(), err)
+		}
+		if result.Error != "unknown flag: --nope" || result.ExitCode != system.ExitUsage {
+			t.Errorf("Unexpected error result: %+v", result)
+		}
+	})
+}
+
+func TestGenerationsCommandJSONOutput(t *testing.T) {
+	withJSONOutput(t)
+	withFakeBackend(t, &system.FakeBackend{GenerationList: []system.Generation{{ID: 1, Date: "2024-05-01"}, {ID: 2, Current: true}}})
+
+	var stdout bytes.Buffer
+	cmd := &cobra.Command{RunE: generationsCmd.RunE}
+	cmd.SetOut(&stdout)
+	cmd.SetArgs([]string{})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("Expected generations to succeed, got: %v", err)
+	}
+
+	var gens []system.Generation
+	if err := json.Unmarshal(stdout.Bytes(), &gens); err != nil {
+		t.Fatalf("Expected JSON on stdout, got %q: %v", stdout.String(), err)
+	}
+	if len(gens) != 2 || !gens[1].Current || gens[0].Date != "2024-05-01" {
+		t.Errorf("Unexpected generations: %+v", gens)
+	}
+}
+
+func TestRebuildCommandHints(t *testing.T) {
+	t.Run("text output", func(t *testing.T) {
+		withTestHome(t)
+		withFakeBackend(t, &system.FakeBackend{SwitchErr: errors.New(`exec: "home-manager": executable file not found in $PATH`)})
+
+		cmd := &cobra.Command{RunE: rebuildCmd.RunE}
+		cmd.SetOut(&bytes.Buffer{})
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SilenceErrors = true
+		cmd.SilenceUsage = true
+		cmd.SetArgs([]string{})
+		err := cmd.Execute()
+		if err == nil {
+			t.Fatal("Expected rebuild to fail")
+		}
+
+		var stderr bytes.Buffer
+		reportError(&bytes.Buffer{}, &stderr, err)
+		lines := strings.Split(stderr.String(), "\n")
+		if !strings.HasPrefix(lines[0], "rebuild failed:") {
+			t.Errorf("Expected the error first, got:\n%s", stderr.String())
+		}
+		if !strings.Contains(stderr.String(), "💡 'home-manager' is not installed") || !strings.Contains(stderr.String(), "Fix: Run 'camp bootstrap'") {
+			t.Errorf("Expected the missing tool hint, got:\n%s", stderr.String())
+		}
+	})
+
+	t.Run("json output", func(t *testing.T) {
+		withJSONOutput(t)
+		withTestHome(t)
+		fake := &outputBackend{
+			FakeBackend: &system.FakeBackend{SwitchErr: errors.New("exit status 1")},
+			output:      "Existing file '/home/alice/.bashrc' would be clobbered by backing up '/home/alice/.bashrc'",
+		}
+		original := backendSelector
+		backendSelector = func(user *system.User) (system.Backend, error) { return fake, nil }
+		t.Cleanup(func() { backendSelector = original })
+
+		stderr := utils.Stderr
+		utils.Stderr = &bytes.Buffer{}
+		t.Cleanup(func() { utils.Stderr = stderr })
+
+		var out bytes.Buffer
+		cmd := &cobra.Command{RunE: rebuildCmd.RunE}
+		cmd.SetOut(&out)
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SilenceErrors = true
+		cmd.SilenceUsage = true
+		cmd.SetArgs([]string{})
+		if err := cmd.Execute(); err == nil {
+			t.Fatal("Expected rebuild to fail")
+		}
+
+		// The hint is recognized in the output of the failed command
+		var result system.OperationResult
+		if err := json.Unmarshal(out.Bytes(), &result); err != nil {
+			t.Fatalf("Expected JSON on stdout, got %q: %v", out.String(), err)
+		}
+		if len(result.Hints) != 1 || result.Hints[0].Name != "file-clobbered" {
+			t.Errorf("Expected the clobbered file hint, got %+v", result.Hints)
+		}
+	})
+}
+
+// outputBackend is a fake backend whose Switch prints output like a failing command
+type outputBackend struct {
+	*system.FakeBackend
+	output string
+}
+
+func (b *outputBackend) Switch(user *system.User) error {
+	fmt.Fprintln(utils.Stderr, b.output)
+	return b.FakeBackend.Switch(user)
+}
@@ -4,11 +4,15 @@ import (
 	"fmt"
 
 	"camp/internal/project"
+	"camp/internal/system"
 	"camp/internal/utils"
 
 	"github.com/spf13/cobra"
 )
 
+// projectDryRun prints the commands of project scripts instead of running them
+var projectDryRun bool
+
 var projectCmd = &cobra.Command{
 	Use:     "project",
 	Aliases: []string{"proj"},
@@ -24,7 +28,7 @@ var projectCmd = &cobra.Command{
 		if len(args) == 0 {
 			return cmd.Help()
 		}
-		return runProjectCommand(args[0])
+		return runProjectCommand(cmd, args[0])
 	},
 }
 
@@ -34,7 +38,7 @@ func installCmd() *cobra.Command {
 		Short: "Install project dependencies",
 		Long:  "Install project dependencies",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runProjectCommand("install")
+			return runProjectCommand(cmd, "install")
 		},
 	}
 }
@@ -45,7 +49,7 @@ func testCmd() *cobra.Command {
 		Short: "Execute project test suite",
 		Long:  "Execute test script defined in the project's devbox.json file",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runProjectCommand("test")
+			return runProjectCommand(cmd, "test")
 		},
 	}
 }
@@ -60,6 +64,9 @@ func infoCmd() *cobra.Command {
 			if !proj.Compatible() {
 				return fmt.Errorf("project is not compatible with camp")
 			}
+			if jsonOutput() {
+				return printResult(cmd, proj.Describe(), nil)
+			}
 			for _, line := range proj.Info() {
 				fmt.Println(line)
 			}
@@ -68,17 +75,25 @@ func infoCmd() *cobra.Command {
 	}
 }
 
-func runProjectCommand(cmd string) error {
+func runProjectCommand(cmd *cobra.Command, name string) error {
+	result := system.NewOperationResult("project " + name)
 	proj := project.NewProject()
 	if !proj.Compatible() {
-		return fmt.Errorf("project is not compatible with camp")
+		return finishOperation(cmd, result, fmt.Errorf("project is not compatible with camp"))
 	}
 
 	commands := proj.Commands()
-	if commands[cmd] == nil {
-		return fmt.Errorf("command not found: %s", cmd)
+	if commands[name] == nil {
+		return finishOperation(cmd, result, fmt.Errorf("command not found: %s", name))
+	}
+	runner := utils.DefaultRunner
+	if projectDryRun {
+		runner = utils.NewDryRunner(progressOutput(cmd))
 	}
-	return utils.RunCommands(commands[cmd])
+	err := result.RunPhase(name, func() error {
+		return utils.RunCommandsContext(cmd.Context(), runner, commands[name])
+	})
+	return finishOperation(cmd, result, err)
 }
 
 // validateArgs checks if the subcommand exists in the devbox.json file
@@ -98,6 +113,7 @@ func validateArgs(args []string) error {
 }
 
 func init() {
+	projectCmd.PersistentFlags().BoolVar(&projectDryRun, "dry-run", false, "Print the commands of the script without running them")
 	projectCmd.AddCommand(infoCmd())
 	projectCmd.AddCommand(installCmd())
 	projectCmd.AddCommand(testCmd())
@@ -2,12 +2,16 @@ package cmd
 
 import (
 	"fmt"
+	"io"
 
 	"camp/internal/system"
 
 	"github.com/spf13/cobra"
 )
 
+// backendSelector is a variable that can be overridden in tests
+var backendSelector = system.SelectBackend
+
 var rebuildCmd = &cobra.Command{
 	Use:   "rebuild",
 	Short: "Rebuild the development environment",
@@ -16,46 +20,149 @@ var rebuildCmd = &cobra.Command{
 This command:
   1. Copies Nix configuration files from templates to ~/.camp/nix/
   2. Renders flake.nix with your custom environment variables from camp.yml
-  3. Executes the platform-specific rebuild command:
+  3. Executes the rebuild command of the selected backend:
      - macOS: Uses nix-darwin to rebuild system configuration
      - Linux: Uses home-manager to rebuild user environment
+     - NixOS: Uses nixos-rebuild with home-manager as a NixOS module
+     - Profile: Installs packages with nix profile (set 'backend: profile')
+
+The backend is auto-detected from the platform and can be set explicitly
+with the 'backend' setting in camp.yml.
+
+Nix output is summarized as it runs: derivations to build and fetch, the
+current activity, downloaded bytes and the time spent evaluating, building
+and activating. Use --verbose to see the raw output of Nix instead.
+
+The rebuild is skipped when the rendered configuration, flake.lock, camp.yml
+and the camp version are unchanged since the last successful rebuild. Use
+--force to rebuild anyway.
 
 Prerequisites:
   - Nix package manager must be installed
   - macOS: nix-darwin must be configured (requires sudo/admin privileges)
   - Linux: home-manager must be configured
+  - NixOS: sudo privileges are required to switch the system configuration
 
 Note: On macOS, this command requires sudo privileges and will prompt for your password.`,
-	RunE: runRebuild,
+	RunE: locked(logged("rebuild", diagnosed(runRebuild))),
 }
 
+var (
+	forceRebuild   bool
+	verboseRebuild bool
+)
+
 func init() {
 	envCmd.AddCommand(rebuildCmd)
+	addLockFlags(rebuildCmd)
+	rebuildCmd.Flags().BoolVar(&forceRebuild, "force", false, "Rebuild even if nothing changed since the last rebuild")
+	rebuildCmd.Flags().BoolVarP(&verboseRebuild, "verbose", "v", false, "Show the raw output of Nix instead of a progress summary")
 }
 
 func runRebuild(cmd *cobra.Command, args []string) error {
-	// Get current user context
-	user := system.NewUser()
+	return rebuild(cmd, currentUser(), system.NewOperationResult("rebuild"))
+}
+
+// rebuild rebuilds the environment of user, recording its phases in result.
+// Operations ending with a rebuild (like camp env lock restore --rebuild) add theirs first
+func rebuild(cmd *cobra.Command, user *system.User, result *system.OperationResult) error {
+	out := progressOutput(cmd)
+
+	// Select the backend that will perform the rebuild
+	backend, err := backendSelector(user)
+	if err != nil {
+		return finishOperation(cmd, result, fmt.Errorf("failed to select backend: %w", err))
+	}
+	result.Backend = backend.Name()
 
 	// Output rebuild start message
-	fmt.Fprintf(cmd.OutOrStdout(), "Starting environment rebuild...\n")
-	fmt.Fprintf(cmd.OutOrStdout(), "Platform: %s\n", user.Platform)
-	fmt.Fprintf(cmd.OutOrStdout(), "User: %s\n", user.Name)
-	fmt.Fprintf(cmd.OutOrStdout(), "Hostname: %s\n\n", user.HostName)
+	fmt.Fprintf(out, "Starting environment rebuild...\n")
+	fmt.Fprintf(out, "Platform: %s\n", user.Platform)
+	fmt.Fprintf(out, "Backend: %s\n", backend.Name())
+	fmt.Fprintf(out, "User: %s\n", user.Name)
+	fmt.Fprintf(out, "Hostname: %s\n\n", user.HostName)
+	if overrides := system.ActiveFlakeOverrides(user); len(overrides) > 0 {
+		warnFlakeOverrides(out, overrides)
+		fmt.Fprintln(out)
+	}
+	if ignored := system.IgnoredFlakes(user, backend.Name()); len(ignored) > 0 {
+		warnIgnoredFlakes(out, ignored, backend.Name())
+		fmt.Fprintln(out)
+	}
+	if errs := system.ArgSchemaErrors(user); len(errs) > 0 {
+		fmt.Fprintf(out, "⚠️  Some argument schemas could not be fetched, their defaults are missing (run 'camp env check' to retry):\n")
+		for _, err := range errs {
+			fmt.Fprintf(out, "   %v\n", err)
+		}
+		fmt.Fprintln(out)
+	}
+
+	// Run user hooks before touching the environment
+	if err := runHooksPhase(result, user, system.HookPreRebuild, backend, out); err != nil {
+		return finishOperation(cmd, result, err)
+	}
 
 	// Prepare environment (copy files and render templates)
-	fmt.Fprintf(cmd.OutOrStdout(), "Preparing environment...\n")
-	if err := system.PrepareEnvironment(user); err != nil {
-		return fmt.Errorf("failed to prepare environment: %w", err)
+	fmt.Fprintf(out, "Preparing environment...\n")
+	if err := result.RunPhase("prepare", func() error { return backend.Prepare(user) }); err != nil {
+		return finishOperation(cmd, result, fmt.Errorf("failed to prepare environment: %w", err))
+	}
+	fmt.Fprintf(out, "✓ Environment prepared successfully\n\n")
+
+	// Skip the switch when nothing changed since the last one
+	fingerprint, err := system.ComputeFingerprint(user, backend.Name())
+	if err != nil {
+		result.AddWarning("fingerprint", err)
+		fmt.Fprintf(out, "⚠️  Could not fingerprint the environment: %v\n", err)
+	} else if !forceRebuild && upToDate(user, fingerprint) {
+		result.AddSkipped("switch")
+		fmt.Fprintf(out, "✓ Environment is up to date, nothing to rebuild (use --force to rebuild anyway)\n")
+		return finishOperation(cmd, result, nil)
+	}
+
+	// Remember the active generation to summarize the changes afterwards
+	var previous *system.Generation
+	if gens, err := backend.Generations(user); err == nil {
+		previous = system.CurrentGeneration(gens)
 	}
-	fmt.Fprintf(cmd.OutOrStdout(), "✓ Environment prepared successfully\n\n")
 
 	// Execute rebuild
-	fmt.Fprintf(cmd.OutOrStdout(), "Executing rebuild command...\n")
-	if err := system.ExecuteRebuild(user); err != nil {
-		return fmt.Errorf("rebuild failed: %w", err)
+	fmt.Fprintf(out, "Executing rebuild command...\n")
+	switchEnvironment := func() error { return backend.Switch(user) }
+	if err := result.RunPhase("switch", func() error { return runNix(cmd, verboseRebuild, switchEnvironment) }); err != nil {
+		return finishOperation(cmd, result, fmt.Errorf("rebuild failed: %w", err))
+	}
+
+	fmt.Fprintf(out, "\n✓ Environment rebuild completed successfully!\n")
+	if fingerprint != nil {
+		if err := system.SaveRebuildState(user, backend.Name(), fingerprint); err != nil {
+			result.AddWarning("fingerprint", err)
+		}
 	}
+	summarizeRebuild(out, user, backend, previous, result)
+	snapshotFlakeLock(result, user, result.Command)
 
-	fmt.Fprintf(cmd.OutOrStdout(), "\n✓ Environment rebuild completed successfully!\n")
-	return nil
+	// Run user hooks once the new generation is active
+	err = runHooksPhase(result, user, system.HookPostRebuild, backend, out)
+	return finishOperation(cmd, result, err)
+}
+
+// upToDate reports whether the last successful switch had the same fingerprint
+func upToDate(user *system.User, fingerprint *system.Fingerprint) bool {
+	state, err := system.LoadRebuildState(user)
+	if err != nil || state == nil {
+		return false
+	}
+	return state.Fingerprint.Sum() == fingerprint.Sum()
+}
+
+// runHooksPhase runs the user's hooks for a stage as a phase of the operation.
+// Stages without hooks are not recorded
+func runHooksPhase(result *system.OperationResult, user *system.User, stage system.HookStage, backend system.Backend, out io.Writer) error {
+	if len(user.Hooks.ForStage(stage)) == 0 {
+		return nil
+	}
+	return result.RunPhase(string(stage), func() error {
+		return system.RunHooks(user, stage, backend, out)
+	})
 }
@@ -2,11 +2,16 @@ package cmd
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 
+	"camp/internal/system"
+	"camp/internal/utils"
+
 	"github.com/spf13/cobra"
 )
 
@@ -185,3 +190,292 @@ func TestRebuildCommandOutputFormat(t *testing.T) {
 		}
 	}
 }
+
+// withFakeBackend replaces the backend selector with one returning the given fake
+func withFakeBackend(t *testing.T, fake *system.FakeBackend) {
+	t.Helper()
+	original := backendSelector
+	backendSelector = func(user *system.User) (system.Backend, error) {
+		return fake, nil
+	}
+	t.Cleanup(func() { backendSelector = original })
+}
+
+func TestRebuildCommandWithFakeBackend(t *testing.T) {
+	t.Run("prepares and switches", func(t *testing.T) {
+		fake := &system.FakeBackend{}
+		withTestHome(t)
+		withFakeBackend(t, fake)
+
+		var output bytes.Buffer
+		cmd := &cobra.Command{RunE: rebuildCmd.RunE}
+		cmd.SetOut(&output)
+		cmd.SetArgs([]string{})
+
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("Expected rebuild to succeed, got: %v", err)
+		}
+
+		// Generations are listed to summarize the changes of the rebuild
+		if strings.Join(fake.Calls, ",") != "prepare,generations,switch" {
+			t.Errorf("Expected calls 'prepare,generations,switch', got %v", fake.Calls)
+		}
+
+		outputStr := output.String()
+		if !strings.Contains(outputStr, "Backend: fake") {
+			t.Errorf("Expected output to contain backend name, got:\n%s", outputStr)
+		}
+		if !strings.Contains(outputStr, "✓ Environment rebuild completed successfully!") {
+			t.Errorf("Expected success message, got:\n%s", outputStr)
+		}
+	})
+
+	t.Run("does not switch when prepare fails", func(t *testing.T) {
+		fake := &system.FakeBackend{PrepareErr: errors.New("render failed")}
+		withTestHome(t)
+		withFakeBackend(t, fake)
+
+		cmd := &cobra.Command{RunE: rebuildCmd.RunE}
+		cmd.SetOut(&bytes.Buffer{})
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SetArgs([]string{})
+
+		err := cmd.Execute()
+		if err == nil || !strings.Contains(err.Error(), "failed to prepare environment") {
+			t.Errorf("Expected prepare error, got: %v", err)
+		}
+
+		if strings.Join(fake.Calls, ",") != "prepare" {
+			t.Errorf("Expected only prepare to be called, got %v", fake.Calls)
+		}
+	})
+
+	t.Run("warns about flakes the backend ignores", func(t *testing.T) {
+		user := withTestHome(t)
+		user.Flakes = []system.Flake{{Name: "tools", URL: "github:team/tools", Outputs: []system.FlakeOutput{{Name: "homeManagerModules.default", Type: system.OutputTypeHome}}}}
+		withFakeBackend(t, &system.FakeBackend{BackendName: system.BackendProfile})
+
+		var output bytes.Buffer
+		cmd := &cobra.Command{RunE: rebuildCmd.RunE}
+		cmd.SetOut(&output)
+		cmd.SetArgs([]string{})
+
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("Expected rebuild to succeed, got: %v", err)
+		}
+		if !strings.Contains(output.String(), "the outputs of these flakes are not applied: tools") {
+			t.Errorf("Expected a warning about the ignored flake, got:\n%s", output.String())
+		}
+	})
+
+	t.Run("reports switch failure", func(t *testing.T) {
+		fake := &system.FakeBackend{SwitchErr: errors.New("boom")}
+		withTestHome(t)
+		withFakeBackend(t, fake)
+
+		cmd := &cobra.Command{RunE: rebuildCmd.RunE}
+		cmd.SetOut(&bytes.Buffer{})
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SetArgs([]string{})
+
+		err := cmd.Execute()
+		if err == nil || !strings.Contains(err.Error(), "rebuild failed: boom") {
+			t.Errorf("Expected switch error, got: %v", err)
+		}
+	})
+}
+
+func TestRebuildCommandSkipsUnchangedEnvironment(t *testing.T) {
+	withTestHome(t)
+	t.Cleanup(func() { forceRebuild = false })
+
+	rebuild := func(t *testing.T, force bool) (*system.FakeBackend, string) {
+		t.Helper()
+		forceRebuild = force
+		fake := &system.FakeBackend{}
+		withFakeBackend(t, fake)
+
+		var output bytes.Buffer
+		cmd := &cobra.Command{RunE: rebuildCmd.RunE}
+		cmd.SetOut(&output)
+		cmd.SetArgs([]string{})
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("Expected rebuild to succeed, got: %v", err)
+		}
+		return fake, output.String()
+	}
+
+	fake, _ := rebuild(t, false)
+	if !strings.Contains(strings.Join(fake.Calls, ","), "switch") {
+		t.Fatalf("Expected first rebuild to switch, got %v", fake.Calls)
+	}
+
+	fake, output := rebuild(t, false)
+	if strings.Contains(strings.Join(fake.Calls, ","), "switch") {
+		t.Errorf("Expected unchanged rebuild to skip the switch, got %v", fake.Calls)
+	}
+	if !strings.Contains(output, "Environment is up to date") {
+		t.Errorf("Expected up to date message, got:\n%s", output)
+	}
+
+	fake, _ = rebuild(t, true)
+	if !strings.Contains(strings.Join(fake.Calls, ","), "switch") {
+		t.Errorf("Expected --force to switch, got %v", fake.Calls)
+	}
+}
+
+func TestStatusCommand(t *testing.T) {
+	user := withTestHome(t)
+	user.Backend = system.BackendProfile
+
+	status := func(t *testing.T) string {
+		t.Helper()
+		var output bytes.Buffer
+		cmd := &cobra.Command{RunE: statusCmd.RunE}
+		cmd.SetOut(&output)
+		cmd.SetArgs([]string{})
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("Expected status to succeed, got: %v", err)
+		}
+		return output.String()
+	}
+
+	if output := status(t); !strings.Contains(output, "never rebuilt") {
+		t.Errorf("Expected never rebuilt status, got:\n%s", output)
+	}
+
+	fingerprint, err := system.ComputeFingerprint(user, system.BackendProfile)
+	if err != nil {
+		t.Fatalf("ComputeFingerprint() failed: %v", err)
+	}
+	if err := system.SaveRebuildState(user, system.BackendProfile, fingerprint); err != nil {
+		t.Fatalf("SaveRebuildState() failed: %v", err)
+	}
+	if output := status(t); !strings.Contains(output, "up to date") {
+		t.Errorf("Expected up to date status, got:\n%s", output)
+	}
+
+	if err := os.MkdirAll(filepath.Join(user.HomeDir, ".camp"), 0755); err != nil {
+		t.Fatalf("Failed to create .camp directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(user.HomeDir, ".camp", "camp.yml"), []byte("packages: [git]\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	if output := status(t); !strings.Contains(output, "Changed since: camp.yml") {
+		t.Errorf("Expected pending camp.yml change, got:\n%s", output)
+	}
+}
+
+// nixLogBackend is a fake backend whose Switch prints internal-json log messages like Nix
+type nixLogBackend struct {
+	*system.FakeBackend
+}
+
+func (b *nixLogBackend) Switch(user *system.User) error {
+	fmt.Fprintln(utils.Stderr, `@nix {"action":"start","fields":["/nix/store/00000000000000000000000000000000-hello-2.12.drv","",1,1],"id":1,"level":3,"parent":0,"text":"building","type":105}`)
+	fmt.Fprintln(utils.Stderr, `@nix {"action":"stop","id":1}`)
+	fmt.Fprintln(utils.Stdout, "Starting Home Manager activation")
+	return b.FakeBackend.Switch(user)
+}
+
+func TestRebuildCommandProgress(t *testing.T) {
+	tests := []struct {
+		name       string
+		verbose    bool
+		expected   []string
+		unexpected []string
+	}{
+		{
+			name:       "progress summary",
+			expected:   []string{"✓ Build finished: built 1 derivation", "Starting Home Manager activation", "✓ Activated environment"},
+			unexpected: []string{"@nix"},
+		},
+		{
+			name:       "verbose",
+			verbose:    true,
+			expected:   []string{`@nix {"action":"stop","id":1}`, "Starting Home Manager activation"},
+			unexpected: []string{"✓ Build finished"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withTestHome(t)
+			fake := &nixLogBackend{&system.FakeBackend{}}
+			original := backendSelector
+			backendSelector = func(user *system.User) (system.Backend, error) { return fake, nil }
+			t.Cleanup(func() { backendSelector = original })
+
+			// Raw output of external commands goes to the same buffer as camp's output
+			var output bytes.Buffer
+			stdout, stderr := utils.Stdout, utils.Stderr
+			utils.Stdout, utils.Stderr = &output, &output
+			verboseRebuild = tt.verbose
+			t.Cleanup(func() {
+				utils.Stdout, utils.Stderr = stdout, stderr
+				verboseRebuild = false
+			})
+
+			cmd := &cobra.Command{RunE: rebuildCmd.RunE}
+			cmd.SetOut(&output)
+			cmd.SetArgs([]string{})
+			if err := cmd.Execute(); err != nil {
+				t.Fatalf("Expected rebuild to succeed, got: %v", err)
+			}
+
+			for _, want := range tt.expected {
+				if !strings.Contains(output.String(), want) {
+					t.Errorf("Expected output to contain %q, got:\n%s", want, output.String())
+				}
+			}
+			for _, unwanted := range tt.unexpected {
+				if strings.Contains(output.String(), unwanted) {
+					t.Errorf("Expected output not to contain %q, got:\n%s", unwanted, output.String())
+				}
+			}
+		})
+	}
+}
+
+func TestRebuildCommandLogsRawNixOutput(t *testing.T) {
+	user := withTestHome(t)
+	fake := &nixLogBackend{&system.FakeBackend{}}
+	original := backendSelector
+	backendSelector = func(user *system.User) (system.Backend, error) { return fake, nil }
+	t.Cleanup(func() { backendSelector = original })
+
+	var output bytes.Buffer
+	stdout, stderr := utils.Stdout, utils.Stderr
+	utils.Stdout, utils.Stderr = &output, &output
+	t.Cleanup(func() { utils.Stdout, utils.Stderr = stdout, stderr })
+
+	cmd := &cobra.Command{RunE: rebuildCmd.RunE}
+	cmd.SetOut(&output)
+	cmd.SetArgs([]string{})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("Expected rebuild to succeed, got: %v", err)
+	}
+	if strings.Contains(output.String(), "@nix") {
+		t.Errorf("Expected the terminal to show the progress summary only, got:\n%s", output.String())
+	}
+
+	entries, err := system.ListLogs(user)
+	if err != nil || len(entries) == 0 {
+		t.Fatalf("Expected the rebuild to be logged, got %v (%v)", entries, err)
+	}
+	_, content, err := system.ReadLog(user, entries[0].ID)
+	if err != nil {
+		t.Fatalf("ReadLog() failed: %v", err)
+	}
+	expected := []string{
+		`@nix {"action":"start","fields":["/nix/store/00000000000000000000000000000000-hello-2.12.drv","",1,1]`,
+		`@nix {"action":"stop","id":1}`,
+		"Starting Home Manager activation",
+		"✓ Build finished: built 1 derivation",
+	}
+	for _, want := range expected {
+		if strings.Count(content, want) != 1 {
+			t.Errorf("Expected the log to hold %q once, got:\n%s", want, content)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"fmt"
+
+	"camp/internal/system"
+
+	"github.com/spf13/cobra"
+)
+
+var rollbackCmd = &cobra.Command{
+	Use:   "rollback",
+	Short: "Roll back to the previous environment generation",
+	Long: `Roll back the development environment to the previous generation.
+
+This command asks the active backend to activate the generation created
+before the current one. Use 'camp env generations' to see the available
+generations.
+
+Prerequisites:
+  - At least one rebuild must have been completed before the current one`,
+	RunE: locked(runRollback),
+}
+
+var generationsCmd = &cobra.Command{
+	Use:   "generations",
+	Short: "List the environment generations",
+	Long:  "List the generations known to the active backend, marking the current one.",
+	RunE:  runGenerations,
+}
+
+func init() {
+	envCmd.AddCommand(rollbackCmd)
+	addLockFlags(rollbackCmd)
+	envCmd.AddCommand(generationsCmd)
+}
+
+func runRollback(cmd *cobra.Command, args []string) error {
+	// Get current user context
+	user := currentUser()
+	out := progressOutput(cmd)
+	result := system.NewOperationResult("rollback")
+
+	backend, err := backendSelector(user)
+	if err != nil {
+		return finishOperation(cmd, result, fmt.Errorf("failed to select backend: %w", err))
+	}
+	result.Backend = backend.Name()
+
+	fmt.Fprintf(out, "Rolling back environment (backend: %s)...\n", backend.Name())
+	if err := result.RunPhase("rollback", func() error { return backend.Rollback(user) }); err != nil {
+		return finishOperation(cmd, result, fmt.Errorf("rollback failed: %w", err))
+	}
+
+	// The active generation no longer matches the last rebuild
+	if err := system.ClearRebuildState(user); err != nil {
+		result.AddWarning("clear-state", err)
+	}
+
+	fmt.Fprintf(out, "\n✓ Environment rolled back successfully!\n")
+	return finishOperation(cmd, result, nil)
+}
+
+func runGenerations(cmd *cobra.Command, args []string) error {
+	// Get current user context
+	user := currentUser()
+
+	backend, err := backendSelector(user)
+	if err != nil {
+		return fmt.Errorf("failed to select backend: %w", err)
+	}
+
+	gens, err := backend.Generations(user)
+	if err != nil {
+		return err
+	}
+
+	if jsonOutput() {
+		if gens == nil {
+			gens = []system.Generation{}
+		}
+		return printResult(cmd, gens, nil)
+	}
+
+	if len(gens) == 0 {
+		fmt.Fprintf(cmd.OutOrStdout(), "No generations found.\n")
+		return nil
+	}
+
+	for _, gen := range gens {
+		marker := ""
+		if gen.Current {
+			marker = " (current)"
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "%4d  %s%s\n", gen.ID, gen.Date, marker)
+	}
+	return nil
+}
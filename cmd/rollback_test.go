@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"camp/internal/system"
+
+	"github.com/spf13/cobra"
+)
+
+func TestRollbackCommand(t *testing.T) {
+	t.Run("command is subcommand of env", func(t *testing.T) {
+		found := map[string]bool{}
+		for _, cmd := range envCmd.Commands() {
+			found[cmd.Use] = true
+		}
+		if !found["rollback"] {
+			t.Error("rollback command should be registered as subcommand of env")
+		}
+		if !found["generations"] {
+			t.Error("generations command should be registered as subcommand of env")
+		}
+	})
+
+	t.Run("rolls back with the selected backend", func(t *testing.T) {
+		fake := &system.FakeBackend{}
+		withFakeBackend(t, fake)
+
+		var output bytes.Buffer
+		cmd := &cobra.Command{RunE: rollbackCmd.RunE}
+		cmd.SetOut(&output)
+		cmd.SetArgs([]string{})
+
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("Expected rollback to succeed, got: %v", err)
+		}
+
+		if strings.Join(fake.Calls, ",") != "rollback" {
+			t.Errorf("Expected rollback to be called, got %v", fake.Calls)
+		}
+	})
+
+	t.Run("reports rollback failure", func(t *testing.T) {
+		fake := &system.FakeBackend{RollbackErr: errors.New("no previous generation")}
+		withFakeBackend(t, fake)
+
+		cmd := &cobra.Command{RunE: rollbackCmd.RunE}
+		cmd.SetOut(&bytes.Buffer{})
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SetArgs([]string{})
+
+		if err := cmd.Execute(); err == nil {
+			t.Error("Expected rollback to fail")
+		}
+	})
+}
+
+func TestGenerationsCommand(t *testing.T) {
+	fake := &system.FakeBackend{
+		GenerationList: []system.Generation{
+			{ID: 1, Date: "2024-05-01 10:00"},
+			{ID: 2, Date: "2024-05-02 10:00", Current: true},
+		},
+	}
+	withFakeBackend(t, fake)
+
+	var output bytes.Buffer
+	cmd := &cobra.Command{RunE: generationsCmd.RunE}
+	cmd.SetOut(&output)
+	cmd.SetArgs([]string{})
+
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("Expected generations to succeed, got: %v", err)
+	}
+
+	outputStr := output.String()
+	if !strings.Contains(outputStr, "1  2024-05-01 10:00") {
+		t.Errorf("Expected first generation in output, got:\n%s", outputStr)
+	}
+	if !strings.Contains(outputStr, "2  2024-05-02 10:00 (current)") {
+		t.Errorf("Expected current generation to be marked, got:\n%s", outputStr)
+	}
+}
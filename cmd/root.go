@@ -4,13 +4,22 @@ import (
 	"fmt"
 	"os"
 
+	"camp/internal/system"
+
 	"github.com/spf13/cobra"
 )
 
+// currentUser returns the user camp operates on. It can be overridden in tests
+var currentUser = system.NewUser
+
 var rootCmd = &cobra.Command{
-	Use:   "camp",
-	Short: "Camp is your all-in-one dev environment manager",
-	Long:  "Camp is a command line application helps you managing your isolated development environment.",
+	Use:     "camp",
+	Short:   "Camp is your all-in-one dev environment manager",
+	Long:    "Camp is a command line application helps you managing your isolated development environment.",
+	Version: system.Version,
+	// Errors are printed by Execute, as text or JSON
+	SilenceErrors:     true,
+	PersistentPreRunE: setupOutput,
 	Run: func(cmd *cobra.Command, args []string) {
 		fmt.Fprintln(cmd.OutOrStdout(), "Hello! Welcome to camp - your dev environment manager!")
 	},
@@ -18,13 +27,21 @@ var rootCmd = &cobra.Command{
 
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		reportError(os.Stdout, os.Stderr, err)
+		os.Exit(exitCode(err))
 	}
 }
 
 func init() {
+	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", outputText, "Output format: text or json")
+	rootCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return &usageError{err}
+	})
+
 	rootCmd.AddCommand(envCmd)
 	rootCmd.AddCommand(bootstrapCmd)
 	rootCmd.AddCommand(projectCmd)
+	rootCmd.AddCommand(logsCmd)
+	rootCmd.AddCommand(doctorCmd)
+	rootCmd.AddCommand(flakeCmd)
 }
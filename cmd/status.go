@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"camp/internal/system"
+
+	"github.com/spf13/cobra"
+)
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Report whether the environment is up to date",
+	Long: `Report whether the environment matches camp.yml.
+
+The environment is up to date when the rendered configuration, flake.lock,
+camp.yml, the backend and the camp version are unchanged since the last
+successful 'camp env rebuild'.
+
+Flakes overridden by a local checkout with 'camp flake develop' are reported
+with a warning, as the environment then differs from camp.yml.`,
+	RunE: runStatus,
+}
+
+func init() {
+	envCmd.AddCommand(statusCmd)
+}
+
+func runStatus(cmd *cobra.Command, args []string) error {
+	// Get current user context
+	user := currentUser()
+
+	backend, err := system.ResolveBackendName(user)
+	if err != nil {
+		return fmt.Errorf("failed to select backend: %w", err)
+	}
+
+	status, err := system.GetEnvironmentStatus(user, backend)
+	if err != nil {
+		return err
+	}
+
+	if jsonOutput() {
+		return printResult(cmd, status, nil)
+	}
+
+	// Overrides make the environment differ from camp.yml, make them hard to miss
+	if len(status.Overrides) > 0 {
+		fmt.Fprintf(cmd.ErrOrStderr(), "⚠️  %d flake(s) use a local checkout instead of camp.yml:\n", len(status.Overrides))
+		warnFlakeOverrides(cmd.ErrOrStderr(), status.Overrides)
+		fmt.Fprintln(cmd.ErrOrStderr())
+	}
+
+	fmt.Fprintf(cmd.OutOrStdout(), "Backend: %s\n", status.Backend)
+	switch {
+	case status.LastSwitch == nil:
+		fmt.Fprintf(cmd.OutOrStdout(), "Status: never rebuilt by camp\n")
+		fmt.Fprintf(cmd.OutOrStdout(), "\nRun 'camp env rebuild' to apply your configuration.\n")
+	case status.UpToDate:
+		fmt.Fprintf(cmd.OutOrStdout(), "Status: ✓ up to date\n")
+		fmt.Fprintf(cmd.OutOrStdout(), "Last rebuild: %s\n", status.LastSwitch.Format("2006-01-02 15:04:05"))
+	default:
+		fmt.Fprintf(cmd.OutOrStdout(), "Status: changes pending\n")
+		fmt.Fprintf(cmd.OutOrStdout(), "Last rebuild: %s\n", status.LastSwitch.Format("2006-01-02 15:04:05"))
+		fmt.Fprintf(cmd.OutOrStdout(), "Changed since: %s\n", strings.Join(status.Changed, ", "))
+		fmt.Fprintf(cmd.OutOrStdout(), "\nRun 'camp env rebuild' to apply the changes.\n")
+	}
+	return nil
+}
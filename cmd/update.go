@@ -2,8 +2,9 @@ package cmd
 
 import (
 	"fmt"
-	"os/exec"
-	"path/filepath"
+	"io"
+	"strings"
+	"text/tabwriter"
 
 	"camp/internal/system"
 
@@ -11,66 +12,167 @@ import (
 )
 
 var updateCmd = &cobra.Command{
-	Use:   "update",
+	Use:   "update [input...]",
 	Short: "Update flake dependencies to their latest versions",
-	Long: `Update all flake dependencies defined in camp.yml to their latest versions.
+	Long: `Update the flake dependencies defined in camp.yml to their latest versions.
 
 This command:
   1. Prepares the environment (copies files and renders templates with current config)
-  2. Updates flake.lock with the latest versions of all flake inputs
+  2. Updates flake.lock with the latest versions of the flake inputs: all of
+     them, or only the inputs named on the command line
   3. This includes both built-in flakes (nixpkgs, nix-darwin, home-manager)
      and any custom flakes defined in your camp.yml
+  4. Prints the inputs that changed: old and new revision and date, and a
+     link to the commits in between for inputs hosted on GitHub
+
+With --dry-run, the update runs against a scratch copy of ~/.camp/nix and
+only reports what would change; flake.lock is left untouched.
 
 After running this command, you'll need to run 'camp env rebuild' to apply
 the updated dependencies.
 
+Examples:
+  camp env update                   # Update every input
+  camp env update nixpkgs           # Update only nixpkgs
+  camp env update --dry-run         # Show what an update would change
+
 Prerequisites:
-  - Nix package manager must be installed with flakes enabled`,
-	RunE: runUpdate,
+  - Nix package manager must be installed with flakes enabled
+  - Updating named inputs requires Nix 2.19 or later`,
+	RunE: locked(logged("update", diagnosed(runUpdate))),
 }
 
+var updateDryRun bool
+
 func init() {
 	envCmd.AddCommand(updateCmd)
+	addLockFlags(updateCmd)
+	updateCmd.Flags().BoolVar(&updateDryRun, "dry-run", false, "Show the changes an update would make without changing flake.lock")
 }
 
 func runUpdate(cmd *cobra.Command, args []string) error {
 	// Get current user context
-	user := system.NewUser()
+	user := currentUser()
+	out := progressOutput(cmd)
+	result := system.NewOperationResult("update")
 
 	// Output update start message
-	fmt.Fprintf(cmd.OutOrStdout(), "Starting flake update...\n")
-	fmt.Fprintf(cmd.OutOrStdout(), "User: %s\n", user.Name)
-	fmt.Fprintf(cmd.OutOrStdout(), "Nix directory: %s/.camp/nix\n\n", user.HomeDir)
+	fmt.Fprintf(out, "Starting flake update...\n")
+	fmt.Fprintf(out, "User: %s\n", user.Name)
+	fmt.Fprintf(out, "Nix directory: %s/.camp/nix\n\n", user.HomeDir)
+
+	// Check the inputs to update are declared by camp before doing anything
+	if err := system.ValidateFlakeInputs(user, args); err != nil {
+		return finishOperation(cmd, result, &usageError{err})
+	}
+	before, err := system.ReadFlakeLock(system.FlakeLockPath(user))
+	if err != nil {
+		return finishOperation(cmd, result, err)
+	}
+
+	// Run user hooks before updating, unless nothing is going to be updated
+	if !updateDryRun {
+		if err := runHooksPhase(result, user, system.HookPreUpdate, nil, out); err != nil {
+			return finishOperation(cmd, result, err)
+		}
+	}
 
 	// Prepare environment (copy files and render templates)
-	fmt.Fprintf(cmd.OutOrStdout(), "Preparing environment...\n")
-	if err := system.PrepareEnvironment(user); err != nil {
-		return fmt.Errorf("failed to prepare environment: %w", err)
+	fmt.Fprintf(out, "Preparing environment...\n")
+	if err := result.RunPhase("prepare", func() error { return system.PrepareEnvironment(user) }); err != nil {
+		return finishOperation(cmd, result, fmt.Errorf("failed to prepare environment: %w", err))
+	}
+	fmt.Fprintf(out, "✓ Environment prepared successfully\n\n")
+
+	if updateDryRun {
+		return dryRunUpdate(cmd, user, args, result)
+	}
+
+	// Update flakes, streaming the output of Nix to the user
+	if len(args) > 0 {
+		fmt.Fprintf(out, "Updating flake inputs: %s...\n", strings.Join(args, ", "))
+	} else {
+		fmt.Fprintf(out, "Updating flake dependencies...\n")
+	}
+	err = result.RunPhase("update", func() error {
+		return system.UpdateFlakeInputs(cmd.Context(), user.NixDir(), args, out, cmd.ErrOrStderr())
+	})
+	if err != nil {
+		return finishOperation(cmd, result, fmt.Errorf("nix flake update failed: %w", err))
 	}
-	fmt.Fprintf(cmd.OutOrStdout(), "✓ Environment prepared successfully\n\n")
-
-	// Update flakes
-	fmt.Fprintf(cmd.OutOrStdout(), "Updating flake dependencies...\n")
-	nixDir := filepath.Join(user.HomeDir, ".camp", "nix")
-
-	// Run nix flake update
-	nixCmd := exec.Command(
-		"nix",
-		"--extra-experimental-features", "nix-command",
-		"--extra-experimental-features", "flakes",
-		"flake", "update",
-		"--flake", nixDir,
-	)
-
-	// Stream output to user
-	nixCmd.Stdout = cmd.OutOrStdout()
-	nixCmd.Stderr = cmd.ErrOrStderr()
-
-	if err := nixCmd.Run(); err != nil {
-		return fmt.Errorf("nix flake update failed: %w", err)
+
+	// Report the changes made to flake.lock
+	after, err := system.ReadFlakeLock(system.FlakeLockPath(user))
+	if err != nil {
+		result.AddWarning("diff", err)
+		fmt.Fprintf(out, "⚠️  Could not compare flake.lock: %v\n", err)
+	} else {
+		result.Inputs = system.DiffFlakeLocks(before, after)
+		fmt.Fprintln(out)
+		printInputChanges(out, result.Inputs)
+	}
+
+	fmt.Fprintf(out, "\n✓ Flake dependencies updated successfully!\n")
+	snapshotFlakeLock(result, user, "update")
+
+	// Run user hooks once the lock file is updated
+	if err := runHooksPhase(result, user, system.HookPostUpdate, nil, out); err != nil {
+		return finishOperation(cmd, result, err)
 	}
 
-	fmt.Fprintf(cmd.OutOrStdout(), "\n✓ Flake dependencies updated successfully!\n")
-	fmt.Fprintf(cmd.OutOrStdout(), "\nNext step: Run 'camp env rebuild' to apply the updates.\n")
-	return nil
+	fmt.Fprintf(out, "\nNext step: Run 'camp env rebuild' to apply the updates.\n")
+	return finishOperation(cmd, result, nil)
+}
+
+// dryRunUpdate reports the changes an update would make, updating a scratch copy of the flake
+func dryRunUpdate(cmd *cobra.Command, user *system.User, inputs []string, result *system.OperationResult) error {
+	out := progressOutput(cmd)
+	fmt.Fprintf(out, "Checking for updates (dry run)...\n")
+
+	var changes []system.InputChange
+	err := result.RunPhase("update", func() error {
+		var err error
+		changes, err = system.DryRunFlakeUpdate(cmd.Context(), user, inputs, out, cmd.ErrOrStderr())
+		return err
+	})
+	if err != nil {
+		return finishOperation(cmd, result, fmt.Errorf("nix flake update failed: %w", err))
+	}
+
+	result.Inputs = changes
+	fmt.Fprintln(out)
+	printInputChanges(out, changes)
+	fmt.Fprintf(out, "\nDry run: flake.lock was not changed. Run 'camp env update' to apply these updates.\n")
+	return finishOperation(cmd, result, nil)
+}
+
+// printInputChanges prints a table of the flake inputs changed by an update
+func printInputChanges(out io.Writer, changes []system.InputChange) {
+	if len(changes) == 0 {
+		fmt.Fprintf(out, "All flake inputs are up to date\n")
+		return
+	}
+
+	fmt.Fprintf(out, "Flake input changes:\n")
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  INPUT\tOLD\tNEW\tCOMPARE")
+	for _, change := range changes {
+		old, new, compare := "-", "-", change.CompareURL
+		if change.Old != nil {
+			old = change.Old.Describe()
+		}
+		if change.New != nil {
+			new = change.New.Describe()
+		}
+		switch {
+		case change.Old == nil:
+			compare = "(added)"
+		case change.New == nil:
+			compare = "(removed)"
+		case compare == "":
+			compare = "-"
+		}
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", change.Input, old, new, compare)
+	}
+	w.Flush()
 }
@@ -2,18 +2,22 @@ package cmd
 
 import (
 	"bytes"
+	"errors"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 
+	"camp/internal/system"
+	"camp/internal/utils"
+
 	"github.com/spf13/cobra"
 )
 
 func TestUpdateCommand(t *testing.T) {
 	t.Run("command name", func(t *testing.T) {
-		if updateCmd.Use != "update" {
-			t.Errorf("Expected command name to be 'update', got '%s'", updateCmd.Use)
+		if updateCmd.Name() != "update" {
+			t.Errorf("Expected command name to be 'update', got '%s'", updateCmd.Name())
 		}
 	})
 
@@ -41,7 +45,7 @@ func TestUpdateCommand(t *testing.T) {
 	t.Run("command is subcommand of env", func(t *testing.T) {
 		found := false
 		for _, cmd := range envCmd.Commands() {
-			if cmd.Use == "update" {
+			if cmd.Name() == "update" {
 				found = true
 				break
 			}
@@ -195,3 +199,169 @@ func TestUpdateCommandOutputFormat(t *testing.T) {
 		}
 	}
 }
+
+func TestUpdateCommandRunsFlakeUpdate(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		wantErr bool
+	}{
+		{name: "update succeeds"},
+		{name: "update fails", err: errors.New("exit status 1"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The environment is prepared from the templates at the root of the repository
+			t.Chdir("..")
+			user := withTestHome(t)
+			fake := withFakeRunner(t)
+			fake.Err = tt.err
+
+			var output bytes.Buffer
+			cmd := &cobra.Command{RunE: updateCmd.RunE}
+			cmd.SetOut(&output)
+			cmd.SetErr(&output)
+			cmd.SetArgs([]string{})
+
+			err := cmd.Execute()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Execute() error = %v, wantErr %v\n%s", err, tt.wantErr, output.String())
+			}
+
+			want := "nix --extra-experimental-features nix-command --extra-experimental-features flakes flake update --flake " + filepath.Join(user.HomeDir, ".camp", "nix")
+			if got := fake.Commands(); len(got) != 1 || got[0] != want {
+				t.Errorf("Expected %q to run, got %v", want, got)
+			}
+			if tt.wantErr && !strings.Contains(err.Error(), "nix flake update failed") {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+// updateTestLock returns a flake.lock locking nixpkgs and home-manager at the given revisions
+func updateTestLock(nixpkgsRev, homeManagerRev string) string {
+	return `{"nodes": {
+  "nixpkgs": {"locked": {"lastModified": 1714521600, "owner": "NixOS", "repo": "nixpkgs", "rev": "` + nixpkgsRev + `", "type": "github"}},
+  "home-manager": {"locked": {"lastModified": 1714521600, "owner": "nix-community", "repo": "home-manager", "rev": "` + homeManagerRev + `", "type": "github"}},
+  "root": {"inputs": {"nixpkgs": "nixpkgs", "home-manager": "home-manager"}}
+}, "root": "root", "version": 7}`
+}
+
+func TestUpdateCommandInputs(t *testing.T) {
+	oldRev, newRev := strings.Repeat("a", 40), strings.Repeat("b", 40)
+	tests := []struct {
+		name       string
+		args       []string
+		config     string // camp.yml
+		dryRun     bool
+		wantUpdate string
+		wantLock   string
+	}{
+		{
+			name:       "updates named inputs",
+			args:       []string{"nixpkgs"},
+			wantUpdate: "flake update nixpkgs --flake ",
+			wantLock:   updateTestLock(newRev, oldRev),
+		},
+		{
+			name:       "dry run leaves flake.lock untouched",
+			args:       []string{"nixpkgs"},
+			dryRun:     true,
+			wantUpdate: "flake update nixpkgs --flake ",
+			wantLock:   updateTestLock(oldRev, oldRev),
+		},
+		{
+			name:       "updates a flake not locked yet",
+			args:       []string{"tools"},
+			config:     "flakes:\n  - name: tools\n    url: github:team/tools\n    outputs:\n      - name: packages\n        type: home\n",
+			wantUpdate: "flake update tools --flake ",
+			wantLock:   updateTestLock(newRev, oldRev),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The environment is prepared from the templates at the root of the repository
+			t.Chdir("..")
+			user := withTestHome(t)
+			if err := os.MkdirAll(user.NixDir(), 0755); err != nil {
+				t.Fatalf("Failed to create nix directory: %v", err)
+			}
+			if err := os.WriteFile(system.FlakeLockPath(user), []byte(updateTestLock(oldRev, oldRev)), 0644); err != nil {
+				t.Fatalf("Failed to write flake.lock: %v", err)
+			}
+			if tt.config != "" {
+				if err := os.WriteFile(filepath.Join(user.HomeDir, ".camp", "camp.yml"), []byte(tt.config), 0644); err != nil {
+					t.Fatalf("Failed to write config: %v", err)
+				}
+				if err := user.Reload(); err != nil {
+					t.Fatalf("Reload() failed: %v", err)
+				}
+			}
+			originalDryRun := updateDryRun
+			updateDryRun = tt.dryRun
+			t.Cleanup(func() { updateDryRun = originalDryRun })
+
+			// Nix updates the lock file of the flake it is given
+			fake := withFakeRunner(t)
+			fake.Respond = func(command utils.Command) (string, error) {
+				flakeDir := command.Args[len(command.Args)-1]
+				return "", os.WriteFile(filepath.Join(flakeDir, "flake.lock"), []byte(updateTestLock(newRev, oldRev)), 0644)
+			}
+
+			var output bytes.Buffer
+			cmd := &cobra.Command{RunE: updateCmd.RunE}
+			cmd.SetOut(&output)
+			cmd.SetErr(&output)
+			cmd.SetArgs(tt.args)
+
+			if err := cmd.Execute(); err != nil {
+				t.Fatalf("Execute() failed: %v\n%s", err, output.String())
+			}
+			if got := fake.Commands(); len(got) != 1 || !strings.Contains(got[0], tt.wantUpdate) {
+				t.Errorf("Expected %q to run, got %v", tt.wantUpdate, got)
+			}
+			if content, _ := os.ReadFile(system.FlakeLockPath(user)); string(content) != tt.wantLock {
+				t.Errorf("Unexpected flake.lock:\n%s", content)
+			}
+
+			// Only nixpkgs changed, with a link to the commits in between
+			outputStr := output.String()
+			if !strings.Contains(outputStr, "nixpkgs  aaaaaaa (2024-05-01)  bbbbbbb (2024-05-01)  https://github.com/NixOS/nixpkgs/compare/"+oldRev+"..."+newRev) {
+				t.Errorf("Expected a nixpkgs change in the table, got:\n%s", outputStr)
+			}
+			if strings.Contains(outputStr, "  home-manager") {
+				t.Errorf("Expected home-manager to be unchanged, got:\n%s", outputStr)
+			}
+		})
+	}
+
+	t.Run("rejects unknown inputs", func(t *testing.T) {
+		user := withTestHome(t)
+		if err := os.MkdirAll(user.NixDir(), 0755); err != nil {
+			t.Fatalf("Failed to create nix directory: %v", err)
+		}
+		if err := os.WriteFile(system.FlakeLockPath(user), []byte(updateTestLock(oldRev, oldRev)), 0644); err != nil {
+			t.Fatalf("Failed to write flake.lock: %v", err)
+		}
+		fake := withFakeRunner(t)
+
+		cmd := &cobra.Command{RunE: updateCmd.RunE}
+		cmd.SetOut(&bytes.Buffer{})
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SetArgs([]string{"nixpgks"})
+
+		err := cmd.Execute()
+		if err == nil || !strings.Contains(err.Error(), `unknown flake input "nixpgks" (inputs: home-manager, nix-darwin, nixpkgs, nixpkgs-unstable)`) {
+			t.Fatalf("Expected an unknown input error, got: %v", err)
+		}
+		if exitCode(err) != system.ExitUsage {
+			t.Errorf("Expected exit code %d, got %d", system.ExitUsage, exitCode(err))
+		}
+		if len(fake.Calls) != 0 {
+			t.Errorf("Expected nothing to run, got %v", fake.Commands())
+		}
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 )
 
@@ -114,3 +115,37 @@ func (p *Project) Info() []string {
 	}
 	return output
 }
+
+// ProjectInfo is the machine-readable description of a project
+type ProjectInfo struct {
+	Name     string        `json:"name"`
+	Path     string        `json:"path"`
+	Packages []string      `json:"packages"`
+	Commands []CommandInfo `json:"commands"`
+}
+
+// CommandInfo describes a command available through 'camp project [command]'
+type CommandInfo struct {
+	Name  string   `json:"name"`
+	Steps []string `json:"steps"` // Shell commands run in order
+}
+
+// Describe returns the project name, packages and commands, with commands sorted by name.
+func (p *Project) Describe() ProjectInfo {
+	info := ProjectInfo{
+		Name:     p.Name(),
+		Path:     p.Path,
+		Packages: p.Config.Packages,
+		Commands: []CommandInfo{},
+	}
+	if info.Packages == nil {
+		info.Packages = []string{}
+	}
+
+	names := p.CommandNames()
+	sort.Strings(names)
+	for _, name := range names {
+		info.Commands = append(info.Commands, CommandInfo{Name: name, Steps: p.Config.Shell.Scripts[name]})
+	}
+	return info
+}
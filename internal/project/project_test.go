@@ -126,4 +126,30 @@ func TestProject(t *testing.T) {
 			}
 		})
 	})
+	t.Run("Describe()", func(t *testing.T) {
+		t.Run("with packages and commands", func(t *testing.T) {
+			sc := ShellConfig{Scripts: map[string][]string{"test": {"go test ./..."}, "build": {"go build", "go vet"}}}
+			p := Project{Path: "path/to/my-project", Config: DevboxConfig{Packages: []string{"go"}, Shell: sc}}
+			expected := ProjectInfo{
+				Name:     "my-project",
+				Path:     "path/to/my-project",
+				Packages: []string{"go"},
+				Commands: []CommandInfo{
+					{Name: "build", Steps: []string{"go build", "go vet"}},
+					{Name: "test", Steps: []string{"go test ./..."}},
+				},
+			}
+			if info := p.Describe(); !reflect.DeepEqual(info, expected) {
+				t.Errorf("expected %+v, got %+v", expected, info)
+			}
+		})
+
+		t.Run("with empty config", func(t *testing.T) {
+			p := Project{Path: "path/to/my-project"}
+			info := p.Describe()
+			if info.Packages == nil || info.Commands == nil {
+				t.Errorf("expected empty lists for JSON output, got %+v", info)
+			}
+		})
+	})
 }
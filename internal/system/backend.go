@@ -0,0 +1,184 @@
+package system
+
+import (
+	"camp/internal/utils"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Backend names accepted by the `backend` setting in camp.yml
+const (
+	// BackendAuto selects a backend based on the current platform
+	BackendAuto = "auto"
+	// BackendDarwin manages the system with nix-darwin (home-manager runs as a module)
+	BackendDarwin = "darwin"
+	// BackendHomeManager manages the user environment with standalone home-manager
+	BackendHomeManager = "home-manager"
+	// BackendNixOS manages the system with nixos-rebuild (home-manager runs as a module)
+	BackendNixOS = "nixos"
+	// BackendProfile installs packages into a Nix profile, without home-manager
+	BackendProfile = "profile"
+)
+
+// systemProfile is the nix-darwin and NixOS system profile holding the generations
+const systemProfile = "/nix/var/nix/profiles/system"
+
+// runCommand executes an external command with utils.DefaultRunner.
+// Its output goes to utils.Stdout and utils.Stderr
+func runCommand(name string, args ...string) error {
+	return runCommandIn("", name, args...)
+}
+
+// runCommandIn executes an external command in the given working directory
+func runCommandIn(dir string, name string, args ...string) error {
+	_, err := utils.Run(context.Background(), utils.Command{Name: name, Args: args, Dir: dir})
+	return err
+}
+
+// runSudo executes a command as root with sudo. The command is interactive,
+// so sudo can prompt for a password on the terminal
+func runSudo(args ...string) error {
+	_, err := utils.Run(context.Background(), utils.Command{Name: "sudo", Args: args, Interactive: true})
+	return err
+}
+
+// nixLogFormat is passed to the Nix commands that build and switch
+// configurations with --log-format when set (see WithProgress)
+var nixLogFormat string
+
+// Generation represents a single activated configuration of a backend
+type Generation struct {
+	ID      int    `json:"id"`      // Generation number as reported by the backend
+	Date    string `json:"date"`    // Creation date as reported by the backend
+	Path    string `json:"path"`    // Store or profile path of the generation
+	Current bool   `json:"current"` // Whether this generation is the active one
+}
+
+// Backend knows how to turn the rendered ~/.camp/nix flake into an
+// activated environment on a specific kind of machine
+type Backend interface {
+	// Name returns the backend identifier used in camp.yml
+	Name() string
+	// Prepare copies config files and renders the flake for this backend
+	Prepare(user *User) error
+	// Build builds the configuration without activating it, leaving a
+	// result link in the state directory (see ResultLink)
+	Build(user *User) error
+	// Switch builds and activates the configuration
+	Switch(user *User) error
+	// Rollback activates the previous generation
+	Rollback(user *User) error
+	// Generations lists the generations known to the backend
+	Generations(user *User) ([]Generation, error)
+}
+
+// AvailableBackends returns the backend names that can be set in camp.yml
+func AvailableBackends() []string {
+	return []string{BackendAuto, BackendDarwin, BackendHomeManager, BackendNixOS, BackendProfile}
+}
+
+// SelectBackend returns the backend configured for the user, falling back
+// to auto-detection when no backend is configured
+func SelectBackend(user *User) (Backend, error) {
+	name, err := ResolveBackendName(user)
+	if err != nil {
+		return nil, err
+	}
+
+	switch name {
+	case BackendDarwin:
+		return &darwinBackend{}, nil
+	case BackendHomeManager:
+		return &homeManagerBackend{}, nil
+	case BackendNixOS:
+		return &nixosBackend{}, nil
+	case BackendProfile:
+		return &profileBackend{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported backend: %s", name)
+	}
+}
+
+// ResolveBackendName returns the name of the backend that will manage the
+// user's environment, resolving "auto" to the detected backend
+func ResolveBackendName(user *User) (string, error) {
+	if user.Backend == "" || user.Backend == BackendAuto {
+		return detectBackend(user)
+	}
+	return user.Backend, nil
+}
+
+// detectBackend picks the default backend for the user's platform
+func detectBackend(user *User) (string, error) {
+	switch user.Platform {
+	case "darwin":
+		return BackendDarwin, nil
+	case "linux":
+		if IsNixOS() {
+			return BackendNixOS, nil
+		}
+		return BackendHomeManager, nil
+	default:
+		return "", fmt.Errorf("unsupported platform: %s", user.Platform)
+	}
+}
+
+// nixCommandArgs prefixes nix arguments with the experimental features camp relies on
+func nixCommandArgs(args ...string) []string {
+	return append([]string{
+		"--extra-experimental-features", "nix-command",
+		"--extra-experimental-features", "flakes",
+	}, args...)
+}
+
+// withLogFormat appends --log-format to the arguments of a build or switch
+// command while its output is rendered as progress
+func withLogFormat(args ...string) []string {
+	if nixLogFormat == "" {
+		return args
+	}
+	return append(args, "--log-format", nixLogFormat)
+}
+
+// ResultLink returns the link to the output of the last build
+func ResultLink(user *User) string {
+	return filepath.Join(user.StateDir(), "result")
+}
+
+// ensureStateDir creates ~/.camp/state if needed
+func ensureStateDir(user *User) error {
+	if err := os.MkdirAll(user.StateDir(), 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	return nil
+}
+
+// ensureNixDir returns an error if ~/.camp/nix has not been prepared yet
+func ensureNixDir(user *User) error {
+	nixDir := user.NixDir()
+	if _, err := os.Stat(nixDir); os.IsNotExist(err) {
+		return fmt.Errorf("nix directory does not exist: %s", nixDir)
+	}
+	return nil
+}
+
+// previousGeneration returns the generation right before the current one
+func previousGeneration(gens []Generation) (*Generation, error) {
+	current := -1
+	for i, gen := range gens {
+		if gen.Current {
+			current = i
+		}
+	}
+	if current == -1 && len(gens) > 0 {
+		// Assume the most recent generation is active when none is marked
+		current = len(gens) - 1
+	}
+
+	if current <= 0 {
+		return nil, fmt.Errorf("no previous generation to roll back to")
+	}
+	return &gens[current-1], nil
+}
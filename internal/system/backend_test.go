@@ -0,0 +1,338 @@
+package system
+
+import (
+	"camp/internal/utils"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// stubCommands replaces utils.DefaultRunner with a FakeRunner for the duration of a test.
+// Commands are recorded in the returned runner and print or return output
+func stubCommands(t *testing.T, output string) *utils.FakeRunner {
+	t.Helper()
+	fake := &utils.FakeRunner{Output: output}
+	original := utils.DefaultRunner
+	utils.DefaultRunner = fake
+	t.Cleanup(func() { utils.DefaultRunner = original })
+	return fake
+}
+
+// newBackendTestUser creates a user with a prepared ~/.camp/nix directory
+func newBackendTestUser(t *testing.T, platform string) *User {
+	t.Helper()
+	tmpHome := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(tmpHome, ".camp", "nix"), 0755); err != nil {
+		t.Fatalf("Failed to create nix directory: %v", err)
+	}
+	return &User{
+		Name:     "testuser",
+		HostName: "testhost",
+		Platform: platform,
+		HomeDir:  tmpHome,
+	}
+}
+
+func TestSelectBackend(t *testing.T) {
+	// Make detection independent of the machine running the tests
+	withOSRelease(t, filepath.Join(t.TempDir(), "os-release"))
+
+	tests := []struct {
+		name     string
+		platform string
+		backend  string
+		want     string
+		wantErr  bool
+	}{
+		{name: "auto-detect darwin", platform: "darwin", want: BackendDarwin},
+		{name: "auto-detect linux", platform: "linux", want: BackendHomeManager},
+		{name: "explicit auto", platform: "linux", backend: BackendAuto, want: BackendHomeManager},
+		{name: "explicit home-manager on darwin", platform: "darwin", backend: BackendHomeManager, want: BackendHomeManager},
+		{name: "unsupported platform", platform: "windows", wantErr: true},
+		{name: "unknown backend", platform: "linux", backend: "unknown", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := &User{Platform: tt.platform, Backend: tt.backend}
+			backend, err := SelectBackend(user)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SelectBackend() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && backend.Name() != tt.want {
+				t.Errorf("SelectBackend() = %s, want %s", backend.Name(), tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectBackend_DetectsNixOS(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "os-release")
+	if err := os.WriteFile(path, []byte("ID=nixos\n"), 0644); err != nil {
+		t.Fatalf("Failed to write os-release: %v", err)
+	}
+	withOSRelease(t, path)
+
+	backend, err := SelectBackend(&User{Platform: "linux"})
+	if err != nil {
+		t.Fatalf("SelectBackend() failed: %v", err)
+	}
+	if backend.Name() != BackendNixOS {
+		t.Errorf("Expected nixos backend on NixOS, got %s", backend.Name())
+	}
+
+	// An explicit backend wins over detection
+	backend, err = SelectBackend(&User{Platform: "linux", Backend: BackendHomeManager})
+	if err != nil {
+		t.Fatalf("SelectBackend() failed: %v", err)
+	}
+	if backend.Name() != BackendHomeManager {
+		t.Errorf("Expected home-manager backend when configured, got %s", backend.Name())
+	}
+}
+
+func TestDarwinBackend_Commands(t *testing.T) {
+	user := newBackendTestUser(t, "darwin")
+	backend := &darwinBackend{}
+	nixDir := user.NixDir()
+
+	tests := []struct {
+		name string
+		run  func() error
+		want string
+	}{
+		{
+			name: "switch",
+			run:  func() error { return backend.Switch(user) },
+			want: "sudo nix --extra-experimental-features nix-command flakes run nix-darwin#darwin-rebuild -- switch --impure --flake " + nixDir + "#testhost",
+		},
+		{
+			name: "build",
+			run:  func() error { return backend.Build(user) },
+			want: "nix --extra-experimental-features nix-command flakes run nix-darwin#darwin-rebuild -- build --impure --flake " + nixDir + "#testhost",
+		},
+		{
+			name: "rollback",
+			run:  func() error { return backend.Rollback(user) },
+			want: "sudo nix --extra-experimental-features nix-command flakes run nix-darwin#darwin-rebuild -- --rollback",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorded := stubCommands(t, "")
+			if err := tt.run(); err != nil {
+				t.Fatalf("%s failed: %v", tt.name, err)
+			}
+			if len(recorded.Calls) != 1 {
+				t.Fatalf("Expected 1 command, got %d", len(recorded.Calls))
+			}
+			if got := recorded.Calls[0].String(); got != tt.want {
+				t.Errorf("Expected command:\n%s\ngot:\n%s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestHomeManagerBackend_Commands(t *testing.T) {
+	user := newBackendTestUser(t, "linux")
+	backend := &homeManagerBackend{}
+	nixDir := user.NixDir()
+
+	t.Run("switch", func(t *testing.T) {
+		recorded := stubCommands(t, "")
+		if err := backend.Switch(user); err != nil {
+			t.Fatalf("Switch() failed: %v", err)
+		}
+		want := "home-manager switch --impure -b backup --flake " + nixDir + "#testuser"
+		if got := recorded.Calls[0].String(); got != want {
+			t.Errorf("Expected command:\n%s\ngot:\n%s", want, got)
+		}
+	})
+
+	t.Run("build", func(t *testing.T) {
+		recorded := stubCommands(t, "")
+		if err := backend.Build(user); err != nil {
+			t.Fatalf("Build() failed: %v", err)
+		}
+		want := "home-manager build --impure --flake " + nixDir + "#testuser"
+		if got := recorded.Calls[0].String(); got != want {
+			t.Errorf("Expected command:\n%s\ngot:\n%s", want, got)
+		}
+	})
+
+	t.Run("rollback activates previous generation", func(t *testing.T) {
+		recorded := stubCommands(t, `2024-05-02 10:00 : id 2 -> /nix/store/bbb-home-manager-generation
+2024-05-01 10:00 : id 1 -> /nix/store/aaa-home-manager-generation
+`)
+		if err := backend.Rollback(user); err != nil {
+			t.Fatalf("Rollback() failed: %v", err)
+		}
+		last := recorded.Calls[len(recorded.Calls)-1].String()
+		if last != "/nix/store/aaa-home-manager-generation/activate" {
+			t.Errorf("Expected previous generation to be activated, got: %s", last)
+		}
+	})
+
+	t.Run("rollback without previous generation", func(t *testing.T) {
+		stubCommands(t, "2024-05-01 10:00 : id 1 -> /nix/store/aaa-home-manager-generation\n")
+		if err := backend.Rollback(user); err == nil {
+			t.Error("Rollback() should fail when there is no previous generation")
+		}
+	})
+}
+
+func TestNixOSBackend_Commands(t *testing.T) {
+	user := newBackendTestUser(t, "linux")
+	backend := &nixosBackend{}
+	nixDir := user.NixDir()
+
+	tests := []struct {
+		name string
+		run  func() error
+		want string
+	}{
+		{
+			name: "switch",
+			run:  func() error { return backend.Switch(user) },
+			want: "sudo nixos-rebuild switch --impure --flake " + nixDir + "#testhost",
+		},
+		{
+			name: "build",
+			run:  func() error { return backend.Build(user) },
+			want: "nixos-rebuild build --impure --flake " + nixDir + "#testhost",
+		},
+		{
+			name: "rollback",
+			run:  func() error { return backend.Rollback(user) },
+			want: "sudo nixos-rebuild switch --rollback",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorded := stubCommands(t, "")
+			if err := tt.run(); err != nil {
+				t.Fatalf("%s failed: %v", tt.name, err)
+			}
+			if got := recorded.Calls[0].String(); got != tt.want {
+				t.Errorf("Expected command:\n%s\ngot:\n%s", tt.want, got)
+			}
+		})
+	}
+
+	t.Run("generations", func(t *testing.T) {
+		recorded := stubCommands(t, "   3   2024-05-01 10:00:00   (current)\n")
+		gens, err := backend.Generations(user)
+		if err != nil {
+			t.Fatalf("Generations() failed: %v", err)
+		}
+		if recorded.Calls[0].String() != "nix-env --list-generations --profile /nix/var/nix/profiles/system" {
+			t.Errorf("Unexpected generations command: %s", recorded.Calls[0])
+		}
+		if len(gens) != 1 || gens[0].ID != 3 || !gens[0].Current {
+			t.Errorf("Unexpected generations: %+v", gens)
+		}
+	})
+}
+
+func TestBackend_BuildRunsInStateDir(t *testing.T) {
+	for _, backend := range []Backend{&darwinBackend{}, &homeManagerBackend{}, &nixosBackend{}} {
+		t.Run(backend.Name(), func(t *testing.T) {
+			user := newBackendTestUser(t, "linux")
+			recorded := stubCommands(t, "")
+
+			if err := backend.Build(user); err != nil {
+				t.Fatalf("Build() failed: %v", err)
+			}
+			if recorded.Calls[0].Dir != user.StateDir() {
+				t.Errorf("Expected build to run in %s, got %q", user.StateDir(), recorded.Calls[0].Dir)
+			}
+			if _, err := os.Stat(user.StateDir()); err != nil {
+				t.Errorf("Build() should create the state directory: %v", err)
+			}
+		})
+	}
+}
+
+func TestBackend_MissingNixDirectory(t *testing.T) {
+	stubCommands(t, "")
+	user := &User{Name: "testuser", HostName: "testhost", HomeDir: t.TempDir()}
+
+	for _, backend := range []Backend{&darwinBackend{}, &homeManagerBackend{}, &nixosBackend{}, &profileBackend{}} {
+		if err := backend.Switch(user); err == nil {
+			t.Errorf("%s Switch() should error when nix directory doesn't exist", backend.Name())
+		}
+		if err := backend.Build(user); err == nil {
+			t.Errorf("%s Build() should error when nix directory doesn't exist", backend.Name())
+		}
+	}
+}
+
+func TestParseProfileGenerations(t *testing.T) {
+	output := `   1   2024-05-01 10:00:00
+   2   2024-05-02 11:30:00   (current)
+`
+	gens := parseProfileGenerations(output, systemProfile)
+	if len(gens) != 2 {
+		t.Fatalf("Expected 2 generations, got %d", len(gens))
+	}
+
+	if gens[0].ID != 1 || gens[0].Current {
+		t.Errorf("Unexpected first generation: %+v", gens[0])
+	}
+	if gens[1].ID != 2 || !gens[1].Current || gens[1].Date != "2024-05-02 11:30:00" {
+		t.Errorf("Unexpected second generation: %+v", gens[1])
+	}
+	if gens[1].Path != "/nix/var/nix/profiles/system-2-link" {
+		t.Errorf("Unexpected generation path: %s", gens[1].Path)
+	}
+}
+
+func TestParseHomeManagerGenerations(t *testing.T) {
+	t.Run("newest is current when unmarked", func(t *testing.T) {
+		output := `2024-05-02 10:00 : id 7 -> /nix/store/bbb-home-manager-generation
+2024-05-01 10:00 : id 6 -> /nix/store/aaa-home-manager-generation
+`
+		gens := parseHomeManagerGenerations(output)
+		if len(gens) != 2 {
+			t.Fatalf("Expected 2 generations, got %d", len(gens))
+		}
+		if gens[0].ID != 6 || gens[1].ID != 7 {
+			t.Errorf("Expected generations sorted by ID, got %+v", gens)
+		}
+		if !gens[1].Current || gens[0].Current {
+			t.Errorf("Expected newest generation to be current, got %+v", gens)
+		}
+	})
+
+	t.Run("explicit current marker", func(t *testing.T) {
+		output := `2024-05-02 10:00 : id 7 -> /nix/store/bbb-home-manager-generation
+2024-05-01 10:00 : id 6 -> /nix/store/aaa-home-manager-generation (current)
+`
+		gens := parseHomeManagerGenerations(output)
+		if !gens[0].Current || gens[1].Current {
+			t.Errorf("Expected generation 6 to be current, got %+v", gens)
+		}
+	})
+
+	t.Run("empty output", func(t *testing.T) {
+		if gens := parseHomeManagerGenerations(""); len(gens) != 0 {
+			t.Errorf("Expected no generations, got %+v", gens)
+		}
+	})
+}
+
+func TestValidateBackend(t *testing.T) {
+	for _, name := range append(AvailableBackends(), "") {
+		config := &CampConfig{Backend: name}
+		if err := config.ValidateBackend(); err != nil {
+			t.Errorf("ValidateBackend() should accept '%s', got: %v", name, err)
+		}
+	}
+
+	config := &CampConfig{Backend: "nixos-rebuild"}
+	if err := config.ValidateBackend(); err == nil {
+		t.Error("ValidateBackend() should reject unknown backends")
+	}
+}
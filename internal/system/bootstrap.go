@@ -2,6 +2,7 @@ package system
 
 import (
 	"camp/internal/utils"
+	"context"
 	"fmt"
 	"io"
 	"os"
@@ -67,11 +68,14 @@ func executeInstallCommand(command string, output io.Writer) error {
 		return fmt.Errorf("empty install command")
 	}
 
-	cmd := exec.Command("sh", "-c", command)
-	cmd.Stdout = output
-	cmd.Stderr = output
-
-	return cmd.Run()
+	_, err := utils.Run(context.Background(), utils.Command{
+		Name:        "sh",
+		Args:        []string{"-c", command},
+		Stdout:      output,
+		Stderr:      output,
+		Interactive: true,
+	})
+	return err
 }
 
 // RunBootstrapWithHome runs the bootstrap process with home directory setup
@@ -97,13 +101,26 @@ func RunBootstrapWithHome(templDir utils.TemplDir, output io.Writer, dryRun bool
 		}
 	}
 
+	var err error
 	if user.Platform == "linux" {
 		fmt.Fprintf(output, "Bootstrapping Linux...\n")
-		return bootstrapLinux(campPath, templDir, user, output, dryRun)
+		err = bootstrapLinux(campPath, templDir, user, output, dryRun)
 	} else {
 		fmt.Fprintf(output, "Bootstrapping macOS...\n")
-		return bootstrapMac(campPath, templDir, user, output, dryRun)
+		err = bootstrapMac(campPath, templDir, user, output, dryRun)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Run user hooks once the environment is bootstrapped
+	if dryRun {
+		for _, hook := range user.Hooks.ForStage(HookPostBootstrap) {
+			fmt.Fprintf(output, "[DRY RUN] Would run post_bootstrap hook: %s\n", hook.Command)
+		}
+		return nil
 	}
+	return RunHooks(user, HookPostBootstrap, nil, output)
 }
 
 // bootstrapHome sets up the home directory structure
@@ -0,0 +1,69 @@
+package system
+
+import (
+	"camp/internal/utils"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// BuildResult describes the output of a backend build
+type BuildResult struct {
+	StorePath   string `json:"store_path"`   // Store path the result link points to
+	ClosureSize int64  `json:"closure_size"` // Size in bytes of the store path and all its dependencies
+}
+
+// InspectBuildResult reads the result link left by Backend.Build and
+// queries the closure size of the built store path
+func InspectBuildResult(user *User) (*BuildResult, error) {
+	storePath, err := os.Readlink(ResultLink(user))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read build result: %w", err)
+	}
+
+	output, err := utils.CommandReturn("nix", nixCommandArgs("path-info", "--closure-size", storePath)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query closure size: %w", err)
+	}
+
+	size, err := parseClosureSize(output)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BuildResult{StorePath: storePath, ClosureSize: size}, nil
+}
+
+// parseClosureSize parses the output of nix path-info --closure-size,
+// formatted as "<store path>  <size in bytes>"
+func parseClosureSize(output string) (int64, error) {
+	fields := strings.Fields(output)
+	if len(fields) < 2 {
+		return 0, fmt.Errorf("unexpected nix path-info output: %q", strings.TrimSpace(output))
+	}
+	size, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid closure size %q: %w", fields[1], err)
+	}
+	return size, nil
+}
+
+// FormatBytes renders a byte count in human readable binary units (e.g. "1.5 GiB")
+func FormatBytes(size int64) string {
+	const unit = 1024
+	abs := size
+	if abs < 0 {
+		abs = -abs
+	}
+	if abs < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	div, exp := int64(unit), 0
+	for n := abs / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
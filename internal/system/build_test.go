@@ -0,0 +1,87 @@
+package system
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestInspectBuildResult(t *testing.T) {
+	user := &User{HomeDir: t.TempDir()}
+	if err := os.MkdirAll(user.StateDir(), 0755); err != nil {
+		t.Fatalf("Failed to create state directory: %v", err)
+	}
+	storePath := "/nix/store/abc123-home-manager-generation"
+	if err := os.Symlink(storePath, ResultLink(user)); err != nil {
+		t.Fatalf("Failed to create result link: %v", err)
+	}
+
+	recorded := stubCommands(t, storePath+"\t  1610612736\n")
+
+	result, err := InspectBuildResult(user)
+	if err != nil {
+		t.Fatalf("InspectBuildResult() failed: %v", err)
+	}
+
+	if result.StorePath != storePath {
+		t.Errorf("Expected store path %s, got %s", storePath, result.StorePath)
+	}
+	if result.ClosureSize != 1610612736 {
+		t.Errorf("Expected closure size 1610612736, got %d", result.ClosureSize)
+	}
+	if !strings.HasSuffix(recorded.Calls[0].String(), "path-info --closure-size "+storePath) {
+		t.Errorf("Unexpected command: %s", recorded.Calls[0])
+	}
+}
+
+func TestInspectBuildResult_NoResult(t *testing.T) {
+	stubCommands(t, "")
+	user := &User{HomeDir: t.TempDir()}
+
+	if _, err := InspectBuildResult(user); err == nil {
+		t.Error("InspectBuildResult() should fail when there is no result link")
+	}
+}
+
+func TestParseClosureSize(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		want    int64
+		wantErr bool
+	}{
+		{name: "valid output", output: "/nix/store/abc-foo  4096\n", want: 4096},
+		{name: "missing size", output: "/nix/store/abc-foo\n", wantErr: true},
+		{name: "invalid size", output: "/nix/store/abc-foo  lots\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseClosureSize(tt.output)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseClosureSize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseClosureSize() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		size int64
+		want string
+	}{
+		{size: 512, want: "512 B"},
+		{size: 2048, want: "2.0 KiB"},
+		{size: 1610612736, want: "1.5 GiB"},
+		{size: -3145728, want: "-3.0 MiB"},
+	}
+
+	for _, tt := range tests {
+		if got := FormatBytes(tt.size); got != tt.want {
+			t.Errorf("FormatBytes(%d) = %q, want %q", tt.size, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,352 @@
+package system
+
+import (
+	"camp/internal/utils"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// NixErrorKind classifies the Nix evaluation errors camp knows how to explain
+type NixErrorKind string
+
+const (
+	// NixErrorMissingAttribute is reported for unknown packages or flake outputs
+	NixErrorMissingAttribute NixErrorKind = "missing-attribute"
+	// NixErrorUnexpectedArgument is reported when a flake output doesn't accept an argument
+	NixErrorUnexpectedArgument NixErrorKind = "unexpected-argument"
+	// NixErrorMissingArgument is reported when a flake output requires an argument camp didn't pass
+	NixErrorMissingArgument NixErrorKind = "missing-argument"
+	// NixErrorInfiniteRecursion is reported when evaluation loops on itself
+	NixErrorInfiniteRecursion NixErrorKind = "infinite-recursion"
+	// NixErrorUnknownArgument is reported when camp.yml sets an argument the flake's schema doesn't declare
+	NixErrorUnknownArgument NixErrorKind = "unknown-argument"
+	// NixErrorInvalidArgument is reported when an argument doesn't have the type declared in the flake's schema
+	NixErrorInvalidArgument NixErrorKind = "invalid-argument"
+	// NixErrorOther is any other evaluation error
+	NixErrorOther NixErrorKind = "other"
+)
+
+// NixError is an error reported by a Nix evaluation
+type NixError struct {
+	Kind    NixErrorKind `json:"kind"`
+	Subject string       `json:"subject,omitempty"` // Attribute or argument the error is about (empty if unknown)
+	Message string       `json:"message"`           // The "error: ..." line reported by Nix
+}
+
+// ConfigIssue is a Nix error attributed to an entry of camp.yml
+type ConfigIssue struct {
+	Line  int      `json:"line,omitempty"`  // Line of the entry in camp.yml (0 if the error couldn't be attributed)
+	Entry string   `json:"entry,omitempty"` // Description of the entry (e.g. "package 'ripgrep'")
+	Error NixError `json:"error"`
+}
+
+// CheckResult is the outcome of evaluating the rendered configuration
+type CheckResult struct {
+	Attribute  string        `json:"attribute"`   // Flake attribute that was evaluated
+	ConfigPath string        `json:"config_path"` // camp.yml the issues refer to
+	Passed     bool          `json:"passed"`      // Whether the evaluation succeeded
+	Issues     []ConfigIssue `json:"issues"`      // Errors found, attributed to camp.yml entries where possible
+	Output     string        `json:"output"`      // Raw output of the evaluation
+}
+
+// nixErrorPatterns maps error shapes to their kind. The first group captures the subject
+var nixErrorPatterns = []struct {
+	kind  NixErrorKind
+	regex *regexp.Regexp
+}{
+	{NixErrorMissingAttribute, regexp.MustCompile(`attribute '([^']+)' missing`)},
+	{NixErrorMissingAttribute, regexp.MustCompile(`does not provide attribute '([^']+)'`)},
+	{NixErrorUnexpectedArgument, regexp.MustCompile(`called with unexpected argument '([^']+)'`)},
+	{NixErrorMissingArgument, regexp.MustCompile(`called without required argument '([^']+)'`)},
+	{NixErrorInfiniteRecursion, regexp.MustCompile(`infinite recursion encountered()`)},
+}
+
+// CheckEnvironment evaluates the rendered flake for the user's backend and
+// maps evaluation errors back to the entries of camp.yml that caused them.
+// The environment must have been prepared first
+func CheckEnvironment(user *User) (*CheckResult, error) {
+	if err := ensureNixDir(user); err != nil {
+		return nil, err
+	}
+
+	backend, err := ResolveBackendName(user)
+	if err != nil {
+		return nil, err
+	}
+	attribute, err := checkAttribute(user, backend)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &CheckResult{
+		Attribute:  attribute,
+		ConfigPath: ConfigPath(user.HomeDir),
+	}
+
+	flakeRef := fmt.Sprintf("%s#%s.drvPath", user.NixDir(), attribute)
+	output, err := utils.CommandCombinedOutput("nix", nixCommandArgs("eval", "--impure", "--raw", flakeRef)...)
+	result.Output = output
+	if err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return nil, fmt.Errorf("nix is not installed: %w", err)
+		}
+		nixErrors := ParseNixErrors(output)
+		if len(nixErrors) == 0 {
+			// Keep the failure visible even when Nix printed no recognizable error
+			nixErrors = []NixError{{Kind: NixErrorOther, Message: lastLine(output, err.Error())}}
+		}
+		issues, err := attributeNixErrors(nixErrors, result.ConfigPath, output)
+		if err != nil {
+			return nil, err
+		}
+		result.Issues = issues
+		return result, nil
+	}
+
+	result.Passed = true
+	return result, nil
+}
+
+// checkAttribute returns the flake attribute that builds the backend's configuration
+func checkAttribute(user *User, backend string) (string, error) {
+	switch backend {
+	case BackendDarwin:
+		return fmt.Sprintf("darwinConfigurations.%s.system", user.HostName), nil
+	case BackendHomeManager:
+		return fmt.Sprintf("homeConfigurations.%s.activationPackage", user.Name), nil
+	case BackendNixOS:
+		return fmt.Sprintf("nixosConfigurations.%s.config.system.build.toplevel", user.HostName), nil
+	case BackendProfile:
+		return fmt.Sprintf("packages.%s.%s", nixSystem(user), profilePackageName), nil
+	default:
+		return "", fmt.Errorf("unsupported backend: %s", backend)
+	}
+}
+
+// nixSystem returns the Nix system double, mirroring the logic of flake.nix
+func nixSystem(user *User) string {
+	if user.Platform == "darwin" {
+		return "aarch64-darwin"
+	}
+	if user.Architecture == "arm64" {
+		return "aarch64-linux"
+	}
+	return "x86_64-linux"
+}
+
+// ParseNixErrors extracts the errors reported in the output of a Nix command
+func ParseNixErrors(output string) []NixError {
+	var nixErrors []NixError
+	seen := make(map[string]bool)
+
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		_, message, found := strings.Cut(line, "error:")
+		message = strings.TrimSpace(message)
+		// Skip trace lines and the bare "error:" header
+		if !found || message == "" || seen[message] {
+			continue
+		}
+		seen[message] = true
+
+		nixErr := NixError{Kind: NixErrorOther, Message: message}
+		for _, pattern := range nixErrorPatterns {
+			if matches := pattern.regex.FindStringSubmatch(message); matches != nil {
+				nixErr.Kind = pattern.kind
+				nixErr.Subject = matches[1]
+				break
+			}
+		}
+		nixErrors = append(nixErrors, nixErr)
+	}
+
+	return nixErrors
+}
+
+// lastLine returns the last non-empty line of output, or fallback if there is none
+func lastLine(output, fallback string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if last := strings.TrimSpace(lines[len(lines)-1]); last != "" {
+		return last
+	}
+	return fallback
+}
+
+// configEntry is an entry of camp.yml that Nix errors can be attributed to
+type configEntry struct {
+	kind   string // "package", "flake", "output" or "arg"
+	flake  string // Flake the entry belongs to (empty for packages)
+	output string // Output an argument belongs to (empty for flake-level arguments)
+	name   string // Package, flake, output or argument name
+	line   int
+}
+
+func (e configEntry) String() string {
+	switch e.kind {
+	case "package":
+		return fmt.Sprintf("package '%s'", e.name)
+	case "output":
+		return fmt.Sprintf("flake '%s' output '%s'", e.flake, e.name)
+	case "arg":
+		if e.output != "" {
+			return fmt.Sprintf("flake '%s' output '%s' argument '%s'", e.flake, e.output, e.name)
+		}
+		return fmt.Sprintf("flake '%s' argument '%s'", e.flake, e.name)
+	default:
+		return fmt.Sprintf("flake '%s'", e.name)
+	}
+}
+
+// attributeNixErrors attributes each Nix error to the camp.yml entry that caused it
+func attributeNixErrors(nixErrors []NixError, configPath string, output string) ([]ConfigIssue, error) {
+	entries, err := indexConfigEntries(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	issues := []ConfigIssue{}
+	for _, nixErr := range nixErrors {
+		issue := ConfigIssue{Error: nixErr}
+		if entry := findConfigEntry(nixErr, entries, output); entry != nil {
+			issue.Line = entry.line
+			issue.Entry = entry.String()
+		}
+		issues = append(issues, issue)
+	}
+	return issues, nil
+}
+
+// findConfigEntry returns the entry most likely responsible for a Nix error
+func findConfigEntry(nixErr NixError, entries []configEntry, output string) *configEntry {
+	switch nixErr.Kind {
+	case NixErrorMissingAttribute:
+		// A package name or one segment of an output path that doesn't exist
+		for _, kind := range []string{"package", "output", "flake"} {
+			for i, entry := range entries {
+				if entry.kind == kind && matchesAttribute(entry.name, nixErr.Subject) {
+					return &entries[i]
+				}
+			}
+		}
+	case NixErrorUnexpectedArgument:
+		for i, entry := range entries {
+			if entry.kind == "arg" && entry.name == nixErr.Subject {
+				return &entries[i]
+			}
+		}
+	}
+
+	// Fall back to the first output or flake mentioned in the evaluation trace
+	for _, kind := range []string{"output", "flake"} {
+		for i, entry := range entries {
+			if entry.kind != kind {
+				continue
+			}
+			ref := entry.name
+			if kind == "output" {
+				ref = entry.flake + "." + entry.name
+			}
+			if strings.Contains(output, ref) {
+				return &entries[i]
+			}
+		}
+	}
+	return nil
+}
+
+// matchesAttribute reports whether a dotted attribute path refers to the attribute
+// (e.g. "python3Packages.requests" matches "requests")
+func matchesAttribute(path, attribute string) bool {
+	if path == attribute {
+		return true
+	}
+	for _, segment := range strings.Split(path, ".") {
+		if segment == attribute {
+			return true
+		}
+	}
+	// Nix may report the full missing path (e.g. "packages.x86_64-linux.foo")
+	return strings.HasSuffix(attribute, "."+path)
+}
+
+// indexConfigEntries reads camp.yml and records the line of each package,
+// flake, flake output and flake argument
+func indexConfigEntries(configPath string) ([]configEntry, error) {
+	data, err := os.ReadFile(configPath)
+	if os.IsNotExist(err) {
+		return []configEntry{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	entries := []configEntry{}
+	if len(doc.Content) == 0 {
+		return entries, nil
+	}
+
+	root := doc.Content[0]
+	if packages := mappingValue(root, "packages"); packages != nil {
+		for _, pkg := range packages.Content {
+			entries = append(entries, configEntry{kind: "package", name: pkg.Value, line: pkg.Line})
+		}
+	}
+
+	if flakes := mappingValue(root, "flakes"); flakes != nil {
+		for _, flake := range flakes.Content {
+			nameNode := mappingValue(flake, "name")
+			if nameNode == nil {
+				continue
+			}
+			flakeName := nameNode.Value
+			entries = append(entries, configEntry{kind: "flake", name: flakeName, line: nameNode.Line})
+
+			if outputs := mappingValue(flake, "outputs"); outputs != nil {
+				for _, output := range outputs.Content {
+					outputName := mappingValue(output, "name")
+					if outputName == nil {
+						continue
+					}
+					entries = append(entries, configEntry{kind: "output", flake: flakeName, name: outputName.Value, line: outputName.Line})
+					if args := mappingValue(output, "args"); args != nil {
+						for i := 0; i+1 < len(args.Content); i += 2 {
+							key := args.Content[i]
+							entries = append(entries, configEntry{kind: "arg", flake: flakeName, output: outputName.Value, name: key.Value, line: key.Line})
+						}
+					}
+				}
+			}
+
+			if args := mappingValue(flake, "args"); args != nil {
+				for i := 0; i+1 < len(args.Content); i += 2 {
+					key := args.Content[i]
+					entries = append(entries, configEntry{kind: "arg", flake: flakeName, name: key.Value, line: key.Line})
+				}
+			}
+		}
+	}
+
+	return entries, nil
+}
+
+// mappingValue returns the value node for key in a YAML mapping node
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+package system
+
+import (
+	"camp/internal/utils"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// stubCombinedOutput makes every command return output and err for the duration of a test
+func stubCombinedOutput(t *testing.T, output string, err error) *utils.FakeRunner {
+	t.Helper()
+	fake := stubCommands(t, output)
+	fake.Err = err
+	return fake
+}
+
+const checkTestConfig = `env:
+  EDITOR: nvim
+
+packages:
+  - git
+  - ripgrepp
+  - python3Packages.requestz
+
+flakes:
+  - name: team
+    url: "github:team/config"
+    args:
+      enableDevTols: true
+    outputs:
+      - name: homeManagerModules.defualt
+        type: home
+`
+
+// writeCheckTestConfig writes camp.yml into a new home directory and returns a user for it
+func writeCheckTestConfig(t *testing.T, platform string) *User {
+	t.Helper()
+	user := newBackendTestUser(t, platform)
+	configPath := filepath.Join(user.HomeDir, ".camp", "camp.yml")
+	if err := os.WriteFile(configPath, []byte(checkTestConfig), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	return user
+}
+
+func TestParseNixErrors(t *testing.T) {
+	output := `error:
+       … while evaluating the attribute 'activationPackage'
+         at /nix/store/abc-source/modules/lib/default.nix:12:3:
+
+       … while calling anonymous lambda
+
+       (stack trace truncated; use '--show-trace' to show the full trace)
+
+       error: attribute 'ripgrepp' missing
+
+       at /nix/store/def-source/modules/common.nix:20:33:
+`
+	nixErrors := ParseNixErrors(output)
+	if len(nixErrors) != 1 {
+		t.Fatalf("Expected 1 error, got %d: %+v", len(nixErrors), nixErrors)
+	}
+	if nixErrors[0].Kind != NixErrorMissingAttribute || nixErrors[0].Subject != "ripgrepp" {
+		t.Errorf("Unexpected error: %+v", nixErrors[0])
+	}
+	if nixErrors[0].Message != "attribute 'ripgrepp' missing" {
+		t.Errorf("Unexpected message: %q", nixErrors[0].Message)
+	}
+}
+
+func TestParseNixErrors_Shapes(t *testing.T) {
+	tests := []struct {
+		line    string
+		kind    NixErrorKind
+		subject string
+	}{
+		{"error: function 'anonymous lambda' called with unexpected argument 'enableDevTols'", NixErrorUnexpectedArgument, "enableDevTols"},
+		{"error: function 'anonymous lambda' called without required argument 'teamName'", NixErrorMissingArgument, "teamName"},
+		{"error: infinite recursion encountered", NixErrorInfiniteRecursion, ""},
+		{"error: flake 'path:/x' does not provide attribute 'packages.x86_64-linux.foo'", NixErrorMissingAttribute, "packages.x86_64-linux.foo"},
+		{"error: undefined variable 'pkgz'", NixErrorOther, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.kind), func(t *testing.T) {
+			nixErrors := ParseNixErrors(tt.line)
+			if len(nixErrors) != 1 {
+				t.Fatalf("Expected 1 error, got %d", len(nixErrors))
+			}
+			if nixErrors[0].Kind != tt.kind || nixErrors[0].Subject != tt.subject {
+				t.Errorf("Expected %s(%q), got %+v", tt.kind, tt.subject, nixErrors[0])
+			}
+		})
+	}
+}
+
+func TestIndexConfigEntries(t *testing.T) {
+	user := writeCheckTestConfig(t, "linux")
+
+	entries, err := indexConfigEntries(ConfigPath(user.HomeDir))
+	if err != nil {
+		t.Fatalf("indexConfigEntries() failed: %v", err)
+	}
+
+	expected := map[string]int{
+		"package 'git'":                                    5,
+		"package 'ripgrepp'":                               6,
+		"flake 'team'":                                     10,
+		"flake 'team' argument 'enableDevTols'":            13,
+		"flake 'team' output 'homeManagerModules.defualt'": 15,
+		"package 'python3Packages.requestz'":               7,
+	}
+	found := map[string]int{}
+	for _, entry := range entries {
+		found[entry.String()] = entry.line
+	}
+	for entry, line := range expected {
+		if found[entry] != line {
+			t.Errorf("Expected %s on line %d, got %d", entry, line, found[entry])
+		}
+	}
+}
+
+func TestAttributeNixErrors(t *testing.T) {
+	user := writeCheckTestConfig(t, "linux")
+	configPath := ConfigPath(user.HomeDir)
+
+	tests := []struct {
+		name      string
+		nixErr    NixError
+		output    string
+		wantLine  int
+		wantEntry string
+	}{
+		{
+			name:      "missing package",
+			nixErr:    NixError{Kind: NixErrorMissingAttribute, Subject: "ripgrepp"},
+			wantLine:  6,
+			wantEntry: "package 'ripgrepp'",
+		},
+		{
+			name:      "missing nested package",
+			nixErr:    NixError{Kind: NixErrorMissingAttribute, Subject: "requestz"},
+			wantLine:  7,
+			wantEntry: "package 'python3Packages.requestz'",
+		},
+		{
+			name:      "missing output",
+			nixErr:    NixError{Kind: NixErrorMissingAttribute, Subject: "defualt"},
+			wantLine:  15,
+			wantEntry: "flake 'team' output 'homeManagerModules.defualt'",
+		},
+		{
+			name:      "unexpected argument",
+			nixErr:    NixError{Kind: NixErrorUnexpectedArgument, Subject: "enableDevTols"},
+			wantLine:  13,
+			wantEntry: "flake 'team' argument 'enableDevTols'",
+		},
+		{
+			name:      "infinite recursion mentioning an output",
+			nixErr:    NixError{Kind: NixErrorInfiniteRecursion},
+			output:    "… while evaluating team.homeManagerModules.defualt",
+			wantLine:  15,
+			wantEntry: "flake 'team' output 'homeManagerModules.defualt'",
+		},
+		{
+			name:   "unattributed error",
+			nixErr: NixError{Kind: NixErrorOther, Subject: ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issues, err := attributeNixErrors([]NixError{tt.nixErr}, configPath, tt.output)
+			if err != nil {
+				t.Fatalf("attributeNixErrors() failed: %v", err)
+			}
+			if len(issues) != 1 {
+				t.Fatalf("Expected 1 issue, got %d", len(issues))
+			}
+			if issues[0].Line != tt.wantLine || issues[0].Entry != tt.wantEntry {
+				t.Errorf("Expected %s on line %d, got %s on line %d", tt.wantEntry, tt.wantLine, issues[0].Entry, issues[0].Line)
+			}
+		})
+	}
+}
+
+func TestCheckEnvironment(t *testing.T) {
+	t.Run("passing evaluation", func(t *testing.T) {
+		user := writeCheckTestConfig(t, "linux")
+		user.Backend = BackendHomeManager
+		recorded := stubCombinedOutput(t, "/nix/store/abc-home-manager-generation.drv", nil)
+
+		result, err := CheckEnvironment(user)
+		if err != nil {
+			t.Fatalf("CheckEnvironment() failed: %v", err)
+		}
+		if !result.Passed || len(result.Issues) != 0 {
+			t.Errorf("Expected check to pass, got %+v", result)
+		}
+
+		want := user.NixDir() + "#homeConfigurations.testuser.activationPackage.drvPath"
+		if !strings.HasSuffix(recorded.Calls[0].String(), "eval --impure --raw "+want) {
+			t.Errorf("Unexpected eval command: %s", recorded.Calls[0])
+		}
+	})
+
+	t.Run("failing evaluation", func(t *testing.T) {
+		user := writeCheckTestConfig(t, "darwin")
+		user.Backend = BackendDarwin
+		stubCombinedOutput(t, "error:\n       error: attribute 'ripgrepp' missing\n", errors.New("exit status 1"))
+
+		result, err := CheckEnvironment(user)
+		if err != nil {
+			t.Fatalf("CheckEnvironment() failed: %v", err)
+		}
+		if result.Passed {
+			t.Error("Expected check to fail")
+		}
+		if result.Attribute != "darwinConfigurations.testhost.system" {
+			t.Errorf("Unexpected attribute: %s", result.Attribute)
+		}
+		if len(result.Issues) != 1 || result.Issues[0].Line != 6 {
+			t.Errorf("Expected issue on line 6, got %+v", result.Issues)
+		}
+	})
+
+	t.Run("missing nix directory", func(t *testing.T) {
+		stubCombinedOutput(t, "", nil)
+		user := &User{Platform: "linux", HomeDir: t.TempDir()}
+		if _, err := CheckEnvironment(user); err == nil {
+			t.Error("CheckEnvironment() should fail when the environment isn't prepared")
+		}
+	})
+}
@@ -11,9 +11,15 @@ import (
 
 // CampConfig represents the camp.yml configuration file
 type CampConfig struct {
-	Env      map[string]string `yaml:"env"`      // Environment variables
-	Packages []string          `yaml:"packages"` // Nix packages to install
-	Flakes   []Flake           `yaml:"flakes"`   // External Nix flakes to integrate
+	Env         map[string]string `yaml:"env"`                    // Environment variables
+	Packages    []string          `yaml:"packages"`               // Nix packages to install
+	Flakes      []Flake           `yaml:"flakes"`                 // External Nix flakes to integrate
+	Backend     string            `yaml:"backend,omitempty"`      // Rebuild backend (auto, darwin, home-manager, nixos, profile)
+	Hooks       Hooks             `yaml:"hooks,omitempty"`        // Commands run around camp operations
+	Logs        LogsConfig        `yaml:"logs,omitempty"`         // Rotation of operation logs
+	LockHistory LockHistoryConfig `yaml:"lock_history,omitempty"` // Pruning of flake.lock snapshots
+	// Follows applied to every flake, e.g. nixpkgs: nixpkgs. A flake's own follows take precedence
+	DefaultFollows map[string]string `yaml:"defaultFollows,omitempty"`
 }
 
 // DefaultConfig returns a CampConfig with sensible defaults
@@ -43,7 +49,7 @@ func LoadConfig(path string) (*CampConfig, error) {
 	// Parse YAML
 	var config CampConfig
 	if err := yaml.Unmarshal(data, &config); err != nil {
-		return nil, fmt.Errorf("failed to parse config file: %w", err)
+		return nil, &ConfigError{Err: fmt.Errorf("failed to parse config file: %w", err)}
 	}
 
 	// Initialize Env map if nil
@@ -63,7 +69,7 @@ func LoadConfig(path string) (*CampConfig, error) {
 
 	// Validate configuration
 	if err := config.Validate(); err != nil {
-		return nil, fmt.Errorf("invalid configuration: %w", err)
+		return nil, &ConfigError{Err: fmt.Errorf("invalid configuration: %w", err)}
 	}
 
 	return &config, nil
@@ -101,6 +107,20 @@ func LoadUserConfig(homeDir string) (*CampConfig, error) {
 	return DefaultConfig(), nil
 }
 
+// ConfigPath returns the path of the user's camp configuration file.
+// Prefers ~/.camp/camp.yml, falls back to ~/.camp/camp.yaml if only that one exists
+func ConfigPath(homeDir string) string {
+	ymlPath := filepath.Join(homeDir, ".camp", "camp.yml")
+	yamlPath := filepath.Join(homeDir, ".camp", "camp.yaml")
+
+	if _, err := os.Stat(ymlPath); os.IsNotExist(err) {
+		if _, err := os.Stat(yamlPath); err == nil {
+			return yamlPath
+		}
+	}
+	return ymlPath
+}
+
 // Validate checks if the configuration is valid
 func (c *CampConfig) Validate() error {
 	// Validate flakes configuration
@@ -108,14 +128,55 @@ func (c *CampConfig) Validate() error {
 		return err
 	}
 
+	// Validate follows against the inputs of the rendered flake
+	if err := c.ValidateFollows(); err != nil {
+		return err
+	}
+
 	// Validate packages configuration
 	if err := c.ValidatePackages(); err != nil {
 		return err
 	}
 
+	// Validate backend configuration
+	if err := c.ValidateBackend(); err != nil {
+		return err
+	}
+
+	// Validate hooks configuration
+	if err := c.ValidateHooks(); err != nil {
+		return err
+	}
+
+	// Validate logs configuration
+	if err := c.ValidateLogs(); err != nil {
+		return err
+	}
+
+	// Validate lock history configuration
+	if err := c.ValidateLockHistory(); err != nil {
+		return err
+	}
+
 	return nil
 }
 
+// ValidateBackend validates the backend setting
+func (c *CampConfig) ValidateBackend() error {
+	if c.Backend == "" {
+		// Empty backend means auto-detection
+		return nil
+	}
+
+	for _, name := range AvailableBackends() {
+		if c.Backend == name {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("invalid backend '%s' - must be one of: %s", c.Backend, strings.Join(AvailableBackends(), ", "))
+}
+
 // ValidateFlakes validates the flakes configuration
 func (c *CampConfig) ValidateFlakes() error {
 	if c.Flakes == nil || len(c.Flakes) == 0 {
@@ -148,6 +209,11 @@ func (c *CampConfig) ValidateFlakes() error {
 			return fmt.Errorf("flake '%s' has empty URL", flake.Name)
 		}
 
+		// Validate URL is a well-formed flake reference
+		if _, err := flake.FlakeRef(); err != nil {
+			return fmt.Errorf("flake '%s' has invalid URL: %w", flake.Name, err)
+		}
+
 		// Validate outputs
 		if len(flake.Outputs) == 0 {
 			return fmt.Errorf("flake '%s' has no outputs defined - at least one output is required", flake.Name)
@@ -164,19 +230,46 @@ func (c *CampConfig) ValidateFlakes() error {
 				return fmt.Errorf("flake '%s' output '%s' has invalid type '%s' - must be 'system' or 'home'",
 					flake.Name, output.Name, output.Type)
 			}
+
+			// Plain modules are imported as-is, there is nothing to pass arguments to
+			if !output.Calls() && len(output.Args) > 0 {
+				return fmt.Errorf("flake '%s' output '%s' has args but call is false - args are only passed to outputs called with camp's arguments",
+					flake.Name, output.Name)
+			}
+
+			// Validate output conditions
+			if err := output.When.validate(fmt.Sprintf("flake '%s' output '%s'", flake.Name, output.Name)); err != nil {
+				return err
+			}
+
+			// Validate output arguments
+			if err := validateFlakeArgs(fmt.Sprintf("flake '%s' output '%s'", flake.Name, output.Name), output.Args); err != nil {
+				return err
+			}
+		}
+
+		// Validate conditions
+		if err := flake.When.validate(fmt.Sprintf("flake '%s'", flake.Name)); err != nil {
+			return err
 		}
 
 		// Validate arguments
-		if err := validateFlakeArgs(flake.Name, flake.Args); err != nil {
+		if err := validateFlakeArgs(fmt.Sprintf("flake '%s'", flake.Name), flake.Args); err != nil {
 			return err
 		}
+
+		// Flake-level arguments need an output to be passed to
+		if len(flake.Args) > 0 && !flake.callsOutputs() {
+			return fmt.Errorf("flake '%s' has args but all of its outputs have call: false - args are only passed to outputs called with camp's arguments", flake.Name)
+		}
 	}
 
 	return nil
 }
 
-// validateFlakeArgs validates the arguments for a flake
-func validateFlakeArgs(flakeName string, args map[string]interface{}) error {
+// validateFlakeArgs validates the arguments of a flake or of one of its outputs.
+// subject describes their owner in errors, e.g. "flake 'tools'"
+func validateFlakeArgs(subject string, args map[string]interface{}) error {
 	if args == nil || len(args) == 0 {
 		// Empty args is valid
 		return nil
@@ -192,21 +285,21 @@ func validateFlakeArgs(flakeName string, args map[string]interface{}) error {
 	for argName, argValue := range args {
 		// Validate arg name is not empty
 		if argName == "" {
-			return fmt.Errorf("flake '%s' has an argument with empty name", flakeName)
+			return fmt.Errorf("%s has an argument with empty name", subject)
 		}
 
 		// Validate arg name is a valid Nix identifier
 		if !isValidNixIdentifier(argName) {
-			return fmt.Errorf("flake '%s' argument '%s' has invalid name - must contain only letters, numbers, hyphens, and underscores", flakeName, argName)
+			return fmt.Errorf("%s argument '%s' has invalid name - must contain only letters, numbers, hyphens, and underscores", subject, argName)
 		}
 
 		// Check for reserved names
 		if reservedNames[argName] {
-			return fmt.Errorf("flake '%s' argument '%s' uses a reserved name - userName, hostName, and home are automatically provided", flakeName, argName)
+			return fmt.Errorf("%s argument '%s' uses a reserved name - userName, hostName, and home are automatically provided", subject, argName)
 		}
 
 		// Validate argument type is supported
-		if err := validateArgType(flakeName, argName, argValue); err != nil {
+		if err := validateArgType(subject, argName, argValue); err != nil {
 			return err
 		}
 	}
@@ -215,7 +308,7 @@ func validateFlakeArgs(flakeName string, args map[string]interface{}) error {
 }
 
 // validateArgType validates that an argument value is a supported type
-func validateArgType(flakeName, argName string, value interface{}) error {
+func validateArgType(subject, argName string, value interface{}) error {
 	switch v := value.(type) {
 	case string, bool, int, int64, float64:
 		// Supported scalar types
@@ -228,12 +321,12 @@ func validateArgType(flakeName, argName string, value interface{}) error {
 				// Supported element types
 				continue
 			default:
-				return fmt.Errorf("flake '%s' argument '%s' list element at index %d has unsupported type (only string, bool, number are supported in lists)", flakeName, argName, i)
+				return fmt.Errorf("%s argument '%s' list element at index %d has unsupported type (only string, bool, number are supported in lists)", subject, argName, i)
 			}
 		}
 		return nil
 	default:
-		return fmt.Errorf("flake '%s' argument '%s' has unsupported type - only string, bool, number, and list types are supported", flakeName, argName)
+		return fmt.Errorf("%s argument '%s' has unsupported type - only string, bool, number, and list types are supported", subject, argName)
 	}
 }
 
@@ -3,6 +3,7 @@ package system
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -783,6 +784,43 @@ func TestValidateFlakes_EmptyURL(t *testing.T) {
 	}
 }
 
+func TestValidateFlakes_InvalidURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		flake   Flake
+		wantErr string
+	}{
+		{
+			name:    "missing owner/repo",
+			flake:   Flake{URL: "github:user"},
+			wantErr: "flake 'my-flake' has invalid URL: github reference 'github:user' is missing owner/repo",
+		},
+		{
+			name:    "invalid rev hash",
+			flake:   Flake{URL: "github:user/repo", Rev: "abc123"},
+			wantErr: "flake 'my-flake' has invalid URL: invalid rev 'abc123' - must be a full 40 character commit hash",
+		},
+		{
+			name:    "unsupported type",
+			flake:   Flake{URL: "svn://example.com/repo"},
+			wantErr: "flake 'my-flake' has invalid URL: unsupported flake reference type 'svn'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.flake.Name = "my-flake"
+			tt.flake.Outputs = []FlakeOutput{{Name: "packages", Type: OutputTypeHome}}
+			config := &CampConfig{Flakes: []Flake{tt.flake}}
+
+			err := config.ValidateFlakes()
+			if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error starting with %q, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
 func TestValidateFlakes_NoOutputs(t *testing.T) {
 	config := &CampConfig{
 		Flakes: []Flake{
@@ -1643,3 +1681,109 @@ func containsMiddle(s, substr string) bool {
 	}
 	return false
 }
+
+func TestValidateFlakes_OutputCallAndArgs(t *testing.T) {
+	noCall := false
+	tests := []struct {
+		name    string
+		flake   Flake
+		wantErr string
+	}{
+		{
+			name: "plain home and system modules",
+			flake: Flake{Outputs: []FlakeOutput{
+				{Name: "homeManagerModules.default", Type: OutputTypeHome, Call: &noCall},
+				{Name: "darwinModules.default", Type: OutputTypeSystem, Call: &noCall},
+			}},
+		},
+		{
+			name: "output args override flake args",
+			flake: Flake{Args: map[string]interface{}{"fontSize": 12}, Outputs: []FlakeOutput{
+				{Name: "homeManagerModules.default", Type: OutputTypeHome, Args: map[string]interface{}{"fontSize": 16}},
+				{Name: "darwinModules.default", Type: OutputTypeSystem, Call: &noCall},
+			}},
+		},
+		{
+			name: "args on a plain module",
+			flake: Flake{Outputs: []FlakeOutput{
+				{Name: "darwinModules.default", Type: OutputTypeSystem, Call: &noCall, Args: map[string]interface{}{"fontSize": 16}},
+			}},
+			wantErr: "flake 'test-flake' output 'darwinModules.default' has args but call is false",
+		},
+		{
+			name: "flake args without called outputs",
+			flake: Flake{Args: map[string]interface{}{"fontSize": 12}, Outputs: []FlakeOutput{
+				{Name: "homeManagerModules.default", Type: OutputTypeHome, Call: &noCall},
+			}},
+			wantErr: "flake 'test-flake' has args but all of its outputs have call: false",
+		},
+		{
+			name: "reserved output arg",
+			flake: Flake{Outputs: []FlakeOutput{
+				{Name: "homeManagerModules.default", Type: OutputTypeHome, Args: map[string]interface{}{"home": "/tmp"}},
+			}},
+			wantErr: "flake 'test-flake' output 'homeManagerModules.default' argument 'home' uses a reserved name",
+		},
+		{
+			name: "unsupported output arg type",
+			flake: Flake{Outputs: []FlakeOutput{
+				{Name: "nixosModules.default", Type: OutputTypeSystem, Args: map[string]interface{}{"theme": map[string]interface{}{}}},
+			}},
+			wantErr: "flake 'test-flake' output 'nixosModules.default' argument 'theme' has unsupported type",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.flake.Name, tt.flake.URL = "test-flake", "github:user/flake"
+			config := &CampConfig{Flakes: []Flake{tt.flake}}
+
+			err := config.ValidateFlakes()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("ValidateFlakes() failed: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_WithOutputCallAndArgs(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "camp.yml")
+	content := `flakes:
+  - name: tools
+    url: github:team/tools
+    args:
+      fontSize: 12
+    outputs:
+      - name: homeManagerModules.default
+        type: home
+        args:
+          fontSize: 16
+      - name: homeManagerModules.plain
+        type: home
+        call: false
+`
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	config, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig() failed: %v", err)
+	}
+	flake := config.Flakes[0]
+	if !flake.Outputs[0].Calls() || flake.Outputs[1].Calls() {
+		t.Errorf("Expected only the second output to be imported as-is, got %+v", flake.Outputs)
+	}
+	if args := flake.OutputArgs(flake.Outputs[0]); args["fontSize"] != 16 {
+		t.Errorf("Expected the output args to override the flake args, got %+v", args)
+	}
+	if flake.Args["fontSize"] != 12 {
+		t.Errorf("Expected the flake args to be left untouched, got %+v", flake.Args)
+	}
+}
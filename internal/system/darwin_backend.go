@@ -0,0 +1,75 @@
+package system
+
+import (
+	"camp/internal/utils"
+	"fmt"
+)
+
+// darwinBackend manages macOS machines with nix-darwin
+type darwinBackend struct{}
+
+func (b *darwinBackend) Name() string {
+	return BackendDarwin
+}
+
+func (b *darwinBackend) Prepare(user *User) error {
+	return PrepareEnvironment(user)
+}
+
+func (b *darwinBackend) Build(user *User) error {
+	if err := ensureNixDir(user); err != nil {
+		return err
+	}
+	if err := ensureStateDir(user); err != nil {
+		return err
+	}
+	// darwin-rebuild build leaves ./result in the working directory
+	if err := runCommandIn(user.StateDir(), "nix", darwinRebuildArgs(withLogFormat("build", "--impure", "--flake", b.flakeRef(user))...)...); err != nil {
+		return fmt.Errorf("build command failed: %w", err)
+	}
+	return nil
+}
+
+func (b *darwinBackend) Switch(user *User) error {
+	if err := ensureNixDir(user); err != nil {
+		return err
+	}
+	// nix-darwin requires sudo for system activation
+	args := append([]string{"nix"}, darwinRebuildArgs(withLogFormat("switch", "--impure", "--flake", b.flakeRef(user))...)...)
+	if err := runSudo(args...); err != nil {
+		return fmt.Errorf("rebuild command failed: %w", err)
+	}
+	return nil
+}
+
+func (b *darwinBackend) Rollback(user *User) error {
+	args := append([]string{"nix"}, darwinRebuildArgs("--rollback")...)
+	if err := runSudo(args...); err != nil {
+		return fmt.Errorf("rollback command failed: %w", err)
+	}
+	return nil
+}
+
+func (b *darwinBackend) Generations(user *User) ([]Generation, error) {
+	output, err := utils.CommandReturn("nix", darwinRebuildArgs("--list-generations")...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list generations: %w", err)
+	}
+	return parseProfileGenerations(output, systemProfile), nil
+}
+
+// flakeRef returns the flake reference of the host's darwinConfiguration
+func (b *darwinBackend) flakeRef(user *User) string {
+	return fmt.Sprintf("%s#%s", user.NixDir(), user.HostName)
+}
+
+// darwinRebuildArgs builds the arguments to run darwin-rebuild through nix
+func darwinRebuildArgs(args ...string) []string {
+	return append([]string{
+		"--extra-experimental-features",
+		"nix-command flakes",
+		"run",
+		"nix-darwin#darwin-rebuild",
+		"--", // Separator: everything after this goes to darwin-rebuild
+	}, args...)
+}
@@ -0,0 +1,198 @@
+package system
+
+import (
+	"camp/internal/utils"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// PackageChange is a package whose versions or size differ between two closures
+type PackageChange struct {
+	Name        string   `json:"name"`
+	OldVersions []string `json:"old_versions,omitempty"` // Empty for added packages
+	NewVersions []string `json:"new_versions,omitempty"` // Empty for removed packages
+	SizeDelta   int64    `json:"size_delta"`             // Size difference in bytes
+}
+
+// ClosureDiff summarizes the package changes between two generations
+type ClosureDiff struct {
+	From             int             `json:"from"` // Generation IDs
+	To               int             `json:"to"`
+	Added            []PackageChange `json:"added"`
+	Removed          []PackageChange `json:"removed"`
+	Upgraded         []PackageChange `json:"upgraded"` // Includes downgrades and other version changes
+	FromClosureSize  int64           `json:"from_closure_size"`
+	ToClosureSize    int64           `json:"to_closure_size"`
+	ClosureSizeDelta int64           `json:"closure_size_delta"`
+}
+
+// Empty reports whether no package changed between the generations
+func (d *ClosureDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Upgraded) == 0
+}
+
+// DiffGenerations compares the closures of two generations with nix store diff-closures
+func DiffGenerations(from, to Generation) (*ClosureDiff, error) {
+	output, err := utils.CommandReturn("nix", nixCommandArgs("store", "diff-closures", from.Path, to.Path)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare generations %d and %d: %w", from.ID, to.ID, err)
+	}
+
+	diff := &ClosureDiff{From: from.ID, To: to.ID, Added: []PackageChange{}, Removed: []PackageChange{}, Upgraded: []PackageChange{}}
+	for _, change := range ParseDiffClosures(output) {
+		switch {
+		case len(change.OldVersions) == 0 && len(change.NewVersions) > 0:
+			diff.Added = append(diff.Added, change)
+		case len(change.NewVersions) == 0 && len(change.OldVersions) > 0:
+			diff.Removed = append(diff.Removed, change)
+		case len(change.OldVersions) > 0:
+			diff.Upgraded = append(diff.Upgraded, change)
+		}
+		// Size-only changes (same version, rebuilt) aren't listed
+	}
+
+	if diff.FromClosureSize, err = closureSize(from.Path); err != nil {
+		return nil, err
+	}
+	if diff.ToClosureSize, err = closureSize(to.Path); err != nil {
+		return nil, err
+	}
+	diff.ClosureSizeDelta = diff.ToClosureSize - diff.FromClosureSize
+	return diff, nil
+}
+
+// closureSize returns the size in bytes of a path and all its dependencies
+func closureSize(path string) (int64, error) {
+	output, err := utils.CommandReturn("nix", nixCommandArgs("path-info", "--closure-size", path)...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query closure size: %w", err)
+	}
+	return parseClosureSize(output)
+}
+
+var (
+	// diffClosuresRegex matches lines like "firefox: 120.0 → 121.0, +3.2 MiB"
+	diffClosuresRegex = regexp.MustCompile(`^(\S+): (?:(.*?) → (.*?))?(?:, )?([+-][\d.]+ \S+)?$`)
+	// ansiRegex matches terminal color codes
+	ansiRegex = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+)
+
+// ParseDiffClosures parses the output of nix store diff-closures. Added and
+// removed packages have "∅" as their old or new version
+func ParseDiffClosures(output string) []PackageChange {
+	var changes []PackageChange
+	for _, line := range strings.Split(ansiRegex.ReplaceAllString(output, ""), "\n") {
+		matches := diffClosuresRegex.FindStringSubmatch(strings.TrimSpace(line))
+		if matches == nil || (matches[2] == "" && matches[4] == "") {
+			continue
+		}
+		changes = append(changes, PackageChange{
+			Name:        matches[1],
+			OldVersions: parseVersions(matches[2]),
+			NewVersions: parseVersions(matches[3]),
+			SizeDelta:   parseSizeDelta(matches[4]),
+		})
+	}
+	return changes
+}
+
+// parseVersions splits a comma separated version list, where "∅" means absent
+func parseVersions(field string) []string {
+	var versions []string
+	for _, version := range strings.Split(field, ",") {
+		version = strings.TrimSpace(version)
+		if version != "" && version != "∅" && version != "ε" {
+			versions = append(versions, version)
+		}
+	}
+	return versions
+}
+
+// parseSizeDelta parses sizes like "+3.2 MiB" into bytes
+func parseSizeDelta(field string) int64 {
+	fields := strings.Fields(field)
+	if len(fields) != 2 {
+		return 0
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0
+	}
+	multiplier := map[string]float64{
+		"B":   1,
+		"KiB": 1 << 10,
+		"MiB": 1 << 20,
+		"GiB": 1 << 30,
+		"TiB": 1 << 40,
+	}[fields[1]]
+	return int64(value * multiplier)
+}
+
+// FormatSizeDelta renders a signed byte count (e.g. "+3.2 MiB")
+func FormatSizeDelta(delta int64) string {
+	if delta < 0 {
+		return "-" + FormatBytes(-delta)
+	}
+	return "+" + FormatBytes(delta)
+}
+
+// generationDiffPath returns where the change summary of a generation is stored
+func generationDiffPath(user *User, backend string, generation int) string {
+	return filepath.Join(user.StateDir(), "diffs", backend, fmt.Sprintf("%d.json", generation))
+}
+
+// SaveGenerationDiff stores the change summary of the generation a diff leads to
+func SaveGenerationDiff(user *User, backend string, diff *ClosureDiff) error {
+	path := generationDiffPath(user, backend, diff.To)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create diffs directory: %w", err)
+	}
+	data, err := json.MarshalIndent(diff, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode change summary: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write change summary: %w", err)
+	}
+	return nil
+}
+
+// LoadGenerationDiff returns the stored change summary of a generation, or nil if there is none
+func LoadGenerationDiff(user *User, backend string, generation int) (*ClosureDiff, error) {
+	data, err := os.ReadFile(generationDiffPath(user, backend, generation))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read change summary: %w", err)
+	}
+	var diff ClosureDiff
+	if err := json.Unmarshal(data, &diff); err != nil {
+		return nil, fmt.Errorf("failed to parse change summary: %w", err)
+	}
+	return &diff, nil
+}
+
+// CurrentGeneration returns the active generation, or nil if there is none
+func CurrentGeneration(gens []Generation) *Generation {
+	for i := range gens {
+		if gens[i].Current {
+			return &gens[i]
+		}
+	}
+	return nil
+}
+
+// FindGeneration returns the generation with the given ID
+func FindGeneration(gens []Generation, id int) (*Generation, error) {
+	for i := range gens {
+		if gens[i].ID == id {
+			return &gens[i], nil
+		}
+	}
+	return nil, fmt.Errorf("generation %d not found - run 'camp env generations' to list them", id)
+}
@@ -0,0 +1,111 @@
+package system
+
+import (
+	"camp/internal/utils"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const diffClosuresOutput = `firefox: 120.0 → 121.0, +3.2 MiB
+hello: ∅ → 2.12.1, +100.0 KiB
+python3: 3.11.4, 3.12.0 → 3.12.1, -12.0 MiB
+oldtool: 1.0 → ∅, -10.0 KiB
+glibc: +2.0 KiB
+`
+
+func TestParseDiffClosures(t *testing.T) {
+	expected := []PackageChange{
+		{Name: "firefox", OldVersions: []string{"120.0"}, NewVersions: []string{"121.0"}, SizeDelta: 3355443},
+		{Name: "hello", NewVersions: []string{"2.12.1"}, SizeDelta: 102400},
+		{Name: "python3", OldVersions: []string{"3.11.4", "3.12.0"}, NewVersions: []string{"3.12.1"}, SizeDelta: -12582912},
+		{Name: "oldtool", OldVersions: []string{"1.0"}, SizeDelta: -10240},
+		{Name: "glibc", SizeDelta: 2048},
+	}
+
+	changes := ParseDiffClosures(diffClosuresOutput)
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, changes)
+	}
+}
+
+func TestParseDiffClosures_Colors(t *testing.T) {
+	changes := ParseDiffClosures("\x1b[1mfirefox\x1b[0m: \x1b[31;1m120.0\x1b[0m → \x1b[32;1m121.0\x1b[0m\n")
+	if len(changes) != 1 || changes[0].Name != "firefox" || changes[0].NewVersions[0] != "121.0" {
+		t.Errorf("Expected color codes to be ignored, got %+v", changes)
+	}
+}
+
+func TestDiffGenerations(t *testing.T) {
+	fake := stubCommands(t, "")
+	fake.Respond = func(command utils.Command) (string, error) {
+		switch command := command.String(); {
+		case strings.Contains(command, "diff-closures"):
+			return diffClosuresOutput, nil
+		case strings.HasSuffix(command, "/gen-41"):
+			return "/nix/store/abc-gen-41\t1000\n", nil
+		case strings.HasSuffix(command, "/gen-42"):
+			return "/nix/store/def-gen-42\t1500\n", nil
+		}
+		return "", errors.New("unexpected command")
+	}
+
+	diff, err := DiffGenerations(Generation{ID: 41, Path: "/profiles/gen-41"}, Generation{ID: 42, Path: "/profiles/gen-42"})
+	if err != nil {
+		t.Fatalf("DiffGenerations() failed: %v", err)
+	}
+	commands := fake.Commands()
+
+	if !strings.HasSuffix(commands[0], "store diff-closures /profiles/gen-41 /profiles/gen-42") {
+		t.Errorf("Unexpected diff command: %s", commands[0])
+	}
+	if diff.From != 41 || diff.To != 42 {
+		t.Errorf("Unexpected generations: %d → %d", diff.From, diff.To)
+	}
+	if len(diff.Upgraded) != 2 || len(diff.Added) != 1 || len(diff.Removed) != 1 {
+		t.Errorf("Expected 2 upgraded, 1 added and 1 removed package, got %+v", diff)
+	}
+	if diff.FromClosureSize != 1000 || diff.ToClosureSize != 1500 || diff.ClosureSizeDelta != 500 {
+		t.Errorf("Unexpected closure sizes: %+v", diff)
+	}
+}
+
+func TestGenerationDiffStorage(t *testing.T) {
+	user := newBackendTestUser(t, "linux")
+
+	missing, err := LoadGenerationDiff(user, "fake", 42)
+	if err != nil || missing != nil {
+		t.Fatalf("Expected no stored diff, got %+v, %v", missing, err)
+	}
+
+	diff := &ClosureDiff{From: 41, To: 42, Added: []PackageChange{{Name: "hello", NewVersions: []string{"2.12.1"}}}}
+	if err := SaveGenerationDiff(user, "fake", diff); err != nil {
+		t.Fatalf("SaveGenerationDiff() failed: %v", err)
+	}
+	loaded, err := LoadGenerationDiff(user, "fake", 42)
+	if err != nil {
+		t.Fatalf("LoadGenerationDiff() failed: %v", err)
+	}
+	if !reflect.DeepEqual(loaded, diff) {
+		t.Errorf("Expected %+v, got %+v", diff, loaded)
+	}
+
+	// Summaries are kept per backend, generation numbers aren't shared
+	if other, _ := LoadGenerationDiff(user, "other", 42); other != nil {
+		t.Errorf("Expected no diff for another backend, got %+v", other)
+	}
+}
+
+func TestFormatSizeDelta(t *testing.T) {
+	tests := map[int64]string{
+		0:        "+0 B",
+		2048:     "+2.0 KiB",
+		-3145728: "-3.0 MiB",
+	}
+	for delta, want := range tests {
+		if got := FormatSizeDelta(delta); got != want {
+			t.Errorf("FormatSizeDelta(%d) = %s, want %s", delta, got, want)
+		}
+	}
+}
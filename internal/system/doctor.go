@@ -0,0 +1,511 @@
+package system
+
+import (
+	"camp/internal/utils"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Outcomes of a health check
+const (
+	HealthPass = "pass"
+	HealthWarn = "warn"
+	HealthFail = "fail"
+)
+
+// minimumNixVersion is the oldest Nix release camp is tested with
+const minimumNixVersion = "2.18"
+
+// backupScanDepth limits how deep camp doctor looks for stale backup files in ~/.config
+const backupScanDepth = 3
+
+var (
+	// lookPath finds executables on the PATH. It can be overridden in tests
+	lookPath = exec.LookPath
+	// getenv reads environment variables. It can be overridden in tests
+	getenv = os.Getenv
+	// nixDaemonSocket is the socket of the daemon of multi-user Nix installs
+	nixDaemonSocket = "/nix/var/nix/daemon-socket/socket"
+	// nixStoreDir is the Nix store, present on any Nix install
+	nixStoreDir = "/nix/store"
+	// systemShellRCs are shell startup files outside the home directory that may hook direnv
+	systemShellRCs = []string{"/etc/bashrc", "/etc/bash.bashrc", "/etc/zshrc", "/etc/zsh/zshrc", "/etc/fish/config.fish"}
+)
+
+// HealthCheck is the outcome of one camp doctor check
+type HealthCheck struct {
+	Name       string   `json:"name"`
+	Status     string   `json:"status"` // HealthPass, HealthWarn or HealthFail
+	Message    string   `json:"message"`
+	Details    []string `json:"details,omitempty"`    // Files or values the message refers to
+	Suggestion string   `json:"suggestion,omitempty"` // How to fix the problem by hand
+	Fixable    bool     `json:"fixable,omitempty"`    // Whether camp doctor --fix can fix it
+	Fixed      bool     `json:"fixed,omitempty"`      // Whether camp doctor --fix fixed it
+}
+
+// HealthReport is the outcome of camp doctor
+type HealthReport struct {
+	Checks   []HealthCheck `json:"checks"`
+	Passed   int           `json:"passed"`
+	Warnings int           `json:"warnings"`
+	Failed   int           `json:"failed"`
+}
+
+// Healthy reports whether no check failed
+func (r *HealthReport) Healthy() bool {
+	return r.Failed == 0
+}
+
+// healthCheck is a check run by camp doctor, with the safe fix for the problems it finds
+type healthCheck struct {
+	name  string
+	check func(user *User) HealthCheck
+	fix   func(user *User) error // Only called when the check reports Fixable
+}
+
+// healthChecks are the checks of camp doctor, in the order they are reported
+var healthChecks = []healthCheck{
+	{name: "nix", check: checkNixInstalled},
+	{name: "flakes", check: checkFlakesEnabled, fix: enableFlakes},
+	{name: "daemon", check: checkNixDaemon},
+	{name: "backend", check: checkBackendTools},
+	{name: "direnv", check: checkDirenv},
+	{name: "layout", check: checkCampLayout, fix: fixCampLayout},
+	{name: "config", check: checkCampConfig},
+	{name: "scripts", check: checkBinScripts, fix: fixBinScripts},
+	{name: "backups", check: checkBackupFiles, fix: archiveBackupFiles},
+	{name: "env", check: checkEnvVars},
+}
+
+// RunDoctor runs the health checks of the user's environment. With fix set,
+// problems that can be fixed safely are fixed and checked again
+func RunDoctor(user *User, fix bool) *HealthReport {
+	report := &HealthReport{Checks: []HealthCheck{}}
+	for _, hc := range healthChecks {
+		result := hc.check(user)
+		result.Name = hc.name
+		if fix && result.Status != HealthPass && result.Fixable && hc.fix != nil {
+			if err := hc.fix(user); err != nil {
+				result.Details = append(result.Details, fmt.Sprintf("fix failed: %v", err))
+			} else {
+				result = hc.check(user)
+				result.Name = hc.name
+				result.Fixed = true
+			}
+		}
+
+		switch result.Status {
+		case HealthPass:
+			report.Passed++
+		case HealthWarn:
+			report.Warnings++
+		default:
+			report.Failed++
+		}
+		report.Checks = append(report.Checks, result)
+	}
+	return report
+}
+
+// nixVersionRegex matches the version in the output of nix --version (e.g. "nix (Nix) 2.24.10")
+var nixVersionRegex = regexp.MustCompile(`(\d+)\.(\d+)(?:\.\d+)?\S*`)
+
+// checkNixInstalled reports whether Nix is installed and recent enough
+func checkNixInstalled(user *User) HealthCheck {
+	if _, err := lookPath("nix"); err != nil {
+		return HealthCheck{
+			Status:     HealthFail,
+			Message:    "Nix is not installed",
+			Suggestion: "Run 'camp bootstrap' to install Nix",
+		}
+	}
+	output, err := utils.CommandReturn("nix", "--version")
+	if err != nil {
+		return HealthCheck{Status: HealthFail, Message: fmt.Sprintf("nix --version failed: %v", err)}
+	}
+
+	version := nixVersionRegex.FindString(output)
+	if version == "" {
+		return HealthCheck{Status: HealthWarn, Message: fmt.Sprintf("Unrecognized Nix version: %s", strings.TrimSpace(output))}
+	}
+	if versionLess(version, minimumNixVersion) {
+		return HealthCheck{
+			Status:     HealthWarn,
+			Message:    fmt.Sprintf("Nix %s is older than %s", version, minimumNixVersion),
+			Suggestion: "Upgrade Nix (see https://nix.dev/manual/nix/latest/installation/upgrading)",
+		}
+	}
+	return HealthCheck{Status: HealthPass, Message: fmt.Sprintf("Nix %s installed", version)}
+}
+
+// versionLess compares the major and minor parts of two versions
+func versionLess(version, minimum string) bool {
+	parse := func(v string) (int, int) {
+		matches := nixVersionRegex.FindStringSubmatch(v)
+		if matches == nil {
+			return 0, 0
+		}
+		major, _ := strconv.Atoi(matches[1])
+		minor, _ := strconv.Atoi(matches[2])
+		return major, minor
+	}
+	major, minor := parse(version)
+	minMajor, minMinor := parse(minimum)
+	return major < minMajor || (major == minMajor && minor < minMinor)
+}
+
+// nixConfPath returns the user's Nix configuration file
+func nixConfPath(user *User) string {
+	return filepath.Join(user.HomeDir, ".config", "nix", "nix.conf")
+}
+
+// checkFlakesEnabled reports whether flakes are enabled, which home-manager and nix-darwin need
+func checkFlakesEnabled(user *User) HealthCheck {
+	if _, err := lookPath("nix"); err != nil {
+		return HealthCheck{Status: HealthFail, Message: "Nix is not installed"}
+	}
+	output, err := utils.CommandReturn("nix", "--extra-experimental-features", "nix-command", "config", "show", "experimental-features")
+	if err != nil {
+		return HealthCheck{Status: HealthWarn, Message: fmt.Sprintf("Could not read the Nix configuration: %v", err)}
+	}
+
+	features := strings.Fields(output)
+	if slices.Contains(features, "flakes") && slices.Contains(features, "nix-command") {
+		return HealthCheck{Status: HealthPass, Message: "Flakes are enabled"}
+	}
+
+	// Only append to nix.conf files that don't configure features already
+	confData, _ := os.ReadFile(nixConfPath(user))
+	return HealthCheck{
+		Status:     HealthFail,
+		Message:    "Flakes are not enabled",
+		Suggestion: fmt.Sprintf("Add 'experimental-features = nix-command flakes' to %s", nixConfPath(user)),
+		Fixable:    !strings.Contains(string(confData), "experimental-features"),
+	}
+}
+
+// enableFlakes enables flakes in the user's Nix configuration
+func enableFlakes(user *User) error {
+	path := nixConfPath(user)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create Nix configuration directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString("\n# Added by camp doctor\nexperimental-features = nix-command flakes\n"); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// checkNixDaemon reports whether Nix is a multi-user install with a running daemon
+func checkNixDaemon(user *User) HealthCheck {
+	if _, err := os.Stat(nixDaemonSocket); err == nil {
+		conn, err := net.DialTimeout("unix", nixDaemonSocket, time.Second)
+		if err != nil {
+			return HealthCheck{
+				Status:     HealthFail,
+				Message:    "Multi-user install, but the Nix daemon is not running",
+				Suggestion: "Start it with 'sudo systemctl start nix-daemon' on Linux or 'sudo launchctl kickstart -k system/org.nixos.nix-daemon' on macOS",
+			}
+		}
+		conn.Close()
+		return HealthCheck{Status: HealthPass, Message: "Multi-user install, daemon running"}
+	}
+	if _, err := os.Stat(nixStoreDir); err == nil {
+		return HealthCheck{Status: HealthPass, Message: "Single-user install"}
+	}
+	return HealthCheck{Status: HealthFail, Message: fmt.Sprintf("No Nix store at %s", nixStoreDir)}
+}
+
+// checkBackendTools reports whether the tools of the selected backend are available
+func checkBackendTools(user *User) HealthCheck {
+	backend, err := ResolveBackendName(user)
+	if err != nil {
+		return HealthCheck{Status: HealthFail, Message: err.Error()}
+	}
+
+	var tool string
+	switch backend {
+	case BackendHomeManager:
+		tool = "home-manager"
+	case BackendNixOS:
+		tool = "nixos-rebuild"
+	case BackendDarwin:
+		tool = "darwin-rebuild"
+	default:
+		return HealthCheck{Status: HealthPass, Message: fmt.Sprintf("The %s backend only needs Nix", backend)}
+	}
+
+	if _, err := lookPath(tool); err == nil {
+		return HealthCheck{Status: HealthPass, Message: fmt.Sprintf("%s found for the %s backend", tool, backend)}
+	}
+	if backend == BackendDarwin {
+		// Rebuilds run darwin-rebuild through nix run, fetching it if needed
+		return HealthCheck{
+			Status:     HealthWarn,
+			Message:    "darwin-rebuild is not installed yet, rebuilds will fetch it",
+			Suggestion: "Run 'camp env rebuild' to activate nix-darwin",
+		}
+	}
+	return HealthCheck{
+		Status:     HealthFail,
+		Message:    fmt.Sprintf("%s is not installed, the %s backend needs it", tool, backend),
+		Suggestion: "Run 'camp bootstrap' to install it",
+	}
+}
+
+// shellRCs returns the startup files of the user's shell in the home directory
+func shellRCs(user *User) []string {
+	switch filepath.Base(getenv("SHELL")) {
+	case "zsh":
+		dir := user.HomeDir
+		if zdotdir := getenv("ZDOTDIR"); zdotdir != "" {
+			dir = zdotdir
+		}
+		return []string{filepath.Join(dir, ".zshrc")}
+	case "fish":
+		return []string{filepath.Join(user.HomeDir, ".config", "fish", "config.fish")}
+	default:
+		return []string{filepath.Join(user.HomeDir, ".bashrc"), filepath.Join(user.HomeDir, ".bash_profile")}
+	}
+}
+
+// checkDirenv reports whether direnv is installed and hooked into the shell
+func checkDirenv(user *User) HealthCheck {
+	if _, err := lookPath("direnv"); err != nil {
+		return HealthCheck{
+			Status:     HealthWarn,
+			Message:    "direnv is not installed, project environments won't load automatically",
+			Suggestion: "Add direnv to the packages in camp.yml and run 'camp env rebuild'",
+		}
+	}
+
+	for _, rc := range append(shellRCs(user), systemShellRCs...) {
+		data, err := os.ReadFile(rc)
+		if err == nil && strings.Contains(string(data), "direnv hook") {
+			return HealthCheck{Status: HealthPass, Message: fmt.Sprintf("direnv is hooked into the shell (%s)", rc)}
+		}
+	}
+	shell := filepath.Base(getenv("SHELL"))
+	if shell == "." || shell == "" {
+		shell = "bash"
+	}
+	return HealthCheck{
+		Status:     HealthWarn,
+		Message:    "direnv is installed but not hooked into the shell",
+		Suggestion: fmt.Sprintf("Add 'eval \"$(direnv hook %s)\"' to %s", shell, shellRCs(user)[0]),
+	}
+}
+
+// campDirs are the directories a bootstrapped ~/.camp contains
+func campDirs(user *User) []string {
+	campDir := filepath.Join(user.HomeDir, ".camp")
+	return []string{campDir, user.NixDir(), filepath.Join(campDir, "bin")}
+}
+
+// checkCampLayout reports missing parts of ~/.camp
+func checkCampLayout(user *User) HealthCheck {
+	var missing []string
+	for _, dir := range campDirs(user) {
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			missing = append(missing, dir)
+		}
+	}
+	if _, err := os.Stat(ConfigPath(user.HomeDir)); os.IsNotExist(err) {
+		missing = append(missing, ConfigPath(user.HomeDir))
+	}
+	if len(missing) > 0 {
+		return HealthCheck{
+			Status:     HealthFail,
+			Message:    "~/.camp is incomplete",
+			Details:    missing,
+			Suggestion: "Run 'camp bootstrap' to set it up",
+			Fixable:    true,
+		}
+	}
+
+	// The flake is rendered by the first rebuild
+	if _, err := os.Stat(filepath.Join(user.NixDir(), "flake.nix")); os.IsNotExist(err) {
+		return HealthCheck{
+			Status:     HealthWarn,
+			Message:    "~/.camp/nix has no flake.nix yet",
+			Suggestion: "Run 'camp env rebuild' to render it",
+		}
+	}
+	return HealthCheck{Status: HealthPass, Message: "~/.camp is complete"}
+}
+
+// fixCampLayout creates the missing directories of ~/.camp and a default camp.yml
+func fixCampLayout(user *User) error {
+	for _, dir := range campDirs(user) {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create %s: %w", dir, err)
+		}
+	}
+	if _, err := os.Stat(ConfigPath(user.HomeDir)); os.IsNotExist(err) {
+		return DefaultConfig().SaveConfig(ConfigPath(user.HomeDir))
+	}
+	return nil
+}
+
+// checkCampConfig reports whether camp.yml is valid
+func checkCampConfig(user *User) HealthCheck {
+	path := ConfigPath(user.HomeDir)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return HealthCheck{Status: HealthWarn, Message: "No camp.yml, using the default configuration"}
+	}
+	if _, err := LoadConfig(path); err != nil {
+		return HealthCheck{
+			Status:     HealthFail,
+			Message:    err.Error(),
+			Suggestion: "Fix camp.yml; 'camp env check' points evaluation errors to their line",
+		}
+	}
+	return HealthCheck{Status: HealthPass, Message: fmt.Sprintf("%s is valid", path)}
+}
+
+// nonExecutableScripts returns the scripts of ~/.camp/bin that can't be executed
+func nonExecutableScripts(user *User) []string {
+	dir := filepath.Join(user.HomeDir, ".camp", "bin")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var scripts []string
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		if info.Mode().Perm()&0100 == 0 {
+			scripts = append(scripts, filepath.Join(dir, entry.Name()))
+		}
+	}
+	return scripts
+}
+
+// checkBinScripts reports scripts of ~/.camp/bin that aren't executable
+func checkBinScripts(user *User) HealthCheck {
+	if scripts := nonExecutableScripts(user); len(scripts) > 0 {
+		return HealthCheck{
+			Status:     HealthFail,
+			Message:    fmt.Sprintf("%d script(s) in ~/.camp/bin are not executable", len(scripts)),
+			Details:    scripts,
+			Suggestion: "Run 'chmod +x ~/.camp/bin/*'",
+			Fixable:    true,
+		}
+	}
+	return HealthCheck{Status: HealthPass, Message: "Scripts in ~/.camp/bin are executable"}
+}
+
+// fixBinScripts makes the scripts of ~/.camp/bin executable
+func fixBinScripts(user *User) error {
+	for _, script := range nonExecutableScripts(user) {
+		if err := os.Chmod(script, 0755); err != nil {
+			return fmt.Errorf("failed to make %s executable: %w", script, err)
+		}
+	}
+	return nil
+}
+
+// BackupArchiveDir returns where camp doctor --fix moves stale backup files
+func BackupArchiveDir(user *User) string {
+	return filepath.Join(user.StateDir(), "backups")
+}
+
+// staleBackupFiles returns the files home-manager backed up before replacing
+// them (rebuilds run with -b backup), in the home directory and ~/.config
+func staleBackupFiles(user *User) []string {
+	var backups []string
+	entries, _ := os.ReadDir(user.HomeDir)
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".backup") {
+			backups = append(backups, filepath.Join(user.HomeDir, entry.Name()))
+		}
+	}
+
+	configDir := filepath.Join(user.HomeDir, ".config")
+	filepath.WalkDir(configDir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		rel, _ := filepath.Rel(configDir, path)
+		if entry.IsDir() && strings.Count(rel, string(filepath.Separator)) >= backupScanDepth-1 {
+			return filepath.SkipDir
+		}
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".backup") {
+			backups = append(backups, path)
+		}
+		return nil
+	})
+	return backups
+}
+
+// checkBackupFiles reports backup files left by home-manager, which make the
+// next rebuild fail when home-manager needs to back up the same file again
+func checkBackupFiles(user *User) HealthCheck {
+	backups := staleBackupFiles(user)
+	if len(backups) == 0 {
+		return HealthCheck{Status: HealthPass, Message: "No stale .backup files"}
+	}
+	return HealthCheck{
+		Status:     HealthWarn,
+		Message:    fmt.Sprintf("%d stale .backup file(s) left by home-manager", len(backups)),
+		Details:    backups,
+		Suggestion: fmt.Sprintf("Review and delete them, or run 'camp doctor --fix' to move them to %s", BackupArchiveDir(user)),
+		Fixable:    true,
+	}
+}
+
+// archiveBackupFiles moves stale backup files to the backup archive, keeping their path relative to home
+func archiveBackupFiles(user *User) error {
+	for _, backup := range staleBackupFiles(user) {
+		rel, err := filepath.Rel(user.HomeDir, backup)
+		if err != nil {
+			return err
+		}
+		dest := filepath.Join(BackupArchiveDir(user), rel)
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return fmt.Errorf("failed to create backup archive: %w", err)
+		}
+		if _, err := os.Stat(dest); err == nil {
+			// Don't overwrite an archived backup of the same file
+			dest = fmt.Sprintf("%s.%s", dest, time.Now().Format("20060102-150405"))
+		}
+		if err := os.Rename(backup, dest); err != nil {
+			return fmt.Errorf("failed to move %s: %w", backup, err)
+		}
+	}
+	return nil
+}
+
+// checkEnvVars reports whether USER and SHELL are set
+func checkEnvVars(user *User) HealthCheck {
+	if getenv("USER") == "" {
+		return HealthCheck{
+			Status:     HealthFail,
+			Message:    "USER is not set, home-manager can't tell whose environment to build",
+			Suggestion: "Run 'export USER=$(id -un)' or use a login shell",
+		}
+	}
+	if getenv("SHELL") == "" {
+		return HealthCheck{
+			Status:     HealthWarn,
+			Message:    "SHELL is not set",
+			Suggestion: "Use a login shell, or export SHELL to the path of your shell",
+		}
+	}
+	return HealthCheck{Status: HealthPass, Message: fmt.Sprintf("USER=%s, SHELL=%s", getenv("USER"), getenv("SHELL"))}
+}
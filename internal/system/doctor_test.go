@@ -0,0 +1,268 @@
+package system
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// stubDoctorEnv makes the doctor checks see the given executables and
+// environment variables, and no Nix install on the machine running the tests
+func stubDoctorEnv(t *testing.T, executables []string, env map[string]string) {
+	t.Helper()
+	originalLookPath, originalGetenv := lookPath, getenv
+	originalSocket, originalStore, originalRCs := nixDaemonSocket, nixStoreDir, systemShellRCs
+	lookPath = func(name string) (string, error) {
+		for _, executable := range executables {
+			if executable == name {
+				return "/usr/bin/" + name, nil
+			}
+		}
+		return "", errors.New("executable file not found in $PATH")
+	}
+	getenv = func(key string) string { return env[key] }
+	nixDaemonSocket = filepath.Join(t.TempDir(), "socket")
+	nixStoreDir = filepath.Join(t.TempDir(), "store")
+	systemShellRCs = nil
+	t.Cleanup(func() {
+		lookPath, getenv = originalLookPath, originalGetenv
+		nixDaemonSocket, nixStoreDir, systemShellRCs = originalSocket, originalStore, originalRCs
+	})
+}
+
+// newDoctorTestUser creates a user with a complete ~/.camp
+func newDoctorTestUser(t *testing.T) *User {
+	t.Helper()
+	user := &User{Name: "alice", HomeDir: t.TempDir(), Platform: "linux", Backend: BackendHomeManager}
+	if err := fixCampLayout(user); err != nil {
+		t.Fatalf("Failed to create ~/.camp: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(user.NixDir(), "flake.nix"), []byte("{ }"), 0644); err != nil {
+		t.Fatalf("Failed to write flake.nix: %v", err)
+	}
+	return user
+}
+
+func TestCheckNixInstalled(t *testing.T) {
+	tests := []struct {
+		name       string
+		installed  bool
+		version    string
+		wantStatus string
+		wantMsg    string
+	}{
+		{"not installed", false, "", HealthFail, "Nix is not installed"},
+		{"recent", true, "nix (Nix) 2.24.10\n", HealthPass, "Nix 2.24.10 installed"},
+		{"determinate", true, "nix (Determinate Nix 3.6.2) 2.29.0\n", HealthPass, "installed"},
+		{"old", true, "nix (Nix) 2.3.16\n", HealthWarn, "older than 2.18"},
+		{"unrecognized", true, "something else\n", HealthWarn, "Unrecognized Nix version"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var executables []string
+			if tt.installed {
+				executables = []string{"nix"}
+			}
+			stubDoctorEnv(t, executables, nil)
+			stubCommands(t, tt.version)
+
+			result := checkNixInstalled(&User{})
+			if result.Status != tt.wantStatus || !strings.Contains(result.Message, tt.wantMsg) {
+				t.Errorf("checkNixInstalled() = %s %q, want %s %q", result.Status, result.Message, tt.wantStatus, tt.wantMsg)
+			}
+		})
+	}
+}
+
+func TestCheckFlakesEnabled(t *testing.T) {
+	t.Run("enabled", func(t *testing.T) {
+		stubDoctorEnv(t, []string{"nix"}, nil)
+		stubCommands(t, "flakes nix-command\n")
+		if result := checkFlakesEnabled(newDoctorTestUser(t)); result.Status != HealthPass {
+			t.Errorf("Expected flakes to be enabled, got %+v", result)
+		}
+	})
+
+	t.Run("disabled is fixed in nix.conf", func(t *testing.T) {
+		stubDoctorEnv(t, []string{"nix"}, nil)
+		stubCommands(t, "\n")
+		user := newDoctorTestUser(t)
+
+		result := checkFlakesEnabled(user)
+		if result.Status != HealthFail || !result.Fixable {
+			t.Fatalf("Expected fixable failure, got %+v", result)
+		}
+		if err := enableFlakes(user); err != nil {
+			t.Fatalf("enableFlakes() failed: %v", err)
+		}
+		data, _ := os.ReadFile(nixConfPath(user))
+		if !strings.Contains(string(data), "experimental-features = nix-command flakes") {
+			t.Errorf("Expected flakes to be enabled in nix.conf, got:\n%s", data)
+		}
+	})
+
+	t.Run("existing features are not overwritten", func(t *testing.T) {
+		stubDoctorEnv(t, []string{"nix"}, nil)
+		stubCommands(t, "nix-command\n")
+		user := newDoctorTestUser(t)
+		os.MkdirAll(filepath.Dir(nixConfPath(user)), 0755)
+		os.WriteFile(nixConfPath(user), []byte("experimental-features = nix-command\n"), 0644)
+
+		if result := checkFlakesEnabled(user); result.Status != HealthFail || result.Fixable {
+			t.Errorf("Expected failure without automatic fix, got %+v", result)
+		}
+	})
+}
+
+func TestCheckNixDaemon(t *testing.T) {
+	stubDoctorEnv(t, nil, nil)
+	if result := checkNixDaemon(&User{}); result.Status != HealthFail {
+		t.Errorf("Expected failure without Nix store, got %+v", result)
+	}
+
+	os.MkdirAll(nixStoreDir, 0755)
+	if result := checkNixDaemon(&User{}); result.Status != HealthPass || result.Message != "Single-user install" {
+		t.Errorf("Expected single-user install, got %+v", result)
+	}
+
+	// A socket file nobody listens on
+	os.WriteFile(nixDaemonSocket, nil, 0644)
+	if result := checkNixDaemon(&User{}); result.Status != HealthFail || !strings.Contains(result.Message, "daemon is not running") {
+		t.Errorf("Expected stopped daemon, got %+v", result)
+	}
+}
+
+func TestCheckBackendTools(t *testing.T) {
+	tests := []struct {
+		name        string
+		backend     string
+		executables []string
+		wantStatus  string
+	}{
+		{"home-manager found", BackendHomeManager, []string{"home-manager"}, HealthPass},
+		{"home-manager missing", BackendHomeManager, nil, HealthFail},
+		{"nixos-rebuild missing", BackendNixOS, nil, HealthFail},
+		{"darwin-rebuild fetched on rebuild", BackendDarwin, nil, HealthWarn},
+		{"profile only needs nix", BackendProfile, nil, HealthPass},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubDoctorEnv(t, tt.executables, nil)
+			result := checkBackendTools(&User{Platform: "linux", Backend: tt.backend})
+			if result.Status != tt.wantStatus {
+				t.Errorf("checkBackendTools() = %+v, want status %s", result, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestCheckDirenv(t *testing.T) {
+	user := newDoctorTestUser(t)
+
+	stubDoctorEnv(t, nil, map[string]string{"SHELL": "/bin/zsh"})
+	if result := checkDirenv(user); result.Status != HealthWarn || !strings.Contains(result.Message, "not installed") {
+		t.Errorf("Expected missing direnv warning, got %+v", result)
+	}
+
+	stubDoctorEnv(t, []string{"direnv"}, map[string]string{"SHELL": "/bin/zsh"})
+	result := checkDirenv(user)
+	if result.Status != HealthWarn || !strings.Contains(result.Suggestion, `direnv hook zsh`) {
+		t.Errorf("Expected missing hook warning for zsh, got %+v", result)
+	}
+
+	os.WriteFile(filepath.Join(user.HomeDir, ".zshrc"), []byte(`eval "$(direnv hook zsh)"`), 0644)
+	if result := checkDirenv(user); result.Status != HealthPass {
+		t.Errorf("Expected hooked direnv, got %+v", result)
+	}
+}
+
+func TestCheckEnvVars(t *testing.T) {
+	tests := []struct {
+		name       string
+		env        map[string]string
+		wantStatus string
+	}{
+		{"both set", map[string]string{"USER": "alice", "SHELL": "/bin/bash"}, HealthPass},
+		{"no shell", map[string]string{"USER": "alice"}, HealthWarn},
+		{"no user", map[string]string{"SHELL": "/bin/bash"}, HealthFail},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubDoctorEnv(t, nil, tt.env)
+			if result := checkEnvVars(&User{}); result.Status != tt.wantStatus {
+				t.Errorf("checkEnvVars() = %+v, want status %s", result, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestCheckCampConfig(t *testing.T) {
+	user := newDoctorTestUser(t)
+	if result := checkCampConfig(user); result.Status != HealthPass {
+		t.Errorf("Expected default config to be valid, got %+v", result)
+	}
+
+	os.WriteFile(ConfigPath(user.HomeDir), []byte("backend: nope\n"), 0644)
+	if result := checkCampConfig(user); result.Status != HealthFail {
+		t.Errorf("Expected invalid config to fail, got %+v", result)
+	}
+}
+
+func TestRunDoctorFix(t *testing.T) {
+	stubDoctorEnv(t, []string{"nix", "home-manager"}, map[string]string{"USER": "alice", "SHELL": "/bin/bash"})
+	stubCommands(t, "nix (Nix) 2.24.10\n")
+	user := &User{Name: "alice", HomeDir: t.TempDir(), Platform: "linux", Backend: BackendHomeManager}
+
+	// A script that lost its executable bit and backups left by home-manager
+	binDir := filepath.Join(user.HomeDir, ".camp", "bin")
+	os.MkdirAll(binDir, 0755)
+	os.WriteFile(filepath.Join(binDir, "bootstrap"), []byte("#!/bin/sh\n"), 0644)
+	os.WriteFile(filepath.Join(user.HomeDir, ".bashrc.backup"), []byte("old"), 0644)
+	os.MkdirAll(filepath.Join(user.HomeDir, ".config", "git"), 0755)
+	os.WriteFile(filepath.Join(user.HomeDir, ".config", "git", "config.backup"), []byte("old"), 0644)
+
+	report := RunDoctor(user, false)
+	checks := map[string]HealthCheck{}
+	for _, check := range report.Checks {
+		checks[check.Name] = check
+	}
+	if checks["layout"].Status != HealthFail || checks["scripts"].Status != HealthFail || checks["backups"].Status != HealthWarn {
+		t.Fatalf("Expected layout, scripts and backups problems, got %+v", report.Checks)
+	}
+	if len(checks["backups"].Details) != 2 {
+		t.Errorf("Expected 2 backup files, got %v", checks["backups"].Details)
+	}
+	if report.Healthy() {
+		t.Error("Expected report to be unhealthy")
+	}
+
+	report = RunDoctor(user, true)
+	checks = map[string]HealthCheck{}
+	for _, check := range report.Checks {
+		checks[check.Name] = check
+	}
+	for _, name := range []string{"layout", "scripts", "backups"} {
+		if !checks[name].Fixed {
+			t.Errorf("Expected %s to be fixed, got %+v", name, checks[name])
+		}
+	}
+	if checks["scripts"].Status != HealthPass || checks["backups"].Status != HealthPass {
+		t.Errorf("Expected fixed checks to pass, got %+v", report.Checks)
+	}
+
+	// flake.nix is only rendered by the next rebuild
+	if checks["layout"].Status != HealthWarn {
+		t.Errorf("Expected layout warning about flake.nix, got %+v", checks["layout"])
+	}
+	if _, err := os.Stat(filepath.Join(BackupArchiveDir(user), ".config", "git", "config.backup")); err != nil {
+		t.Errorf("Expected backup to be archived: %v", err)
+	}
+	if _, err := os.Stat(ConfigPath(user.HomeDir)); err != nil {
+		t.Errorf("Expected default camp.yml to be created: %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package system
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+)
+
+// Exit codes reported by camp for each class of failure
+const (
+	ExitSuccess       = 0 // The command succeeded
+	ExitFailure       = 1 // Any failure not covered by a more specific code
+	ExitUsage         = 2 // Invalid command line flags or arguments
+	ExitConfig        = 3 // camp.yml is invalid or doesn't evaluate
+	ExitMissingTool   = 4 // A required tool (nix, home-manager, ...) isn't installed
+	ExitCommandFailed = 5 // An external command (nix, home-manager, ...) failed
+	ExitHookFailed    = 6 // A user hook from camp.yml failed
+	ExitLocked        = 7 // Another camp command holds the lock on ~/.camp
+)
+
+// ConfigError reports a camp.yml that is invalid or doesn't evaluate
+type ConfigError struct {
+	Err error
+}
+
+func (e *ConfigError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// HookError reports a failing user hook
+type HookError struct {
+	Stage   HookStage
+	Command string
+	Err     error
+}
+
+func (e *HookError) Error() string {
+	return fmt.Sprintf("%s hook '%s' failed: %v", e.Stage, e.Command, e.Err)
+}
+
+func (e *HookError) Unwrap() error {
+	return e.Err
+}
+
+// ExitCode returns the exit code camp reports for an error
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitSuccess
+	}
+
+	// Hooks run external commands too, so they're classified first
+	var hookErr *HookError
+	var configErr *ConfigError
+	var exitErr *exec.ExitError
+	var lockErr *LockError
+	switch {
+	case errors.As(err, &lockErr):
+		return ExitLocked
+	case errors.As(err, &hookErr):
+		return ExitHookFailed
+	case errors.As(err, &configErr):
+		return ExitConfig
+	case errors.Is(err, exec.ErrNotFound):
+		return ExitMissingTool
+	case errors.As(err, &exitErr):
+		return ExitCommandFailed
+	default:
+		return ExitFailure
+	}
+}
@@ -0,0 +1,47 @@
+package system
+
+// FakeBackend is a Backend that records the calls it receives instead of
+// running Nix. It lets tests exercise rebuild flows end-to-end
+type FakeBackend struct {
+	BackendName    string       // Name reported by the backend (defaults to "fake")
+	Calls          []string     // Methods called, in order
+	GenerationList []Generation // Generations returned by Generations
+
+	PrepareErr     error
+	BuildErr       error
+	SwitchErr      error
+	RollbackErr    error
+	GenerationsErr error
+}
+
+func (f *FakeBackend) Name() string {
+	if f.BackendName == "" {
+		return "fake"
+	}
+	return f.BackendName
+}
+
+func (f *FakeBackend) Prepare(user *User) error {
+	f.Calls = append(f.Calls, "prepare")
+	return f.PrepareErr
+}
+
+func (f *FakeBackend) Build(user *User) error {
+	f.Calls = append(f.Calls, "build")
+	return f.BuildErr
+}
+
+func (f *FakeBackend) Switch(user *User) error {
+	f.Calls = append(f.Calls, "switch")
+	return f.SwitchErr
+}
+
+func (f *FakeBackend) Rollback(user *User) error {
+	f.Calls = append(f.Calls, "rollback")
+	return f.RollbackErr
+}
+
+func (f *FakeBackend) Generations(user *User) ([]Generation, error) {
+	f.Calls = append(f.Calls, "generations")
+	return f.GenerationList, f.GenerationsErr
+}
@@ -0,0 +1,233 @@
+package system
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Inputs of a rebuild that make up its fingerprint
+const (
+	InputCampVersion = "camp"
+	InputBackend     = "backend"
+	InputConfig      = "camp.yml"
+	InputFlakeLock   = "flake.lock"
+	InputNixDir      = "nix"
+	// InputOverridePrefix prefixes the inputs of the checkouts of flakes under development
+	InputOverridePrefix = "override:"
+)
+
+// Fingerprint identifies the inputs of a rebuild. Two rebuilds with the same
+// fingerprint produce the same environment
+type Fingerprint struct {
+	Inputs map[string]string `json:"inputs"` // Hash of each input
+}
+
+// Sum returns a single hash of all inputs
+func (f *Fingerprint) Sum() string {
+	names := make([]string, 0, len(f.Inputs))
+	for name := range f.Inputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	hash := sha256.New()
+	for _, name := range names {
+		fmt.Fprintf(hash, "%s=%s\n", name, f.Inputs[name])
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Changed returns the names of the inputs that differ from other, sorted
+func (f *Fingerprint) Changed(other *Fingerprint) []string {
+	changed := []string{}
+	for name, value := range f.Inputs {
+		if other == nil || other.Inputs[name] != value {
+			changed = append(changed, name)
+		}
+	}
+	if other != nil {
+		for name := range other.Inputs {
+			if _, ok := f.Inputs[name]; !ok {
+				changed = append(changed, name)
+			}
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// ComputeFingerprint fingerprints the inputs of a rebuild with a backend: the
+// rendered ~/.camp/nix tree, flake.lock, camp.yml, the camp version and the
+// checkouts of flakes under development
+func ComputeFingerprint(user *User, backend string) (*Fingerprint, error) {
+	config, err := hashFile(ConfigPath(user.HomeDir))
+	if err != nil {
+		return nil, err
+	}
+	flakeLock, err := hashFile(filepath.Join(user.NixDir(), "flake.lock"))
+	if err != nil {
+		return nil, err
+	}
+	nixDir, err := hashTree(user.NixDir(), "flake.lock", false)
+	if err != nil {
+		return nil, err
+	}
+
+	fingerprint := &Fingerprint{Inputs: map[string]string{
+		InputCampVersion: Version,
+		InputBackend:     backend,
+		InputConfig:      config,
+		InputFlakeLock:   flakeLock,
+		InputNixDir:      nixDir,
+	}}
+
+	// Edits to a checkout under development change the environment too
+	for _, override := range ActiveFlakeOverrides(user) {
+		checkout, err := hashTree(override.Path, "", true)
+		if err != nil {
+			return nil, err
+		}
+		fingerprint.Inputs[InputOverridePrefix+override.Flake] = checkout
+	}
+	return fingerprint, nil
+}
+
+// hashFile returns the hash of a file's content, or an empty string if it doesn't exist
+func hashFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// hashTree returns a hash of the paths and contents of the regular files
+// under dir, skipping the top-level file named exclude, and the .git
+// directories with skipGit, for checkouts whose version control data
+// doesn't affect the rebuild
+func hashTree(dir string, exclude string, skipGit bool) (string, error) {
+	hash := sha256.New()
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if skipGit && entry.IsDir() && entry.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		// Skip directories, and links like ./result that don't affect the rebuild
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == exclude {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		// WalkDir visits files in lexical order, so the hash is stable
+		fmt.Fprintf(hash, "%s %s\n", filepath.ToSlash(rel), hex.EncodeToString(sum[:]))
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to fingerprint %s: %w", dir, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// RebuildState records the last successful switch
+type RebuildState struct {
+	Backend     string      `json:"backend"`
+	Fingerprint Fingerprint `json:"fingerprint"`
+	SwitchedAt  time.Time   `json:"switched_at"`
+}
+
+// rebuildStatePath returns where the last successful switch is recorded
+func rebuildStatePath(user *User) string {
+	return filepath.Join(user.StateDir(), "rebuild.json")
+}
+
+// LoadRebuildState returns the last successful switch, or nil if there is none
+func LoadRebuildState(user *User) (*RebuildState, error) {
+	data, err := os.ReadFile(rebuildStatePath(user))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read rebuild state: %w", err)
+	}
+	var state RebuildState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse rebuild state: %w", err)
+	}
+	return &state, nil
+}
+
+// SaveRebuildState records a successful switch with the given fingerprint
+func SaveRebuildState(user *User, backend string, fingerprint *Fingerprint) error {
+	if err := ensureStateDir(user); err != nil {
+		return err
+	}
+	state := RebuildState{Backend: backend, Fingerprint: *fingerprint, SwitchedAt: time.Now()}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode rebuild state: %w", err)
+	}
+	if err := os.WriteFile(rebuildStatePath(user), data, 0644); err != nil {
+		return fmt.Errorf("failed to write rebuild state: %w", err)
+	}
+	return nil
+}
+
+// ClearRebuildState forgets the last switch, so the next rebuild always
+// switches. Used when the active generation changes outside of a rebuild
+func ClearRebuildState(user *User) error {
+	if err := os.Remove(rebuildStatePath(user)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to clear rebuild state: %w", err)
+	}
+	return nil
+}
+
+// EnvironmentStatus reports whether the environment matches camp.yml
+type EnvironmentStatus struct {
+	Backend    string          `json:"backend"`
+	UpToDate   bool            `json:"up_to_date"`
+	LastSwitch *time.Time      `json:"last_switch,omitempty"` // Unset if camp never switched the environment
+	Changed    []string        `json:"changed"`               // Inputs changed since the last switch
+	Overrides  []FlakeOverride `json:"overrides"`             // Flakes replaced by a local checkout
+}
+
+// GetEnvironmentStatus compares the current inputs with those of the last switch
+func GetEnvironmentStatus(user *User, backend string) (*EnvironmentStatus, error) {
+	fingerprint, err := ComputeFingerprint(user, backend)
+	if err != nil {
+		return nil, err
+	}
+	state, err := LoadRebuildState(user)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &EnvironmentStatus{Backend: backend, Changed: []string{}, Overrides: ActiveFlakeOverrides(user)}
+	if state == nil {
+		return status, nil
+	}
+	status.LastSwitch = &state.SwitchedAt
+	status.Changed = fingerprint.Changed(&state.Fingerprint)
+	status.UpToDate = len(status.Changed) == 0
+	return status, nil
+}
@@ -0,0 +1,137 @@
+package system
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeNixFile writes a file into the user's ~/.camp/nix directory
+func writeNixFile(t *testing.T, user *User, name, content string) {
+	t.Helper()
+	path := filepath.Join(user.NixDir(), name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", name, err)
+	}
+}
+
+func TestComputeFingerprint(t *testing.T) {
+	user := writeCheckTestConfig(t, "linux")
+	writeNixFile(t, user, "flake.nix", "{ }")
+	writeNixFile(t, user, "flake.lock", `{"nodes": {}}`)
+	writeNixFile(t, user, "modules/home.nix", "{ }")
+
+	base, err := ComputeFingerprint(user, BackendHomeManager)
+	if err != nil {
+		t.Fatalf("ComputeFingerprint() failed: %v", err)
+	}
+
+	again, _ := ComputeFingerprint(user, BackendHomeManager)
+	if base.Sum() != again.Sum() {
+		t.Error("Expected fingerprint to be stable")
+	}
+
+	tests := []struct {
+		name    string
+		change  func(t *testing.T)
+		changed []string
+	}{
+		{"rendered file", func(t *testing.T) { writeNixFile(t, user, "modules/home.nix", "{ x = 1; }") }, []string{InputNixDir}},
+		{"new rendered file", func(t *testing.T) { writeNixFile(t, user, "nixos.nix", "{ }") }, []string{InputNixDir}},
+		{"flake.lock", func(t *testing.T) { writeNixFile(t, user, "flake.lock", `{"nodes": {"a": {}}}`) }, []string{InputFlakeLock}},
+		{"camp.yml", func(t *testing.T) {
+			os.WriteFile(ConfigPath(user.HomeDir), []byte("packages: [git]\n"), 0644)
+		}, []string{InputConfig}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before, _ := ComputeFingerprint(user, BackendHomeManager)
+			tt.change(t)
+			after, err := ComputeFingerprint(user, BackendHomeManager)
+			if err != nil {
+				t.Fatalf("ComputeFingerprint() failed: %v", err)
+			}
+			if changed := after.Changed(before); !reflect.DeepEqual(changed, tt.changed) {
+				t.Errorf("Expected %v to change, got %v", tt.changed, changed)
+			}
+			if after.Sum() == before.Sum() {
+				t.Error("Expected fingerprint sum to change")
+			}
+		})
+	}
+
+	t.Run("backend and version", func(t *testing.T) {
+		originalVersion := Version
+		t.Cleanup(func() { Version = originalVersion })
+
+		before, _ := ComputeFingerprint(user, BackendHomeManager)
+		Version = "9.9.9"
+		after, _ := ComputeFingerprint(user, BackendProfile)
+		expected := []string{InputBackend, InputCampVersion}
+		if changed := after.Changed(before); !reflect.DeepEqual(changed, expected) {
+			t.Errorf("Expected %v to change, got %v", expected, changed)
+		}
+	})
+
+	t.Run("ignores links like ./result", func(t *testing.T) {
+		before, _ := ComputeFingerprint(user, BackendHomeManager)
+		if err := os.Symlink("/nix/store/abc", filepath.Join(user.NixDir(), "result")); err != nil {
+			t.Fatalf("Failed to create link: %v", err)
+		}
+		after, _ := ComputeFingerprint(user, BackendHomeManager)
+		if before.Sum() != after.Sum() {
+			t.Error("Expected links to be ignored")
+		}
+	})
+}
+
+func TestComputeFingerprint_Unprepared(t *testing.T) {
+	user := &User{HomeDir: t.TempDir()}
+	fingerprint, err := ComputeFingerprint(user, BackendHomeManager)
+	if err != nil {
+		t.Fatalf("Expected missing files to be fingerprinted as empty, got: %v", err)
+	}
+	if fingerprint.Inputs[InputConfig] != "" || fingerprint.Inputs[InputFlakeLock] != "" {
+		t.Errorf("Expected empty hashes for missing files, got %+v", fingerprint.Inputs)
+	}
+}
+
+func TestEnvironmentStatus(t *testing.T) {
+	user := writeCheckTestConfig(t, "linux")
+	writeNixFile(t, user, "flake.nix", "{ }")
+
+	status, err := GetEnvironmentStatus(user, BackendHomeManager)
+	if err != nil {
+		t.Fatalf("GetEnvironmentStatus() failed: %v", err)
+	}
+	if status.UpToDate || status.LastSwitch != nil {
+		t.Errorf("Expected never rebuilt status, got %+v", status)
+	}
+
+	fingerprint, _ := ComputeFingerprint(user, BackendHomeManager)
+	if err := SaveRebuildState(user, BackendHomeManager, fingerprint); err != nil {
+		t.Fatalf("SaveRebuildState() failed: %v", err)
+	}
+	status, _ = GetEnvironmentStatus(user, BackendHomeManager)
+	if !status.UpToDate || status.LastSwitch == nil {
+		t.Errorf("Expected up to date status, got %+v", status)
+	}
+
+	os.WriteFile(ConfigPath(user.HomeDir), []byte("packages: [git]\n"), 0644)
+	status, _ = GetEnvironmentStatus(user, BackendHomeManager)
+	if status.UpToDate || !reflect.DeepEqual(status.Changed, []string{InputConfig}) {
+		t.Errorf("Expected camp.yml change to be reported, got %+v", status)
+	}
+
+	if err := ClearRebuildState(user); err != nil {
+		t.Fatalf("ClearRebuildState() failed: %v", err)
+	}
+	if state, _ := LoadRebuildState(user); state != nil {
+		t.Errorf("Expected rebuild state to be cleared, got %+v", state)
+	}
+}
@@ -0,0 +1,460 @@
+package system
+
+import (
+	"camp/internal/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// argSchemaFile is the file a flake ships at its root to declare the arguments its outputs take
+const argSchemaFile = "camp.args.json"
+
+// argSchemaOutput is the flake output declaring the arguments, for flakes that don't ship argSchemaFile
+const argSchemaOutput = "campArgs"
+
+// Argument types a schema can declare
+const (
+	ArgTypeString = "string"
+	ArgTypeBool   = "bool"
+	ArgTypeInt    = "int"
+	ArgTypeFloat  = "float"
+	ArgTypeList   = "list"
+)
+
+// ArgSpec declares an argument of a flake
+type ArgSpec struct {
+	Type        string      `json:"type"`
+	Default     interface{} `json:"default,omitempty"`
+	Required    bool        `json:"required,omitempty"`
+	Description string      `json:"description,omitempty"`
+}
+
+// ArgSchema maps the arguments a flake's outputs take to their declaration
+type ArgSchema map[string]ArgSpec
+
+// ArgProblem is an argument of camp.yml that doesn't match the schema of its flake
+type ArgProblem struct {
+	Kind    NixErrorKind // NixErrorUnknownArgument, NixErrorMissingArgument or NixErrorInvalidArgument
+	Arg     string
+	Message string
+}
+
+// ParseArgSchema parses and checks a schema, e.g. the content of camp.args.json:
+//
+//	{"enableDevTools": {"type": "bool", "default": false}, "gitEmail": {"type": "string", "required": true}}
+func ParseArgSchema(data []byte) (ArgSchema, error) {
+	var schema ArgSchema
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, fmt.Errorf("invalid argument schema: %w", err)
+	}
+
+	for name, spec := range schema {
+		// camp always passes userName, hostName and home itself
+		if name == "userName" || name == "hostName" || name == "home" {
+			delete(schema, name)
+			continue
+		}
+		switch spec.Type {
+		case ArgTypeString, ArgTypeBool, ArgTypeInt, ArgTypeFloat, ArgTypeList:
+		default:
+			return nil, fmt.Errorf("invalid argument schema: argument '%s' has unknown type '%s' - must be one of: string, bool, int, float, list", name, spec.Type)
+		}
+		if spec.Default == nil {
+			continue
+		}
+		// JSON numbers are decoded as float64, integer defaults are rendered as integers
+		if f, ok := spec.Default.(float64); ok && spec.Type == ArgTypeInt && f == math.Trunc(f) {
+			spec.Default = int(f)
+			schema[name] = spec
+		}
+		if !matchesArgType(spec.Default, spec.Type) {
+			return nil, fmt.Errorf("invalid argument schema: default of argument '%s' is not a %s", name, spec.Type)
+		}
+	}
+	return schema, nil
+}
+
+// matchesArgType reports whether a value of camp.yml has the type declared in a schema
+func matchesArgType(value interface{}, argType string) bool {
+	switch value.(type) {
+	case string:
+		return argType == ArgTypeString
+	case bool:
+		return argType == ArgTypeBool
+	case int, int64:
+		return argType == ArgTypeInt || argType == ArgTypeFloat
+	case float64:
+		return argType == ArgTypeFloat
+	case []interface{}:
+		return argType == ArgTypeList
+	}
+	return false
+}
+
+// describeArgType names the type of a value of camp.yml in error messages
+func describeArgType(value interface{}) string {
+	switch value.(type) {
+	case string:
+		return ArgTypeString
+	case bool:
+		return ArgTypeBool
+	case int, int64:
+		return ArgTypeInt
+	case float64:
+		return ArgTypeFloat
+	case []interface{}:
+		return ArgTypeList
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// Check compares the arguments of a flake in camp.yml with the schema, sorted by argument name
+func (s ArgSchema) Check(args map[string]interface{}) []ArgProblem {
+	var problems []ArgProblem
+
+	for _, name := range sortedKeys(args) {
+		spec, ok := s[name]
+		if !ok {
+			message := fmt.Sprintf("unknown argument '%s'", name)
+			if suggestion := s.suggest(name); suggestion != "" {
+				message += fmt.Sprintf(" - did you mean '%s'?", suggestion)
+			} else {
+				message += fmt.Sprintf(" - the flake accepts: %s", strings.Join(sortedKeys(s), ", "))
+			}
+			problems = append(problems, ArgProblem{Kind: NixErrorUnknownArgument, Arg: name, Message: message})
+			continue
+		}
+		if !matchesArgType(args[name], spec.Type) {
+			problems = append(problems, ArgProblem{
+				Kind:    NixErrorInvalidArgument,
+				Arg:     name,
+				Message: fmt.Sprintf("argument '%s' must be a %s, got a %s", name, spec.Type, describeArgType(args[name])),
+			})
+		}
+	}
+
+	for _, name := range sortedKeys(s) {
+		spec := s[name]
+		if _, ok := args[name]; ok || !spec.Required || spec.Default != nil {
+			continue
+		}
+		message := fmt.Sprintf("missing required argument '%s' (%s)", name, spec.Type)
+		if spec.Description != "" {
+			message += ": " + spec.Description
+		}
+		problems = append(problems, ArgProblem{Kind: NixErrorMissingArgument, Arg: name, Message: message})
+	}
+
+	return problems
+}
+
+// suggest returns the declared argument closest to a misspelled one, if any is close enough
+func (s ArgSchema) suggest(name string) string {
+	return closestName(name, sortedKeys(s))
+}
+
+// closestName returns the candidate closest to a misspelled name, if any is close enough
+func closestName(name string, candidates []string) string {
+	best, bestDistance := "", 0
+	for _, candidate := range candidates {
+		distance := editDistance(strings.ToLower(name), strings.ToLower(candidate))
+		if distance <= max(2, len(candidate)/4) && (best == "" || distance < bestDistance) {
+			best, bestDistance = candidate, distance
+		}
+	}
+	return best
+}
+
+// WithDefaults returns the arguments of camp.yml completed with the defaults of the schema
+func (s ArgSchema) WithDefaults(args map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(args))
+	for name, value := range args {
+		merged[name] = value
+	}
+	for name, spec := range s {
+		if _, ok := merged[name]; !ok && spec.Default != nil {
+			merged[name] = spec.Default
+		}
+	}
+	return merged
+}
+
+// FetchArgSchema fetches the argument schema published by a flake, from its
+// camp.args.json or else its campArgs output. It returns nil when the flake
+// publishes none
+func FetchArgSchema(ctx context.Context, flake Flake) (ArgSchema, error) {
+	ref, err := flake.FlakeRef()
+	if err != nil {
+		return nil, err
+	}
+	return fetchArgSchema(ctx, ref)
+}
+
+// fetchArgSchema fetches the argument schema of the flake at ref, like FetchArgSchema
+func fetchArgSchema(ctx context.Context, ref FlakeRef) (ArgSchema, error) {
+	url := ref.String()
+
+	// nix flake metadata fetches the flake and gives the store path of its source
+	result, err := utils.Run(ctx, utils.Command{
+		Name:    "nix",
+		Args:    nixCommandArgs("flake", "metadata", "--json", url),
+		Capture: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("nix flake metadata %s failed: %w", url, err)
+	}
+	var metadata struct {
+		Path string `json:"path"`
+	}
+	if err := json.Unmarshal([]byte(result.Stdout), &metadata); err != nil {
+		return nil, fmt.Errorf("failed to parse nix flake metadata output: %w", err)
+	}
+
+	if metadata.Path != "" {
+		data, err := os.ReadFile(filepath.Join(metadata.Path, ref.Dir, argSchemaFile))
+		if err == nil {
+			return ParseArgSchema(data)
+		} else if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to read %s: %w", argSchemaFile, err)
+		}
+	}
+
+	// Flakes without the file may declare their arguments as an output
+	expr := fmt.Sprintf("(builtins.getFlake %s).%s or null", strconv.Quote(url), argSchemaOutput)
+	result, err = utils.Run(ctx, utils.Command{
+		Name:    "nix",
+		Args:    nixCommandArgs("eval", "--json", "--impure", "--expr", expr),
+		Capture: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate the %s output of %s: %w", argSchemaOutput, url, err)
+	}
+	if strings.TrimSpace(result.Stdout) == "null" {
+		return nil, nil
+	}
+	return ParseArgSchema([]byte(result.Stdout))
+}
+
+// cachedArgSchema is the schema of a flake as fetched for its URL
+type cachedArgSchema struct {
+	URL    string    `json:"url"`
+	Schema ArgSchema `json:"schema"`          // nil when the flake publishes no schema
+	Error  string    `json:"error,omitempty"` // Why the last fetch failed, the schema is then the previous one
+}
+
+// argSchemaCachePath returns where the fetched argument schemas are cached
+func argSchemaCachePath(user *User) string {
+	return filepath.Join(user.StateDir(), "flake-args.json")
+}
+
+// CachedArgSchemas returns the cached schemas of the user's active flakes, by
+// flake name. Schemas fetched for another URL than the rendered one, e.g.
+// before a 'camp flake develop' override, are left out
+func CachedArgSchemas(user *User) map[string]ArgSchema {
+	cache := loadArgSchemaCache(user)
+	schemas := map[string]ArgSchema{}
+	for _, flake := range developedFlakes(user) {
+		if cached, ok := cache[flake.Name]; ok && cached.URL == flake.FlakeURL() && cached.Schema != nil {
+			schemas[flake.Name] = cached.Schema
+		}
+	}
+	return schemas
+}
+
+// ArgSchemaErrors returns why the last fetch of the schemas of the user's
+// active flakes failed, sorted by flake name
+func ArgSchemaErrors(user *User) []error {
+	cache := loadArgSchemaCache(user)
+	var errs []error
+	for _, flake := range developedFlakes(user) {
+		if cached, ok := cache[flake.Name]; ok && cached.URL == flake.FlakeURL() && cached.Error != "" {
+			errs = append(errs, fmt.Errorf("flake '%s': %s", flake.Name, cached.Error))
+		}
+	}
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+	return errs
+}
+
+// RefreshArgSchemas fetches the argument schemas of the user's active flakes
+// and caches them, by flake name, for the next renderings. Flakes are fetched
+// at the revision locked in flake.lock, the schema then matches the code the
+// rebuild evaluates; flakes not locked yet are fetched from their URL, and
+// flakes under development from their checkout. A failed fetch is recorded in
+// the cache, keeping the previous schema of the flake, and the errors are
+// returned together
+func RefreshArgSchemas(ctx context.Context, user *User) (map[string]ArgSchema, error) {
+	cache := loadArgSchemaCache(user)
+	lock, err := ReadFlakeLock(FlakeLockPath(user))
+	if err != nil {
+		// The flakes are then fetched as if they were new
+		lock = &FlakeLock{Root: "root"}
+	}
+	overrides, _ := LoadFlakeOverrides(user)
+	var errs []error
+
+	for _, flake := range developedFlakes(user) {
+		url := flake.FlakeURL()
+		ref, err := flake.FlakeRef()
+		if _, developed := overrides[flake.Name]; err == nil && !developed {
+			ref = lockedFlakeRef(lock, flake.Name, ref)
+		}
+		var schema ArgSchema
+		if err == nil {
+			schema, err = fetchArgSchema(ctx, ref)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return CachedArgSchemas(user), ctx.Err()
+			}
+			errs = append(errs, fmt.Errorf("flake '%s': %w", flake.Name, err))
+			cached := cachedArgSchema{URL: url, Error: err.Error()}
+			if previous, ok := cache[flake.Name]; ok && previous.URL == url {
+				cached.Schema = previous.Schema
+			}
+			cache[flake.Name] = cached
+			continue
+		}
+		cache[flake.Name] = cachedArgSchema{URL: url, Schema: schema}
+	}
+
+	saveArgSchemaCache(user, cache)
+	return CachedArgSchemas(user), errors.Join(errs...)
+}
+
+// lockedFlakeRef returns the reference of the revision flake.lock locks for the
+// input named name, or ref itself when the input isn't locked yet or was locked
+// for another reference, e.g. before its URL changed in camp.yml
+func lockedFlakeRef(lock *FlakeLock, name string, ref FlakeRef) FlakeRef {
+	input, ok := lock.Inputs()[name]
+	if !ok {
+		return ref
+	}
+	unlocked := ref
+	unlocked.Params = nil
+	if input.original.flakeRef().String() != unlocked.String() {
+		return ref
+	}
+
+	locked := input.locked.flakeRef()
+	if locked.Dir == "" {
+		locked.Dir = ref.Dir
+	}
+	locked.Params = ref.Params
+	return locked
+}
+
+// CheckFlakeArgs compares the arguments of the user's active flakes with their schemas,
+// attributing the problems to the lines of camp.yml
+func CheckFlakeArgs(user *User, schemas map[string]ArgSchema) ([]ConfigIssue, error) {
+	configPath := ConfigPath(user.HomeDir)
+	entries, err := indexConfigEntries(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	issues := []ConfigIssue{}
+	for _, flake := range ActiveFlakes(user) {
+		schema, ok := schemas[flake.Name]
+		if !ok {
+			continue
+		}
+		// Each called output gets the flake-level arguments overridden by its own
+		seen := make(map[string]bool)
+		for _, output := range flake.Outputs {
+			if !output.Calls() {
+				continue
+			}
+			for _, problem := range schema.Check(flake.OutputArgs(output)) {
+				if seen[problem.Message] {
+					continue
+				}
+				seen[problem.Message] = true
+				issue := ConfigIssue{Error: NixError{Kind: problem.Kind, Subject: problem.Arg, Message: problem.Message}}
+				if entry := findArgEntry(entries, flake.Name, output, problem); entry != nil {
+					issue.Line = entry.line
+					issue.Entry = entry.String()
+				}
+				issues = append(issues, issue)
+			}
+		}
+	}
+	return issues, nil
+}
+
+// findArgEntry returns the camp.yml entry an argument problem is reported on:
+// the flake for missing arguments, the argument itself for the others
+func findArgEntry(entries []configEntry, flakeName string, output FlakeOutput, problem ArgProblem) *configEntry {
+	outputName := ""
+	if _, ok := output.Args[problem.Arg]; ok {
+		outputName = output.Name
+	}
+	for i, entry := range entries {
+		if problem.Kind == NixErrorMissingArgument {
+			if entry.kind == "flake" && entry.name == flakeName {
+				return &entries[i]
+			}
+		} else if entry.kind == "arg" && entry.flake == flakeName && entry.output == outputName && entry.name == problem.Arg {
+			return &entries[i]
+		}
+	}
+	return nil
+}
+
+// loadArgSchemaCache returns the cached schemas by flake name. A missing or unreadable cache is empty
+func loadArgSchemaCache(user *User) map[string]cachedArgSchema {
+	cache := map[string]cachedArgSchema{}
+	if data, err := os.ReadFile(argSchemaCachePath(user)); err == nil {
+		json.Unmarshal(data, &cache)
+	}
+	return cache
+}
+
+// saveArgSchemaCache stores the fetched schemas. Failures to write the cache
+// are ignored, the schemas are fetched again next time
+func saveArgSchemaCache(user *User, cache map[string]cachedArgSchema) {
+	if err := ensureStateDir(user); err != nil {
+		return
+	}
+	if data, err := json.MarshalIndent(cache, "", "  "); err == nil {
+		os.WriteFile(argSchemaCachePath(user), data, 0644)
+	}
+}
+
+// sortedKeys returns the keys of a map in order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// editDistance returns the Levenshtein distance between two strings
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
@@ -0,0 +1,275 @@
+package system
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"camp/internal/utils"
+)
+
+const testArgSchema = `{
+  "enableDevTools": {"type": "bool", "default": false},
+  "gitEmail": {"type": "string", "required": true, "description": "Email of git commits"},
+  "fontSize": {"type": "int", "default": 12},
+  "languages": {"type": "list"},
+  "userName": {"type": "string", "required": true}
+}`
+
+func TestParseArgSchema(t *testing.T) {
+	schema, err := ParseArgSchema([]byte(testArgSchema))
+	if err != nil {
+		t.Fatalf("ParseArgSchema() failed: %v", err)
+	}
+	if _, ok := schema["userName"]; ok {
+		t.Error("Expected the arguments camp passes itself to be dropped")
+	}
+	if schema["fontSize"].Default != 12 {
+		t.Errorf("Expected integer default 12, got %#v", schema["fontSize"].Default)
+	}
+
+	tests := []struct {
+		name    string
+		schema  string
+		wantErr string
+	}{
+		{name: "not json", schema: "enableDevTools: bool", wantErr: "invalid argument schema"},
+		{name: "unknown type", schema: `{"theme": {"type": "enum"}}`, wantErr: "argument 'theme' has unknown type 'enum'"},
+		{name: "default of the wrong type", schema: `{"fontSize": {"type": "int", "default": "12"}}`, wantErr: "default of argument 'fontSize' is not a int"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseArgSchema([]byte(tt.schema))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestArgSchemaCheck(t *testing.T) {
+	schema, err := ParseArgSchema([]byte(testArgSchema))
+	if err != nil {
+		t.Fatalf("ParseArgSchema() failed: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		args map[string]interface{}
+		want []string
+	}{
+		{
+			name: "valid",
+			args: map[string]interface{}{"gitEmail": "me@example.com", "fontSize": 14, "languages": []interface{}{"go"}},
+		},
+		{
+			name: "misspelled",
+			args: map[string]interface{}{"gitEmail": "me@example.com", "enableDevTols": true},
+			want: []string{"unknown argument 'enableDevTols' - did you mean 'enableDevTools'?"},
+		},
+		{
+			name: "unknown without suggestion",
+			args: map[string]interface{}{"gitEmail": "me@example.com", "theme": "dark"},
+			want: []string{"unknown argument 'theme' - the flake accepts: enableDevTools, fontSize, gitEmail, languages"},
+		},
+		{
+			name: "missing and wrong type",
+			args: map[string]interface{}{"enableDevTools": "yes"},
+			want: []string{
+				"argument 'enableDevTools' must be a bool, got a string",
+				"missing required argument 'gitEmail' (string): Email of git commits",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, problem := range schema.Check(tt.args) {
+				got = append(got, problem.Message)
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("Expected problems:\n%s\ngot:\n%s", strings.Join(tt.want, "\n"), strings.Join(got, "\n"))
+			}
+		})
+	}
+}
+
+func TestFetchArgSchema(t *testing.T) {
+	source := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(source, "nix"), 0755); err != nil {
+		t.Fatalf("Failed to create flake source: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(source, "nix", argSchemaFile), []byte(testArgSchema), 0644); err != nil {
+		t.Fatalf("Failed to write schema: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		flake     Flake
+		output    string // Output of the evaluation of campArgs
+		wantArgs  int
+		wantCalls int
+	}{
+		{name: "camp.args.json", flake: Flake{URL: "github:team/tools", Dir: "nix"}, wantArgs: 4, wantCalls: 1},
+		{name: "campArgs output", flake: Flake{URL: "github:team/tools"}, output: `{"theme": {"type": "string"}}`, wantArgs: 1, wantCalls: 2},
+		{name: "no schema", flake: Flake{URL: "github:team/tools"}, output: "null", wantCalls: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := stubCommands(t, "")
+			fake.Respond = func(command utils.Command) (string, error) {
+				if strings.Contains(command.String(), "flake metadata") {
+					return `{"path": "` + source + `"}`, nil
+				}
+				return tt.output, nil
+			}
+
+			schema, err := FetchArgSchema(context.Background(), tt.flake)
+			if err != nil {
+				t.Fatalf("FetchArgSchema() failed: %v", err)
+			}
+			if len(schema) != tt.wantArgs {
+				t.Errorf("Expected %d arguments, got %+v", tt.wantArgs, schema)
+			}
+			if len(fake.Calls) != tt.wantCalls {
+				t.Errorf("Expected %d commands, got %v", tt.wantCalls, fake.Commands())
+			}
+			if tt.wantCalls == 2 && !strings.HasSuffix(fake.Calls[1].String(), `--expr (builtins.getFlake "github:team/tools").campArgs or null`) {
+				t.Errorf("Expected the campArgs output to be evaluated, got %s", fake.Calls[1].String())
+			}
+		})
+	}
+}
+
+func TestRefreshArgSchemas(t *testing.T) {
+	user := newBackendTestUser(t, "linux")
+	user.Flakes = []Flake{
+		{Name: "tools", URL: "github:team/tools", Args: map[string]interface{}{"fontSize": 14}},
+		{Name: "plain", URL: "github:team/plain"},
+	}
+	fake := stubCommands(t, "")
+	fake.Respond = func(command utils.Command) (string, error) {
+		switch {
+		case strings.Contains(command.String(), "flake metadata"):
+			return `{"path": "/nonexistent"}`, nil
+		case strings.Contains(command.String(), "team/tools"):
+			return testArgSchema, nil
+		}
+		return "null", nil
+	}
+	lock := outdatedTestLock(map[string]string{
+		"tools": `{"locked": {"lastModified": 1714521600, "owner": "team", "repo": "tools", "rev": "` + oldNixpkgsRev + `", "type": "github"}, "original": {"owner": "team", "repo": "tools", "type": "github"}}`,
+	})
+	if err := os.WriteFile(FlakeLockPath(user), []byte(lock), 0644); err != nil {
+		t.Fatalf("Failed to write flake.lock: %v", err)
+	}
+
+	schemas, err := RefreshArgSchemas(context.Background(), user)
+	if err != nil {
+		t.Fatalf("RefreshArgSchemas() failed: %v", err)
+	}
+	if len(schemas) != 1 || len(schemas["tools"]) != 4 {
+		t.Errorf("Expected the schema of tools only, got %+v", schemas)
+	}
+
+	// Locked flakes are fetched at their locked revision, new ones from their URL
+	fetched := strings.Join(fake.Commands(), "\n")
+	for _, want := range []string{"flake metadata --json github:team/tools/" + oldNixpkgsRev + "\n", "flake metadata --json github:team/plain\n"} {
+		if !strings.Contains(fetched, want) {
+			t.Errorf("Expected %q to run, got:\n%s", strings.TrimSpace(want), fetched)
+		}
+	}
+
+	// Defaults are rendered for the arguments left out of camp.yml, from the cache only
+	fake.Calls = nil
+	data := NewTemplateData(user)
+	if data.Flakes[0].Args["enableDevTools"] != false || data.Flakes[0].Args["fontSize"] != 14 {
+		t.Errorf("Expected defaults to complete the arguments, got %+v", data.Flakes[0].Args)
+	}
+	if _, ok := user.Flakes[0].Args["enableDevTools"]; ok {
+		t.Error("Expected the user's arguments to be left untouched")
+	}
+	if len(fake.Calls) != 0 {
+		t.Errorf("Expected rendering not to fetch schemas, got %v", fake.Commands())
+	}
+
+	// A failed fetch is recorded, keeping the previous schema
+	fake.Respond = func(command utils.Command) (string, error) { return "", os.ErrNotExist }
+	if _, err := RefreshArgSchemas(context.Background(), user); err == nil || !strings.Contains(err.Error(), "flake 'tools'") {
+		t.Errorf("Expected the failed fetch to be reported, got %v", err)
+	}
+	if len(CachedArgSchemas(user)["tools"]) != 4 {
+		t.Errorf("Expected the previous schema to be kept, got %+v", CachedArgSchemas(user))
+	}
+	if errs := ArgSchemaErrors(user); len(errs) != 2 || !strings.HasPrefix(errs[0].Error(), "flake 'plain': ") {
+		t.Errorf("Expected the failures to be recorded, got %v", errs)
+	}
+
+	// A new URL invalidates the cached schema
+	user.Flakes[0].Ref = "v2"
+	if len(CachedArgSchemas(user)) != 0 {
+		t.Errorf("Expected no cached schema for the new URL, got %+v", CachedArgSchemas(user))
+	}
+	// and isn't fetched at the revision locked for the previous one
+	fake.Calls = nil
+	RefreshArgSchemas(context.Background(), user)
+	if len(fake.Calls) == 0 || !strings.HasSuffix(fake.Calls[0].String(), "flake metadata --json github:team/tools/v2") {
+		t.Errorf("Expected the new URL to be fetched, got %v", fake.Commands())
+	}
+
+	// Flakes under development are fetched from their checkout
+	checkout := newFlakeCheckout(t)
+	if _, err := SetFlakeOverride(user, "tools", checkout, time.Now()); err != nil {
+		t.Fatalf("SetFlakeOverride() failed: %v", err)
+	}
+	fake.Calls = nil
+	RefreshArgSchemas(context.Background(), user)
+	if len(fake.Calls) == 0 || !strings.Contains(fake.Calls[0].String(), "flake metadata --json path:"+checkout) {
+		t.Errorf("Expected the checkout to be fetched, got %v", fake.Commands())
+	}
+}
+
+func TestCheckFlakeArgs(t *testing.T) {
+	user := newBackendTestUser(t, "linux")
+	config := `flakes:
+  - name: tools
+    url: github:team/tools
+    args:
+      enableDevTools: "yes"
+    outputs:
+      - name: homeManagerModules.default
+        type: home
+`
+	if err := os.WriteFile(ConfigPath(user.HomeDir), []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	user.Flakes = []Flake{{
+		Name:    "tools",
+		URL:     "github:team/tools",
+		Args:    map[string]interface{}{"enableDevTools": "yes"},
+		Outputs: []FlakeOutput{{Name: "homeManagerModules.default", Type: OutputTypeHome}},
+	}}
+	schema, err := ParseArgSchema([]byte(testArgSchema))
+	if err != nil {
+		t.Fatalf("ParseArgSchema() failed: %v", err)
+	}
+
+	issues, err := CheckFlakeArgs(user, map[string]ArgSchema{"tools": schema})
+	if err != nil {
+		t.Fatalf("CheckFlakeArgs() failed: %v", err)
+	}
+	if len(issues) != 2 {
+		t.Fatalf("Expected 2 issues, got %+v", issues)
+	}
+	if issues[0].Line != 5 || issues[0].Entry != "flake 'tools' argument 'enableDevTools'" || issues[0].Error.Kind != NixErrorInvalidArgument {
+		t.Errorf("Expected the wrong type on line 5, got %+v", issues[0])
+	}
+	if issues[1].Line != 2 || issues[1].Entry != "flake 'tools'" || issues[1].Error.Kind != NixErrorMissingArgument {
+		t.Errorf("Expected the missing argument on the flake's line, got %+v", issues[1])
+	}
+}
@@ -0,0 +1,132 @@
+package system
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// FlakeCondition restricts a flake or an output to some machines. Every field
+// that is set must match
+type FlakeCondition struct {
+	Platform string `yaml:"platform,omitempty" json:"platform,omitempty"` // darwin or linux
+	Arch     string `yaml:"arch,omitempty" json:"arch,omitempty"`         // amd64 or arm64 (x86_64 and aarch64 are accepted too)
+	HostName string `yaml:"hostname,omitempty" json:"hostname,omitempty"` // Glob matched against the hostname, e.g. "work-*"
+}
+
+// FlakeStatus tells whether a flake or an output applies to the current machine, and why
+type FlakeStatus struct {
+	Active bool   `json:"active"`
+	Reason string `json:"reason"`
+}
+
+// archAliases maps the architecture names of uname to those of camp
+var archAliases = map[string]string{
+	"x86_64":  "amd64",
+	"aarch64": "arm64",
+}
+
+// normalizeArch returns the camp name of an architecture
+func normalizeArch(arch string) string {
+	if alias, ok := archAliases[arch]; ok {
+		return alias
+	}
+	return arch
+}
+
+// validate checks the values of a condition. subject describes its owner in errors, e.g. "flake 'tools'"
+func (c *FlakeCondition) validate(subject string) error {
+	if c == nil {
+		return nil
+	}
+	if c.Platform != "" && c.Platform != "darwin" && c.Platform != "linux" {
+		return fmt.Errorf("%s has invalid when.platform '%s' - must be 'darwin' or 'linux'", subject, c.Platform)
+	}
+	if arch := normalizeArch(c.Arch); arch != "" && arch != "amd64" && arch != "arm64" {
+		return fmt.Errorf("%s has invalid when.arch '%s' - must be 'amd64' or 'arm64'", subject, c.Arch)
+	}
+	if _, err := path.Match(c.HostName, ""); err != nil {
+		return fmt.Errorf("%s has invalid when.hostname '%s' - must be a valid glob pattern", subject, c.HostName)
+	}
+	return nil
+}
+
+// status matches the condition against the user's machine
+func (c *FlakeCondition) status(user *User) FlakeStatus {
+	if c == nil {
+		return FlakeStatus{Active: true, Reason: "no conditions"}
+	}
+
+	var matched []string
+	if c.Platform != "" {
+		if c.Platform != user.Platform {
+			return FlakeStatus{Reason: fmt.Sprintf("platform is %s, not %s", user.Platform, c.Platform)}
+		}
+		matched = append(matched, "platform "+c.Platform)
+	}
+	if c.Arch != "" {
+		if normalizeArch(c.Arch) != normalizeArch(user.Architecture) {
+			return FlakeStatus{Reason: fmt.Sprintf("arch is %s, not %s", user.Architecture, normalizeArch(c.Arch))}
+		}
+		matched = append(matched, "arch "+normalizeArch(c.Arch))
+	}
+	if c.HostName != "" {
+		if ok, _ := path.Match(c.HostName, user.HostName); !ok {
+			return FlakeStatus{Reason: fmt.Sprintf("hostname '%s' doesn't match '%s'", user.HostName, c.HostName)}
+		}
+		matched = append(matched, fmt.Sprintf("hostname matches '%s'", c.HostName))
+	}
+
+	if len(matched) == 0 {
+		return FlakeStatus{Active: true, Reason: "no conditions"}
+	}
+	return FlakeStatus{Active: true, Reason: strings.Join(matched, ", ")}
+}
+
+// conditionStatus combines the enabled flag and the when block of a flake or an output
+func conditionStatus(enabled *bool, when *FlakeCondition, user *User) FlakeStatus {
+	if enabled != nil && !*enabled {
+		return FlakeStatus{Reason: "disabled (enabled: false)"}
+	}
+	return when.status(user)
+}
+
+// Status tells whether the output applies to the user's machine
+func (o FlakeOutput) Status(user *User) FlakeStatus {
+	return conditionStatus(o.Enabled, o.When, user)
+}
+
+// Status tells whether the flake applies to the user's machine. A flake whose
+// outputs are all inactive is inactive too, it has nothing to import
+func (f Flake) Status(user *User) FlakeStatus {
+	status := conditionStatus(f.Enabled, f.When, user)
+	if !status.Active || len(f.Outputs) == 0 {
+		return status
+	}
+	for _, output := range f.Outputs {
+		if output.Status(user).Active {
+			return status
+		}
+	}
+	return FlakeStatus{Reason: "no output is active"}
+}
+
+// ActiveFlakes returns the flakes of the user that apply to their machine,
+// with only their active outputs
+func ActiveFlakes(user *User) []Flake {
+	flakes := []Flake{}
+	for _, flake := range user.Flakes {
+		if !flake.Status(user).Active {
+			continue
+		}
+		outputs := []FlakeOutput{}
+		for _, output := range flake.Outputs {
+			if output.Status(user).Active {
+				outputs = append(outputs, output)
+			}
+		}
+		flake.Outputs = outputs
+		flakes = append(flakes, flake)
+	}
+	return flakes
+}
@@ -0,0 +1,118 @@
+package system
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFlakeStatus(t *testing.T) {
+	user := &User{Platform: "darwin", Architecture: "arm64", HostName: "work-laptop"}
+	enabled, disabled := true, false
+	outputs := []FlakeOutput{{Name: "homeManagerModules.default", Type: OutputTypeHome}}
+
+	tests := []struct {
+		name       string
+		flake      Flake
+		wantActive bool
+		wantReason string
+	}{
+		{name: "no conditions", flake: Flake{}, wantActive: true, wantReason: "no conditions"},
+		{name: "enabled", flake: Flake{Enabled: &enabled}, wantActive: true, wantReason: "no conditions"},
+		{name: "disabled", flake: Flake{Enabled: &disabled, When: &FlakeCondition{Platform: "darwin"}}, wantReason: "disabled (enabled: false)"},
+		{
+			name:       "matching conditions",
+			flake:      Flake{When: &FlakeCondition{Platform: "darwin", Arch: "aarch64", HostName: "work-*"}},
+			wantActive: true,
+			wantReason: "platform darwin, arch arm64, hostname matches 'work-*'",
+		},
+		{name: "other platform", flake: Flake{When: &FlakeCondition{Platform: "linux"}}, wantReason: "platform is darwin, not linux"},
+		{name: "other arch", flake: Flake{When: &FlakeCondition{Arch: "x86_64"}}, wantReason: "arch is arm64, not amd64"},
+		{name: "other hostname", flake: Flake{When: &FlakeCondition{HostName: "home-*"}}, wantReason: "hostname 'work-laptop' doesn't match 'home-*'"},
+		{
+			name:       "no active output",
+			flake:      Flake{Outputs: []FlakeOutput{{Name: "darwinModules.default", Type: OutputTypeSystem, When: &FlakeCondition{Platform: "linux"}}}},
+			wantReason: "no output is active",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.flake.Outputs == nil {
+				tt.flake.Outputs = outputs
+			}
+			status := tt.flake.Status(user)
+			if status.Active != tt.wantActive || status.Reason != tt.wantReason {
+				t.Errorf("Expected active=%v (%s), got active=%v (%s)", tt.wantActive, tt.wantReason, status.Active, status.Reason)
+			}
+		})
+	}
+}
+
+func TestActiveFlakes(t *testing.T) {
+	disabled := false
+	user := &User{
+		Platform:     "linux",
+		Architecture: "amd64",
+		HostName:     "ci-runner-1",
+		Flakes: []Flake{
+			{Name: "tools", Outputs: []FlakeOutput{
+				{Name: "homeManagerModules.default", Type: OutputTypeHome},
+				{Name: "darwinModules.default", Type: OutputTypeSystem, When: &FlakeCondition{Platform: "darwin"}},
+				{Name: "homeManagerModules.extra", Type: OutputTypeHome, Enabled: &disabled},
+			}},
+			{Name: "old", Enabled: &disabled, Outputs: []FlakeOutput{{Name: "homeManagerModules.default", Type: OutputTypeHome}}},
+			{Name: "ci", When: &FlakeCondition{HostName: "ci-*"}, Outputs: []FlakeOutput{{Name: "homeManagerModules.default", Type: OutputTypeHome}}},
+		},
+	}
+
+	var got []string
+	for _, flake := range ActiveFlakes(user) {
+		for _, output := range flake.Outputs {
+			got = append(got, flake.Name+"."+output.Name)
+		}
+	}
+	want := "tools.homeManagerModules.default,ci.homeManagerModules.default"
+	if strings.Join(got, ",") != want {
+		t.Errorf("Expected %s, got %s", want, strings.Join(got, ","))
+	}
+	if len(user.Flakes[0].Outputs) != 3 {
+		t.Error("Expected the user's flakes to be left untouched")
+	}
+}
+
+func TestValidateFlakes_Conditions(t *testing.T) {
+	tests := []struct {
+		name    string
+		flake   Flake
+		wantErr string
+	}{
+		{name: "valid", flake: Flake{When: &FlakeCondition{Platform: "linux", Arch: "aarch64", HostName: "work-[0-9]*"}}},
+		{name: "invalid platform", flake: Flake{When: &FlakeCondition{Platform: "macos"}}, wantErr: "flake 'tools' has invalid when.platform 'macos' - must be 'darwin' or 'linux'"},
+		{name: "invalid arch", flake: Flake{When: &FlakeCondition{Arch: "riscv64"}}, wantErr: "flake 'tools' has invalid when.arch 'riscv64'"},
+		{name: "invalid hostname glob", flake: Flake{When: &FlakeCondition{HostName: "work-["}}, wantErr: "flake 'tools' has invalid when.hostname 'work-['"},
+		{
+			name:    "invalid output condition",
+			flake:   Flake{Outputs: []FlakeOutput{{Name: "darwinModules.default", Type: OutputTypeSystem, When: &FlakeCondition{Platform: "windows"}}}},
+			wantErr: "flake 'tools' output 'darwinModules.default' has invalid when.platform 'windows'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.flake.Name, tt.flake.URL = "tools", "github:team/tools"
+			if tt.flake.Outputs == nil {
+				tt.flake.Outputs = []FlakeOutput{{Name: "homeManagerModules.default", Type: OutputTypeHome}}
+			}
+			err := (&CampConfig{Flakes: []Flake{tt.flake}}).ValidateFlakes()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("ValidateFlakes() failed: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package system
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// builtinInputs are the inputs the rendered flake.nix declares besides the flakes of camp.yml
+var builtinInputs = []string{"nixpkgs", "nixpkgs-unstable", "home-manager", "nix-darwin"}
+
+// ValidateFollows checks that follows, of the flakes and of defaultFollows,
+// point to inputs declared in the rendered flake.nix: the built-in ones or
+// other flakes of camp.yml
+func (c *CampConfig) ValidateFollows() error {
+	inputs := append([]string{}, builtinInputs...)
+	for _, flake := range c.Flakes {
+		inputs = append(inputs, flake.Name)
+	}
+	sort.Strings(inputs)
+
+	for _, input := range sortedKeys(c.DefaultFollows) {
+		if err := validateFollow("defaultFollows", input, c.DefaultFollows[input], inputs); err != nil {
+			return err
+		}
+	}
+
+	for _, flake := range c.Flakes {
+		subject := fmt.Sprintf("flake '%s'", flake.Name)
+		for _, input := range sortedKeys(flake.Follows) {
+			target := flake.Follows[input]
+			if err := validateFollow(subject, input, target, inputs); err != nil {
+				return err
+			}
+			// A flake can't follow one of its own inputs through itself
+			if followedInput(target) == flake.Name {
+				return fmt.Errorf("%s has follows '%s' pointing to itself - must point to another input", subject, input)
+			}
+		}
+	}
+	return nil
+}
+
+// validateFollow checks one follows entry. input is the input of the flake to
+// override, target the input of the rendered flake.nix it follows, possibly
+// nested (e.g. "home-manager/nixpkgs")
+func validateFollow(subject, input, target string, inputs []string) error {
+	if !isValidInputPath(input) {
+		return fmt.Errorf("%s has invalid follows input '%s' - must be an input name, or a path like 'utils/nixpkgs'", subject, input)
+	}
+	if target == "" {
+		return fmt.Errorf("%s has empty follows target for '%s'", subject, input)
+	}
+	if !isValidInputPath(target) {
+		return fmt.Errorf("%s has invalid follows target '%s' for '%s' - must be an input name, or a path like 'home-manager/nixpkgs'", subject, target, input)
+	}
+
+	name := followedInput(target)
+	for _, known := range inputs {
+		if name == known {
+			return nil
+		}
+	}
+	if suggestion := closestName(name, inputs); suggestion != "" {
+		return fmt.Errorf("%s has follows '%s' pointing to unknown input '%s' - did you mean '%s'?", subject, input, name, suggestion)
+	}
+	return fmt.Errorf("%s has follows '%s' pointing to unknown input '%s' - must be one of: %s", subject, input, name, strings.Join(inputs, ", "))
+}
+
+// isValidInputPath reports whether s is an input name, or a path of input names separated by slashes
+func isValidInputPath(s string) bool {
+	for _, part := range strings.Split(s, "/") {
+		if !isValidNixIdentifier(part) {
+			return false
+		}
+	}
+	return true
+}
+
+// followedInput returns the input of the rendered flake.nix a follows target starts with
+func followedInput(target string) string {
+	name, _, _ := strings.Cut(target, "/")
+	return name
+}
+
+// InputFollows returns the follows rendered for a flake: defaultFollows,
+// overridden by the flake's own follows. Defaults pointing to the flake
+// itself are skipped
+func (f Flake) InputFollows(defaults map[string]string) map[string]string {
+	follows := make(map[string]string, len(defaults)+len(f.Follows))
+	for input, target := range defaults {
+		if followedInput(target) != f.Name {
+			follows[input] = target
+		}
+	}
+	for input, target := range f.Follows {
+		follows[input] = target
+	}
+	return follows
+}
+
+// renderedFollows resolves the follows of the flakes about to be rendered.
+// Follows pointing to flakes inactive on this machine are left out, as their
+// input isn't declared: the flake then uses its own locked input
+func renderedFollows(flakes []Flake, defaults map[string]string) {
+	declared := map[string]bool{}
+	for _, input := range builtinInputs {
+		declared[input] = true
+	}
+	for _, flake := range flakes {
+		declared[flake.Name] = true
+	}
+
+	for i, flake := range flakes {
+		follows := map[string]string{}
+		for input, target := range flake.InputFollows(defaults) {
+			if declared[followedInput(target)] {
+				follows[input] = target
+			}
+		}
+		flakes[i].Follows = follows
+	}
+}
@@ -0,0 +1,152 @@
+package system
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateFollows(t *testing.T) {
+	flake := func(name string, follows map[string]string) Flake {
+		return Flake{Name: name, URL: "github:team/" + name, Follows: follows, Outputs: []FlakeOutput{{Name: "packages", Type: OutputTypeHome}}}
+	}
+
+	tests := []struct {
+		name     string
+		flakes   []Flake
+		defaults map[string]string
+		wantErr  string
+	}{
+		{
+			name:   "built-in inputs",
+			flakes: []Flake{flake("tools", map[string]string{"nixpkgs": "nixpkgs", "home-manager": "home-manager", "darwin": "nix-darwin"})},
+		},
+		{
+			name:   "other flake and nested input",
+			flakes: []Flake{flake("tools", map[string]string{"utils": "flake-utils", "utils/systems": "home-manager/nixpkgs"}), flake("flake-utils", nil)},
+		},
+		{
+			name:     "defaults",
+			flakes:   []Flake{flake("tools", nil)},
+			defaults: map[string]string{"nixpkgs": "nixpkgs"},
+		},
+		{
+			name:    "misspelled target",
+			flakes:  []Flake{flake("tools", map[string]string{"nixpkgs": "nixpgks"})},
+			wantErr: "flake 'tools' has follows 'nixpkgs' pointing to unknown input 'nixpgks' - did you mean 'nixpkgs'?",
+		},
+		{
+			name:    "unknown target",
+			flakes:  []Flake{flake("tools", map[string]string{"utils": "flake-utils"})},
+			wantErr: "pointing to unknown input 'flake-utils' - must be one of: home-manager, nix-darwin, nixpkgs, nixpkgs-unstable, tools",
+		},
+		{
+			name:     "misspelled default target",
+			flakes:   []Flake{flake("tools", nil)},
+			defaults: map[string]string{"nixpkgs": "nixpkgs-unstabel"},
+			wantErr:  "defaultFollows has follows 'nixpkgs' pointing to unknown input 'nixpkgs-unstabel' - did you mean 'nixpkgs-unstable'?",
+		},
+		{
+			name:    "itself",
+			flakes:  []Flake{flake("tools", map[string]string{"nixpkgs": "tools/nixpkgs"})},
+			wantErr: "flake 'tools' has follows 'nixpkgs' pointing to itself",
+		},
+		{
+			name:    "invalid input",
+			flakes:  []Flake{flake("tools", map[string]string{"nix pkgs": "nixpkgs"})},
+			wantErr: "flake 'tools' has invalid follows input 'nix pkgs'",
+		},
+		{
+			name:    "empty target",
+			flakes:  []Flake{flake("tools", map[string]string{"nixpkgs": ""})},
+			wantErr: "flake 'tools' has empty follows target for 'nixpkgs'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &CampConfig{Flakes: tt.flakes, DefaultFollows: tt.defaults}
+			err := config.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Expected valid follows, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_DefaultFollows(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "camp.yml")
+	config := `defaultFollows:
+  nixpkgs: nixpkgs
+flakes:
+  - name: tools
+    url: github:team/tools
+    outputs:
+      - name: packages
+        type: home
+`
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	loaded, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig() failed: %v", err)
+	}
+	if loaded.DefaultFollows["nixpkgs"] != "nixpkgs" {
+		t.Errorf("Expected defaultFollows to be loaded, got %+v", loaded.DefaultFollows)
+	}
+}
+
+func TestCompileTemplate_DefaultFollows(t *testing.T) {
+	if _, err := os.Stat(flakeTemplatePath); os.IsNotExist(err) {
+		t.Skip("Skipping test: flake.nix template not found")
+	}
+
+	outputs := []FlakeOutput{{Name: "homeManagerModules.default", Type: OutputTypeHome}}
+	user := &User{
+		Name:     "testuser",
+		HostName: "laptop",
+		Platform: "linux",
+		HomeDir:  "/home/testuser",
+		Flakes: []Flake{
+			{Name: "tools", URL: "github:team/tools", Outputs: outputs},
+			{Name: "pinned", URL: "github:team/pinned", Follows: map[string]string{"nixpkgs": "nixpkgs-unstable"}, Outputs: outputs},
+			{Name: "flake-utils", URL: "github:numtide/flake-utils", Outputs: outputs},
+			{Name: "mac-utils", URL: "github:team/mac-utils", When: &FlakeCondition{Platform: "darwin"}, Outputs: outputs},
+			{Name: "work", URL: "github:corp/work", Follows: map[string]string{"mac": "mac-utils"}, Outputs: outputs},
+		},
+		DefaultFollows: map[string]string{"nixpkgs": "nixpkgs", "flake-utils": "flake-utils"},
+	}
+
+	result, err := CompileTemplate(flakeTemplatePath, NewTemplateData(user))
+	if err != nil {
+		t.Fatalf("CompileTemplate() failed: %v", err)
+	}
+	resultStr := string(result)
+
+	expected := []string{
+		"tools = {\n      url = \"github:team/tools\";\n      inputs.flake-utils.follows = \"flake-utils\";\n      inputs.nixpkgs.follows = \"nixpkgs\";\n    };",
+		"pinned = {\n      url = \"github:team/pinned\";\n      inputs.flake-utils.follows = \"flake-utils\";\n      inputs.nixpkgs.follows = \"nixpkgs-unstable\";\n    };",
+		// A flake doesn't follow itself
+		"flake-utils = {\n      url = \"github:numtide/flake-utils\";\n      inputs.nixpkgs.follows = \"nixpkgs\";\n    };",
+	}
+	for _, want := range expected {
+		if !strings.Contains(resultStr, want) {
+			t.Errorf("Expected flake.nix to contain:\n%s\ngot:\n%s", want, resultStr)
+		}
+	}
+	if strings.Contains(resultStr, "inputs.mac.follows") {
+		t.Error("Expected follows to the inactive flake to be left out")
+	}
+	if user.Flakes[0].Follows != nil {
+		t.Error("Expected the user's flakes to be left untouched")
+	}
+}
@@ -0,0 +1,301 @@
+package system
+
+import (
+	"camp/internal/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FlakeLock is a parsed flake.lock file
+type FlakeLock struct {
+	Nodes   map[string]flakeLockNode `json:"nodes"`
+	Root    string                   `json:"root"`
+	Version int                      `json:"version"`
+}
+
+// flakeLockNode is a node of the flake.lock graph. Inputs map input names either
+// to a node name or, for inputs following another one, to a path of input names
+type flakeLockNode struct {
+	Inputs   map[string]json.RawMessage `json:"inputs,omitempty"`
+	Locked   *flakeLockedRef            `json:"locked,omitempty"`
+	Original *flakeLockedRef            `json:"original,omitempty"` // Reference as written in flake.nix, before locking
+}
+
+// flakeLockedRef is the locked reference of a node
+type flakeLockedRef struct {
+	Type         string `json:"type"`
+	ID           string `json:"id,omitempty"` // Registry name of indirect references
+	Owner        string `json:"owner,omitempty"`
+	Repo         string `json:"repo,omitempty"`
+	Host         string `json:"host,omitempty"` // GitHub and GitLab host, for self-hosted instances
+	Dir          string `json:"dir,omitempty"`  // Subdirectory holding flake.nix
+	URL          string `json:"url,omitempty"`
+	Path         string `json:"path,omitempty"`
+	Ref          string `json:"ref,omitempty"`
+	Rev          string `json:"rev,omitempty"`
+	LastModified int64  `json:"lastModified,omitempty"`
+}
+
+// flakeRef returns the node reference as a FlakeRef, to render it like camp.yml references
+func (r flakeLockedRef) flakeRef() FlakeRef {
+	return FlakeRef{Type: r.Type, Owner: r.Owner, Repo: r.Repo, Host: r.Host, URL: r.URL, Path: r.Path, ID: r.ID, Ref: r.Ref, Rev: r.Rev, Dir: r.Dir}
+}
+
+// onGitHub reports whether a GitHub reference is hosted on github.com rather than a GitHub Enterprise instance
+func (r flakeLockedRef) onGitHub() bool {
+	return r.Host == "" || r.Host == "github.com"
+}
+
+// LockedInput is a direct input of the camp flake as locked in flake.lock
+type LockedInput struct {
+	Name         string    `json:"name"`
+	Type         string    `json:"type"`          // Fetcher type, e.g. "github", "git" or "path"
+	Source       string    `json:"source"`        // Where the input comes from, e.g. "github:NixOS/nixpkgs"
+	Rev          string    `json:"rev,omitempty"` // Locked commit, empty for inputs without revisions
+	LastModified time.Time `json:"last_modified"` // Date of the locked commit
+	owner, repo  string
+	locked       flakeLockedRef
+	original     flakeLockedRef
+}
+
+// ShortRev returns the abbreviated locked commit
+func (i LockedInput) ShortRev() string {
+	if len(i.Rev) > 7 {
+		return i.Rev[:7]
+	}
+	return i.Rev
+}
+
+// Describe returns the locked revision and its date, e.g. "abc1234 (2024-05-01)"
+func (i LockedInput) Describe() string {
+	date := "unknown date"
+	if !i.LastModified.IsZero() {
+		date = i.LastModified.UTC().Format("2006-01-02")
+	}
+	if i.Rev == "" {
+		return date
+	}
+	return fmt.Sprintf("%s (%s)", i.ShortRev(), date)
+}
+
+// InputChange is the change of a flake input between two flake.lock files
+type InputChange struct {
+	Input      string       `json:"input"`
+	Old        *LockedInput `json:"old,omitempty"`         // nil for added inputs
+	New        *LockedInput `json:"new,omitempty"`         // nil for removed inputs
+	CompareURL string       `json:"compare_url,omitempty"` // Commits between the revisions, for GitHub inputs
+}
+
+// FlakeLockPath returns the path of the lock file of the camp flake
+func FlakeLockPath(user *User) string {
+	return filepath.Join(user.NixDir(), "flake.lock")
+}
+
+// ParseFlakeLock parses the content of a flake.lock file
+func ParseFlakeLock(content []byte) (*FlakeLock, error) {
+	var lock FlakeLock
+	if err := json.Unmarshal(content, &lock); err != nil {
+		return nil, fmt.Errorf("invalid flake.lock: %w", err)
+	}
+	if lock.Root == "" {
+		lock.Root = "root"
+	}
+	return &lock, nil
+}
+
+// ReadFlakeLock reads a flake.lock file. A missing file is read as a lock without inputs
+func ReadFlakeLock(path string) (*FlakeLock, error) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &FlakeLock{Root: "root"}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read flake.lock: %w", err)
+	}
+	return ParseFlakeLock(content)
+}
+
+// Inputs returns the direct inputs of the flake, by name.
+// Inputs following another input are left out, they are locked by the followed one
+func (l *FlakeLock) Inputs() map[string]LockedInput {
+	inputs := map[string]LockedInput{}
+	root, ok := l.Nodes[l.Root]
+	if !ok {
+		return inputs
+	}
+
+	for name, target := range root.Inputs {
+		var nodeName string
+		if err := json.Unmarshal(target, &nodeName); err != nil {
+			continue
+		}
+		node, ok := l.Nodes[nodeName]
+		if !ok || node.Locked == nil {
+			continue
+		}
+		input := newLockedInput(name, *node.Locked)
+		if node.Original != nil {
+			input.original = *node.Original
+		}
+		inputs[name] = input
+	}
+	return inputs
+}
+
+// InputNames returns the names of the direct inputs of the flake, sorted
+func (l *FlakeLock) InputNames() []string {
+	var names []string
+	for name := range l.Inputs() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func newLockedInput(name string, ref flakeLockedRef) LockedInput {
+	input := LockedInput{Name: name, Type: ref.Type, Rev: ref.Rev, owner: ref.Owner, repo: ref.Repo, locked: ref, original: ref}
+	if ref.LastModified > 0 {
+		input.LastModified = time.Unix(ref.LastModified, 0).UTC()
+	}
+
+	switch ref.Type {
+	case FlakeRefGitHub, FlakeRefGitLab:
+		source := ref.flakeRef()
+		source.Rev = ""
+		input.Source = source.String()
+	case "sourcehut":
+		input.Source = fmt.Sprintf("%s:%s/%s", ref.Type, ref.Owner, ref.Repo)
+		if ref.Ref != "" {
+			input.Source += "/" + ref.Ref
+		}
+	case "path":
+		input.Source = "path:" + ref.Path
+	default:
+		input.Source = ref.URL
+	}
+
+	// Git inputs hosted on GitHub get compare URLs too
+	if ref.Type == "git" && strings.HasPrefix(ref.URL, "https://github.com/") {
+		parts := strings.Split(strings.TrimSuffix(strings.TrimPrefix(ref.URL, "https://github.com/"), ".git"), "/")
+		if len(parts) == 2 {
+			input.owner, input.repo = parts[0], parts[1]
+		}
+	}
+	return input
+}
+
+// compareURL returns the GitHub page listing the commits between two revisions of an input,
+// or an empty string for inputs not hosted on github.com
+func compareURL(old, new LockedInput) string {
+	if old.owner == "" || old.owner != new.owner || old.repo != new.repo || old.Rev == "" || new.Rev == "" {
+		return ""
+	}
+	if old.Type != "github" && old.Type != "git" || !old.locked.onGitHub() || !new.locked.onGitHub() {
+		return ""
+	}
+	return fmt.Sprintf("https://github.com/%s/%s/compare/%s...%s", old.owner, old.repo, old.Rev, new.Rev)
+}
+
+// DiffFlakeLocks returns the inputs added, removed or locked to another revision
+// between two flake.lock files, sorted by input name
+func DiffFlakeLocks(before, after *FlakeLock) []InputChange {
+	oldInputs, newInputs := before.Inputs(), after.Inputs()
+	var changes []InputChange
+
+	for name, newInput := range newInputs {
+		oldInput, ok := oldInputs[name]
+		switch {
+		case !ok:
+			changes = append(changes, InputChange{Input: name, New: &newInput})
+		case oldInput.Rev != newInput.Rev || !oldInput.LastModified.Equal(newInput.LastModified) || oldInput.Source != newInput.Source:
+			changes = append(changes, InputChange{Input: name, Old: &oldInput, New: &newInput, CompareURL: compareURL(oldInput, newInput)})
+		}
+	}
+	for name, oldInput := range oldInputs {
+		if _, ok := newInputs[name]; !ok {
+			changes = append(changes, InputChange{Input: name, Old: &oldInput})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Input < changes[j].Input })
+	return changes
+}
+
+// DeclaredInputs returns the inputs the rendered flake.nix declares for the
+// user, sorted: the built-in ones and the flakes active on this machine
+func DeclaredInputs(user *User) []string {
+	inputs := append([]string{}, builtinInputs...)
+	for _, flake := range ActiveFlakes(user) {
+		inputs = append(inputs, flake.Name)
+	}
+	sort.Strings(inputs)
+	return inputs
+}
+
+// ValidateFlakeInputs checks that inputs are declared by the rendered flake.nix
+// of the user. Flakes just added to camp.yml are valid before being locked
+func ValidateFlakeInputs(user *User, inputs []string) error {
+	declared := DeclaredInputs(user)
+	for _, input := range inputs {
+		found := false
+		for _, name := range declared {
+			found = found || name == input
+		}
+		if !found {
+			return fmt.Errorf("unknown flake input %q (inputs: %s)", input, strings.Join(declared, ", "))
+		}
+	}
+	return nil
+}
+
+// UpdateFlakeInputs updates the named inputs of the flake in flakeDir, or all of them
+// when inputs is empty. The output of Nix is written to stdout and stderr
+func UpdateFlakeInputs(ctx context.Context, flakeDir string, inputs []string, stdout, stderr io.Writer) error {
+	args := append([]string{"flake", "update"}, inputs...)
+	_, err := utils.Run(ctx, utils.Command{
+		Name:   "nix",
+		Args:   nixCommandArgs(append(args, "--flake", flakeDir)...),
+		Stdout: stdout,
+		Stderr: stderr,
+	})
+	return err
+}
+
+// DryRunFlakeUpdate updates the named inputs (or all of them) of a scratch copy of the
+// camp flake and returns the changes the update would make to flake.lock.
+// The flake of the user is left untouched
+func DryRunFlakeUpdate(ctx context.Context, user *User, inputs []string, stdout, stderr io.Writer) ([]InputChange, error) {
+	before, err := ReadFlakeLock(FlakeLockPath(user))
+	if err != nil {
+		return nil, err
+	}
+
+	scratch, err := os.MkdirTemp("", "camp-update-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create scratch directory: %w", err)
+	}
+	defer os.RemoveAll(scratch)
+
+	flakeDir := filepath.Join(scratch, "nix")
+	if err := copyDir(user.NixDir(), flakeDir); err != nil {
+		return nil, fmt.Errorf("failed to copy flake: %w", err)
+	}
+	if err := UpdateFlakeInputs(ctx, flakeDir, inputs, stdout, stderr); err != nil {
+		return nil, err
+	}
+
+	after, err := ReadFlakeLock(filepath.Join(flakeDir, "flake.lock"))
+	if err != nil {
+		return nil, err
+	}
+	return DiffFlakeLocks(before, after), nil
+}
@@ -0,0 +1,198 @@
+package system
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"camp/internal/utils"
+)
+
+const (
+	oldNixpkgsRev  = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	newNixpkgsRev  = "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+	homeManagerRev = "cccccccccccccccccccccccccccccccccccccccc"
+)
+
+// testFlakeLock returns a flake.lock locking nixpkgs at rev, home-manager, a team
+// flake fetched with git from GitHub and a nix-darwin input following home-manager
+func testFlakeLock(nixpkgsRev string, lastModified int) string {
+	return `{
+  "nodes": {
+    "home-manager": {
+      "inputs": {"nixpkgs": ["nixpkgs"]},
+      "locked": {"lastModified": 1714000000, "owner": "nix-community", "repo": "home-manager", "rev": "` + homeManagerRev + `", "type": "github"},
+      "original": {"owner": "nix-community", "repo": "home-manager", "type": "github"}
+    },
+    "nixpkgs": {
+      "locked": {"lastModified": ` + strconv.Itoa(lastModified) + `, "owner": "NixOS", "ref": "nixos-unstable", "repo": "nixpkgs", "rev": "` + nixpkgsRev + `", "type": "github"},
+      "original": {"owner": "NixOS", "ref": "nixos-unstable", "repo": "nixpkgs", "type": "github"}
+    },
+    "team": {
+      "locked": {"lastModified": 1714000000, "rev": "1111111111111111111111111111111111111111", "type": "git", "url": "https://github.com/team/config.git"},
+      "original": {"type": "git", "url": "https://github.com/team/config.git"}
+    },
+    "root": {
+      "inputs": {"home-manager": "home-manager", "nixpkgs": "nixpkgs", "team": "team", "nix-darwin": ["home-manager"]}
+    }
+  },
+  "root": "root",
+  "version": 7
+}`
+}
+
+func TestFlakeLockInputs(t *testing.T) {
+	lock, err := ParseFlakeLock([]byte(testFlakeLock(oldNixpkgsRev, 1714521600)))
+	if err != nil {
+		t.Fatalf("ParseFlakeLock() failed: %v", err)
+	}
+
+	// Inputs following another input aren't locked on their own
+	if got := strings.Join(lock.InputNames(), ","); got != "home-manager,nixpkgs,team" {
+		t.Errorf("Expected inputs home-manager,nixpkgs,team, got %s", got)
+	}
+
+	nixpkgs := lock.Inputs()["nixpkgs"]
+	if nixpkgs.Source != "github:NixOS/nixpkgs/nixos-unstable" {
+		t.Errorf("Unexpected source: %s", nixpkgs.Source)
+	}
+	if nixpkgs.Describe() != "aaaaaaa (2024-05-01)" {
+		t.Errorf("Unexpected description: %s", nixpkgs.Describe())
+	}
+	if hosted := withNixpkgsHost(lock, "github.example.com").Inputs()["nixpkgs"]; hosted.Source != "github:NixOS/nixpkgs/nixos-unstable?host=github.example.com" {
+		t.Errorf("Unexpected GitHub Enterprise source: %s", hosted.Source)
+	}
+	if team := lock.Inputs()["team"]; team.Source != "https://github.com/team/config.git" {
+		t.Errorf("Unexpected git source: %s", team.Source)
+	}
+
+	if _, err := ParseFlakeLock([]byte("not json")); err == nil {
+		t.Error("ParseFlakeLock() should fail on invalid content")
+	}
+}
+
+func TestReadFlakeLockMissing(t *testing.T) {
+	lock, err := ReadFlakeLock(filepath.Join(t.TempDir(), "flake.lock"))
+	if err != nil {
+		t.Fatalf("ReadFlakeLock() failed: %v", err)
+	}
+	if len(lock.Inputs()) != 0 {
+		t.Errorf("Expected no inputs, got %v", lock.Inputs())
+	}
+}
+
+// withNixpkgsHost returns a copy of lock with nixpkgs fetched from another GitHub host
+func withNixpkgsHost(lock *FlakeLock, host string) *FlakeLock {
+	hosted := &FlakeLock{Root: lock.Root, Version: lock.Version, Nodes: map[string]flakeLockNode{}}
+	for name, node := range lock.Nodes {
+		if name == "nixpkgs" {
+			locked := *node.Locked
+			locked.Host = host
+			node.Locked = &locked
+		}
+		hosted.Nodes[name] = node
+	}
+	return hosted
+}
+
+func TestDiffFlakeLocks(t *testing.T) {
+	before, _ := ParseFlakeLock([]byte(testFlakeLock(oldNixpkgsRev, 1714521600)))
+	after, _ := ParseFlakeLock([]byte(testFlakeLock(newNixpkgsRev, 1716163200)))
+
+	tests := []struct {
+		name        string
+		before      *FlakeLock
+		after       *FlakeLock
+		wantInputs  string
+		wantCompare string
+	}{
+		{
+			name:        "updated input",
+			before:      before,
+			after:       after,
+			wantInputs:  "nixpkgs",
+			wantCompare: "https://github.com/NixOS/nixpkgs/compare/" + oldNixpkgsRev + "..." + newNixpkgsRev,
+		},
+		{
+			name:       "GitHub Enterprise input",
+			before:     withNixpkgsHost(before, "github.example.com"),
+			after:      withNixpkgsHost(after, "github.example.com"),
+			wantInputs: "nixpkgs",
+		},
+		{name: "no changes", before: before, after: before},
+		{name: "first lock", before: &FlakeLock{Root: "root"}, after: after, wantInputs: "home-manager,nixpkgs,team"},
+		{name: "removed inputs", before: before, after: &FlakeLock{Root: "root"}, wantInputs: "home-manager,nixpkgs,team"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes := DiffFlakeLocks(tt.before, tt.after)
+			var inputs []string
+			for _, change := range changes {
+				inputs = append(inputs, change.Input)
+			}
+			if got := strings.Join(inputs, ","); got != tt.wantInputs {
+				t.Fatalf("Expected changed inputs %q, got %q", tt.wantInputs, got)
+			}
+			if len(changes) > 0 && changes[0].CompareURL != tt.wantCompare {
+				t.Errorf("Expected compare URL %s, got %s", tt.wantCompare, changes[0].CompareURL)
+			}
+		})
+	}
+}
+
+func TestValidateFlakeInputs(t *testing.T) {
+	user := newBackendTestUser(t, "linux")
+	disabled := false
+	user.Flakes = []Flake{
+		{Name: "team", URL: "github:team/tools", Outputs: []FlakeOutput{{Name: "packages", Type: OutputTypeHome}}},
+		{Name: "old", URL: "github:team/old", Enabled: &disabled, Outputs: []FlakeOutput{{Name: "packages", Type: OutputTypeHome}}},
+	}
+
+	// Inputs are known from camp.yml, whether flake.lock exists or not
+	if err := ValidateFlakeInputs(user, []string{"nixpkgs", "team"}); err != nil {
+		t.Errorf("Expected declared inputs to be valid, got %v", err)
+	}
+	err := ValidateFlakeInputs(user, []string{"nixpgks"})
+	if err == nil || !strings.Contains(err.Error(), `unknown flake input "nixpgks" (inputs: home-manager, nix-darwin, nixpkgs, nixpkgs-unstable, team)`) {
+		t.Errorf("Expected an unknown input error listing the inputs, got %v", err)
+	}
+	if err := ValidateFlakeInputs(user, []string{"old"}); err == nil {
+		t.Error("Expected an inactive flake to be unknown")
+	}
+}
+
+func TestDryRunFlakeUpdate(t *testing.T) {
+	user := newBackendTestUser(t, "linux")
+	original := testFlakeLock(oldNixpkgsRev, 1714521600)
+	if err := os.WriteFile(FlakeLockPath(user), []byte(original), 0644); err != nil {
+		t.Fatalf("Failed to write flake.lock: %v", err)
+	}
+
+	// Nix updates the lock file of the flake it is given
+	fake := stubCommands(t, "")
+	fake.Respond = func(command utils.Command) (string, error) {
+		flakeDir := command.Args[len(command.Args)-1]
+		return "", os.WriteFile(filepath.Join(flakeDir, "flake.lock"), []byte(testFlakeLock(newNixpkgsRev, 1716163200)), 0644)
+	}
+
+	changes, err := DryRunFlakeUpdate(context.Background(), user, []string{"nixpkgs"}, io.Discard, io.Discard)
+	if err != nil {
+		t.Fatalf("DryRunFlakeUpdate() failed: %v", err)
+	}
+	if len(changes) != 1 || changes[0].Input != "nixpkgs" || changes[0].New.Rev != newNixpkgsRev {
+		t.Errorf("Expected nixpkgs to be updated, got %+v", changes)
+	}
+
+	command := fake.Calls[0].String()
+	if !strings.Contains(command, "flake update nixpkgs --flake ") || strings.Contains(command, user.NixDir()) {
+		t.Errorf("Expected the update to run on a scratch copy, got %s", command)
+	}
+	if content, _ := os.ReadFile(FlakeLockPath(user)); string(content) != original {
+		t.Error("Expected flake.lock of the user to be left untouched")
+	}
+}
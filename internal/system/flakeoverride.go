@@ -0,0 +1,386 @@
+package system
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FlakeOverride swaps a flake of camp.yml for a local checkout while developing it
+type FlakeOverride struct {
+	Flake     string    `json:"flake"`      // Name of the flake in camp.yml
+	Path      string    `json:"path"`       // Absolute path of the checkout, holding flake.nix
+	CreatedAt time.Time `json:"created_at"` // When the override was set
+}
+
+// URL returns the flake reference rendered in place of the flake's URL
+func (o FlakeOverride) URL() string {
+	return "path:" + o.Path
+}
+
+// apply points a flake to the checkout. The pinning fields of camp.yml don't apply to it
+func (o FlakeOverride) apply(flake Flake) Flake {
+	flake.URL = o.URL()
+	flake.Rev, flake.Ref, flake.Dir, flake.Host = "", "", "", ""
+	return flake
+}
+
+// flakeOverridesPath returns where the development overrides are recorded
+func flakeOverridesPath(user *User) string {
+	return filepath.Join(user.StateDir(), "flake-overrides.json")
+}
+
+// LoadFlakeOverrides returns the recorded overrides by flake name
+func LoadFlakeOverrides(user *User) (map[string]FlakeOverride, error) {
+	overrides := map[string]FlakeOverride{}
+	data, err := os.ReadFile(flakeOverridesPath(user))
+	if os.IsNotExist(err) {
+		return overrides, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read flake overrides: %w", err)
+	}
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return nil, fmt.Errorf("failed to parse flake overrides: %w", err)
+	}
+	return overrides, nil
+}
+
+// saveFlakeOverrides records the overrides, removing the file when there is none left
+func saveFlakeOverrides(user *User, overrides map[string]FlakeOverride) error {
+	if len(overrides) == 0 {
+		if err := os.Remove(flakeOverridesPath(user)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove flake overrides: %w", err)
+		}
+		return nil
+	}
+	if err := ensureStateDir(user); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(overrides, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode flake overrides: %w", err)
+	}
+	if err := os.WriteFile(flakeOverridesPath(user), data, 0644); err != nil {
+		return fmt.Errorf("failed to write flake overrides: %w", err)
+	}
+	return nil
+}
+
+// SetFlakeOverride makes the next rebuilds use the checkout at dir instead of
+// the flake named name, until ResetFlakeOverride. dir may be relative to the
+// working directory, and must hold a flake.nix
+func SetFlakeOverride(user *User, name, dir string, now time.Time) (*FlakeOverride, error) {
+	found := false
+	names := []string{}
+	for _, flake := range user.Flakes {
+		found = found || flake.Name == name
+		names = append(names, flake.Name)
+	}
+	if !found {
+		if len(names) == 0 {
+			return nil, fmt.Errorf("flake '%s' is not in camp.yml - there are no flakes configured", name)
+		}
+		return nil, fmt.Errorf("flake '%s' is not in camp.yml - must be one of: %s", name, strings.Join(names, ", "))
+	}
+
+	path, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", dir, err)
+	}
+	if info, err := os.Stat(path); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", path)
+	}
+	if _, err := os.Stat(filepath.Join(path, "flake.nix")); err != nil {
+		return nil, fmt.Errorf("%s has no flake.nix - point to the directory of the flake, including its dir if it sets one", path)
+	}
+
+	overrides, err := LoadFlakeOverrides(user)
+	if err != nil {
+		return nil, err
+	}
+	// Switching to another checkout keeps the entry saved by the first override
+	if _, ok := overrides[name]; !ok {
+		if err := saveLockedInput(user, name); err != nil {
+			return nil, err
+		}
+	}
+	override := FlakeOverride{Flake: name, Path: path, CreatedAt: now}
+	overrides[name] = override
+	if err := saveFlakeOverrides(user, overrides); err != nil {
+		return nil, err
+	}
+	return &override, nil
+}
+
+// ResetFlakeOverride goes back to the flake of camp.yml for the flake named
+// name. Its entry of flake.lock from before the override is put back, so the
+// next rebuild uses the revision it was locked at rather than locking it again
+func ResetFlakeOverride(user *User, name string) error {
+	overrides, err := LoadFlakeOverrides(user)
+	if err != nil {
+		return err
+	}
+	if _, ok := overrides[name]; !ok {
+		return fmt.Errorf("flake '%s' has no development override", name)
+	}
+	if err := restoreLockedInput(user, name); err != nil {
+		return err
+	}
+	delete(overrides, name)
+	return saveFlakeOverrides(user, overrides)
+}
+
+// ActiveFlakeOverrides returns the overrides of the flakes of camp.yml, sorted
+// by flake name. Overrides of flakes removed from camp.yml are ignored
+func ActiveFlakeOverrides(user *User) []FlakeOverride {
+	overrides, err := LoadFlakeOverrides(user)
+	if err != nil {
+		return nil
+	}
+	active := []FlakeOverride{}
+	for _, flake := range user.Flakes {
+		if override, ok := overrides[flake.Name]; ok {
+			active = append(active, override)
+		}
+	}
+	sort.Slice(active, func(i, j int) bool { return active[i].Flake < active[j].Flake })
+	return active
+}
+
+// developedFlakes returns the active flakes of the user, those under
+// development pointing to their local checkout
+func developedFlakes(user *User) []Flake {
+	flakes := ActiveFlakes(user)
+	for _, override := range ActiveFlakeOverrides(user) {
+		for i, flake := range flakes {
+			if flake.Name == override.Flake {
+				flakes[i] = override.apply(flake)
+			}
+		}
+	}
+	return flakes
+}
+
+// rawFlakeLock is a flake.lock whose nodes are kept as written by Nix, to edit
+// it without dropping the fields camp doesn't parse, like narHash
+type rawFlakeLock struct {
+	Nodes   map[string]json.RawMessage `json:"nodes"`
+	Root    string                     `json:"root"`
+	Version int                        `json:"version"`
+}
+
+// readRawFlakeLock reads a flake.lock file, or returns nil when it doesn't exist
+func readRawFlakeLock(path string) (*rawFlakeLock, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	var lock rawFlakeLock
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", path, err)
+	}
+	if lock.Root == "" {
+		lock.Root = "root"
+	}
+	return &lock, nil
+}
+
+// write saves the lock at path, formatted like Nix does
+func (l *rawFlakeLock) write(path string) error {
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", path, err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// inputs returns the inputs of a node, by input name
+func (l *rawFlakeLock) inputs(node string) map[string]json.RawMessage {
+	var parsed flakeLockNode
+	if err := json.Unmarshal(l.Nodes[node], &parsed); err != nil {
+		return nil
+	}
+	return parsed.Inputs
+}
+
+// inputNode returns the node locking a direct input, or an empty string when
+// the input isn't locked or follows another one
+func (l *rawFlakeLock) inputNode(input string) string {
+	var node string
+	if err := json.Unmarshal(l.inputs(l.Root)[input], &node); err != nil {
+		return ""
+	}
+	return node
+}
+
+// reachable returns the nodes reachable from the given ones, including them.
+// Inputs following another input name a path from the root, not a node, and
+// are left out
+func (l *rawFlakeLock) reachable(nodes ...string) map[string]bool {
+	seen := map[string]bool{}
+	for len(nodes) > 0 {
+		node := nodes[len(nodes)-1]
+		nodes = nodes[:len(nodes)-1]
+		if seen[node] {
+			continue
+		}
+		seen[node] = true
+		for _, target := range l.inputs(node) {
+			var next string
+			if json.Unmarshal(target, &next) == nil {
+				nodes = append(nodes, next)
+			}
+		}
+	}
+	return seen
+}
+
+// flakeOverrideLockPath returns where the entry of flake.lock of an overridden flake is saved
+func flakeOverrideLockPath(user *User, name string) string {
+	return filepath.Join(user.StateDir(), "flake-overrides", name+".lock")
+}
+
+// saveLockedInput saves the node locking the input named name, with the nodes
+// of its own inputs, as a flake.lock rooted at the input's node. Nothing is
+// saved for inputs not locked yet
+func saveLockedInput(user *User, name string) error {
+	path := flakeOverrideLockPath(user, name)
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove %s: %w", path, err)
+	}
+	lock, err := readRawFlakeLock(FlakeLockPath(user))
+	if err != nil || lock == nil {
+		return err
+	}
+	node := lock.inputNode(name)
+	if node == "" {
+		return nil
+	}
+
+	saved := &rawFlakeLock{Nodes: map[string]json.RawMessage{}, Root: node, Version: lock.Version}
+	for name := range lock.reachable(node) {
+		saved.Nodes[name] = lock.Nodes[name]
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+	return saved.write(path)
+}
+
+// restoreLockedInput puts the nodes saved by saveLockedInput back into
+// flake.lock, in place of those locking the checkout. Saved nodes whose name
+// is now taken by another node are renamed
+func restoreLockedInput(user *User, name string) error {
+	path := flakeOverrideLockPath(user, name)
+	saved, err := readRawFlakeLock(path)
+	if err != nil || saved == nil {
+		return err
+	}
+	lock, err := readRawFlakeLock(FlakeLockPath(user))
+	if err != nil {
+		return err
+	}
+
+	if lock != nil && lock.Nodes[lock.Root] != nil {
+		// Nodes only the checkout uses go away with it
+		if current := lock.inputNode(name); current != "" {
+			var others []string
+			for input := range lock.inputs(lock.Root) {
+				if node := lock.inputNode(input); input != name && node != "" {
+					others = append(others, node)
+				}
+			}
+			kept := lock.reachable(others...)
+			kept[lock.Root] = true
+			for node := range lock.reachable(current) {
+				if !kept[node] {
+					delete(lock.Nodes, node)
+				}
+			}
+		}
+
+		// Nodes still in flake.lock, e.g. shared with another input, are reused.
+		// Like Nix, the others get the next free numeric suffix, e.g. nixpkgs_3
+		renamed := map[string]string{}
+		for node := range saved.Nodes {
+			base, next := node, 2
+			if i := strings.LastIndex(node, "_"); i > 0 {
+				if n, err := strconv.Atoi(node[i+1:]); err == nil {
+					base, next = node[:i], n+1
+				}
+			}
+			renamed[node] = node
+			for ; lock.Nodes[renamed[node]] != nil && !sameJSON(lock.Nodes[renamed[node]], saved.Nodes[node]); next++ {
+				renamed[node] = fmt.Sprintf("%s_%d", base, next)
+			}
+			lock.Nodes[renamed[node]] = saved.Nodes[node]
+		}
+		for node := range saved.Nodes {
+			if err := renameNodeInputs(lock, renamed[node], renamed); err != nil {
+				return err
+			}
+		}
+		if err := setNodeInput(lock, lock.Root, name, renamed[saved.Root]); err != nil {
+			return err
+		}
+		if err := lock.write(FlakeLockPath(user)); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove %s: %w", path, err)
+	}
+	return nil
+}
+
+// sameJSON reports whether two JSON documents only differ by their whitespace
+func sameJSON(a, b json.RawMessage) bool {
+	var compactA, compactB bytes.Buffer
+	return json.Compact(&compactA, a) == nil && json.Compact(&compactB, b) == nil && bytes.Equal(compactA.Bytes(), compactB.Bytes())
+}
+
+// renameNodeInputs points the inputs of a node to the new names of the nodes they lock
+func renameNodeInputs(lock *rawFlakeLock, node string, renamed map[string]string) error {
+	for input, target := range lock.inputs(node) {
+		var name string
+		if json.Unmarshal(target, &name) != nil || renamed[name] == name {
+			continue
+		}
+		if err := setNodeInput(lock, node, input, renamed[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setNodeInput points an input of a node to another node, keeping the other fields of the node
+func setNodeInput(lock *rawFlakeLock, node, input, target string) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(lock.Nodes[node], &fields); err != nil {
+		return fmt.Errorf("invalid node '%s' in flake.lock: %w", node, err)
+	}
+	inputs := lock.inputs(node)
+	if inputs == nil {
+		inputs = map[string]json.RawMessage{}
+	}
+	inputs[input], _ = json.Marshal(target)
+
+	var err error
+	if fields["inputs"], err = json.Marshal(inputs); err != nil {
+		return err
+	}
+	lock.Nodes[node], err = json.Marshal(fields)
+	return err
+}
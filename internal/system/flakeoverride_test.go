@@ -0,0 +1,218 @@
+package system
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newFlakeCheckout creates a directory holding a flake.nix
+func newFlakeCheckout(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "flake.nix"), []byte("{ outputs = _: { }; }\n"), 0644); err != nil {
+		t.Fatalf("Failed to write flake.nix: %v", err)
+	}
+	return dir
+}
+
+func TestSetFlakeOverride(t *testing.T) {
+	checkout := newFlakeCheckout(t)
+
+	tests := []struct {
+		name    string
+		flake   string
+		dir     string
+		wantErr string
+	}{
+		{name: "valid", flake: "tools", dir: checkout},
+		{name: "unknown flake", flake: "tols", dir: checkout, wantErr: "flake 'tols' is not in camp.yml - must be one of: tools"},
+		{name: "missing directory", flake: "tools", dir: filepath.Join(checkout, "missing"), wantErr: "is not a directory"},
+		{name: "no flake.nix", flake: "tools", dir: t.TempDir(), wantErr: "has no flake.nix"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := newBackendTestUser(t, "linux")
+			user.Flakes = []Flake{{Name: "tools", URL: "github:team/tools"}}
+
+			override, err := SetFlakeOverride(user, tt.flake, tt.dir, time.Now())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+				}
+				if len(ActiveFlakeOverrides(user)) != 0 {
+					t.Error("Expected no override to be recorded")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SetFlakeOverride() failed: %v", err)
+			}
+			if override.URL() != "path:"+checkout {
+				t.Errorf("Expected URL path:%s, got %s", checkout, override.URL())
+			}
+		})
+	}
+}
+
+func TestFlakeOverrideLifecycle(t *testing.T) {
+	user := newBackendTestUser(t, "linux")
+	user.Flakes = []Flake{
+		{Name: "tools", URL: "github:team/tools", Ref: "v2", Dir: "nix", Outputs: []FlakeOutput{{Name: "homeManagerModules.default", Type: OutputTypeHome}}},
+		{Name: "extras", URL: "github:team/extras", Outputs: []FlakeOutput{{Name: "homeManagerModules.default", Type: OutputTypeHome}}},
+	}
+	checkout := newFlakeCheckout(t)
+
+	before, err := ComputeFingerprint(user, BackendProfile)
+	if err != nil {
+		t.Fatalf("ComputeFingerprint() failed: %v", err)
+	}
+	if _, err := SetFlakeOverride(user, "tools", checkout, time.Now()); err != nil {
+		t.Fatalf("SetFlakeOverride() failed: %v", err)
+	}
+
+	// The checkout replaces the flake, without its pinning fields
+	data := NewTemplateData(user)
+	if data.Flakes[0].FlakeURL() != "path:"+checkout {
+		t.Errorf("Expected the checkout to be rendered, got %s", data.Flakes[0].FlakeURL())
+	}
+	if data.Flakes[1].FlakeURL() != "github:team/extras" {
+		t.Errorf("Expected other flakes to be left alone, got %s", data.Flakes[1].FlakeURL())
+	}
+	if user.Flakes[0].URL != "github:team/tools" {
+		t.Error("Expected the user's flakes to be left untouched")
+	}
+
+	// The checkout is part of the fingerprint, so editing it calls for a rebuild
+	overridden, err := ComputeFingerprint(user, BackendProfile)
+	if err != nil {
+		t.Fatalf("ComputeFingerprint() failed: %v", err)
+	}
+	if overridden.Sum() == before.Sum() {
+		t.Error("Expected the override to change the fingerprint")
+	}
+	if err := os.WriteFile(filepath.Join(checkout, "module.nix"), []byte("{ }\n"), 0644); err != nil {
+		t.Fatalf("Failed to edit checkout: %v", err)
+	}
+	edited, err := ComputeFingerprint(user, BackendProfile)
+	if err != nil {
+		t.Fatalf("ComputeFingerprint() failed: %v", err)
+	}
+	if edited.Inputs[InputOverridePrefix+"tools"] == overridden.Inputs[InputOverridePrefix+"tools"] {
+		t.Error("Expected editing the checkout to change the fingerprint")
+	}
+	if err := os.MkdirAll(filepath.Join(checkout, ".git"), 0755); err != nil {
+		t.Fatalf("Failed to create .git: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(checkout, ".git", "index"), []byte("index"), 0644); err != nil {
+		t.Fatalf("Failed to write .git/index: %v", err)
+	}
+	if committed, _ := ComputeFingerprint(user, BackendProfile); committed.Sum() != edited.Sum() {
+		t.Error("Expected version control data to be left out of the fingerprint")
+	}
+
+	// Overrides of flakes removed from camp.yml are ignored
+	user.Flakes = user.Flakes[1:]
+	if len(ActiveFlakeOverrides(user)) != 0 {
+		t.Errorf("Expected no active override, got %+v", ActiveFlakeOverrides(user))
+	}
+
+	if err := ResetFlakeOverride(user, "tools"); err != nil {
+		t.Fatalf("ResetFlakeOverride() failed: %v", err)
+	}
+	if _, err := os.Stat(flakeOverridesPath(user)); !os.IsNotExist(err) {
+		t.Errorf("Expected the overrides file to be removed, got %v", err)
+	}
+	if err := ResetFlakeOverride(user, "tools"); err == nil || !strings.Contains(err.Error(), "has no development override") {
+		t.Errorf("Expected an error for a flake without override, got %v", err)
+	}
+}
+
+func TestFlakeOverrideKeepsLockedRevision(t *testing.T) {
+	user := newBackendTestUser(t, "linux")
+	user.Flakes = []Flake{{Name: "tools", URL: "github:team/tools"}, {Name: "extras", URL: "github:team/extras"}}
+	checkout := newFlakeCheckout(t)
+	lockedNixpkgs := `{"locked": {"lastModified": 1714000000, "narHash": "sha256-tools", "owner": "NixOS", "repo": "nixpkgs", "rev": "` + homeManagerRev + `", "type": "github"}, "original": {"owner": "NixOS", "repo": "nixpkgs", "type": "github"}}`
+	writeLock := func(nodes map[string]string) {
+		t.Helper()
+		var entries []string
+		for name, node := range nodes {
+			entries = append(entries, `"`+name+`": `+node)
+		}
+		lock := `{"nodes": {` + strings.Join(entries, ",") + `}, "root": "root", "version": 7}`
+		if err := os.WriteFile(FlakeLockPath(user), []byte(lock), 0644); err != nil {
+			t.Fatalf("Failed to write flake.lock: %v", err)
+		}
+	}
+	lockedTools := func(t *testing.T) LockedInput {
+		t.Helper()
+		lock, err := ReadFlakeLock(FlakeLockPath(user))
+		if err != nil {
+			t.Fatalf("ReadFlakeLock() failed: %v", err)
+		}
+		return lock.Inputs()["tools"]
+	}
+	before := map[string]string{
+		"root":      `{"inputs": {"nixpkgs": "nixpkgs", "tools": "tools"}}`,
+		"nixpkgs":   `{"locked": {"lastModified": 1714000000, "owner": "NixOS", "repo": "nixpkgs", "rev": "` + newNixpkgsRev + `", "type": "github"}, "original": {"owner": "NixOS", "repo": "nixpkgs", "type": "github"}}`,
+		"tools":     `{"inputs": {"nixpkgs": "nixpkgs_2"}, "locked": {"lastModified": 1714521600, "narHash": "sha256-pinned", "owner": "team", "repo": "tools", "rev": "` + oldNixpkgsRev + `", "type": "github"}, "original": {"owner": "team", "repo": "tools", "type": "github"}}`,
+		"nixpkgs_2": lockedNixpkgs,
+	}
+
+	t.Run("reset without rebuild", func(t *testing.T) {
+		writeLock(before)
+		if _, err := SetFlakeOverride(user, "tools", checkout, time.Now()); err != nil {
+			t.Fatalf("SetFlakeOverride() failed: %v", err)
+		}
+		if err := ResetFlakeOverride(user, "tools"); err != nil {
+			t.Fatalf("ResetFlakeOverride() failed: %v", err)
+		}
+		if tools := lockedTools(t); tools.Rev != oldNixpkgsRev || tools.Source != "github:team/tools" {
+			t.Errorf("Expected tools to stay locked at %s, got %+v", oldNixpkgsRev, tools)
+		}
+	})
+
+	t.Run("reset after the checkout was locked", func(t *testing.T) {
+		writeLock(before)
+		if _, err := SetFlakeOverride(user, "tools", checkout, time.Now()); err != nil {
+			t.Fatalf("SetFlakeOverride() failed: %v", err)
+		}
+		// A rebuild locks the checkout with its own nixpkgs, and extras added meanwhile takes nixpkgs_2
+		writeLock(map[string]string{
+			"root":      `{"inputs": {"extras": "extras", "nixpkgs": "nixpkgs", "tools": "tools"}}`,
+			"nixpkgs":   before["nixpkgs"],
+			"extras":    `{"inputs": {"nixpkgs": "nixpkgs_2"}, "locked": {"lastModified": 1716163200, "owner": "team", "repo": "extras", "rev": "` + newNixpkgsRev + `", "type": "github"}, "original": {"owner": "team", "repo": "extras", "type": "github"}}`,
+			"nixpkgs_2": `{"locked": {"lastModified": 1716163200, "owner": "NixOS", "repo": "nixpkgs", "rev": "` + newNixpkgsRev + `", "type": "github"}, "original": {"owner": "NixOS", "repo": "nixpkgs", "type": "github"}}`,
+			"tools":     `{"inputs": {"nixpkgs": "nixpkgs_3"}, "locked": {"lastModified": 1717000000, "narHash": "sha256-checkout", "path": "` + checkout + `", "type": "path"}, "original": {"path": "` + checkout + `", "type": "path"}}`,
+			"nixpkgs_3": `{"locked": {"lastModified": 1717000000, "owner": "NixOS", "repo": "nixpkgs", "rev": "` + strings.Repeat("d", 40) + `", "type": "github"}, "original": {"owner": "NixOS", "repo": "nixpkgs", "type": "github"}}`,
+		})
+
+		if err := ResetFlakeOverride(user, "tools"); err != nil {
+			t.Fatalf("ResetFlakeOverride() failed: %v", err)
+		}
+		if tools := lockedTools(t); tools.Rev != oldNixpkgsRev || tools.Source != "github:team/tools" {
+			t.Errorf("Expected tools to be locked at %s again, got %+v", oldNixpkgsRev, tools)
+		}
+
+		// The saved nixpkgs of tools is renamed, the one of extras is left alone
+		lock, err := readRawFlakeLock(FlakeLockPath(user))
+		if err != nil {
+			t.Fatalf("readRawFlakeLock() failed: %v", err)
+		}
+		if got := string(lock.inputs("tools")["nixpkgs"]); got != `"nixpkgs_3"` || !sameJSON(lock.Nodes["nixpkgs_3"], []byte(lockedNixpkgs)) {
+			t.Errorf("Expected tools to use its saved nixpkgs as nixpkgs_3, got %s: %s", got, lock.Nodes["nixpkgs_3"])
+		}
+		if got := string(lock.inputs("extras")["nixpkgs"]); got != `"nixpkgs_2"` || !strings.Contains(string(lock.Nodes["nixpkgs_2"]), newNixpkgsRev) {
+			t.Errorf("Expected extras to keep nixpkgs_2, got %s: %s", got, lock.Nodes["nixpkgs_2"])
+		}
+		if !strings.Contains(string(lock.Nodes["tools"]), "sha256-pinned") {
+			t.Errorf("Expected the narHash of tools to be restored, got %s", lock.Nodes["tools"])
+		}
+		if _, err := os.Stat(flakeOverrideLockPath(user, "tools")); !os.IsNotExist(err) {
+			t.Errorf("Expected the saved entry to be removed, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,339 @@
+package system
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Flake reference types accepted in camp.yml
+const (
+	FlakeRefGitHub   = "github"
+	FlakeRefGitLab   = "gitlab"
+	FlakeRefGit      = "git"
+	FlakeRefPath     = "path"
+	FlakeRefTarball  = "tarball"
+	FlakeRefIndirect = "indirect"
+)
+
+var (
+	// revPattern matches a full git commit hash
+	revPattern = regexp.MustCompile(`^[0-9a-f]{40}$`)
+	// repoNamePattern matches GitHub and GitLab owner and repository names
+	repoNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+	// flakeIDPattern matches the names of flakes in the registry, e.g. "nixpkgs"
+	flakeIDPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]*$`)
+	// tarballExtensions are the archive types Nix fetches as tarball references
+	tarballExtensions = []string{".tar", ".tar.gz", ".tgz", ".tar.xz", ".txz", ".tar.bz2", ".tbz2", ".tar.zst", ".zip"}
+)
+
+// FlakeRef is a parsed flake reference, like "github:NixOS/nixpkgs/nixos-unstable"
+type FlakeRef struct {
+	Type  string // One of the FlakeRef* types
+	Owner string // GitHub and GitLab owner
+	Repo  string // GitHub and GitLab repository
+	Host  string // GitHub and GitLab host, for self-hosted instances
+	URL   string // Repository or archive URL of git and tarball references, without query
+	Path  string // Directory of path references
+	ID    string // Registry name of indirect references
+	Ref   string // Branch or tag
+	Rev   string // Commit hash
+	Dir   string // Subdirectory holding flake.nix
+	// Params holds the other query parameters, e.g. "submodules=1", which are passed through
+	Params url.Values
+}
+
+// ParseFlakeRef parses a flake reference in the URL-like syntax of Nix
+func ParseFlakeRef(ref string) (FlakeRef, error) {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return FlakeRef{}, fmt.Errorf("empty flake reference")
+	}
+
+	// The query holds the parameters shared by all types
+	location, query, _ := strings.Cut(ref, "?")
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return FlakeRef{}, fmt.Errorf("invalid query in %q: %w", ref, err)
+	}
+	r := FlakeRef{
+		Ref:    takeParam(params, "ref"),
+		Rev:    takeParam(params, "rev"),
+		Dir:    takeParam(params, "dir"),
+		Host:   takeParam(params, "host"),
+		Params: params,
+	}
+
+	scheme, rest, hasScheme := strings.Cut(location, ":")
+	switch {
+	case scheme == "github" || scheme == "gitlab":
+		r.Type = scheme
+		err = r.parseRepository(rest)
+	case strings.HasPrefix(scheme, "git+"):
+		r.Type = FlakeRefGit
+		err = r.parseGitURL(strings.TrimPrefix(location, "git+"))
+	case scheme == "path":
+		r.Type = FlakeRefPath
+		r.Path = rest
+	case strings.HasPrefix(scheme, "tarball+"):
+		r.Type = FlakeRefTarball
+		r.URL = strings.TrimPrefix(location, "tarball+")
+	case scheme == "http" || scheme == "https" || scheme == "file":
+		if !isTarballURL(location) {
+			return FlakeRef{}, fmt.Errorf("unsupported flake reference %q - use git+%s for git repositories or tarball+%s for archives", ref, location, location)
+		}
+		r.Type = FlakeRefTarball
+		r.URL = location
+	case scheme == "flake":
+		r.Type = FlakeRefIndirect
+		err = r.parseIndirect(rest)
+	case !hasScheme:
+		r.Type = FlakeRefIndirect
+		err = r.parseIndirect(location)
+	default:
+		return FlakeRef{}, fmt.Errorf("unsupported flake reference type '%s' in %q - must be github:, gitlab:, git+https://, git+ssh://, path:, a tarball URL or a registry name", scheme, ref)
+	}
+	if err != nil {
+		return FlakeRef{}, err
+	}
+	return r, r.Validate()
+}
+
+// takeParam removes a query parameter and returns its value
+func takeParam(params url.Values, name string) string {
+	value := params.Get(name)
+	params.Del(name)
+	return value
+}
+
+// parseRepository parses the "owner/repo[/ref-or-rev]" part of GitHub and GitLab references
+func (r *FlakeRef) parseRepository(rest string) error {
+	parts := strings.Split(rest, "/")
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("%s reference '%s:%s' is missing owner/repo", r.Type, r.Type, rest)
+	}
+	if len(parts) > 3 {
+		return fmt.Errorf("%s reference '%s:%s' has too many path segments - use ?ref= for branches containing slashes", r.Type, r.Type, rest)
+	}
+	r.Owner, r.Repo = parts[0], parts[1]
+
+	// The third segment is a commit when it looks like one, a branch or tag otherwise
+	if len(parts) == 3 {
+		if r.Ref != "" || r.Rev != "" {
+			return fmt.Errorf("%s reference '%s:%s' sets a branch or commit both in the path and in the query", r.Type, r.Type, rest)
+		}
+		if revPattern.MatchString(parts[2]) {
+			r.Rev = parts[2]
+		} else {
+			r.Ref = parts[2]
+		}
+	}
+	return nil
+}
+
+// parseGitURL parses the URL of a git repository, without its query
+func (r *FlakeRef) parseGitURL(location string) error {
+	u, err := url.Parse(location)
+	if err != nil {
+		if strings.Contains(err.Error(), "invalid port") {
+			return fmt.Errorf("invalid git URL 'git+%s' - use git+ssh://host/owner/repo, not host:owner/repo", location)
+		}
+		return fmt.Errorf("invalid git URL 'git+%s': %w", location, err)
+	}
+	switch u.Scheme {
+	case "https", "http", "ssh":
+		if u.Host == "" {
+			return fmt.Errorf("git URL 'git+%s' is missing a host", location)
+		}
+	case "file":
+	default:
+		return fmt.Errorf("unsupported git URL 'git+%s' - must be git+https://, git+ssh:// or git+file://", location)
+	}
+	if strings.Trim(u.Path, "/") == "" {
+		return fmt.Errorf("git URL 'git+%s' is missing the repository path", location)
+	}
+	r.URL = location
+	return nil
+}
+
+// parseIndirect parses "id[/ref[/rev]]" registry references
+func (r *FlakeRef) parseIndirect(rest string) error {
+	parts := strings.Split(rest, "/")
+	if !flakeIDPattern.MatchString(parts[0]) {
+		return fmt.Errorf("invalid flake registry name '%s' - must start with a letter and contain only letters, numbers, hyphens, and underscores", parts[0])
+	}
+	if len(parts) > 3 {
+		return fmt.Errorf("registry reference '%s' has too many path segments", rest)
+	}
+	r.ID = parts[0]
+	for _, part := range parts[1:] {
+		if revPattern.MatchString(part) {
+			r.Rev = part
+		} else {
+			r.Ref = part
+		}
+	}
+	return nil
+}
+
+// isTarballURL reports whether a URL points to an archive
+func isTarballURL(location string) bool {
+	for _, ext := range tarballExtensions {
+		if strings.HasSuffix(location, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks the fields of the reference, including those set from camp.yml
+func (r FlakeRef) Validate() error {
+	if r.Rev != "" && !revPattern.MatchString(r.Rev) {
+		return fmt.Errorf("invalid rev '%s' - must be a full 40 character commit hash", r.Rev)
+	}
+	if r.Ref != "" && !isValidGitRef(r.Ref) {
+		return fmt.Errorf("invalid ref '%s' - must be a branch or tag name", r.Ref)
+	}
+	if r.Dir != "" && (path.IsAbs(r.Dir) || strings.HasPrefix(path.Clean(r.Dir), "..")) {
+		return fmt.Errorf("invalid dir '%s' - must be a relative path inside the flake", r.Dir)
+	}
+
+	switch r.Type {
+	case FlakeRefGitHub, FlakeRefGitLab:
+		if !repoNamePattern.MatchString(r.Owner) || !repoNamePattern.MatchString(r.Repo) {
+			return fmt.Errorf("invalid %s owner/repo '%s/%s'", r.Type, r.Owner, r.Repo)
+		}
+		if r.Ref != "" && r.Rev != "" {
+			return fmt.Errorf("%s references can't set both ref and rev - the rev already pins the commit", r.Type)
+		}
+	case FlakeRefPath:
+		if r.Ref != "" || r.Rev != "" {
+			return fmt.Errorf("path references can't set ref or rev")
+		}
+		if !path.IsAbs(r.Path) {
+			return fmt.Errorf("path '%s' must be absolute - relative paths would be resolved from ~/.camp/nix", r.Path)
+		}
+	case FlakeRefTarball:
+		if r.Ref != "" || r.Rev != "" {
+			return fmt.Errorf("tarball references can't set ref or rev")
+		}
+	}
+
+	if r.Host != "" && r.Type != FlakeRefGitHub && r.Type != FlakeRefGitLab {
+		return fmt.Errorf("host only applies to github and gitlab references - put it in the URL of %s references", r.Type)
+	}
+	return nil
+}
+
+// isValidGitRef checks the rules of git check-ref-format that matter for branch and tag names
+func isValidGitRef(ref string) bool {
+	if strings.HasPrefix(ref, "-") || strings.HasPrefix(ref, "/") || strings.HasSuffix(ref, "/") ||
+		strings.HasSuffix(ref, ".lock") || strings.HasSuffix(ref, ".") || strings.Contains(ref, "..") ||
+		strings.Contains(ref, "@{") || strings.Contains(ref, "//") {
+		return false
+	}
+	return !strings.ContainsAny(ref, " ~^:?*[\\\t\n")
+}
+
+// String renders the canonical URL of the reference
+func (r FlakeRef) String() string {
+	params := url.Values{}
+	for name, values := range r.Params {
+		params[name] = values
+	}
+
+	var location string
+	switch r.Type {
+	case FlakeRefGitHub, FlakeRefGitLab:
+		location = fmt.Sprintf("%s:%s/%s", r.Type, r.Owner, r.Repo)
+		// Branches containing slashes can only be passed in the query
+		if r.Rev != "" {
+			location += "/" + r.Rev
+		} else if strings.Contains(r.Ref, "/") {
+			setParam(params, "ref", r.Ref)
+		} else if r.Ref != "" {
+			location += "/" + r.Ref
+		}
+		setParam(params, "host", r.Host)
+	case FlakeRefGit:
+		location = "git+" + r.URL
+		setParam(params, "ref", r.Ref)
+		setParam(params, "rev", r.Rev)
+	case FlakeRefPath:
+		location = "path:" + r.Path
+	case FlakeRefTarball:
+		location = r.URL
+		if !isTarballURL(location) {
+			location = "tarball+" + location
+		}
+	case FlakeRefIndirect:
+		location = r.ID
+		if r.Ref != "" {
+			location += "/" + r.Ref
+		}
+		if r.Rev != "" {
+			location += "/" + r.Rev
+		}
+	}
+	setParam(params, "dir", r.Dir)
+
+	if len(params) == 0 {
+		return location
+	}
+	// Slashes are valid in queries, and keep refs and dirs readable
+	return location + "?" + strings.ReplaceAll(params.Encode(), "%2F", "/")
+}
+
+// setParam sets a query parameter when value is set
+func setParam(params url.Values, name, value string) {
+	if value != "" {
+		params.Set(name, value)
+	}
+}
+
+// FlakeRef parses the URL of the flake and applies the rev, ref, dir and host fields of camp.yml.
+// Fields conflicting with what the URL already pins are rejected
+func (f Flake) FlakeRef() (FlakeRef, error) {
+	ref, err := ParseFlakeRef(f.URL)
+	if err != nil {
+		return FlakeRef{}, err
+	}
+
+	fields := []struct {
+		name  string
+		value string
+		field *string
+	}{
+		{"rev", f.Rev, &ref.Rev},
+		{"ref", f.Ref, &ref.Ref},
+		{"dir", f.Dir, &ref.Dir},
+		{"host", f.Host, &ref.Host},
+	}
+	for _, field := range fields {
+		if field.value == "" {
+			continue
+		}
+		if *field.field != "" && *field.field != field.value {
+			return FlakeRef{}, fmt.Errorf("%s '%s' conflicts with %s '%s' in the URL", field.name, field.value, field.name, *field.field)
+		}
+		*field.field = field.value
+	}
+
+	// A pinned commit replaces the branch of GitHub and GitLab references
+	if f.Rev != "" && (ref.Type == FlakeRefGitHub || ref.Type == FlakeRefGitLab) && f.Ref == "" {
+		ref.Ref = ""
+	}
+	return ref, ref.Validate()
+}
+
+// FlakeURL returns the canonical URL of the flake, with the rev, ref, dir and host fields of
+// camp.yml applied. The URL is returned as is when it can't be parsed; ValidateFlakes reports it
+func (f Flake) FlakeURL() string {
+	ref, err := f.FlakeRef()
+	if err != nil {
+		return f.URL
+	}
+	return ref.String()
+}
@@ -0,0 +1,166 @@
+package system
+
+import (
+	"strings"
+	"testing"
+)
+
+const testRev = "0123456789abcdef0123456789abcdef01234567"
+
+func TestParseFlakeRef(t *testing.T) {
+	tests := []struct {
+		name      string
+		ref       string
+		wantType  string
+		wantURL   string // Canonical URL, the reference itself when empty
+		checkFunc func(t *testing.T, r FlakeRef)
+	}{
+		{
+			name:     "github",
+			ref:      "github:user/repo",
+			wantType: FlakeRefGitHub,
+			checkFunc: func(t *testing.T, r FlakeRef) {
+				if r.Owner != "user" || r.Repo != "repo" {
+					t.Errorf("Expected user/repo, got %s/%s", r.Owner, r.Repo)
+				}
+			},
+		},
+		{
+			name:     "github branch",
+			ref:      "github:NixOS/nixpkgs/nixos-unstable",
+			wantType: FlakeRefGitHub,
+			checkFunc: func(t *testing.T, r FlakeRef) {
+				if r.Ref != "nixos-unstable" || r.Rev != "" {
+					t.Errorf("Expected ref nixos-unstable, got ref %q rev %q", r.Ref, r.Rev)
+				}
+			},
+		},
+		{
+			name:     "github commit",
+			ref:      "github:user/repo/" + testRev,
+			wantType: FlakeRefGitHub,
+			checkFunc: func(t *testing.T, r FlakeRef) {
+				if r.Rev != testRev || r.Ref != "" {
+					t.Errorf("Expected rev %s, got ref %q rev %q", testRev, r.Ref, r.Rev)
+				}
+			},
+		},
+		{name: "github query", ref: "github:user/repo?ref=v1.2&dir=nix", wantType: FlakeRefGitHub, wantURL: "github:user/repo/v1.2?dir=nix"},
+		{name: "github branch with slashes", ref: "github:user/repo?ref=feature/x", wantType: FlakeRefGitHub},
+		{name: "gitlab self-hosted", ref: "gitlab:team/tools?host=gitlab.example.com", wantType: FlakeRefGitLab},
+		{name: "git over ssh", ref: "git+ssh://git@github.com/org/flake2.git", wantType: FlakeRefGit},
+		{
+			name:     "git over https with params",
+			ref:      "git+https://example.com/repo.git?submodules=1&ref=main",
+			wantType: FlakeRefGit,
+			wantURL:  "git+https://example.com/repo.git?ref=main&submodules=1",
+			checkFunc: func(t *testing.T, r FlakeRef) {
+				if r.URL != "https://example.com/repo.git" || r.Params.Get("submodules") != "1" {
+					t.Errorf("Unexpected git reference: %+v", r)
+				}
+			},
+		},
+		{name: "path", ref: "path:/Users/test/dev/flake3", wantType: FlakeRefPath},
+		{name: "tarball", ref: "https://example.com/flake.tar.gz", wantType: FlakeRefTarball},
+		{name: "tarball with prefix", ref: "tarball+https://example.com/archive/latest", wantType: FlakeRefTarball},
+		{name: "indirect", ref: "nixpkgs", wantType: FlakeRefIndirect},
+		{name: "indirect with flake prefix", ref: "flake:nixpkgs/nixos-24.11", wantType: FlakeRefIndirect, wantURL: "nixpkgs/nixos-24.11"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := ParseFlakeRef(tt.ref)
+			if err != nil {
+				t.Fatalf("ParseFlakeRef(%q) failed: %v", tt.ref, err)
+			}
+			if r.Type != tt.wantType {
+				t.Errorf("Expected type %s, got %s", tt.wantType, r.Type)
+			}
+			wantURL := tt.wantURL
+			if wantURL == "" {
+				wantURL = tt.ref
+			}
+			if r.String() != wantURL {
+				t.Errorf("Expected canonical URL %s, got %s", wantURL, r.String())
+			}
+			if tt.checkFunc != nil {
+				tt.checkFunc(t, r)
+			}
+		})
+	}
+}
+
+func TestParseFlakeRef_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		ref     string
+		wantErr string
+	}{
+		{name: "missing repo", ref: "github:user", wantErr: "is missing owner/repo"},
+		{name: "missing owner", ref: "gitlab:/repo", wantErr: "is missing owner/repo"},
+		{name: "invalid owner", ref: "github:us er/repo", wantErr: "invalid github owner/repo"},
+		{name: "too many segments", ref: "github:user/repo/feature/x", wantErr: "use ?ref= for branches containing slashes"},
+		{name: "short rev", ref: "github:user/repo?rev=abc123", wantErr: "invalid rev 'abc123' - must be a full 40 character commit hash"},
+		{name: "ref and rev", ref: "github:user/repo/main?rev=" + testRev, wantErr: "sets a branch or commit both in the path and in the query"},
+		{name: "invalid ref", ref: "git+https://example.com/repo.git?ref=bad..ref", wantErr: "invalid ref 'bad..ref'"},
+		{name: "scp-like git url", ref: "git+ssh://git@github.com:org/repo.git", wantErr: "not host:owner/repo"},
+		{name: "git url without host", ref: "git+https:///repo.git", wantErr: "is missing a host"},
+		{name: "unsupported git scheme", ref: "git+ftp://example.com/repo.git", wantErr: "must be git+https://, git+ssh:// or git+file://"},
+		{name: "relative path", ref: "path:./flake", wantErr: "must be absolute"},
+		{name: "path with rev", ref: "path:/tmp/flake?rev=" + testRev, wantErr: "path references can't set ref or rev"},
+		{name: "plain https repository", ref: "https://github.com/user/repo", wantErr: "use git+https://github.com/user/repo for git repositories"},
+		{name: "escaping dir", ref: "github:user/repo?dir=../other", wantErr: "invalid dir '../other'"},
+		{name: "host on git", ref: "git+https://example.com/repo.git?host=example.com", wantErr: "host only applies to github and gitlab references"},
+		{name: "unknown type", ref: "svn:repo", wantErr: "unsupported flake reference type 'svn'"},
+		{name: "invalid registry name", ref: "-nixpkgs", wantErr: "invalid flake registry name"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseFlakeRef(tt.ref)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseFlakeRef(%q) = %v, want error containing %q", tt.ref, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFlakeFlakeURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		flake   Flake
+		wantURL string
+		wantErr string
+	}{
+		{name: "url only", flake: Flake{URL: "github:user/repo"}, wantURL: "github:user/repo"},
+		{name: "github ref", flake: Flake{URL: "github:user/repo", Ref: "v2"}, wantURL: "github:user/repo/v2"},
+		{name: "rev replaces branch", flake: Flake{URL: "github:user/repo/main", Rev: testRev}, wantURL: "github:user/repo/" + testRev},
+		{name: "github dir and host", flake: Flake{URL: "github:team/tools", Dir: "nix", Host: "github.example.com"}, wantURL: "github:team/tools?dir=nix&host=github.example.com"},
+		{name: "git ref and rev", flake: Flake{URL: "git+ssh://git@github.com/org/repo.git", Ref: "main", Rev: testRev}, wantURL: "git+ssh://git@github.com/org/repo.git?ref=main&rev=" + testRev},
+		{name: "same value as url", flake: Flake{URL: "github:user/repo?dir=nix", Dir: "nix"}, wantURL: "github:user/repo?dir=nix"},
+		{name: "conflicting dir", flake: Flake{URL: "github:user/repo?dir=nix", Dir: "flake"}, wantErr: "dir 'flake' conflicts with dir 'nix' in the URL"},
+		{name: "invalid rev field", flake: Flake{URL: "github:user/repo", Rev: "main"}, wantErr: "invalid rev 'main'"},
+		{name: "host on path", flake: Flake{URL: "path:/tmp/flake", Host: "example.com"}, wantErr: "host only applies to github and gitlab references"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ref, err := tt.flake.FlakeRef()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("FlakeRef() = %v, want error containing %q", err, tt.wantErr)
+				}
+				if tt.flake.FlakeURL() != tt.flake.URL {
+					t.Errorf("Expected FlakeURL() to fall back to the URL, got %s", tt.flake.FlakeURL())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FlakeRef() failed: %v", err)
+			}
+			if ref.String() != tt.wantURL || tt.flake.FlakeURL() != tt.wantURL {
+				t.Errorf("Expected %s, got %s", tt.wantURL, ref.String())
+			}
+		})
+	}
+}
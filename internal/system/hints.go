@@ -0,0 +1,161 @@
+package system
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Hint maps a known failure, recognized by a pattern in the output of a
+// failed command, to a diagnosis and a suggested fix. Diagnosis and fix can
+// refer to groups of the pattern ($1, ${name}...)
+type Hint struct {
+	Name      string `yaml:"name" json:"name"`
+	Pattern   string `yaml:"pattern" json:"-"` // Regular expression matched against the output
+	Diagnosis string `yaml:"diagnosis" json:"diagnosis"`
+	Fix       string `yaml:"fix" json:"fix"`
+}
+
+// hintsFile is the layout of the user's hint catalogue (~/.camp/hints.yml)
+type hintsFile struct {
+	Hints []Hint `yaml:"hints"`
+}
+
+// builtinHints are the failures camp knows how to diagnose
+var builtinHints = []Hint{
+	{
+		Name:      "file-clobbered",
+		Pattern:   `Existing file '([^']+)' (?:is in the way of|would be clobbered)`,
+		Diagnosis: "home-manager won't replace $1, which it doesn't manage (or whose backup already exists).",
+		Fix:       "Move $1 (and any $1.backup) out of the way, then run 'camp env rebuild' again.",
+	},
+	{
+		Name:      "flakes-disabled",
+		Pattern:   `experimental Nix feature '(flakes|nix-command)' is disabled`,
+		Diagnosis: "The '$1' experimental feature of Nix is not enabled.",
+		Fix:       "Add 'experimental-features = nix-command flakes' to ~/.config/nix/nix.conf, then run the command again.",
+	},
+	{
+		Name:      "dirty-git-tree",
+		Pattern:   `Git tree '([^']+)' is dirty`,
+		Diagnosis: "$1 has uncommitted changes. Nix only sees files tracked by git, so new files are missing from the build.",
+		Fix:       "Run 'git -C $1 add -A' (or commit your changes), then run the command again.",
+	},
+	{
+		Name:      "missing-user",
+		Pattern:   `(?:\$USER|USER environment variable|environment variable 'USER') is (?:not set|empty)|option .home\.username. is used but not defined`,
+		Diagnosis: "The USER environment variable is not set, so home-manager can't tell whose environment to build.",
+		Fix:       "Run 'export USER=$$(id -un)' (or use a login shell), then run the command again.",
+	},
+	{
+		Name:      "daemon-not-running",
+		Pattern:   `cannot connect to socket at '[^']*daemon-socket[^']*'|Connection refused.*nix-daemon|nix-daemon.*(?:is not running|inactive)`,
+		Diagnosis: "The Nix daemon is not running.",
+		Fix:       "Start it with 'sudo systemctl start nix-daemon' on Linux or 'sudo launchctl kickstart -k system/org.nixos.nix-daemon' on macOS.",
+	},
+	{
+		Name:      "sudo-password",
+		Pattern:   `sudo: (?:a terminal is required to read the password|a password is required|no tty present)`,
+		Diagnosis: "Activating the system configuration needs sudo, but sudo couldn't ask for your password.",
+		Fix:       "Run camp from an interactive terminal, or run 'sudo -v' first to cache your credentials.",
+	},
+	{
+		Name:      "missing-tool",
+		Pattern:   `exec: "([^"]+)": executable file not found in \$PATH`,
+		Diagnosis: "'$1' is not installed or not on your PATH.",
+		Fix:       "Run 'camp bootstrap' to install Nix and the tools camp needs, then open a new shell.",
+	},
+}
+
+// HintsPath returns the path of the user's hint catalogue
+func HintsPath(user *User) string {
+	return filepath.Join(user.HomeDir, ".camp", "hints.yml")
+}
+
+// LoadHints returns the built-in hints extended with the user's catalogue.
+// User hints are tried first and replace built-in hints with the same name.
+// If the user's catalogue is invalid, the built-in hints are returned with the error
+func LoadHints(user *User) ([]Hint, error) {
+	data, err := os.ReadFile(HintsPath(user))
+	if os.IsNotExist(err) {
+		return builtinHints, nil
+	} else if err != nil {
+		return builtinHints, fmt.Errorf("failed to read hints file: %w", err)
+	}
+
+	var file hintsFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return builtinHints, fmt.Errorf("failed to parse hints file: %w", err)
+	}
+	if err := validateHints(file.Hints); err != nil {
+		return builtinHints, fmt.Errorf("invalid hints file %s: %w", HintsPath(user), err)
+	}
+
+	hints := file.Hints
+	overridden := map[string]bool{}
+	for _, hint := range file.Hints {
+		overridden[hint.Name] = true
+	}
+	for _, hint := range builtinHints {
+		if !overridden[hint.Name] {
+			hints = append(hints, hint)
+		}
+	}
+	return hints, nil
+}
+
+// validateHints checks that hints are complete and their patterns compile
+func validateHints(hints []Hint) error {
+	for i, hint := range hints {
+		if hint.Name == "" {
+			return fmt.Errorf("hint at index %d has no name", i)
+		}
+		if hint.Pattern == "" || hint.Diagnosis == "" {
+			return fmt.Errorf("hint '%s' must have a pattern and a diagnosis", hint.Name)
+		}
+		if _, err := regexp.Compile(hint.Pattern); err != nil {
+			return fmt.Errorf("hint '%s' has an invalid pattern: %w", hint.Name, err)
+		}
+	}
+	return nil
+}
+
+// MatchHints returns the hints whose pattern matches the output of a failed
+// command, with their diagnosis and fix expanded from the match
+func MatchHints(hints []Hint, output string) []Hint {
+	matched := []Hint{}
+	for _, hint := range hints {
+		pattern, err := regexp.Compile(hint.Pattern)
+		if err != nil {
+			continue
+		}
+		match := pattern.FindStringSubmatchIndex(output)
+		if match == nil {
+			continue
+		}
+		expand := func(template string) string {
+			return string(pattern.ExpandString(nil, template, output, match))
+		}
+		matched = append(matched, Hint{
+			Name:      hint.Name,
+			Pattern:   hint.Pattern,
+			Diagnosis: expand(hint.Diagnosis),
+			Fix:       expand(hint.Fix),
+		})
+	}
+	return matched
+}
+
+// PrintHints prints the diagnosis and fix of matched hints
+func PrintHints(out io.Writer, hints []Hint) {
+	for _, hint := range hints {
+		fmt.Fprintf(out, "\n💡 %s\n", hint.Diagnosis)
+		if hint.Fix != "" {
+			fmt.Fprintf(out, "   Fix: %s\n", hint.Fix)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package system
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMatchHints(t *testing.T) {
+	tests := []struct {
+		name      string
+		output    string
+		hint      string
+		diagnosis string
+		fix       string
+	}{
+		{
+			name:      "clobbered file",
+			output:    "Existing file '/home/alice/.bashrc' would be clobbered by backing up '/home/alice/.bashrc'",
+			hint:      "file-clobbered",
+			diagnosis: "home-manager won't replace /home/alice/.bashrc",
+			fix:       "Move /home/alice/.bashrc (and any /home/alice/.bashrc.backup) out of the way",
+		},
+		{
+			name:      "flakes disabled",
+			output:    "error: experimental Nix feature 'flakes' is disabled; add '--extra-experimental-features flakes' to enable it",
+			hint:      "flakes-disabled",
+			diagnosis: "The 'flakes' experimental feature",
+			fix:       "experimental-features = nix-command flakes",
+		},
+		{
+			name:      "dirty git tree",
+			output:    "warning: Git tree '/home/alice/dotfiles' is dirty\nerror: path '/nix/store/abc-source/new.nix' does not exist",
+			hint:      "dirty-git-tree",
+			diagnosis: "/home/alice/dotfiles has uncommitted changes",
+			fix:       "git -C /home/alice/dotfiles add -A",
+		},
+		{
+			name:      "missing USER",
+			output:    "error: The option `home.username' is used but not defined.",
+			hint:      "missing-user",
+			diagnosis: "The USER environment variable is not set",
+			fix:       "export USER=$(id -un)",
+		},
+		{
+			name:      "daemon not running",
+			output:    "error: cannot connect to socket at '/nix/var/nix/daemon-socket/socket': Connection refused",
+			hint:      "daemon-not-running",
+			diagnosis: "The Nix daemon is not running",
+			fix:       "sudo systemctl start nix-daemon",
+		},
+		{
+			name:      "sudo without terminal",
+			output:    "sudo: a terminal is required to read the password; either use the -S option to read from standard input or configure an askpass helper",
+			hint:      "sudo-password",
+			diagnosis: "needs sudo",
+			fix:       "sudo -v",
+		},
+		{
+			name:      "missing tool",
+			output:    `rebuild failed: rebuild command failed: exec: "home-manager": executable file not found in $PATH`,
+			hint:      "missing-tool",
+			diagnosis: "'home-manager' is not installed",
+			fix:       "camp bootstrap",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matched := MatchHints(builtinHints, tt.output)
+			if len(matched) != 1 {
+				t.Fatalf("Expected exactly one hint, got %+v", matched)
+			}
+			hint := matched[0]
+			if hint.Name != tt.hint {
+				t.Errorf("Expected hint '%s', got '%s'", tt.hint, hint.Name)
+			}
+			if !strings.Contains(hint.Diagnosis, tt.diagnosis) {
+				t.Errorf("Expected diagnosis to contain %q, got %q", tt.diagnosis, hint.Diagnosis)
+			}
+			if !strings.Contains(hint.Fix, tt.fix) {
+				t.Errorf("Expected fix to contain %q, got %q", tt.fix, hint.Fix)
+			}
+		})
+	}
+
+	if matched := MatchHints(builtinHints, "error: attribute 'foo' missing"); len(matched) != 0 {
+		t.Errorf("Expected no hint for unknown errors, got %+v", matched)
+	}
+}
+
+func TestLoadHints(t *testing.T) {
+	writeHints := func(t *testing.T, content string) *User {
+		t.Helper()
+		user := &User{HomeDir: t.TempDir()}
+		if err := os.MkdirAll(filepath.Dir(HintsPath(user)), 0755); err != nil {
+			t.Fatalf("Failed to create .camp directory: %v", err)
+		}
+		if err := os.WriteFile(HintsPath(user), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write hints file: %v", err)
+		}
+		return user
+	}
+
+	t.Run("built-in hints without file", func(t *testing.T) {
+		hints, err := LoadHints(&User{HomeDir: t.TempDir()})
+		if err != nil || len(hints) != len(builtinHints) {
+			t.Errorf("Expected built-in hints, got %d hints and error %v", len(hints), err)
+		}
+	})
+
+	t.Run("user hints extend and override built-in ones", func(t *testing.T) {
+		user := writeHints(t, `
+hints:
+  - name: corporate-proxy
+    pattern: "SSL certificate problem: (.*)"
+    diagnosis: "The proxy intercepted HTTPS traffic ($1)."
+    fix: "Run 'camp env rebuild' with NIX_SSL_CERT_FILE set to the company bundle."
+  - name: flakes-disabled
+    pattern: "experimental Nix feature 'flakes' is disabled"
+    diagnosis: "Flakes are disabled."
+    fix: "Ask IT to enable flakes."
+`)
+		hints, err := LoadHints(user)
+		if err != nil {
+			t.Fatalf("LoadHints() failed: %v", err)
+		}
+		if len(hints) != len(builtinHints)+1 {
+			t.Errorf("Expected %d hints, got %d", len(builtinHints)+1, len(hints))
+		}
+
+		matched := MatchHints(hints, "curl: SSL certificate problem: self signed certificate in chain")
+		if len(matched) != 1 || matched[0].Diagnosis != "The proxy intercepted HTTPS traffic (self signed certificate in chain)." {
+			t.Errorf("Expected user hint to match, got %+v", matched)
+		}
+		matched = MatchHints(hints, "error: experimental Nix feature 'flakes' is disabled")
+		if len(matched) != 1 || matched[0].Fix != "Ask IT to enable flakes." {
+			t.Errorf("Expected user hint to replace the built-in one, got %+v", matched)
+		}
+	})
+
+	invalid := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"invalid YAML", "hints: [", "failed to parse hints file"},
+		{"missing name", "hints:\n  - pattern: x\n    diagnosis: y\n", "has no name"},
+		{"missing diagnosis", "hints:\n  - name: x\n    pattern: y\n", "must have a pattern and a diagnosis"},
+		{"invalid pattern", "hints:\n  - name: x\n    pattern: '('\n    diagnosis: y\n", "invalid pattern"},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			hints, err := LoadHints(writeHints(t, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got: %v", tt.wantErr, err)
+			}
+			if len(hints) != len(builtinHints) {
+				t.Errorf("Expected built-in hints as a fallback, got %d hints", len(hints))
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package system
+
+import (
+	"camp/internal/utils"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// homeManagerBackend manages the user environment with standalone home-manager
+type homeManagerBackend struct{}
+
+func (b *homeManagerBackend) Name() string {
+	return BackendHomeManager
+}
+
+func (b *homeManagerBackend) Prepare(user *User) error {
+	return PrepareEnvironment(user)
+}
+
+func (b *homeManagerBackend) Build(user *User) error {
+	if err := ensureNixDir(user); err != nil {
+		return err
+	}
+	if err := ensureStateDir(user); err != nil {
+		return err
+	}
+	// home-manager build leaves ./result in the working directory
+	if err := runCommandIn(user.StateDir(), "home-manager", withLogFormat("build", "--impure", "--flake", b.flakeRef(user))...); err != nil {
+		return fmt.Errorf("build command failed: %w", err)
+	}
+	return nil
+}
+
+func (b *homeManagerBackend) Switch(user *User) error {
+	if err := ensureNixDir(user); err != nil {
+		return err
+	}
+	if err := runCommand("home-manager", withLogFormat("switch", "--impure", "-b", "backup", "--flake", b.flakeRef(user))...); err != nil {
+		return fmt.Errorf("rebuild command failed: %w", err)
+	}
+	return nil
+}
+
+func (b *homeManagerBackend) Rollback(user *User) error {
+	gens, err := b.Generations(user)
+	if err != nil {
+		return err
+	}
+	previous, err := previousGeneration(gens)
+	if err != nil {
+		return err
+	}
+
+	// home-manager has no rollback command; activating an older
+	// generation is the documented way to go back
+	if err := runCommand(filepath.Join(previous.Path, "activate")); err != nil {
+		return fmt.Errorf("rollback command failed: %w", err)
+	}
+	return nil
+}
+
+func (b *homeManagerBackend) Generations(user *User) ([]Generation, error) {
+	output, err := utils.CommandReturn("home-manager", "generations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list generations: %w", err)
+	}
+	return parseHomeManagerGenerations(output), nil
+}
+
+// flakeRef returns the flake reference of the user's homeConfiguration
+func (b *homeManagerBackend) flakeRef(user *User) string {
+	return fmt.Sprintf("%s#%s", user.NixDir(), user.Name)
+}
+
+// homeManagerGenerationRegex matches lines like
+// "2024-05-01 10:00 : id 42 -> /nix/store/...-home-manager-generation (current)"
+var homeManagerGenerationRegex = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2} \d{2}:\d{2})\s*:\s*id (\d+) -> (\S+)\s*(\(current\))?`)
+
+// parseHomeManagerGenerations parses the output of home-manager generations.
+// home-manager lists the newest generation first and only recent versions
+// mark the current one, so the newest is assumed active when none is marked
+func parseHomeManagerGenerations(output string) []Generation {
+	var gens []Generation
+	anyCurrent := false
+	for _, line := range strings.Split(output, "\n") {
+		matches := homeManagerGenerationRegex.FindStringSubmatch(strings.TrimSpace(line))
+		if matches == nil {
+			continue
+		}
+		id, err := strconv.Atoi(matches[2])
+		if err != nil {
+			continue
+		}
+		current := matches[4] != ""
+		anyCurrent = anyCurrent || current
+		gens = append(gens, Generation{
+			ID:      id,
+			Date:    matches[1],
+			Path:    matches[3],
+			Current: current,
+		})
+	}
+	sort.Slice(gens, func(i, j int) bool { return gens[i].ID < gens[j].ID })
+	if !anyCurrent && len(gens) > 0 {
+		gens[len(gens)-1].Current = true
+	}
+	return gens
+}
@@ -0,0 +1,191 @@
+package system
+
+import (
+	"camp/internal/utils"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultHookTimeout is applied to hooks that don't set a timeout
+const DefaultHookTimeout = 10 * time.Minute
+
+// HookStage identifies when a hook runs
+type HookStage string
+
+const (
+	// HookPreRebuild runs before the environment is prepared for a rebuild
+	HookPreRebuild HookStage = "pre_rebuild"
+	// HookPostRebuild runs after a successful rebuild
+	HookPostRebuild HookStage = "post_rebuild"
+	// HookPreUpdate runs before flake inputs are updated
+	HookPreUpdate HookStage = "pre_update"
+	// HookPostUpdate runs after flake inputs were updated successfully
+	HookPostUpdate HookStage = "post_update"
+	// HookPostBootstrap runs after a successful bootstrap
+	HookPostBootstrap HookStage = "post_bootstrap"
+)
+
+// Hook is a shell command run around a camp operation
+type Hook struct {
+	Command         string `yaml:"command"`                     // Shell command, run with sh -c
+	Timeout         string `yaml:"timeout,omitempty"`           // Maximum duration (e.g. "30s"), defaults to DefaultHookTimeout
+	ContinueOnError bool   `yaml:"continue_on_error,omitempty"` // Don't abort the operation if the hook fails
+}
+
+// UnmarshalYAML allows hooks to be written as a plain command string
+func (h *Hook) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		h.Command = node.Value
+		return nil
+	}
+
+	// Decode through an alias type to avoid recursing into this method
+	type rawHook Hook
+	var raw rawHook
+	if err := node.Decode(&raw); err != nil {
+		return err
+	}
+	*h = Hook(raw)
+	return nil
+}
+
+// timeout returns the configured timeout or the default one
+func (h Hook) timeout() (time.Duration, error) {
+	if h.Timeout == "" {
+		return DefaultHookTimeout, nil
+	}
+	return time.ParseDuration(h.Timeout)
+}
+
+// Hooks holds the hooks configured in camp.yml, per stage
+type Hooks struct {
+	PreRebuild    []Hook `yaml:"pre_rebuild,omitempty"`
+	PostRebuild   []Hook `yaml:"post_rebuild,omitempty"`
+	PreUpdate     []Hook `yaml:"pre_update,omitempty"`
+	PostUpdate    []Hook `yaml:"post_update,omitempty"`
+	PostBootstrap []Hook `yaml:"post_bootstrap,omitempty"`
+}
+
+// ForStage returns the hooks configured for a stage
+func (h Hooks) ForStage(stage HookStage) []Hook {
+	switch stage {
+	case HookPreRebuild:
+		return h.PreRebuild
+	case HookPostRebuild:
+		return h.PostRebuild
+	case HookPreUpdate:
+		return h.PreUpdate
+	case HookPostUpdate:
+		return h.PostUpdate
+	case HookPostBootstrap:
+		return h.PostBootstrap
+	default:
+		return nil
+	}
+}
+
+// hookContext describes the camp operation hooks run for. It is exposed to
+// hooks through CAMP_* environment variables
+type hookContext struct {
+	backend    string // Name of the active backend (empty if none)
+	generation int    // Current generation of the backend (0 if unknown)
+}
+
+// newHookContext builds the hook context for a backend, looking up its current generation
+func newHookContext(user *User, backend Backend) hookContext {
+	if backend == nil {
+		return hookContext{}
+	}
+	hookCtx := hookContext{backend: backend.Name()}
+	gens, err := backend.Generations(user)
+	if err != nil {
+		// The generation is informational, hooks still run without it
+		return hookCtx
+	}
+	if current := CurrentGeneration(gens); current != nil {
+		hookCtx.generation = current.ID
+	}
+	return hookCtx
+}
+
+// ValidateHooks validates the hooks configuration
+func (c *CampConfig) ValidateHooks() error {
+	stages := []HookStage{HookPreRebuild, HookPostRebuild, HookPreUpdate, HookPostUpdate, HookPostBootstrap}
+	for _, stage := range stages {
+		for i, hook := range c.Hooks.ForStage(stage) {
+			if hook.Command == "" {
+				return fmt.Errorf("%s hook at index %d has empty command", stage, i)
+			}
+			timeout, err := hook.timeout()
+			if err != nil || timeout <= 0 {
+				return fmt.Errorf("%s hook at index %d has invalid timeout '%s' - must be a positive duration like 30s or 5m", stage, i, hook.Timeout)
+			}
+		}
+	}
+	return nil
+}
+
+// RunHooks runs the user's hooks for a stage in order. A failing hook aborts
+// the remaining ones unless it is marked continue_on_error. backend may be nil
+// for operations that don't involve one, like bootstrap
+func RunHooks(user *User, stage HookStage, backend Backend, out io.Writer) error {
+	hooks := user.Hooks.ForStage(stage)
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	fmt.Fprintf(out, "Running %s hooks...\n", stage)
+	env := hookEnv(user, stage, newHookContext(user, backend))
+	for _, hook := range hooks {
+		fmt.Fprintf(out, "  → %s\n", hook.Command)
+		if err := runHook(hook, env, out); err != nil {
+			if hook.ContinueOnError {
+				fmt.Fprintf(out, "  ⚠️  Hook failed, continuing: %v\n", err)
+				continue
+			}
+			return &HookError{Stage: stage, Command: hook.Command, Err: err}
+		}
+	}
+	fmt.Fprintf(out, "✓ %s hooks completed\n", stage)
+	return nil
+}
+
+// runHook runs a single hook with its timeout
+func runHook(hook Hook, env []string, out io.Writer) error {
+	timeout, err := hook.timeout()
+	if err != nil {
+		return fmt.Errorf("invalid timeout: %w", err)
+	}
+
+	_, err = utils.Run(context.Background(), utils.Command{
+		Name:    "sh",
+		Args:    []string{"-c", hook.Command},
+		Env:     env,
+		Stdout:  out,
+		Stderr:  out,
+		Timeout: timeout,
+	})
+	return err
+}
+
+// hookEnv returns the camp context variables added to the environment of hook processes
+func hookEnv(user *User, stage HookStage, hookCtx hookContext) []string {
+	env := []string{
+		"CAMP_HOOK=" + string(stage),
+		"CAMP_PLATFORM=" + user.Platform,
+		"CAMP_HOST=" + user.HostName,
+		"CAMP_USER=" + user.Name,
+		"CAMP_CONFIG=" + ConfigPath(user.HomeDir),
+		"CAMP_NIX_DIR=" + user.NixDir(),
+		"CAMP_BACKEND=" + hookCtx.backend,
+	}
+	if hookCtx.generation > 0 {
+		env = append(env, "CAMP_GENERATION="+strconv.Itoa(hookCtx.generation))
+	}
+	return env
+}
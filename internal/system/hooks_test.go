@@ -0,0 +1,174 @@
+package system
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestHooks_UnmarshalYAML(t *testing.T) {
+	data := `
+pre_rebuild:
+  - echo shorthand
+  - command: echo full
+    timeout: 30s
+    continue_on_error: true
+post_bootstrap:
+  - ./setup.sh
+`
+	var hooks Hooks
+	if err := yaml.Unmarshal([]byte(data), &hooks); err != nil {
+		t.Fatalf("Failed to parse hooks: %v", err)
+	}
+
+	if len(hooks.PreRebuild) != 2 {
+		t.Fatalf("Expected 2 pre_rebuild hooks, got %d", len(hooks.PreRebuild))
+	}
+	if hooks.PreRebuild[0] != (Hook{Command: "echo shorthand"}) {
+		t.Errorf("Unexpected shorthand hook: %+v", hooks.PreRebuild[0])
+	}
+	expected := Hook{Command: "echo full", Timeout: "30s", ContinueOnError: true}
+	if hooks.PreRebuild[1] != expected {
+		t.Errorf("Expected %+v, got %+v", expected, hooks.PreRebuild[1])
+	}
+	if len(hooks.ForStage(HookPostBootstrap)) != 1 || len(hooks.ForStage(HookPostUpdate)) != 0 {
+		t.Errorf("Unexpected hooks per stage: %+v", hooks)
+	}
+}
+
+func TestValidateHooks(t *testing.T) {
+	tests := []struct {
+		name    string
+		hook    Hook
+		wantErr string
+	}{
+		{"valid", Hook{Command: "true"}, ""},
+		{"valid timeout", Hook{Command: "true", Timeout: "5m"}, ""},
+		{"empty command", Hook{}, "empty command"},
+		{"invalid timeout", Hook{Command: "true", Timeout: "soon"}, "invalid timeout"},
+		{"negative timeout", Hook{Command: "true", Timeout: "-1s"}, "invalid timeout"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &CampConfig{Hooks: Hooks{PostUpdate: []Hook{tt.hook}}}
+			err := config.ValidateHooks()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Expected no error, got: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing '%s', got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestRunHooks(t *testing.T) {
+	t.Run("exposes camp context", func(t *testing.T) {
+		user := newBackendTestUser(t, "linux")
+		envFile := filepath.Join(user.HomeDir, "env.txt")
+		user.Hooks.PostRebuild = []Hook{{Command: "env | grep ^CAMP_ > " + envFile}}
+		fake := &FakeBackend{GenerationList: []Generation{{ID: 6}, {ID: 7, Current: true}}}
+
+		var output bytes.Buffer
+		if err := RunHooks(user, HookPostRebuild, fake, &output); err != nil {
+			t.Fatalf("RunHooks() failed: %v", err)
+		}
+
+		data, err := os.ReadFile(envFile)
+		if err != nil {
+			t.Fatalf("Hook did not run: %v", err)
+		}
+		for _, want := range []string{
+			"CAMP_HOOK=post_rebuild",
+			"CAMP_PLATFORM=linux",
+			"CAMP_HOST=testhost",
+			"CAMP_USER=testuser",
+			"CAMP_NIX_DIR=" + user.NixDir(),
+			"CAMP_BACKEND=fake",
+			"CAMP_GENERATION=7",
+		} {
+			if !strings.Contains(string(data), want+"\n") {
+				t.Errorf("Expected hook environment to contain %s, got:\n%s", want, data)
+			}
+		}
+	})
+
+	t.Run("omits generation without backend", func(t *testing.T) {
+		user := newBackendTestUser(t, "linux")
+		user.Hooks.PostBootstrap = []Hook{{Command: `test -z "$CAMP_GENERATION" && test -z "$CAMP_BACKEND"`}}
+		if err := RunHooks(user, HookPostBootstrap, nil, &bytes.Buffer{}); err != nil {
+			t.Errorf("RunHooks() failed: %v", err)
+		}
+	})
+
+	t.Run("aborts on failure", func(t *testing.T) {
+		user := newBackendTestUser(t, "linux")
+		marker := filepath.Join(user.HomeDir, "second")
+		user.Hooks.PreUpdate = []Hook{{Command: "exit 3"}, {Command: "touch " + marker}}
+
+		err := RunHooks(user, HookPreUpdate, nil, &bytes.Buffer{})
+		if err == nil || !strings.Contains(err.Error(), "pre_update hook 'exit 3' failed") {
+			t.Errorf("Expected hook failure, got: %v", err)
+		}
+		if _, err := os.Stat(marker); !os.IsNotExist(err) {
+			t.Error("Hooks after a failing hook should not run")
+		}
+	})
+
+	t.Run("continues on error when configured", func(t *testing.T) {
+		user := newBackendTestUser(t, "linux")
+		marker := filepath.Join(user.HomeDir, "second")
+		user.Hooks.PreUpdate = []Hook{{Command: "exit 3", ContinueOnError: true}, {Command: "touch " + marker}}
+
+		var output bytes.Buffer
+		if err := RunHooks(user, HookPreUpdate, nil, &output); err != nil {
+			t.Fatalf("Expected failure to be ignored, got: %v", err)
+		}
+		if _, err := os.Stat(marker); err != nil {
+			t.Error("Hooks after an ignored failure should run")
+		}
+		if !strings.Contains(output.String(), "Hook failed, continuing") {
+			t.Errorf("Expected warning in output, got:\n%s", output.String())
+		}
+	})
+
+	t.Run("times out", func(t *testing.T) {
+		user := newBackendTestUser(t, "linux")
+		user.Hooks.PreRebuild = []Hook{{Command: "sleep 5", Timeout: "100ms"}}
+
+		err := RunHooks(user, HookPreRebuild, nil, &bytes.Buffer{})
+		if err == nil || !strings.Contains(err.Error(), "timed out after 100ms") {
+			t.Errorf("Expected timeout error, got: %v", err)
+		}
+	})
+
+	t.Run("ignores generation lookup errors", func(t *testing.T) {
+		user := newBackendTestUser(t, "linux")
+		user.Hooks.PreRebuild = []Hook{{Command: `test "$CAMP_BACKEND" = fake`}}
+		fake := &FakeBackend{GenerationsErr: errors.New("no generations")}
+		if err := RunHooks(user, HookPreRebuild, fake, &bytes.Buffer{}); err != nil {
+			t.Errorf("RunHooks() failed: %v", err)
+		}
+	})
+
+	t.Run("no hooks", func(t *testing.T) {
+		user := newBackendTestUser(t, "linux")
+		fake := &FakeBackend{}
+		var output bytes.Buffer
+		if err := RunHooks(user, HookPreRebuild, fake, &output); err != nil {
+			t.Errorf("RunHooks() failed: %v", err)
+		}
+		if output.Len() != 0 || len(fake.Calls) != 0 {
+			t.Errorf("Expected nothing to happen without hooks, got output %q and calls %v", output.String(), fake.Calls)
+		}
+	})
+}
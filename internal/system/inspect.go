@@ -0,0 +1,294 @@
+package system
+
+import (
+	"bytes"
+	"camp/internal/utils"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// moduleOutputs maps the flake outputs holding modules to the configuration they apply to
+var moduleOutputs = map[string]struct {
+	kind       string
+	outputType FlakeOutputType
+}{
+	"homeManagerModules": {"home-manager", OutputTypeHome},
+	"homeModules":        {"home-manager", OutputTypeHome},
+	"darwinModules":      {"nix-darwin", OutputTypeSystem},
+	"nixosModules":       {"nixos", OutputTypeSystem},
+}
+
+// campArgs are the arguments camp passes to every flake output it imports
+var campArgs = []string{"userName", "hostName", "home"}
+
+// moduleArgsExpr maps each module of an output to the arguments it takes, or null when it isn't a function
+const moduleArgsExpr = `mods: builtins.mapAttrs (_: m: if builtins.isFunction m then builtins.attrNames (builtins.functionArgs m) else null) mods`
+
+// FlakeModule is a module exposed by a flake
+type FlakeModule struct {
+	Output   string          `json:"output"` // Output name for camp.yml, e.g. "homeManagerModules.default"
+	Kind     string          `json:"kind"`   // home-manager, nix-darwin or nixos
+	Type     FlakeOutputType `json:"type"`
+	Function bool            `json:"function"`       // Whether the module is a function
+	Args     []string        `json:"args,omitempty"` // Named arguments of the function
+	CampArgs bool            `json:"camp_args"`      // Whether the function expects camp's userName/hostName/home arguments
+}
+
+// FlakeInspection lists what a flake exposes
+type FlakeInspection struct {
+	URL     string        `json:"url"`
+	Outputs []string      `json:"outputs"` // Top-level outputs, e.g. "packages"
+	Modules []FlakeModule `json:"modules"`
+}
+
+// InspectFlake lists the outputs of a flake with 'nix flake show' and evaluates
+// its home-manager, nix-darwin and NixOS modules to find those camp can import
+func InspectFlake(ctx context.Context, url string) (*FlakeInspection, error) {
+	result, err := utils.Run(ctx, utils.Command{
+		Name:    "nix",
+		Args:    nixCommandArgs("flake", "show", "--json", url),
+		Capture: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("nix flake show %s failed: %w", url, err)
+	}
+
+	var outputs map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(result.Stdout), &outputs); err != nil {
+		return nil, fmt.Errorf("failed to parse nix flake show output: %w", err)
+	}
+
+	inspection := &FlakeInspection{URL: url, Outputs: []string{}, Modules: []FlakeModule{}}
+	for name := range outputs {
+		inspection.Outputs = append(inspection.Outputs, name)
+	}
+	sort.Strings(inspection.Outputs)
+
+	// Nix doesn't describe modules, they are evaluated to get their arguments
+	for _, output := range inspection.Outputs {
+		category, ok := moduleOutputs[output]
+		if !ok {
+			continue
+		}
+		modules, err := inspectModules(ctx, url, output)
+		if err != nil {
+			return nil, err
+		}
+		for name, args := range modules {
+			module := FlakeModule{
+				Output:   output + "." + name,
+				Kind:     category.kind,
+				Type:     category.outputType,
+				Function: args != nil,
+				Args:     args,
+			}
+			for _, arg := range args {
+				for _, campArg := range campArgs {
+					module.CampArgs = module.CampArgs || arg == campArg
+				}
+			}
+			inspection.Modules = append(inspection.Modules, module)
+		}
+	}
+	sort.Slice(inspection.Modules, func(i, j int) bool { return inspection.Modules[i].Output < inspection.Modules[j].Output })
+	return inspection, nil
+}
+
+// inspectModules returns the arguments of each module of an output, nil for modules that aren't functions
+func inspectModules(ctx context.Context, url, output string) (map[string][]string, error) {
+	result, err := utils.Run(ctx, utils.Command{
+		Name:    "nix",
+		Args:    nixCommandArgs("eval", "--json", url+"#"+output, "--apply", moduleArgsExpr),
+		Capture: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate %s of %s: %w", output, url, err)
+	}
+	var modules map[string][]string
+	if err := json.Unmarshal([]byte(result.Stdout), &modules); err != nil {
+		return nil, fmt.Errorf("failed to parse the modules of %s: %w", output, err)
+	}
+	return modules, nil
+}
+
+// SuggestFlake returns a flakes entry importing the modules of an inspected flake.
+// For each kind of module, those taking camp's arguments are called; a flake
+// without any gets its plain "default" module, or else all of its plain modules,
+// imported as-is (call: false). System modules are only imported when they match
+// systemKind, the kind of system configuration of the backend ("nix-darwin" or
+// "nixos"), since camp imports them in whichever system configuration it builds
+func SuggestFlake(name string, inspection *FlakeInspection, systemKind string) Flake {
+	flake := Flake{Name: name, URL: inspection.URL}
+	for _, kind := range []string{"home-manager", systemKind} {
+		var called, plain []FlakeModule
+		var plainDefault *FlakeModule
+		for i, module := range inspection.Modules {
+			switch {
+			case module.Kind != kind:
+			case module.CampArgs:
+				called = append(called, module)
+			case strings.HasSuffix(module.Output, ".default"):
+				plainDefault = &inspection.Modules[i]
+			default:
+				plain = append(plain, module)
+			}
+		}
+
+		if len(called) > 0 {
+			for _, module := range called {
+				flake.Outputs = append(flake.Outputs, FlakeOutput{Name: module.Output, Type: module.Type})
+			}
+			continue
+		}
+		if plainDefault != nil {
+			plain = []FlakeModule{*plainDefault}
+		}
+		for _, module := range plain {
+			noCall := false
+			flake.Outputs = append(flake.Outputs, FlakeOutput{Name: module.Output, Type: module.Type, Call: &noCall})
+		}
+	}
+	return flake
+}
+
+// flakeNameReplacer matches the characters not allowed in flake names
+var flakeNameReplacer = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// DefaultFlakeName derives a flake name for camp.yml from a flake reference, e.g. "tools" for "github:team/tools"
+func DefaultFlakeName(ref FlakeRef) string {
+	var name string
+	switch ref.Type {
+	case FlakeRefGitHub, FlakeRefGitLab:
+		name = ref.Repo
+	case FlakeRefIndirect:
+		name = ref.ID
+	case FlakeRefPath:
+		name = filepath.Base(ref.Path)
+	default:
+		name = ref.URL[strings.LastIndex(ref.URL, "/")+1:]
+		name, _, _ = strings.Cut(name, ".")
+	}
+	if ref.Dir != "" {
+		name += "-" + filepath.Base(ref.Dir)
+	}
+	name = strings.Trim(flakeNameReplacer.ReplaceAllString(name, "-"), "-")
+	if name == "" {
+		return "flake"
+	}
+	return name
+}
+
+// flakeEntry is how a new flake is written to camp.yml, leaving out empty fields
+type flakeEntry struct {
+	Name    string        `yaml:"name"`
+	URL     string        `yaml:"url"`
+	Outputs []FlakeOutput `yaml:"outputs"`
+}
+
+// FlakeEntryYAML returns a flakes entry as it would be written to camp.yml
+func FlakeEntryYAML(flake Flake) (string, error) {
+	data, err := encodeYAML([]flakeEntry{{Name: flake.Name, URL: flake.URL, Outputs: flake.Outputs}})
+	if err != nil {
+		return "", err
+	}
+	return "flakes:\n" + indentLines(string(data), "  "), nil
+}
+
+// AddFlakeToConfig appends a flake to the flakes of the camp.yml at path, keeping
+// its comments. The resulting configuration is validated before it is written
+func AddFlakeToConfig(path string, flake Flake) error {
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("failed to parse config file: %w", err)
+	}
+	if len(doc.Content) == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("failed to parse config file: expected a mapping at the top level")
+	}
+
+	// Create the flakes list when camp.yml has none, or an empty one
+	flakes := mappingValue(root, "flakes")
+	if flakes == nil {
+		flakes = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "flakes"}, flakes)
+	} else if flakes.Kind == yaml.ScalarNode && (flakes.Tag == "!!null" || flakes.Value == "") {
+		*flakes = yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	}
+	if flakes.Kind != yaml.SequenceNode {
+		return fmt.Errorf("failed to parse config file: flakes must be a list")
+	}
+
+	var entry yaml.Node
+	if err := entry.Encode(flakeEntry{Name: flake.Name, URL: flake.URL, Outputs: flake.Outputs}); err != nil {
+		return fmt.Errorf("failed to encode flake: %w", err)
+	}
+	flakes.Style = 0
+	flakes.Content = append(flakes.Content, &entry)
+
+	updated, err := encodeYAML(&doc)
+	if err != nil {
+		return err
+	}
+	var config CampConfig
+	if err := yaml.Unmarshal(updated, &config); err != nil {
+		return fmt.Errorf("failed to parse updated config: %w", err)
+	}
+	if err := config.Validate(); err != nil {
+		return &ConfigError{Err: fmt.Errorf("invalid configuration: %w", err)}
+	}
+
+	// Replace camp.yml at once, so it is never left half written
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, updated, 0644); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	return nil
+}
+
+// encodeYAML encodes v with the 2 space indentation of camp.yml
+func encodeYAML(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(v); err != nil {
+		return nil, fmt.Errorf("failed to encode YAML: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode YAML: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// indentLines prefixes every non-empty line of s
+func indentLines(s, prefix string) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = prefix + line
+		}
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
@@ -0,0 +1,227 @@
+package system
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"camp/internal/utils"
+)
+
+// stubFlakeShow makes nix describe a flake with home-manager and nix-darwin modules
+func stubFlakeShow(t *testing.T) *utils.FakeRunner {
+	t.Helper()
+	fake := stubCommands(t, "")
+	fake.Respond = func(command utils.Command) (string, error) {
+		args := strings.Join(command.Args, " ")
+		switch {
+		case strings.Contains(args, "flake show"):
+			return `{"homeManagerModules": {"type": "unknown"}, "darwinModules": {"type": "unknown"}, "packages": {"x86_64-linux": {}}}`, nil
+		case strings.Contains(args, "#homeManagerModules"):
+			return `{"default": ["hostName", "userName"], "plain": ["config", "lib", "pkgs"], "file": null}`, nil
+		case strings.Contains(args, "#darwinModules"):
+			return `{"company": ["home", "userName"]}`, nil
+		}
+		return "", nil
+	}
+	return fake
+}
+
+func TestInspectFlake(t *testing.T) {
+	fake := stubFlakeShow(t)
+
+	inspection, err := InspectFlake(context.Background(), "github:team/tools")
+	if err != nil {
+		t.Fatalf("InspectFlake() failed: %v", err)
+	}
+
+	want := []string{
+		"nix --extra-experimental-features nix-command --extra-experimental-features flakes flake show --json github:team/tools",
+		"nix --extra-experimental-features nix-command --extra-experimental-features flakes eval --json github:team/tools#darwinModules --apply " + moduleArgsExpr,
+		"nix --extra-experimental-features nix-command --extra-experimental-features flakes eval --json github:team/tools#homeManagerModules --apply " + moduleArgsExpr,
+	}
+	if got := fake.Commands(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Expected commands:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+	if strings.Join(inspection.Outputs, ",") != "darwinModules,homeManagerModules,packages" {
+		t.Errorf("Unexpected outputs: %v", inspection.Outputs)
+	}
+
+	var modules []string
+	for _, module := range inspection.Modules {
+		modules = append(modules, module.Output+":"+module.Kind+":"+strings.Join(module.Args, "+"))
+		if module.CampArgs != (module.Output == "darwinModules.company" || module.Output == "homeManagerModules.default") {
+			t.Errorf("Unexpected camp_args for %+v", module)
+		}
+	}
+	wantModules := "darwinModules.company:nix-darwin:home+userName,homeManagerModules.default:home-manager:hostName+userName,homeManagerModules.file:home-manager:,homeManagerModules.plain:home-manager:config+lib+pkgs"
+	if strings.Join(modules, ",") != wantModules {
+		t.Errorf("Expected modules %s, got %s", wantModules, strings.Join(modules, ","))
+	}
+
+	// System modules are only suggested for the matching backend
+	tests := []struct {
+		systemKind string
+		want       int
+	}{
+		{systemKind: "", want: 1},
+		{systemKind: "nix-darwin", want: 2},
+		{systemKind: "nixos", want: 1},
+	}
+	for _, tt := range tests {
+		flake := SuggestFlake("tools", inspection, tt.systemKind)
+		if len(flake.Outputs) != tt.want {
+			t.Errorf("Expected %d outputs for %q, got %+v", tt.want, tt.systemKind, flake.Outputs)
+		}
+	}
+}
+
+func TestSuggestFlake(t *testing.T) {
+	tests := []struct {
+		name    string
+		modules []FlakeModule
+		want    string
+	}{
+		{
+			name: "camp modules are called",
+			modules: []FlakeModule{
+				{Output: "homeManagerModules.default", Kind: "home-manager", Type: OutputTypeHome},
+				{Output: "homeManagerModules.tools", Kind: "home-manager", Type: OutputTypeHome, CampArgs: true},
+			},
+			want: "homeManagerModules.tools:call",
+		},
+		{
+			name: "plain default module",
+			modules: []FlakeModule{
+				{Output: "homeManagerModules.default", Kind: "home-manager", Type: OutputTypeHome},
+				{Output: "homeManagerModules.git", Kind: "home-manager", Type: OutputTypeHome},
+				{Output: "darwinModules.default", Kind: "nix-darwin", Type: OutputTypeSystem, Function: true},
+			},
+			want: "homeManagerModules.default:import,darwinModules.default:import",
+		},
+		{
+			name: "plain modules without default",
+			modules: []FlakeModule{
+				{Output: "homeManagerModules.git", Kind: "home-manager", Type: OutputTypeHome},
+				{Output: "homeManagerModules.shell", Kind: "home-manager", Type: OutputTypeHome},
+				{Output: "nixosModules.default", Kind: "nixos", Type: OutputTypeSystem},
+			},
+			want: "homeManagerModules.git:import,homeManagerModules.shell:import",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flake := SuggestFlake("tools", &FlakeInspection{URL: "github:team/tools", Modules: tt.modules}, "nix-darwin")
+			var got []string
+			for _, output := range flake.Outputs {
+				mode := "call"
+				if !output.Calls() {
+					mode = "import"
+				}
+				got = append(got, output.Name+":"+mode)
+			}
+			if strings.Join(got, ",") != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, strings.Join(got, ","))
+			}
+		})
+	}
+}
+
+func TestDefaultFlakeName(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want string
+	}{
+		{ref: "github:team/tools", want: "tools"},
+		{ref: "github:team/dev.tools?dir=nix/home", want: "dev-tools-home"},
+		{ref: "git+ssh://git@github.com/company/nix-tools.git", want: "nix-tools"},
+		{ref: "path:/Users/test/dev/my-flake", want: "my-flake"},
+		{ref: "https://example.com/flake.tar.gz", want: "flake"},
+		{ref: "nixpkgs/nixos-24.11", want: "nixpkgs"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			ref, err := ParseFlakeRef(tt.ref)
+			if err != nil {
+				t.Fatalf("ParseFlakeRef() failed: %v", err)
+			}
+			if got := DefaultFlakeName(ref); got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestAddFlakeToConfig(t *testing.T) {
+	flake := Flake{Name: "tools", URL: "github:team/tools", Outputs: []FlakeOutput{{Name: "homeManagerModules.default", Type: OutputTypeHome}}}
+	tests := []struct {
+		name     string
+		existing string
+		plain    bool // Import the module as-is
+		want     string
+		wantErr  string
+	}{
+		{
+			name:     "appends and keeps comments",
+			existing: "# My environment\nenv:\n  EDITOR: nvim # the best\nflakes:\n  - name: dotfiles\n    url: github:me/dotfiles\n    outputs:\n      - name: homeManagerModules.default\n        type: home\n",
+			want:     "# My environment\nenv:\n  EDITOR: nvim # the best\nflakes:\n  - name: dotfiles\n    url: github:me/dotfiles\n    outputs:\n      - name: homeManagerModules.default\n        type: home\n  - name: tools\n    url: github:team/tools\n    outputs:\n      - name: homeManagerModules.default\n        type: home\n",
+		},
+		{
+			name:     "creates the flakes list",
+			existing: "packages:\n  - git\n",
+			want:     "packages:\n  - git\nflakes:\n  - name: tools\n    url: github:team/tools\n    outputs:\n      - name: homeManagerModules.default\n        type: home\n",
+		},
+		{
+			name:     "fills an empty flakes list",
+			existing: "flakes: []\n",
+			want:     "flakes:\n  - name: tools\n    url: github:team/tools\n    outputs:\n      - name: homeManagerModules.default\n        type: home\n",
+		},
+		{
+			name:     "writes plain modules",
+			existing: "flakes:\n",
+			plain:    true,
+			want:     "flakes:\n  - name: tools\n    url: github:team/tools\n    outputs:\n      - name: homeManagerModules.default\n        type: home\n        call: false\n",
+		},
+		{
+			name:     "rejects duplicate names",
+			existing: "flakes:\n  - name: tools\n    url: github:other/tools\n    outputs:\n      - name: default\n        type: home\n",
+			wantErr:  "duplicate flake name 'tools'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "camp.yml")
+			if err := os.WriteFile(path, []byte(tt.existing), 0644); err != nil {
+				t.Fatalf("Failed to write config: %v", err)
+			}
+
+			entry := flake
+			if tt.plain {
+				noCall := false
+				entry.Outputs = []FlakeOutput{{Name: "homeManagerModules.default", Type: OutputTypeHome, Call: &noCall}}
+			}
+			err := AddFlakeToConfig(path, entry)
+			content, _ := os.ReadFile(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+				}
+				if string(content) != tt.existing {
+					t.Errorf("Expected camp.yml to be left untouched, got:\n%s", content)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("AddFlakeToConfig() failed: %v", err)
+			}
+			if string(content) != tt.want {
+				t.Errorf("Expected:\n%s\ngot:\n%s", tt.want, content)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package system
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// lockPollInterval is how often a waiting command retries to acquire the lock.
+// It can be overridden in tests
+var lockPollInterval = 200 * time.Millisecond
+
+// LockInfo describes the camp command holding the lock on ~/.camp
+type LockInfo struct {
+	PID       int       `json:"pid"`
+	Command   string    `json:"command"` // camp command holding the lock (e.g. "camp env rebuild")
+	StartedAt time.Time `json:"started_at"`
+}
+
+// String describes the holder for humans, e.g. "'camp env rebuild' (PID 42, started 3m0s ago)"
+func (i LockInfo) String() string {
+	if i.PID == 0 {
+		return "another camp command"
+	}
+	description := fmt.Sprintf("'%s' (PID %d", i.Command, i.PID)
+	if !i.StartedAt.IsZero() {
+		description += fmt.Sprintf(", started %s ago", time.Since(i.StartedAt).Round(time.Second))
+	}
+	return description + ")"
+}
+
+// LockError reports that another camp command holds the lock on ~/.camp
+type LockError struct {
+	Holder LockInfo
+	Waited time.Duration // How long the command waited for the lock, zero without --wait
+}
+
+func (e *LockError) Error() string {
+	message := fmt.Sprintf("~/.camp is locked by %s", e.Holder)
+	if e.Waited > 0 {
+		return fmt.Sprintf("%s, gave up after waiting %s", message, e.Waited)
+	}
+	return message + "; use --wait to wait for it to finish"
+}
+
+// LockPath returns the path of the lock file serializing the commands that modify ~/.camp
+func LockPath(user *User) string {
+	return filepath.Join(user.HomeDir, ".camp", "camp.lock")
+}
+
+// Lock is an exclusive advisory lock on ~/.camp held by the running command
+type Lock struct {
+	path string
+	file *os.File
+}
+
+// AcquireLock takes the lock on ~/.camp for command.
+//
+// When another camp command holds the lock, AcquireLock returns a LockError describing
+// it, or with wait > 0, retries until the lock is released or wait elapses. Progress
+// messages (waiting, stale lock) are written to out.
+//
+// The lock is a flock on ~/.camp/camp.lock, released by the system when its holder exits,
+// even if it crashes. The file also records the PID and command of its holder: finding a
+// record when acquiring the lock means the previous holder exited without releasing it.
+func AcquireLock(user *User, command string, wait time.Duration, out io.Writer) (*Lock, error) {
+	path := LockPath(user)
+	deadline := time.Now().Add(wait)
+	waiting := false
+	var file *os.File
+	for {
+		var err error
+		file, err = openLockFile(path)
+		if err != nil {
+			return nil, err
+		}
+		locked, err := tryLockFile(file)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+		}
+		if locked {
+			if isLockFile(file, path) {
+				break
+			}
+			// The holder removed the lock file before releasing it (camp env nuke
+			// deletes ~/.camp): other commands lock the new file, not this one
+			unlockFile(file)
+			file.Close()
+			continue
+		}
+
+		holder := readLockInfo(file)
+		file.Close()
+		if wait <= 0 {
+			return nil, &LockError{Holder: holder}
+		}
+		if time.Now().After(deadline) {
+			return nil, &LockError{Holder: holder, Waited: wait}
+		}
+		if !waiting {
+			fmt.Fprintf(out, "Waiting for %s to finish...\n", holder)
+			waiting = true
+		}
+		time.Sleep(lockPollInterval)
+	}
+
+	// A record left in the file belongs to a holder that didn't release the lock
+	if previous := readLockInfo(file); previous.PID != 0 {
+		fmt.Fprintf(out, "⚠️  Removed stale lock left by %s, which exited without releasing it\n", previous)
+	}
+
+	info := LockInfo{PID: os.Getpid(), Command: command, StartedAt: time.Now()}
+	if err := writeLockInfo(file, info); err != nil {
+		unlockFile(file)
+		file.Close()
+		return nil, fmt.Errorf("failed to write lock file: %w", err)
+	}
+	return &Lock{path: path, file: file}, nil
+}
+
+// openLockFile opens the lock file, creating it and ~/.camp if needed
+func openLockFile(path string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create camp directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+	return file, nil
+}
+
+// isLockFile reports whether file is still the file at path, and not one
+// removed (or replaced) since it was opened
+func isLockFile(file *os.File, path string) bool {
+	opened, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	current, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(opened, current)
+}
+
+// Release clears the holder record and releases the lock
+func (l *Lock) Release() error {
+	if err := l.file.Truncate(0); err != nil {
+		unlockFile(l.file)
+		l.file.Close()
+		return fmt.Errorf("failed to clear lock file: %w", err)
+	}
+	if err := unlockFile(l.file); err != nil {
+		l.file.Close()
+		return fmt.Errorf("failed to unlock %s: %w", l.path, err)
+	}
+	return l.file.Close()
+}
+
+// readLockInfo reads the holder record of the lock file. A missing or unreadable
+// record (e.g. being written by the holder) is returned as an unknown holder
+func readLockInfo(file *os.File) LockInfo {
+	var info LockInfo
+	content, err := io.ReadAll(io.NewSectionReader(file, 0, 1<<16))
+	if err != nil || json.Unmarshal(content, &info) != nil {
+		return LockInfo{}
+	}
+	return info
+}
+
+// writeLockInfo replaces the holder record of the lock file
+func writeLockInfo(file *os.File, info LockInfo) error {
+	content, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	if err := file.Truncate(0); err != nil {
+		return err
+	}
+	_, err = file.WriteAt(append(content, '\n'), 0)
+	return err
+}
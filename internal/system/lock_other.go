@@ -0,0 +1,15 @@
+//go:build !unix
+
+package system
+
+import "os"
+
+// tryLockFile always succeeds on platforms without flock: commands aren't serialized
+func tryLockFile(file *os.File) (bool, error) {
+	return true, nil
+}
+
+// unlockFile is a no-op on platforms without flock
+func unlockFile(file *os.File) error {
+	return nil
+}
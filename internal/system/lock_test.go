@@ -0,0 +1,163 @@
+package system
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAcquireLock(t *testing.T) {
+	t.Run("excludes other commands", func(t *testing.T) {
+		user := &User{HomeDir: t.TempDir()}
+		lock, err := AcquireLock(user, "camp env rebuild", 0, &bytes.Buffer{})
+		if err != nil {
+			t.Fatalf("AcquireLock() failed: %v", err)
+		}
+
+		_, err = AcquireLock(user, "camp env update", 0, &bytes.Buffer{})
+		var lockErr *LockError
+		if !errors.As(err, &lockErr) {
+			t.Fatalf("Expected a LockError, got %v", err)
+		}
+		if lockErr.Holder.PID != os.Getpid() || lockErr.Holder.Command != "camp env rebuild" {
+			t.Errorf("Unexpected holder: %+v", lockErr.Holder)
+		}
+		if !strings.Contains(err.Error(), "locked by 'camp env rebuild'") || !strings.Contains(err.Error(), "--wait") {
+			t.Errorf("Expected the error to name the holder and suggest --wait, got %q", err)
+		}
+
+		if err := lock.Release(); err != nil {
+			t.Fatalf("Release() failed: %v", err)
+		}
+		lock, err = AcquireLock(user, "camp env update", 0, &bytes.Buffer{})
+		if err != nil {
+			t.Fatalf("Expected the lock to be free once released, got %v", err)
+		}
+		lock.Release()
+	})
+
+	t.Run("waits for the holder", func(t *testing.T) {
+		user := &User{HomeDir: t.TempDir()}
+		withLockPollInterval(t, 10*time.Millisecond)
+		lock, err := AcquireLock(user, "camp env rebuild", 0, &bytes.Buffer{})
+		if err != nil {
+			t.Fatalf("AcquireLock() failed: %v", err)
+		}
+		time.AfterFunc(50*time.Millisecond, func() { lock.Release() })
+
+		var out bytes.Buffer
+		waiter, err := AcquireLock(user, "camp env update", 5*time.Second, &out)
+		if err != nil {
+			t.Fatalf("Expected the lock once released, got %v", err)
+		}
+		defer waiter.Release()
+		if !strings.Contains(out.String(), "Waiting for 'camp env rebuild'") {
+			t.Errorf("Expected a waiting message, got %q", out.String())
+		}
+	})
+
+	t.Run("gives up after the timeout", func(t *testing.T) {
+		user := &User{HomeDir: t.TempDir()}
+		withLockPollInterval(t, 10*time.Millisecond)
+		lock, err := AcquireLock(user, "camp env rebuild", 0, &bytes.Buffer{})
+		if err != nil {
+			t.Fatalf("AcquireLock() failed: %v", err)
+		}
+		defer lock.Release()
+
+		_, err = AcquireLock(user, "camp env update", 50*time.Millisecond, &bytes.Buffer{})
+		var lockErr *LockError
+		if !errors.As(err, &lockErr) || lockErr.Waited != 50*time.Millisecond {
+			t.Errorf("Expected a LockError after waiting, got %v", err)
+		}
+	})
+
+	t.Run("holder removing the lock file", func(t *testing.T) {
+		user := &User{HomeDir: t.TempDir()}
+		withLockPollInterval(t, 10*time.Millisecond)
+		lock, err := AcquireLock(user, "camp env nuke", 0, &bytes.Buffer{})
+		if err != nil {
+			t.Fatalf("AcquireLock() failed: %v", err)
+		}
+		// Opened before the removal, like a waiter polling the lock
+		removed, err := os.Open(LockPath(user))
+		if err != nil {
+			t.Fatalf("Failed to open lock file: %v", err)
+		}
+		defer removed.Close()
+		time.AfterFunc(50*time.Millisecond, func() {
+			os.RemoveAll(filepath.Join(user.HomeDir, ".camp"))
+			lock.Release()
+		})
+
+		waiter, err := AcquireLock(user, "camp env rebuild", 5*time.Second, &bytes.Buffer{})
+		if err != nil {
+			t.Fatalf("Expected the lock once released, got %v", err)
+		}
+		defer waiter.Release()
+		if isLockFile(removed, LockPath(user)) {
+			t.Error("Expected the removed lock file not to be the lock file anymore")
+		}
+
+		// The waiter holds the lock file other commands open
+		_, err = AcquireLock(user, "camp env update", 0, &bytes.Buffer{})
+		var lockErr *LockError
+		if !errors.As(err, &lockErr) || lockErr.Holder.Command != "camp env rebuild" {
+			t.Errorf("Expected a LockError naming the waiter, got %v", err)
+		}
+	})
+
+	t.Run("removes stale locks", func(t *testing.T) {
+		user := &User{HomeDir: t.TempDir()}
+		if err := os.MkdirAll(filepath.Join(user.HomeDir, ".camp"), 0755); err != nil {
+			t.Fatalf("Failed to create camp directory: %v", err)
+		}
+		// Left by a command killed while holding the lock
+		stale := `{"pid": 999999, "command": "camp env update", "started_at": "2024-05-01T10:00:00Z"}`
+		if err := os.WriteFile(LockPath(user), []byte(stale), 0644); err != nil {
+			t.Fatalf("Failed to write lock file: %v", err)
+		}
+
+		var out bytes.Buffer
+		lock, err := AcquireLock(user, "camp env rebuild", 0, &out)
+		if err != nil {
+			t.Fatalf("AcquireLock() failed: %v", err)
+		}
+		defer lock.Release()
+		if !strings.Contains(out.String(), "Removed stale lock left by 'camp env update' (PID 999999") {
+			t.Errorf("Expected a stale lock message, got %q", out.String())
+		}
+	})
+}
+
+func TestLockInfoString(t *testing.T) {
+	tests := []struct {
+		name string
+		info LockInfo
+		want string
+	}{
+		{"unknown holder", LockInfo{}, "another camp command"},
+		{"without start time", LockInfo{PID: 42, Command: "camp bootstrap"}, "'camp bootstrap' (PID 42)"},
+		{"with start time", LockInfo{PID: 42, Command: "camp env rebuild", StartedAt: time.Now().Add(-90 * time.Second)}, "'camp env rebuild' (PID 42, started 1m30s ago)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.info.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// withLockPollInterval makes waiting commands retry faster for the duration of a test
+func withLockPollInterval(t *testing.T, interval time.Duration) {
+	t.Helper()
+	original := lockPollInterval
+	lockPollInterval = interval
+	t.Cleanup(func() { lockPollInterval = original })
+}
@@ -0,0 +1,264 @@
+package system
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultLockHistoryMaxCount is the number of flake.lock snapshots kept when lock_history.max_count isn't set
+	DefaultLockHistoryMaxCount = 20
+	// DefaultLockHistoryMaxAgeDays is the age in days after which snapshots are removed when lock_history.max_age_days isn't set
+	DefaultLockHistoryMaxAgeDays = 90
+)
+
+// LockHistoryConfig controls the pruning of flake.lock snapshots
+type LockHistoryConfig struct {
+	MaxCount   int `yaml:"max_count,omitempty"`    // Number of snapshots to keep (default: DefaultLockHistoryMaxCount)
+	MaxAgeDays int `yaml:"max_age_days,omitempty"` // Days to keep snapshots for (default: DefaultLockHistoryMaxAgeDays)
+}
+
+// maxCount returns the configured number of snapshots to keep or the default one
+func (c LockHistoryConfig) maxCount() int {
+	if c.MaxCount > 0 {
+		return c.MaxCount
+	}
+	return DefaultLockHistoryMaxCount
+}
+
+// maxAge returns the configured snapshot retention or the default one
+func (c LockHistoryConfig) maxAge() time.Duration {
+	days := DefaultLockHistoryMaxAgeDays
+	if c.MaxAgeDays > 0 {
+		days = c.MaxAgeDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// ValidateLockHistory validates the lock_history configuration
+func (c *CampConfig) ValidateLockHistory() error {
+	if c.LockHistory.MaxCount < 0 {
+		return fmt.Errorf("lock_history.max_count must not be negative, got %d", c.LockHistory.MaxCount)
+	}
+	if c.LockHistory.MaxAgeDays < 0 {
+		return fmt.Errorf("lock_history.max_age_days must not be negative, got %d", c.LockHistory.MaxAgeDays)
+	}
+	return nil
+}
+
+// LockSnapshot is a flake.lock saved in the lock history, stored as <id>.lock with <id>.json metadata
+type LockSnapshot struct {
+	ID        string    `json:"id"`
+	Command   string    `json:"command"` // camp command after which the snapshot was taken (e.g. "update")
+	CreatedAt time.Time `json:"created_at"`
+	Hash      string    `json:"hash"`              // Short hash of the flake.lock content
+	Current   bool      `json:"current,omitempty"` // Whether ~/.camp/nix/flake.lock has this content
+}
+
+// LockHistoryDir returns the directory holding the flake.lock snapshots
+func LockHistoryDir(user *User) string {
+	return filepath.Join(user.StateDir(), "flake-locks")
+}
+
+// SnapshotFlakeLock saves the current flake.lock in the lock history and prunes old snapshots.
+// Nothing is saved without flake.lock or when the history already holds its content,
+// in which case the returned snapshot is nil
+func SnapshotFlakeLock(user *User, command string) (*LockSnapshot, error) {
+	snapshot, err := saveLockSnapshot(user, command)
+	if err != nil {
+		return nil, err
+	}
+	return snapshot, PruneLockHistory(user, user.LockHistory, time.Now())
+}
+
+// saveLockSnapshot saves the current flake.lock in the lock history, unless
+// the history already holds its content. Switching back and forth between two
+// locks (e.g. with camp env lock restore) doesn't grow the history
+func saveLockSnapshot(user *User, command string) (*LockSnapshot, error) {
+	content, err := os.ReadFile(FlakeLockPath(user))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read flake.lock: %w", err)
+	}
+
+	snapshots, err := ListLockSnapshots(user)
+	if err != nil {
+		return nil, err
+	}
+	hash := lockHash(content)
+	for _, snapshot := range snapshots {
+		if snapshot.Hash == hash {
+			return nil, nil
+		}
+	}
+
+	dir := LockHistoryDir(user)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create lock history directory: %w", err)
+	}
+
+	// Snapshots taken within the same second get a numeric suffix
+	createdAt := time.Now()
+	snapshot := LockSnapshot{Command: command, CreatedAt: createdAt, Hash: hash}
+	baseID := createdAt.Format(logIDFormat)
+	for i := 1; ; i++ {
+		snapshot.ID = baseID
+		if i > 1 {
+			snapshot.ID = fmt.Sprintf("%s-%d", baseID, i)
+		}
+		file, err := os.OpenFile(filepath.Join(dir, snapshot.ID+".lock"), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to create lock snapshot: %w", err)
+		}
+		_, err = file.Write(content)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to write lock snapshot: %w", err)
+		}
+		break
+	}
+
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode lock snapshot metadata: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, snapshot.ID+".json"), data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write lock snapshot metadata: %w", err)
+	}
+
+	snapshot.Current = true
+	return &snapshot, nil
+}
+
+// ListLockSnapshots returns the flake.lock snapshots, newest first
+func ListLockSnapshots(user *User) ([]LockSnapshot, error) {
+	dir := LockHistoryDir(user)
+	files, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return []LockSnapshot{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read lock history directory: %w", err)
+	}
+
+	currentHash := ""
+	if content, err := os.ReadFile(FlakeLockPath(user)); err == nil {
+		currentHash = lockHash(content)
+	}
+
+	snapshots := []LockSnapshot{}
+	for _, file := range files {
+		id, ok := strings.CutSuffix(file.Name(), ".lock")
+		if !ok || file.IsDir() {
+			continue
+		}
+		snapshot := readLockSnapshot(dir, id)
+		snapshot.Current = snapshot.Hash != "" && snapshot.Hash == currentHash
+		snapshots = append(snapshots, snapshot)
+	}
+
+	// IDs are timestamps, so they sort chronologically
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].ID > snapshots[j].ID })
+	return snapshots, nil
+}
+
+// readLockSnapshot reads the metadata of a snapshot, falling back to what its ID and content tell
+func readLockSnapshot(dir, id string) LockSnapshot {
+	snapshot := LockSnapshot{ID: id}
+	if data, err := os.ReadFile(filepath.Join(dir, id+".json")); err == nil {
+		if err := json.Unmarshal(data, &snapshot); err == nil {
+			return snapshot
+		}
+	}
+
+	if createdAt, err := time.ParseInLocation(logIDFormat, id[:min(len(id), len(logIDFormat))], time.Local); err == nil {
+		snapshot.CreatedAt = createdAt
+	}
+	if content, err := os.ReadFile(filepath.Join(dir, id+".lock")); err == nil {
+		snapshot.Hash = lockHash(content)
+	}
+	return snapshot
+}
+
+// ReadLockSnapshot returns the metadata and the flake.lock content of a snapshot
+func ReadLockSnapshot(user *User, id string) (LockSnapshot, []byte, error) {
+	dir := LockHistoryDir(user)
+	id = filepath.Base(id)
+	content, err := os.ReadFile(filepath.Join(dir, id+".lock"))
+	if os.IsNotExist(err) {
+		return LockSnapshot{}, nil, fmt.Errorf("lock snapshot '%s' not found - run 'camp env lock list' to see available snapshots", id)
+	} else if err != nil {
+		return LockSnapshot{}, nil, fmt.Errorf("failed to read lock snapshot: %w", err)
+	}
+	return readLockSnapshot(dir, id), content, nil
+}
+
+// RestoreLockSnapshot replaces flake.lock with the content of a snapshot.
+// The current flake.lock is saved in the history first, so the restore can be
+// undone. The history is pruned once the snapshot is restored, so that it is
+// kept as the current one
+func RestoreLockSnapshot(user *User, id string) (LockSnapshot, error) {
+	snapshot, content, err := ReadLockSnapshot(user, id)
+	if err != nil {
+		return snapshot, err
+	}
+	if _, err := ParseFlakeLock(content); err != nil {
+		return snapshot, fmt.Errorf("lock snapshot '%s' is corrupted: %w", snapshot.ID, err)
+	}
+
+	if _, err := saveLockSnapshot(user, "lock-restore"); err != nil {
+		return snapshot, fmt.Errorf("failed to save the current flake.lock: %w", err)
+	}
+	if err := ensureNixDir(user); err != nil {
+		return snapshot, err
+	}
+	if err := os.WriteFile(FlakeLockPath(user), content, 0644); err != nil {
+		return snapshot, fmt.Errorf("failed to restore flake.lock: %w", err)
+	}
+	snapshot.Current = true
+	return snapshot, PruneLockHistory(user, user.LockHistory, time.Now())
+}
+
+// PruneLockHistory removes snapshots beyond the configured count or older than the configured age.
+// The newest snapshot and the one matching the current flake.lock are always kept
+func PruneLockHistory(user *User, config LockHistoryConfig, now time.Time) error {
+	snapshots, err := ListLockSnapshots(user)
+	if err != nil {
+		return err
+	}
+
+	dir := LockHistoryDir(user)
+	cutoff := now.Add(-config.maxAge())
+	for i, snapshot := range snapshots {
+		if i == 0 || snapshot.Current || (i < config.maxCount() && (snapshot.CreatedAt.IsZero() || snapshot.CreatedAt.After(cutoff))) {
+			continue
+		}
+		for _, ext := range []string{".lock", ".json"} {
+			if err := os.Remove(filepath.Join(dir, snapshot.ID+ext)); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to remove old lock snapshot: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// lockHash returns a short hash of flake.lock content
+func lockHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])[:12]
+}
@@ -0,0 +1,187 @@
+package system
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTestFlakeLock replaces the flake.lock of user with one locking nixpkgs at rev
+func writeTestFlakeLock(t *testing.T, user *User, rev string) string {
+	t.Helper()
+	content := testFlakeLock(rev, 1714521600)
+	if err := os.WriteFile(FlakeLockPath(user), []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write flake.lock: %v", err)
+	}
+	return content
+}
+
+// writeLockSnapshotFixture writes a snapshot taken at createdAt into the lock history of user
+func writeLockSnapshotFixture(t *testing.T, user *User, createdAt time.Time) string {
+	t.Helper()
+	dir := LockHistoryDir(user)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("Failed to create lock history directory: %v", err)
+	}
+	id := createdAt.Format(logIDFormat)
+	if err := os.WriteFile(filepath.Join(dir, id+".lock"), []byte(testFlakeLock(id, 1714521600)), 0644); err != nil {
+		t.Fatalf("Failed to write lock snapshot: %v", err)
+	}
+	return id
+}
+
+func TestSnapshotFlakeLock(t *testing.T) {
+	user := newBackendTestUser(t, "linux")
+
+	// Nothing to save before the first update
+	if snapshot, err := SnapshotFlakeLock(user, "update"); err != nil || snapshot != nil {
+		t.Fatalf("Expected no snapshot without flake.lock, got %+v, %v", snapshot, err)
+	}
+
+	writeTestFlakeLock(t, user, oldNixpkgsRev)
+	first, err := SnapshotFlakeLock(user, "update")
+	if err != nil || first == nil {
+		t.Fatalf("SnapshotFlakeLock() failed: %+v, %v", first, err)
+	}
+
+	// An unchanged flake.lock isn't saved twice
+	if snapshot, err := SnapshotFlakeLock(user, "rebuild"); err != nil || snapshot != nil {
+		t.Fatalf("Expected no snapshot of an unchanged flake.lock, got %+v, %v", snapshot, err)
+	}
+
+	writeTestFlakeLock(t, user, newNixpkgsRev)
+	second, err := SnapshotFlakeLock(user, "update")
+	if err != nil || second == nil {
+		t.Fatalf("SnapshotFlakeLock() failed: %+v, %v", second, err)
+	}
+	if second.ID == first.ID {
+		t.Errorf("Expected snapshots taken in the same second to get distinct IDs, got %s twice", first.ID)
+	}
+
+	snapshots, err := ListLockSnapshots(user)
+	if err != nil {
+		t.Fatalf("ListLockSnapshots() failed: %v", err)
+	}
+	if len(snapshots) != 2 || snapshots[0].ID != second.ID || snapshots[1].ID != first.ID {
+		t.Fatalf("Expected the snapshots newest first, got %+v", snapshots)
+	}
+	if !snapshots[0].Current || snapshots[1].Current {
+		t.Errorf("Expected only the newest snapshot to be current, got %+v", snapshots)
+	}
+	if snapshots[1].Command != "update" || snapshots[1].Hash != first.Hash {
+		t.Errorf("Expected the metadata to be read back, got %+v", snapshots[1])
+	}
+
+	// Going back to an older flake.lock doesn't save it again
+	writeTestFlakeLock(t, user, oldNixpkgsRev)
+	if snapshot, err := SnapshotFlakeLock(user, "update"); err != nil || snapshot != nil {
+		t.Fatalf("Expected no snapshot of a flake.lock already in the history, got %+v, %v", snapshot, err)
+	}
+}
+
+func TestRestoreLockSnapshot(t *testing.T) {
+	user := newBackendTestUser(t, "linux")
+	original := writeTestFlakeLock(t, user, oldNixpkgsRev)
+	first, err := SnapshotFlakeLock(user, "update")
+	if err != nil {
+		t.Fatalf("SnapshotFlakeLock() failed: %v", err)
+	}
+
+	// The updated flake.lock hasn't been snapshotted yet, the restore saves it
+	writeTestFlakeLock(t, user, newNixpkgsRev)
+	if _, err := RestoreLockSnapshot(user, first.ID); err != nil {
+		t.Fatalf("RestoreLockSnapshot() failed: %v", err)
+	}
+	if content, _ := os.ReadFile(FlakeLockPath(user)); string(content) != original {
+		t.Errorf("Expected flake.lock to be restored, got:\n%s", content)
+	}
+
+	snapshots, _ := ListLockSnapshots(user)
+	if len(snapshots) != 2 || snapshots[0].Command != "lock-restore" {
+		t.Fatalf("Expected the replaced flake.lock to be saved, got %+v", snapshots)
+	}
+	if _, content, _ := ReadLockSnapshot(user, snapshots[0].ID); !strings.Contains(string(content), newNixpkgsRev) {
+		t.Errorf("Expected the saved flake.lock to lock the updated nixpkgs, got:\n%s", content)
+	}
+
+	// Switching back and forth doesn't grow the history
+	if _, err := RestoreLockSnapshot(user, snapshots[0].ID); err != nil {
+		t.Fatalf("RestoreLockSnapshot() failed: %v", err)
+	}
+	if _, err := RestoreLockSnapshot(user, first.ID); err != nil {
+		t.Fatalf("RestoreLockSnapshot() failed: %v", err)
+	}
+	if snapshots, _ := ListLockSnapshots(user); len(snapshots) != 2 {
+		t.Errorf("Expected no new snapshot, got %+v", snapshots)
+	}
+
+	_, err = RestoreLockSnapshot(user, "20000101-000000")
+	if err == nil || !strings.Contains(err.Error(), "camp env lock list") {
+		t.Errorf("Expected an unknown snapshot error, got %v", err)
+	}
+}
+
+func TestRestoreLockSnapshot_FullHistory(t *testing.T) {
+	user := newBackendTestUser(t, "linux")
+	user.LockHistory = LockHistoryConfig{MaxCount: 2}
+	original := writeTestFlakeLock(t, user, oldNixpkgsRev)
+	target, err := SnapshotFlakeLock(user, "update")
+	if err != nil {
+		t.Fatalf("SnapshotFlakeLock() failed: %v", err)
+	}
+	writeTestFlakeLock(t, user, newNixpkgsRev)
+	if _, err := SnapshotFlakeLock(user, "update"); err != nil {
+		t.Fatalf("SnapshotFlakeLock() failed: %v", err)
+	}
+
+	// Saving the replaced flake.lock goes over the limit, the restored snapshot is kept anyway
+	writeTestFlakeLock(t, user, strings.Repeat("c", 40))
+	if _, err := RestoreLockSnapshot(user, target.ID); err != nil {
+		t.Fatalf("RestoreLockSnapshot() failed: %v", err)
+	}
+	if content, _ := os.ReadFile(FlakeLockPath(user)); string(content) != original {
+		t.Errorf("Expected flake.lock to be restored, got:\n%s", content)
+	}
+	if _, _, err := ReadLockSnapshot(user, target.ID); err != nil {
+		t.Errorf("Expected the restored snapshot to be kept, got %v", err)
+	}
+	snapshots, _ := ListLockSnapshots(user)
+	if len(snapshots) != 3 || !snapshots[2].Current {
+		t.Errorf("Expected the newest snapshots and the current one, got %+v", snapshots)
+	}
+}
+
+func TestPruneLockHistory(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.Local)
+	tests := []struct {
+		name   string
+		config LockHistoryConfig
+		ages   []int // Age of each snapshot in days
+		want   int
+	}{
+		{name: "defaults keep recent snapshots", ages: []int{1, 2, 3}, want: 3},
+		{name: "defaults remove snapshots older than 90 days", ages: []int{1, 100, 200}, want: 1},
+		{name: "max count", config: LockHistoryConfig{MaxCount: 2}, ages: []int{1, 2, 3, 4}, want: 2},
+		{name: "max age", config: LockHistoryConfig{MaxAgeDays: 7}, ages: []int{1, 5, 10}, want: 2},
+		{name: "newest snapshot is always kept", config: LockHistoryConfig{MaxAgeDays: 1}, ages: []int{30, 60}, want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := newBackendTestUser(t, "linux")
+			for _, age := range tt.ages {
+				writeLockSnapshotFixture(t, user, now.AddDate(0, 0, -age))
+			}
+
+			if err := PruneLockHistory(user, tt.config, now); err != nil {
+				t.Fatalf("PruneLockHistory() failed: %v", err)
+			}
+			snapshots, _ := ListLockSnapshots(user)
+			if len(snapshots) != tt.want {
+				t.Errorf("Expected %d snapshots, got %d", tt.want, len(snapshots))
+			}
+		})
+	}
+}
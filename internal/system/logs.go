@@ -0,0 +1,294 @@
+package system
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultLogMaxCount is the number of operation logs kept when logs.max_count isn't set
+	DefaultLogMaxCount = 50
+	// DefaultLogMaxAgeDays is the age in days after which operation logs are removed when logs.max_age_days isn't set
+	DefaultLogMaxAgeDays = 30
+
+	// logIDFormat is the timestamp prefix of log IDs
+	logIDFormat = "20060102-150405"
+)
+
+// LogsConfig controls the rotation of operation logs
+type LogsConfig struct {
+	MaxCount   int `yaml:"max_count,omitempty"`    // Number of logs to keep (default: DefaultLogMaxCount)
+	MaxAgeDays int `yaml:"max_age_days,omitempty"` // Days to keep logs for (default: DefaultLogMaxAgeDays)
+}
+
+// maxCount returns the configured number of logs to keep or the default one
+func (c LogsConfig) maxCount() int {
+	if c.MaxCount > 0 {
+		return c.MaxCount
+	}
+	return DefaultLogMaxCount
+}
+
+// maxAge returns the configured log retention or the default one
+func (c LogsConfig) maxAge() time.Duration {
+	days := DefaultLogMaxAgeDays
+	if c.MaxAgeDays > 0 {
+		days = c.MaxAgeDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// ValidateLogs validates the logs configuration
+func (c *CampConfig) ValidateLogs() error {
+	if c.Logs.MaxCount < 0 {
+		return fmt.Errorf("logs.max_count must not be negative, got %d", c.Logs.MaxCount)
+	}
+	if c.Logs.MaxAgeDays < 0 {
+		return fmt.Errorf("logs.max_age_days must not be negative, got %d", c.Logs.MaxAgeDays)
+	}
+	return nil
+}
+
+// LogEntry is the metadata of an operation log, stored next to it as <id>.json
+type LogEntry struct {
+	ID         string    `json:"id"`
+	Command    string    `json:"command"`               // camp command that was run (e.g. "rebuild")
+	Args       []string  `json:"args,omitempty"`        // Arguments of the command
+	ConfigHash string    `json:"config_hash,omitempty"` // Hash of camp.yml at the time of the run (empty without config)
+	StartedAt  time.Time `json:"started_at"`
+	Duration   float64   `json:"duration_seconds"`
+	ExitStatus int       `json:"exit_status"`     // Exit code of camp (see ExitCode), -1 if the run was interrupted
+	Error      string    `json:"error,omitempty"` // Error the command failed with
+}
+
+// Succeeded reports whether the logged operation succeeded
+func (e LogEntry) Succeeded() bool {
+	return e.ExitStatus == 0
+}
+
+// LogsDir returns the directory holding operation logs
+func LogsDir(user *User) string {
+	return filepath.Join(user.HomeDir, ".camp", "logs")
+}
+
+// OperationLog records the output of a camp operation to ~/.camp/logs/<id>.log
+type OperationLog struct {
+	Entry LogEntry
+	dir   string
+	file  *os.File
+}
+
+// StartOperationLog creates the log file of an operation and writes its header
+func StartOperationLog(user *User, command string, args []string) (*OperationLog, error) {
+	dir := LogsDir(user)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create logs directory: %w", err)
+	}
+
+	startedAt := time.Now()
+	entry := LogEntry{
+		Command:    command,
+		Args:       args,
+		ConfigHash: configHash(user),
+		StartedAt:  startedAt,
+	}
+
+	// Runs started within the same second get a numeric suffix
+	baseID := fmt.Sprintf("%s-%s", startedAt.Format(logIDFormat), command)
+	var file *os.File
+	for i := 1; ; i++ {
+		entry.ID = baseID
+		if i > 1 {
+			entry.ID = fmt.Sprintf("%s-%d", baseID, i)
+		}
+		var err error
+		file, err = os.OpenFile(filepath.Join(dir, entry.ID+".log"), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			break
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("failed to create log file: %w", err)
+		}
+	}
+
+	opLog := &OperationLog{Entry: entry, dir: dir, file: file}
+	fmt.Fprintf(file, "# camp %s\n", strings.TrimSpace(command+" "+strings.Join(args, " ")))
+	fmt.Fprintf(file, "# started: %s\n", startedAt.Format(time.RFC3339))
+	if entry.ConfigHash != "" {
+		fmt.Fprintf(file, "# config: %s\n", entry.ConfigHash)
+	}
+	fmt.Fprintln(file)
+	return opLog, nil
+}
+
+// Write appends output of the operation to the log
+func (l *OperationLog) Write(p []byte) (int, error) {
+	return l.file.Write(p)
+}
+
+// Path returns the path of the log file
+func (l *OperationLog) Path() string {
+	return filepath.Join(l.dir, l.Entry.ID+".log")
+}
+
+// Finish records the outcome of the operation, closes the log and rotates old logs
+func (l *OperationLog) Finish(runErr error, config LogsConfig) error {
+	l.Entry.Duration = time.Since(l.Entry.StartedAt).Seconds()
+	l.Entry.ExitStatus = ExitCode(runErr)
+	if runErr != nil {
+		l.Entry.Error = runErr.Error()
+	}
+
+	fmt.Fprintf(l.file, "\n# finished: %s (%s)\n", time.Now().Format(time.RFC3339), FormatLogStatus(l.Entry))
+	if err := l.restoreIfRemoved(); err != nil {
+		l.file.Close()
+		return err
+	}
+	if err := l.file.Close(); err != nil {
+		return fmt.Errorf("failed to close log file: %w", err)
+	}
+
+	data, err := json.MarshalIndent(l.Entry, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode log metadata: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(l.dir, l.Entry.ID+".json"), data, 0644); err != nil {
+		return fmt.Errorf("failed to write log metadata: %w", err)
+	}
+
+	return RotateLogs(l.dir, config, time.Now())
+}
+
+// restoreIfRemoved recreates the log file when the operation deleted it
+// (camp env nuke removes ~/.camp). The open file still holds the content
+func (l *OperationLog) restoreIfRemoved() error {
+	if _, err := os.Stat(l.Path()); !os.IsNotExist(err) {
+		return nil
+	}
+	if err := os.MkdirAll(l.dir, 0755); err != nil {
+		return fmt.Errorf("failed to recreate logs directory: %w", err)
+	}
+	restored, err := os.Create(l.Path())
+	if err != nil {
+		return fmt.Errorf("failed to recreate log file: %w", err)
+	}
+	defer restored.Close()
+	if _, err := l.file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to read log file: %w", err)
+	}
+	if _, err := io.Copy(restored, l.file); err != nil {
+		return fmt.Errorf("failed to recreate log file: %w", err)
+	}
+	return nil
+}
+
+// FormatLogStatus describes the outcome of a logged operation (e.g. "success")
+func FormatLogStatus(entry LogEntry) string {
+	if entry.Succeeded() {
+		return "success"
+	}
+	if entry.ExitStatus < 0 {
+		// Interrupted runs never recorded their outcome
+		return "unknown"
+	}
+	return fmt.Sprintf("failed, exit status %d", entry.ExitStatus)
+}
+
+// configHash returns a short hash of camp.yml, or an empty string without config
+func configHash(user *User) string {
+	data, err := os.ReadFile(ConfigPath(user.HomeDir))
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// ListLogs returns the metadata of the operation logs, newest first.
+// Logs of interrupted runs have no metadata and are listed from their file name
+func ListLogs(user *User) ([]LogEntry, error) {
+	return listLogs(LogsDir(user))
+}
+
+func listLogs(dir string) ([]LogEntry, error) {
+	files, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return []LogEntry{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read logs directory: %w", err)
+	}
+
+	entries := []LogEntry{}
+	for _, file := range files {
+		id, ok := strings.CutSuffix(file.Name(), ".log")
+		if !ok || file.IsDir() {
+			continue
+		}
+		entries = append(entries, readLogEntry(dir, id))
+	}
+
+	// IDs start with the timestamp, so they sort chronologically
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID > entries[j].ID })
+	return entries, nil
+}
+
+// readLogEntry reads the metadata of a log, falling back to what its ID tells
+func readLogEntry(dir, id string) LogEntry {
+	entry := LogEntry{ID: id, ExitStatus: -1}
+	if data, err := os.ReadFile(filepath.Join(dir, id+".json")); err == nil {
+		if err := json.Unmarshal(data, &entry); err == nil {
+			return entry
+		}
+	}
+
+	// "20060102-150405-<command>[-n]"
+	parts := strings.SplitN(id, "-", 3)
+	if len(parts) == 3 {
+		if startedAt, err := time.ParseInLocation(logIDFormat, parts[0]+"-"+parts[1], time.Local); err == nil {
+			entry.StartedAt = startedAt
+		}
+		entry.Command = parts[2]
+	}
+	return entry
+}
+
+// ReadLog returns the metadata and content of an operation log
+func ReadLog(user *User, id string) (LogEntry, string, error) {
+	dir := LogsDir(user)
+	data, err := os.ReadFile(filepath.Join(dir, filepath.Base(id)+".log"))
+	if os.IsNotExist(err) {
+		return LogEntry{}, "", fmt.Errorf("log '%s' not found - run 'camp logs --list' to see available logs", id)
+	} else if err != nil {
+		return LogEntry{}, "", fmt.Errorf("failed to read log: %w", err)
+	}
+	return readLogEntry(dir, filepath.Base(id)), string(data), nil
+}
+
+// RotateLogs removes logs beyond the configured count or older than the configured age
+func RotateLogs(dir string, config LogsConfig, now time.Time) error {
+	entries, err := listLogs(dir)
+	if err != nil {
+		return err
+	}
+
+	cutoff := now.Add(-config.maxAge())
+	for i, entry := range entries {
+		if i < config.maxCount() && (entry.StartedAt.IsZero() || entry.StartedAt.After(cutoff)) {
+			continue
+		}
+		for _, ext := range []string{".log", ".json"} {
+			if err := os.Remove(filepath.Join(dir, entry.ID+ext)); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to remove old log: %w", err)
+			}
+		}
+	}
+	return nil
+}
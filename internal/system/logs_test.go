@@ -0,0 +1,213 @@
+package system
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeLogFixture writes a log and its metadata into dir
+func writeLogFixture(t *testing.T, dir string, entry LogEntry) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("Failed to create logs directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, entry.ID+".log"), []byte("output\n"), 0644); err != nil {
+		t.Fatalf("Failed to write log: %v", err)
+	}
+	data := `{"id":"` + entry.ID + `","command":"` + entry.Command + `","started_at":"` + entry.StartedAt.Format(time.RFC3339) + `","exit_status":0}`
+	if err := os.WriteFile(filepath.Join(dir, entry.ID+".json"), []byte(data), 0644); err != nil {
+		t.Fatalf("Failed to write log metadata: %v", err)
+	}
+}
+
+func TestOperationLog(t *testing.T) {
+	t.Run("records output and outcome", func(t *testing.T) {
+		user := writeCheckTestConfig(t, "linux")
+
+		opLog, err := StartOperationLog(user, "rebuild", []string{"--verbose"})
+		if err != nil {
+			t.Fatalf("StartOperationLog() failed: %v", err)
+		}
+		if _, err := opLog.Write([]byte("building...\n")); err != nil {
+			t.Fatalf("Write() failed: %v", err)
+		}
+		if err := opLog.Finish(nil, LogsConfig{}); err != nil {
+			t.Fatalf("Finish() failed: %v", err)
+		}
+
+		entry, content, err := ReadLog(user, opLog.Entry.ID)
+		if err != nil {
+			t.Fatalf("ReadLog() failed: %v", err)
+		}
+		if !strings.HasSuffix(entry.ID, "-rebuild") || entry.Command != "rebuild" {
+			t.Errorf("Unexpected entry: %+v", entry)
+		}
+		if !entry.Succeeded() || entry.ConfigHash == "" || len(entry.Args) != 1 {
+			t.Errorf("Expected successful run with config hash and args, got %+v", entry)
+		}
+		for _, want := range []string{"# camp rebuild --verbose", "# config: " + entry.ConfigHash, "building...", "(success)"} {
+			if !strings.Contains(content, want) {
+				t.Errorf("Expected log to contain %q, got:\n%s", want, content)
+			}
+		}
+	})
+
+	t.Run("records failures", func(t *testing.T) {
+		user := newBackendTestUser(t, "linux")
+		opLog, err := StartOperationLog(user, "update", nil)
+		if err != nil {
+			t.Fatalf("StartOperationLog() failed: %v", err)
+		}
+		if err := opLog.Finish(errors.New("nix flake update failed"), LogsConfig{}); err != nil {
+			t.Fatalf("Finish() failed: %v", err)
+		}
+
+		entries, err := ListLogs(user)
+		if err != nil {
+			t.Fatalf("ListLogs() failed: %v", err)
+		}
+		if len(entries) != 1 || entries[0].ExitStatus != 1 || entries[0].Error != "nix flake update failed" {
+			t.Errorf("Expected one failed entry, got %+v", entries)
+		}
+		if entries[0].ConfigHash != "" {
+			t.Errorf("Expected no config hash without camp.yml, got %s", entries[0].ConfigHash)
+		}
+	})
+
+	t.Run("survives removal of the camp directory", func(t *testing.T) {
+		user := newBackendTestUser(t, "linux")
+		opLog, err := StartOperationLog(user, "nuke", nil)
+		if err != nil {
+			t.Fatalf("StartOperationLog() failed: %v", err)
+		}
+		opLog.Write([]byte("Removing camp files...\n"))
+		if err := os.RemoveAll(filepath.Join(user.HomeDir, ".camp")); err != nil {
+			t.Fatalf("Failed to remove camp directory: %v", err)
+		}
+		if err := opLog.Finish(nil, LogsConfig{}); err != nil {
+			t.Fatalf("Finish() failed: %v", err)
+		}
+
+		_, content, err := ReadLog(user, opLog.Entry.ID)
+		if err != nil {
+			t.Fatalf("ReadLog() failed: %v", err)
+		}
+		if !strings.Contains(content, "Removing camp files...") {
+			t.Errorf("Expected log content to be restored, got:\n%s", content)
+		}
+	})
+
+	t.Run("unique ids within the same second", func(t *testing.T) {
+		user := newBackendTestUser(t, "linux")
+		first, err := StartOperationLog(user, "rebuild", nil)
+		if err != nil {
+			t.Fatalf("StartOperationLog() failed: %v", err)
+		}
+		second, err := StartOperationLog(user, "rebuild", nil)
+		if err != nil {
+			t.Fatalf("StartOperationLog() failed: %v", err)
+		}
+		first.Finish(nil, LogsConfig{})
+		second.Finish(nil, LogsConfig{})
+		if first.Entry.ID == second.Entry.ID {
+			t.Errorf("Expected unique IDs, got %s twice", first.Entry.ID)
+		}
+	})
+}
+
+func TestListLogs_InterruptedRun(t *testing.T) {
+	user := newBackendTestUser(t, "linux")
+	dir := LogsDir(user)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("Failed to create logs directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "20240501-101500-rebuild.log"), []byte("partial"), 0644); err != nil {
+		t.Fatalf("Failed to write log: %v", err)
+	}
+
+	entries, err := ListLogs(user)
+	if err != nil {
+		t.Fatalf("ListLogs() failed: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 entry, got %d", len(entries))
+	}
+	if entries[0].Command != "rebuild" || entries[0].StartedAt.Year() != 2024 {
+		t.Errorf("Expected entry derived from the file name, got %+v", entries[0])
+	}
+	if FormatLogStatus(entries[0]) != "unknown" {
+		t.Errorf("Expected unknown status, got %s", FormatLogStatus(entries[0]))
+	}
+}
+
+func TestReadLog_NotFound(t *testing.T) {
+	user := newBackendTestUser(t, "linux")
+	if _, _, err := ReadLog(user, "missing"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("Expected not found error, got: %v", err)
+	}
+}
+
+func TestRotateLogs(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	ids := map[string]time.Time{
+		"20240601-110000-rebuild": now.Add(-time.Hour),
+		"20240531-110000-update":  now.Add(-25 * time.Hour),
+		"20240530-110000-rebuild": now.Add(-49 * time.Hour),
+		"20240401-110000-rebuild": now.Add(-61 * 24 * time.Hour),
+	}
+
+	tests := []struct {
+		name   string
+		config LogsConfig
+		kept   []string
+	}{
+		{"default retention drops old logs", LogsConfig{}, []string{"20240601-110000-rebuild", "20240531-110000-update", "20240530-110000-rebuild"}},
+		{"max count", LogsConfig{MaxCount: 2}, []string{"20240601-110000-rebuild", "20240531-110000-update"}},
+		{"max age", LogsConfig{MaxAgeDays: 2}, []string{"20240601-110000-rebuild", "20240531-110000-update"}},
+		{"long max age", LogsConfig{MaxAgeDays: 90}, []string{"20240601-110000-rebuild", "20240531-110000-update", "20240530-110000-rebuild", "20240401-110000-rebuild"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for id, startedAt := range ids {
+				writeLogFixture(t, dir, LogEntry{ID: id, Command: "rebuild", StartedAt: startedAt})
+			}
+
+			if err := RotateLogs(dir, tt.config, now); err != nil {
+				t.Fatalf("RotateLogs() failed: %v", err)
+			}
+
+			entries, err := listLogs(dir)
+			if err != nil {
+				t.Fatalf("listLogs() failed: %v", err)
+			}
+			var kept []string
+			for _, entry := range entries {
+				kept = append(kept, entry.ID)
+			}
+			if strings.Join(kept, ",") != strings.Join(tt.kept, ",") {
+				t.Errorf("Expected %v to be kept, got %v", tt.kept, kept)
+			}
+			if _, err := os.Stat(filepath.Join(dir, "20240401-110000-rebuild.json")); len(tt.kept) < 4 && !os.IsNotExist(err) {
+				t.Error("Expected metadata of removed logs to be removed too")
+			}
+		})
+	}
+}
+
+func TestValidateLogs(t *testing.T) {
+	if err := (&CampConfig{Logs: LogsConfig{MaxCount: 10, MaxAgeDays: 7}}).ValidateLogs(); err != nil {
+		t.Errorf("Expected valid config, got: %v", err)
+	}
+	if err := (&CampConfig{Logs: LogsConfig{MaxCount: -1}}).ValidateLogs(); err == nil {
+		t.Error("Expected error for negative max_count")
+	}
+	if err := (&CampConfig{Logs: LogsConfig{MaxAgeDays: -1}}).ValidateLogs(); err == nil {
+		t.Error("Expected error for negative max_age_days")
+	}
+}
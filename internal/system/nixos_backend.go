@@ -0,0 +1,93 @@
+package system
+
+import (
+	"camp/internal/utils"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// nixosBackend manages NixOS machines with nixos-rebuild
+type nixosBackend struct{}
+
+func (b *nixosBackend) Name() string {
+	return BackendNixOS
+}
+
+func (b *nixosBackend) Prepare(user *User) error {
+	return PrepareEnvironment(user)
+}
+
+func (b *nixosBackend) Build(user *User) error {
+	if err := ensureNixDir(user); err != nil {
+		return err
+	}
+	if err := ensureStateDir(user); err != nil {
+		return err
+	}
+	// nixos-rebuild build leaves ./result in the working directory
+	if err := runCommandIn(user.StateDir(), "nixos-rebuild", withLogFormat("build", "--impure", "--flake", b.flakeRef(user))...); err != nil {
+		return fmt.Errorf("build command failed: %w", err)
+	}
+	return nil
+}
+
+func (b *nixosBackend) Switch(user *User) error {
+	if err := ensureNixDir(user); err != nil {
+		return err
+	}
+	// Activating a NixOS configuration requires root
+	if err := runSudo(withLogFormat("nixos-rebuild", "switch", "--impure", "--flake", b.flakeRef(user))...); err != nil {
+		return fmt.Errorf("rebuild command failed: %w", err)
+	}
+	return nil
+}
+
+func (b *nixosBackend) Rollback(user *User) error {
+	if err := runSudo("nixos-rebuild", "switch", "--rollback"); err != nil {
+		return fmt.Errorf("rollback command failed: %w", err)
+	}
+	return nil
+}
+
+func (b *nixosBackend) Generations(user *User) ([]Generation, error) {
+	output, err := utils.CommandReturn("nix-env", "--list-generations", "--profile", systemProfile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list generations: %w", err)
+	}
+	return parseProfileGenerations(output, systemProfile), nil
+}
+
+// flakeRef returns the flake reference of the host's nixosConfiguration
+func (b *nixosBackend) flakeRef(user *User) string {
+	return fmt.Sprintf("%s#%s", user.NixDir(), user.HostName)
+}
+
+// profileGenerationRegex matches lines like "  42   2024-05-01 10:00:00   (current)"
+var profileGenerationRegex = regexp.MustCompile(`^\s*(\d+)\s+(\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2})\s*(\(current\))?`)
+
+// parseProfileGenerations parses the generation listing of a Nix profile, as
+// printed by nix-env --list-generations and darwin-rebuild --list-generations
+func parseProfileGenerations(output, profile string) []Generation {
+	var gens []Generation
+	for _, line := range strings.Split(output, "\n") {
+		matches := profileGenerationRegex.FindStringSubmatch(line)
+		if matches == nil {
+			continue
+		}
+		id, err := strconv.Atoi(matches[1])
+		if err != nil {
+			continue
+		}
+		gens = append(gens, Generation{
+			ID:      id,
+			Date:    matches[2],
+			Path:    fmt.Sprintf("%s-%d-link", profile, id),
+			Current: matches[3] != "",
+		})
+	}
+	sort.Slice(gens, func(i, j int) bool { return gens[i].ID < gens[j].ID })
+	return gens
+}
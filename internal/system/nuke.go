@@ -1,29 +1,33 @@
 package system
 
 import (
+	"camp/internal/utils"
+	"context"
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
 )
 
-// NukeEnvironment removes camp and Nix completely from the system
-func NukeEnvironment(user *User, out io.Writer) error {
+// NukeEnvironment removes camp and Nix completely from the system.
+// Each step is recorded in result, failures that don't abort the nuke as warnings
+func NukeEnvironment(user *User, out io.Writer, result *OperationResult) error {
 	// Step 1: Uninstall Nix (platform-specific)
 	fmt.Fprintf(out, "Uninstalling Nix...\n")
 	if err := UninstallNix(user.Platform, out); err != nil {
 		// Log error but continue with file cleanup
+		result.AddWarning("uninstall-nix", err)
 		fmt.Fprintf(out, "⚠️  Warning: Nix uninstall encountered an error: %v\n", err)
 		fmt.Fprintf(out, "Continuing with file cleanup...\n")
 	} else {
+		result.addPhase("uninstall-nix", PhaseOK, 0, nil)
 		fmt.Fprintf(out, "✓ Nix uninstalled successfully\n")
 	}
 
 	// Step 2: Remove camp files
 	fmt.Fprintf(out, "Removing camp files...\n")
 	campDir := filepath.Join(user.HomeDir, ".camp")
-	if err := RemoveCampFiles(campDir, out); err != nil {
+	if err := result.RunPhase("remove-camp-files", func() error { return RemoveCampFiles(campDir, out) }); err != nil {
 		return fmt.Errorf("failed to remove camp files: %w", err)
 	}
 	fmt.Fprintf(out, "✓ Camp files removed successfully\n")
@@ -32,8 +36,10 @@ func NukeEnvironment(user *User, out io.Writer) error {
 	fmt.Fprintf(out, "Removing Nix state files...\n")
 	if err := RemoveNixStateFiles(user.HomeDir, out); err != nil {
 		// Log error but don't fail - some files may not exist
+		result.AddWarning("remove-nix-state", err)
 		fmt.Fprintf(out, "⚠️  Warning: Some Nix state files could not be removed: %v\n", err)
 	} else {
+		result.addPhase("remove-nix-state", PhaseOK, 0, nil)
 		fmt.Fprintf(out, "✓ Nix state files removed successfully\n")
 	}
 
@@ -45,20 +51,16 @@ func UninstallNix(platform string, out io.Writer) error {
 	// On macOS, first try to uninstall nix-darwin
 	if platform == "darwin" {
 		fmt.Fprintf(out, "  Uninstalling nix-darwin...\n")
-		cmd := exec.Command("sudo", "darwin-uninstaller")
-		cmd.Stdout = out
-		cmd.Stderr = out
-		if err := cmd.Run(); err != nil {
+		uninstaller := utils.Command{Name: "sudo", Args: []string{"darwin-uninstaller"}, Stdout: out, Stderr: out, Interactive: true}
+		if _, err := utils.Run(context.Background(), uninstaller); err != nil {
 			fmt.Fprintf(out, "  ⚠️  darwin-uninstaller not found or failed (this is OK if not using nix-darwin)\n")
 		}
 	}
 
 	// Run the Nix installer's uninstall command
 	fmt.Fprintf(out, "  Running Nix uninstaller...\n")
-	cmd := exec.Command("/nix/nix-installer", "uninstall")
-	cmd.Stdout = out
-	cmd.Stderr = out
-	if err := cmd.Run(); err != nil {
+	installer := utils.Command{Name: "/nix/nix-installer", Args: []string{"uninstall"}, Stdout: out, Stderr: out, Interactive: true}
+	if _, err := utils.Run(context.Background(), installer); err != nil {
 		return fmt.Errorf("nix-installer uninstall failed: %w", err)
 	}
 
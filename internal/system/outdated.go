@@ -0,0 +1,423 @@
+package system
+
+import (
+	"camp/internal/utils"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// outdatedCacheTTL is how long the latest revisions found upstream are reused
+const outdatedCacheTTL = 6 * time.Hour
+
+// GitHubAPIURL is the GitHub API asked for the commits between revisions.
+// It can be overridden in tests
+var GitHubAPIURL = "https://api.github.com"
+
+// InputStatus reports how far behind its upstream a locked flake input is
+type InputStatus struct {
+	Input          string     `json:"input"`
+	Type           string     `json:"type"`
+	Source         string     `json:"source"`
+	Rev            string     `json:"rev,omitempty"`             // Locked commit
+	LastModified   time.Time  `json:"last_modified"`             // Date of the locked commit
+	AgeDays        int        `json:"age_days"`                  // Days since the locked commit
+	LatestRev      string     `json:"latest_rev,omitempty"`      // Latest commit upstream
+	LatestModified *time.Time `json:"latest_modified,omitempty"` // Date of the latest commit, when upstream tells
+	CommitsBehind  *int       `json:"commits_behind,omitempty"`  // Unknown when upstream can't tell (e.g. path inputs, force pushes)
+	UpToDate       bool       `json:"up_to_date"`
+	CheckedAt      time.Time  `json:"checked_at"`
+	Cached         bool       `json:"cached"` // Whether the upstream revision comes from the cache
+	Error          string     `json:"error,omitempty"`
+}
+
+// Latest describes the latest upstream revision like LockedInput.Describe
+func (s InputStatus) Latest() string {
+	if s.LatestRev == "" && s.LatestModified == nil {
+		return "-"
+	}
+	latest := LockedInput{Rev: s.LatestRev}
+	if s.LatestModified != nil {
+		latest.LastModified = *s.LatestModified
+	}
+	return latest.Describe()
+}
+
+// outdatedCachePath returns where the latest upstream revisions are cached
+func outdatedCachePath(user *User) string {
+	return filepath.Join(user.StateDir(), "outdated.json")
+}
+
+// CheckOutdatedInputs queries the upstream of every input locked in flake.lock
+// for its latest revision, sorted by input name. Remote results less than
+// outdatedCacheTTL old are reused unless refresh is set. Failures to query an
+// input are reported in its Error, they don't stop the other checks
+func CheckOutdatedInputs(ctx context.Context, user *User, refresh bool, now time.Time) ([]InputStatus, error) {
+	lock, err := ReadFlakeLock(FlakeLockPath(user))
+	if err != nil {
+		return nil, err
+	}
+	cache := loadOutdatedCache(user)
+	inputs := lock.Inputs()
+
+	// Only inputs still in flake.lock are cached again
+	statuses := []InputStatus{}
+	updatedCache := map[string]InputStatus{}
+	for _, name := range lock.InputNames() {
+		input := inputs[name]
+		status, ok := cache[name]
+		if refresh || !ok || !status.matches(input) || now.Sub(status.CheckedAt) >= outdatedCacheTTL {
+			status = checkInput(ctx, user, input, now)
+		} else {
+			status.Cached = true
+		}
+		if !input.LastModified.IsZero() {
+			status.AgeDays = int(now.Sub(input.LastModified).Hours() / 24)
+		}
+		if status.Error == "" && isRemoteInput(input) {
+			cached := status
+			cached.Cached = false
+			updatedCache[name] = cached
+		}
+		statuses = append(statuses, status)
+	}
+
+	saveOutdatedCache(user, updatedCache)
+	return statuses, nil
+}
+
+// matches reports whether a cached status was checked for the same locked input
+func (s InputStatus) matches(input LockedInput) bool {
+	return s.Source == input.Source && s.Rev == input.Rev && s.LastModified.Equal(input.LastModified)
+}
+
+// checkInput queries the upstream of an input with the method suited to its type
+func checkInput(ctx context.Context, user *User, input LockedInput, now time.Time) InputStatus {
+	status := InputStatus{
+		Input:        input.Name,
+		Type:         input.Type,
+		Source:       input.Source,
+		Rev:          input.Rev,
+		LastModified: input.LastModified,
+		CheckedAt:    now,
+	}
+
+	var err error
+	switch {
+	case input.Type == "path":
+		err = checkPathInput(user, input, &status)
+	case input.Type == "git" && localGitDir(input) != "":
+		err = checkLocalGitInput(ctx, input, &status)
+	case input.Type == "git":
+		err = checkRemoteGitInput(ctx, input, &status)
+	default:
+		err = checkFlakeMetadata(ctx, input, &status)
+	}
+	if err != nil {
+		status.Error = err.Error()
+	} else if isRemoteInput(input) {
+		countCommitsBehind(ctx, user, input, &status)
+	}
+	return status
+}
+
+// isRemoteInput reports whether checking an input needs the network, and is worth caching
+func isRemoteInput(input LockedInput) bool {
+	return input.Type != "path" && !(input.Type == "git" && localGitDir(input) != "")
+}
+
+// localGitDir returns the repository of a git input cloned on this machine,
+// or an empty string for remote repositories
+func localGitDir(input LockedInput) string {
+	url := input.locked.URL
+	if dir, ok := strings.CutPrefix(url, "file://"); ok {
+		return dir
+	}
+	if filepath.IsAbs(url) {
+		return url
+	}
+	return ""
+}
+
+// gitRef returns the branch or tag an input follows, HEAD when flake.nix doesn't name one
+func gitRef(input LockedInput) string {
+	if input.original.Ref != "" {
+		return input.original.Ref
+	}
+	return "HEAD"
+}
+
+// checkPathInput compares the modification time of a path input with its locked one.
+// Path inputs have no revisions, Nix locks the latest modification time of their files
+func checkPathInput(user *User, input LockedInput, status *InputStatus) error {
+	dir := input.locked.Path
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(user.NixDir(), dir)
+	}
+
+	var latest time.Time
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() && entry.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", dir, err)
+	}
+
+	latest = time.Unix(latest.Unix(), 0).UTC()
+	status.LatestModified = &latest
+	status.UpToDate = !latest.After(input.LastModified)
+	return nil
+}
+
+// checkLocalGitInput reads the latest commit of a local repository and counts the commits since the locked one
+func checkLocalGitInput(ctx context.Context, input LockedInput, status *InputStatus) error {
+	dir := localGitDir(input)
+	output, err := gitOutput(ctx, "-C", dir, "log", "-1", "--format=%H %ct", gitRef(input))
+	if err != nil {
+		return fmt.Errorf("failed to read %s in %s: %w", gitRef(input), dir, err)
+	}
+	fields := strings.Fields(output)
+	if len(fields) != 2 {
+		return fmt.Errorf("unexpected git log output: %q", output)
+	}
+	status.LatestRev = fields[0]
+	if seconds, err := strconv.ParseInt(fields[1], 10, 64); err == nil {
+		latest := time.Unix(seconds, 0).UTC()
+		status.LatestModified = &latest
+	}
+	status.UpToDate = status.LatestRev == input.Rev
+
+	behind := 0
+	if !status.UpToDate {
+		output, err := gitOutput(ctx, "-C", dir, "rev-list", "--count", input.Rev+".."+status.LatestRev)
+		if err != nil {
+			// The locked commit may be gone after a force push, the count is then unknown
+			return nil
+		}
+		if behind, err = strconv.Atoi(strings.TrimSpace(output)); err != nil {
+			return nil
+		}
+	}
+	status.CommitsBehind = &behind
+	return nil
+}
+
+// checkRemoteGitInput asks a remote repository for the commit its ref points to
+func checkRemoteGitInput(ctx context.Context, input LockedInput, status *InputStatus) error {
+	output, err := gitOutput(ctx, "ls-remote", input.locked.URL, gitRef(input))
+	if err != nil {
+		return fmt.Errorf("git ls-remote %s failed: %w", input.locked.URL, err)
+	}
+	fields := strings.Fields(output)
+	if len(fields) == 0 {
+		return fmt.Errorf("ref %s not found in %s", gitRef(input), input.locked.URL)
+	}
+	status.LatestRev = fields[0]
+	status.UpToDate = status.LatestRev == input.Rev
+	return nil
+}
+
+// flakeMetadata is the part of the output of 'nix flake metadata --json' camp uses
+type flakeMetadata struct {
+	Revision     string `json:"revision"`
+	LastModified int64  `json:"lastModified"`
+}
+
+// checkFlakeMetadata asks Nix to lock the reference of an input from flake.nix again
+func checkFlakeMetadata(ctx context.Context, input LockedInput, status *InputStatus) error {
+	ref := originalFlakeRef(input)
+	if ref == "" {
+		return fmt.Errorf("checking %s inputs is not supported", input.Type)
+	}
+	result, err := utils.Run(ctx, utils.Command{
+		Name:    "nix",
+		Args:    nixCommandArgs("flake", "metadata", "--json", "--refresh", ref),
+		Capture: true,
+	})
+	if err != nil {
+		return fmt.Errorf("nix flake metadata %s failed: %w", ref, err)
+	}
+
+	var metadata flakeMetadata
+	if err := json.Unmarshal([]byte(result.Stdout), &metadata); err != nil {
+		return fmt.Errorf("failed to parse nix flake metadata output: %w", err)
+	}
+	status.LatestRev = metadata.Revision
+	if metadata.LastModified > 0 {
+		latest := time.Unix(metadata.LastModified, 0).UTC()
+		status.LatestModified = &latest
+	}
+	if metadata.Revision != "" {
+		status.UpToDate = metadata.Revision == input.Rev
+	} else {
+		status.UpToDate = metadata.LastModified <= input.LastModified.Unix()
+	}
+	return nil
+}
+
+// originalFlakeRef returns the flake reference of an input as written in flake.nix
+func originalFlakeRef(input LockedInput) string {
+	original := input.original
+	switch original.Type {
+	case FlakeRefGitHub, FlakeRefGitLab, FlakeRefIndirect, FlakeRefTarball:
+		return original.flakeRef().String()
+	case "sourcehut":
+		ref := fmt.Sprintf("%s:%s/%s", original.Type, original.Owner, original.Repo)
+		if original.Ref != "" {
+			ref += "/" + original.Ref
+		}
+		return ref
+	case "file":
+		return original.URL
+	}
+	return ""
+}
+
+// countCommitsBehind counts the commits between the locked and the latest
+// revision of a remote input: with the compare API for github.com inputs, in a
+// treeless clone cached in ~/.camp/state/git for other git repositories.
+// The count is left unknown when it fails, e.g. after a force push
+func countCommitsBehind(ctx context.Context, user *User, input LockedInput, status *InputStatus) {
+	behind := 0
+	if !status.UpToDate {
+		if input.Rev == "" || status.LatestRev == "" {
+			return
+		}
+		var err error
+		if input.locked.Type == "github" && input.locked.onGitHub() {
+			behind, err = githubCommitsBehind(ctx, input.locked, input.Rev, status.LatestRev)
+		} else if url := gitRemoteURL(input.locked); url != "" {
+			behind, err = cachedGitCommitsBehind(ctx, user, url, gitRef(input), input.Rev, status.LatestRev)
+		} else {
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+	status.CommitsBehind = &behind
+}
+
+// githubCompare is the part of the GitHub compare API response camp uses
+type githubCompare struct {
+	AheadBy int `json:"ahead_by"`
+}
+
+// githubCommitsBehind asks GitHub how many commits head is ahead of base.
+// GITHUB_TOKEN, when set, raises the rate limit of the API
+func githubCommitsBehind(ctx context.Context, ref flakeLockedRef, base, head string) (int, error) {
+	url := fmt.Sprintf("%s/repos/%s/%s/compare/%s...%s", GitHubAPIURL, ref.Owner, ref.Repo, base, head)
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Accept", "application/vnd.github+json")
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("GitHub compare API returned %s", response.Status)
+	}
+	var compare githubCompare
+	if err := json.NewDecoder(response.Body).Decode(&compare); err != nil {
+		return 0, fmt.Errorf("failed to parse GitHub compare API response: %w", err)
+	}
+	return compare.AheadBy, nil
+}
+
+// gitRemoteURL returns the repository of a locked GitLab, GitHub Enterprise or
+// remote git input, or an empty string when it isn't a git repository
+func gitRemoteURL(ref flakeLockedRef) string {
+	switch ref.Type {
+	case "github", "gitlab":
+		host := ref.Host
+		if host == "" {
+			host = ref.Type + ".com"
+		}
+		return fmt.Sprintf("https://%s/%s/%s.git", host, ref.Owner, ref.Repo)
+	case "git":
+		return ref.URL
+	}
+	return ""
+}
+
+// gitCacheDir returns the bare repository caching the commits of a remote repository
+func gitCacheDir(user *User, url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(user.StateDir(), "git", hex.EncodeToString(sum[:8])+".git")
+}
+
+// cachedGitCommitsBehind fetches the commits of ref, without their files, into
+// a bare repository cached across runs and counts those between base and head
+func cachedGitCommitsBehind(ctx context.Context, user *User, url, ref, base, head string) (int, error) {
+	dir := gitCacheDir(user, url)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		if _, err := gitOutput(ctx, "init", "--bare", "--quiet", dir); err != nil {
+			return 0, fmt.Errorf("git init %s failed: %w", dir, err)
+		}
+	}
+	if _, err := gitOutput(ctx, "-C", dir, "fetch", "--quiet", "--filter=tree:0", url, "+"+ref+":refs/camp/latest"); err != nil {
+		return 0, fmt.Errorf("git fetch %s failed: %w", url, err)
+	}
+	output, err := gitOutput(ctx, "-C", dir, "rev-list", "--count", base+".."+head)
+	if err != nil {
+		return 0, fmt.Errorf("git rev-list failed: %w", err)
+	}
+	return strconv.Atoi(output)
+}
+
+// gitOutput runs git and returns its output
+func gitOutput(ctx context.Context, args ...string) (string, error) {
+	result, err := utils.Run(ctx, utils.Command{Name: "git", Args: args, Capture: true})
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(result.Stdout), nil
+}
+
+// loadOutdatedCache returns the cached statuses by input name. A missing or unreadable cache is empty
+func loadOutdatedCache(user *User) map[string]InputStatus {
+	cache := map[string]InputStatus{}
+	if data, err := os.ReadFile(outdatedCachePath(user)); err == nil {
+		json.Unmarshal(data, &cache)
+	}
+	return cache
+}
+
+// saveOutdatedCache stores the statuses of remote inputs. The cache only saves
+// time, so failures to write it are ignored
+func saveOutdatedCache(user *User, cache map[string]InputStatus) {
+	if err := ensureStateDir(user); err != nil {
+		return
+	}
+	if data, err := json.MarshalIndent(cache, "", "  "); err == nil {
+		os.WriteFile(outdatedCachePath(user), data, 0644)
+	}
+}
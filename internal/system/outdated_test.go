@@ -0,0 +1,226 @@
+package system
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"camp/internal/utils"
+)
+
+// outdatedTestLock returns a flake.lock with the given nodes as direct inputs
+func outdatedTestLock(nodes map[string]string) string {
+	var entries, inputs []string
+	for name, node := range nodes {
+		entries = append(entries, `"`+name+`": `+node)
+		inputs = append(inputs, `"`+name+`": "`+name+`"`)
+	}
+	return `{"nodes": {` + strings.Join(entries, ",") + `, "root": {"inputs": {` + strings.Join(inputs, ",") + `}}}, "root": "root", "version": 7}`
+}
+
+// gitCommit commits a change to file in the repository dir and returns the commit
+func gitCommit(t *testing.T, dir, file, content string) string {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, file), []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", file, err)
+	}
+	for _, args := range [][]string{{"add", file}, {"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", file}} {
+		if output, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, output)
+		}
+	}
+	output, err := exec.Command("git", "-C", dir, "rev-parse", "HEAD").Output()
+	if err != nil {
+		t.Fatalf("git rev-parse failed: %v", err)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// withGitHubAPI serves the GitHub compare API, answering that head is ahead of base by aheadBy commits
+func withGitHubAPI(t *testing.T, aheadBy int) *[]string {
+	t.Helper()
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path)
+		fmt.Fprintf(w, `{"status": "ahead", "ahead_by": %d, "behind_by": 0}`, aheadBy)
+	}))
+	t.Cleanup(server.Close)
+	original := GitHubAPIURL
+	GitHubAPIURL = server.URL
+	t.Cleanup(func() { GitHubAPIURL = original })
+	return &requests
+}
+
+func TestCheckOutdatedInputsOffline(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("Skipping test: git not installed")
+	}
+	user := newBackendTestUser(t, "linux")
+	now := time.Now()
+
+	// A local repository with one commit since the locked one
+	repo := t.TempDir()
+	if output, err := exec.Command("git", "init", "-q", "-b", "main", repo).CombinedOutput(); err != nil {
+		t.Fatalf("git init failed: %v\n%s", err, output)
+	}
+	lockedRev := gitCommit(t, repo, "flake.nix", "{ }")
+	latestRev := gitCommit(t, repo, "README", "docs")
+
+	// A path input modified after it was locked
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "flake.nix"), []byte("{ }"), 0644); err != nil {
+		t.Fatalf("Failed to write flake.nix: %v", err)
+	}
+	lockedAt := strconv.FormatInt(now.Add(-48*time.Hour).Unix(), 10)
+
+	lock := outdatedTestLock(map[string]string{
+		"local-git": `{"locked": {"lastModified": ` + lockedAt + `, "rev": "` + lockedRev + `", "type": "git", "url": "file://` + repo + `"}, "original": {"ref": "main", "type": "git", "url": "file://` + repo + `"}}`,
+		"local-dir": `{"locked": {"lastModified": ` + lockedAt + `, "path": "` + dir + `", "type": "path"}, "original": {"path": "` + dir + `", "type": "path"}}`,
+	})
+	if err := os.WriteFile(FlakeLockPath(user), []byte(lock), 0644); err != nil {
+		t.Fatalf("Failed to write flake.lock: %v", err)
+	}
+
+	statuses, err := CheckOutdatedInputs(context.Background(), user, false, now)
+	if err != nil {
+		t.Fatalf("CheckOutdatedInputs() failed: %v", err)
+	}
+	if len(statuses) != 2 {
+		t.Fatalf("Expected two inputs, got %+v", statuses)
+	}
+
+	dirStatus, gitStatus := statuses[0], statuses[1]
+	if dirStatus.Error != "" || dirStatus.UpToDate || dirStatus.LatestModified == nil || dirStatus.AgeDays != 2 {
+		t.Errorf("Expected the path input to be outdated, got %+v", dirStatus)
+	}
+	if gitStatus.Error != "" || gitStatus.UpToDate || gitStatus.LatestRev != latestRev {
+		t.Fatalf("Expected the git input to be behind %s, got %+v", latestRev, gitStatus)
+	}
+	if gitStatus.CommitsBehind == nil || *gitStatus.CommitsBehind != 1 {
+		t.Errorf("Expected the git input to be 1 commit behind, got %+v", gitStatus)
+	}
+	if _, err := os.Stat(outdatedCachePath(user)); err == nil {
+		if cache := loadOutdatedCache(user); len(cache) != 0 {
+			t.Errorf("Expected local inputs not to be cached, got %+v", cache)
+		}
+	}
+}
+
+func TestCheckOutdatedInputsRemote(t *testing.T) {
+	user := newBackendTestUser(t, "linux")
+	lock := outdatedTestLock(map[string]string{
+		"nixpkgs": `{"locked": {"lastModified": 1714521600, "owner": "NixOS", "repo": "nixpkgs", "rev": "` + oldNixpkgsRev + `", "type": "github"}, "original": {"owner": "NixOS", "ref": "nixos-unstable", "repo": "nixpkgs", "type": "github"}}`,
+		"team":    `{"locked": {"lastModified": 1714521600, "rev": "` + homeManagerRev + `", "type": "git", "url": "https://example.com/team.git"}, "original": {"type": "git", "url": "https://example.com/team.git"}}`,
+		"tools":   `{"locked": {"dir": "nix", "host": "git.example.com", "lastModified": 1714521600, "owner": "team", "repo": "tools", "rev": "` + oldNixpkgsRev + `", "type": "gitlab"}, "original": {"dir": "nix", "host": "git.example.com", "owner": "team", "ref": "main", "repo": "tools", "type": "gitlab"}}`,
+	})
+	requests := withGitHubAPI(t, 1234)
+	if err := os.WriteFile(FlakeLockPath(user), []byte(lock), 0644); err != nil {
+		t.Fatalf("Failed to write flake.lock: %v", err)
+	}
+
+	fake := stubCommands(t, "")
+	fake.Respond = func(command utils.Command) (string, error) {
+		switch {
+		case command.Name != "git":
+			return `{"revision": "` + newNixpkgsRev + `", "lastModified": 1716163200}`, nil
+		case command.Args[0] == "ls-remote":
+			return homeManagerRev + "\tHEAD\n", nil
+		case command.Args[len(command.Args)-2] == "--count":
+			return "42\n", nil
+		}
+		return "", nil
+	}
+
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	statuses, err := CheckOutdatedInputs(context.Background(), user, false, now)
+	if err != nil {
+		t.Fatalf("CheckOutdatedInputs() failed: %v", err)
+	}
+	gitCache := gitCacheDir(user, "https://git.example.com/team/tools.git")
+	want := []string{
+		"nix --extra-experimental-features nix-command --extra-experimental-features flakes flake metadata --json --refresh github:NixOS/nixpkgs/nixos-unstable",
+		"git ls-remote https://example.com/team.git HEAD",
+		"nix --extra-experimental-features nix-command --extra-experimental-features flakes flake metadata --json --refresh gitlab:team/tools/main?dir=nix&host=git.example.com",
+		"git init --bare --quiet " + gitCache,
+		"git -C " + gitCache + " fetch --quiet --filter=tree:0 https://git.example.com/team/tools.git +main:refs/camp/latest",
+		"git -C " + gitCache + " rev-list --count " + oldNixpkgsRev + ".." + newNixpkgsRev,
+	}
+	if got := fake.Commands(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Expected commands:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+
+	// GitHub counts the commits behind, other repositories are fetched to count them
+	nixpkgs, team, tools := statuses[0], statuses[1], statuses[2]
+	if nixpkgs.UpToDate || nixpkgs.LatestRev != newNixpkgsRev || nixpkgs.Latest() != "bbbbbbb (2024-05-20)" || nixpkgs.AgeDays != 31 {
+		t.Errorf("Expected nixpkgs to be outdated, got %+v", nixpkgs)
+	}
+	if nixpkgs.CommitsBehind == nil || *nixpkgs.CommitsBehind != 1234 {
+		t.Errorf("Expected nixpkgs to be 1234 commits behind, got %v", nixpkgs.CommitsBehind)
+	}
+	if wantRequests := []string{"/repos/NixOS/nixpkgs/compare/" + oldNixpkgsRev + "..." + newNixpkgsRev}; strings.Join(*requests, ",") != strings.Join(wantRequests, ",") {
+		t.Errorf("Expected GitHub requests %v, got %v", wantRequests, *requests)
+	}
+	if !team.UpToDate || team.Error != "" || team.CommitsBehind == nil || *team.CommitsBehind != 0 {
+		t.Errorf("Expected team to be up to date, got %+v", team)
+	}
+	if tools.CommitsBehind == nil || *tools.CommitsBehind != 42 {
+		t.Errorf("Expected tools to be 42 commits behind, got %v", tools.CommitsBehind)
+	}
+
+	// Remote results are cached until they expire or a refresh is asked
+	tests := []struct {
+		name      string
+		now       time.Time
+		refresh   bool
+		wantCalls int
+	}{
+		{name: "cached", now: now.Add(time.Hour)},
+		{name: "expired", now: now.Add(outdatedCacheTTL), wantCalls: len(want)},
+		{name: "refresh", now: now.Add(outdatedCacheTTL + time.Hour), refresh: true, wantCalls: len(want)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake.Calls = nil
+			statuses, err := CheckOutdatedInputs(context.Background(), user, tt.refresh, tt.now)
+			if err != nil {
+				t.Fatalf("CheckOutdatedInputs() failed: %v", err)
+			}
+			if len(fake.Calls) != tt.wantCalls {
+				t.Errorf("Expected %d commands, got %v", tt.wantCalls, fake.Commands())
+			}
+			if statuses[0].Cached != (tt.wantCalls == 0) || statuses[0].LatestRev != newNixpkgsRev {
+				t.Errorf("Unexpected status: %+v", statuses[0])
+			}
+		})
+	}
+}
+
+func TestCheckOutdatedInputsReportsFailures(t *testing.T) {
+	user := newBackendTestUser(t, "linux")
+	if err := os.WriteFile(FlakeLockPath(user), []byte(testFlakeLock(oldNixpkgsRev, 1714521600)), 0644); err != nil {
+		t.Fatalf("Failed to write flake.lock: %v", err)
+	}
+	fake := stubCommands(t, "")
+	fake.Err = &exec.ExitError{}
+
+	statuses, err := CheckOutdatedInputs(context.Background(), user, false, time.Now())
+	if err != nil {
+		t.Fatalf("CheckOutdatedInputs() failed: %v", err)
+	}
+	for _, status := range statuses {
+		if status.Error == "" {
+			t.Errorf("Expected %s to report the failure, got %+v", status.Input, status)
+		}
+	}
+	if cache := loadOutdatedCache(user); len(cache) != 0 {
+		t.Errorf("Expected failures not to be cached, got %+v", cache)
+	}
+}
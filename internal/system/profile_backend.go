@@ -0,0 +1,175 @@
+package system
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// profilePackageName is the flake package holding the buildEnv of camp.yml packages
+const profilePackageName = "camp-profile"
+
+// profileBackend installs the packages from camp.yml into a dedicated Nix
+// profile and exposes env values through a sourced shell snippet. It is meant
+// for machines where neither home-manager nor nix-darwin can be used
+type profileBackend struct{}
+
+func (b *profileBackend) Name() string {
+	return BackendProfile
+}
+
+func (b *profileBackend) Prepare(user *User) error {
+	return PrepareEnvironment(user)
+}
+
+func (b *profileBackend) Build(user *User) error {
+	if err := ensureNixDir(user); err != nil {
+		return err
+	}
+	if err := ensureStateDir(user); err != nil {
+		return err
+	}
+	if err := runCommand("nix", nixCommandArgs(withLogFormat("build", "--impure", b.flakeRef(user), "--out-link", ResultLink(user))...)...); err != nil {
+		return fmt.Errorf("build command failed: %w", err)
+	}
+	return nil
+}
+
+func (b *profileBackend) Switch(user *User) error {
+	if err := ensureNixDir(user); err != nil {
+		return err
+	}
+	if err := ensureStateDir(user); err != nil {
+		return err
+	}
+
+	// Install on the first run, upgrade the installed element afterwards
+	profile := ProfilePath(user)
+	args := nixCommandArgs("profile", "install", "--impure", "--profile", profile, b.flakeRef(user))
+	if _, err := os.Lstat(profile); err == nil {
+		args = nixCommandArgs("profile", "upgrade", "--impure", "--profile", profile, "--all")
+	}
+	if err := runCommand("nix", withLogFormat(args...)...); err != nil {
+		return fmt.Errorf("rebuild command failed: %w", err)
+	}
+
+	if err := WriteProfileEnv(user); err != nil {
+		return fmt.Errorf("failed to write environment snippet: %w", err)
+	}
+	return nil
+}
+
+func (b *profileBackend) Rollback(user *User) error {
+	if err := runCommand("nix", nixCommandArgs("profile", "rollback", "--profile", ProfilePath(user))...); err != nil {
+		return fmt.Errorf("rollback command failed: %w", err)
+	}
+	return nil
+}
+
+func (b *profileBackend) Generations(user *User) ([]Generation, error) {
+	return listProfileGenerations(ProfilePath(user))
+}
+
+// flakeRef returns the flake reference of the profile package
+func (b *profileBackend) flakeRef(user *User) string {
+	return fmt.Sprintf("%s#%s", user.NixDir(), profilePackageName)
+}
+
+// IgnoredFlakes returns the active flakes of the user whose outputs the
+// backend doesn't apply. The profile backend only installs packages, so the
+// home and system outputs of every flake are left out of the environment
+func IgnoredFlakes(user *User, backend string) []Flake {
+	if backend != BackendProfile {
+		return nil
+	}
+	ignored := []Flake{}
+	for _, flake := range ActiveFlakes(user) {
+		if len(flake.Outputs) > 0 {
+			ignored = append(ignored, flake)
+		}
+	}
+	return ignored
+}
+
+// ProfilePath returns the Nix profile managed by the profile backend
+func ProfilePath(user *User) string {
+	return filepath.Join(user.StateDir(), "profile")
+}
+
+// ProfileEnvPath returns the shell snippet exporting the profile environment.
+// Users source it from their shell rc file
+func ProfileEnvPath(user *User) string {
+	return filepath.Join(user.StateDir(), "env.sh")
+}
+
+// WriteProfileEnv writes the shell snippet that puts the profile on PATH and
+// exports the env values from camp.yml
+func WriteProfileEnv(user *User) error {
+	var b strings.Builder
+	b.WriteString("# Auto-generated by camp (profile backend). Source this file from your shell rc.\n")
+	fmt.Fprintf(&b, "export PATH=%s:\"$PATH\"\n", shellQuote(filepath.Join(ProfilePath(user), "bin")))
+
+	// Sort keys so the snippet is stable across rebuilds
+	names := make([]string, 0, len(user.EnvVars))
+	for name := range user.EnvVars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&b, "export %s=%s\n", name, shellQuote(user.EnvVars[name]))
+	}
+
+	return os.WriteFile(ProfileEnvPath(user), []byte(b.String()), 0644)
+}
+
+// shellQuote quotes a value for POSIX shells
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// profileLinkRegex matches generation links like "profile-3-link"
+var profileLinkRegex = regexp.MustCompile(`^(.+)-(\d+)-link$`)
+
+// listProfileGenerations lists the generation links of a Nix profile
+func listProfileGenerations(profile string) ([]Generation, error) {
+	dir := filepath.Dir(profile)
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return []Generation{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read profile directory: %w", err)
+	}
+
+	// The profile itself links to the active generation
+	current, _ := os.Readlink(profile)
+
+	gens := []Generation{}
+	for _, entry := range entries {
+		matches := profileLinkRegex.FindStringSubmatch(entry.Name())
+		if matches == nil || matches[1] != filepath.Base(profile) {
+			continue
+		}
+		id, err := strconv.Atoi(matches[2])
+		if err != nil {
+			continue
+		}
+
+		date := ""
+		if info, err := os.Lstat(filepath.Join(dir, entry.Name())); err == nil {
+			date = info.ModTime().Format("2006-01-02 15:04:05")
+		}
+
+		gens = append(gens, Generation{
+			ID:      id,
+			Date:    date,
+			Path:    filepath.Join(dir, entry.Name()),
+			Current: filepath.Base(current) == entry.Name(),
+		})
+	}
+	sort.Slice(gens, func(i, j int) bool { return gens[i].ID < gens[j].ID })
+	return gens, nil
+}
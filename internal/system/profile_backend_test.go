@@ -0,0 +1,168 @@
+package system
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProfileBackend_Switch(t *testing.T) {
+	t.Run("installs on first run", func(t *testing.T) {
+		user := newBackendTestUser(t, "linux")
+		user.EnvVars = map[string]string{"EDITOR": "nvim"}
+		recorded := stubCommands(t, "")
+
+		if err := (&profileBackend{}).Switch(user); err != nil {
+			t.Fatalf("Switch() failed: %v", err)
+		}
+
+		want := "nix --extra-experimental-features nix-command --extra-experimental-features flakes profile install --impure --profile " +
+			ProfilePath(user) + " " + user.NixDir() + "#camp-profile"
+		if got := recorded.Calls[0].String(); got != want {
+			t.Errorf("Expected command:\n%s\ngot:\n%s", want, got)
+		}
+
+		if _, err := os.Stat(ProfileEnvPath(user)); err != nil {
+			t.Errorf("Switch() should write the environment snippet: %v", err)
+		}
+	})
+
+	t.Run("upgrades an existing profile", func(t *testing.T) {
+		user := newBackendTestUser(t, "linux")
+		recorded := stubCommands(t, "")
+
+		if err := os.MkdirAll(user.StateDir(), 0755); err != nil {
+			t.Fatalf("Failed to create state directory: %v", err)
+		}
+		if err := os.Symlink("profile-1-link", ProfilePath(user)); err != nil {
+			t.Fatalf("Failed to create profile link: %v", err)
+		}
+
+		if err := (&profileBackend{}).Switch(user); err != nil {
+			t.Fatalf("Switch() failed: %v", err)
+		}
+
+		got := recorded.Calls[0].String()
+		if !strings.Contains(got, "profile upgrade --impure --profile "+ProfilePath(user)+" --all") {
+			t.Errorf("Expected profile upgrade, got: %s", got)
+		}
+	})
+}
+
+func TestProfileBackend_BuildAndRollback(t *testing.T) {
+	user := newBackendTestUser(t, "linux")
+	backend := &profileBackend{}
+
+	recorded := stubCommands(t, "")
+	if err := backend.Build(user); err != nil {
+		t.Fatalf("Build() failed: %v", err)
+	}
+	wantBuild := "build --impure " + user.NixDir() + "#camp-profile --out-link " + filepath.Join(user.StateDir(), "result")
+	if got := recorded.Calls[0].String(); !strings.HasSuffix(got, wantBuild) {
+		t.Errorf("Expected build command ending with:\n%s\ngot:\n%s", wantBuild, got)
+	}
+
+	recorded = stubCommands(t, "")
+	if err := backend.Rollback(user); err != nil {
+		t.Fatalf("Rollback() failed: %v", err)
+	}
+	if got := recorded.Calls[0].String(); !strings.HasSuffix(got, "profile rollback --profile "+ProfilePath(user)) {
+		t.Errorf("Unexpected rollback command: %s", got)
+	}
+}
+
+func TestWriteProfileEnv(t *testing.T) {
+	user := &User{
+		HomeDir: t.TempDir(),
+		EnvVars: map[string]string{
+			"EDITOR":   "nvim",
+			"GREETING": "it's me",
+		},
+	}
+	if err := os.MkdirAll(user.StateDir(), 0755); err != nil {
+		t.Fatalf("Failed to create state directory: %v", err)
+	}
+
+	if err := WriteProfileEnv(user); err != nil {
+		t.Fatalf("WriteProfileEnv() failed: %v", err)
+	}
+
+	content, err := os.ReadFile(ProfileEnvPath(user))
+	if err != nil {
+		t.Fatalf("Failed to read snippet: %v", err)
+	}
+	contentStr := string(content)
+
+	expected := []string{
+		"export PATH='" + filepath.Join(ProfilePath(user), "bin") + "':\"$PATH\"",
+		"export EDITOR='nvim'",
+		`export GREETING='it'\''s me'`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(contentStr, line) {
+			t.Errorf("Expected snippet to contain %q, got:\n%s", line, contentStr)
+		}
+	}
+
+	// Variables are sorted for stable output
+	if strings.Index(contentStr, "EDITOR") > strings.Index(contentStr, "GREETING") {
+		t.Error("Expected variables to be sorted by name")
+	}
+}
+
+func TestListProfileGenerations(t *testing.T) {
+	stateDir := t.TempDir()
+	profile := filepath.Join(stateDir, "profile")
+
+	for _, name := range []string{"profile-1-link", "profile-2-link", "profile-10-link"} {
+		if err := os.Symlink("/nix/store/fake", filepath.Join(stateDir, name)); err != nil {
+			t.Fatalf("Failed to create generation link: %v", err)
+		}
+	}
+	if err := os.Symlink("profile-2-link", profile); err != nil {
+		t.Fatalf("Failed to create profile link: %v", err)
+	}
+	// Unrelated entries are ignored
+	if err := os.WriteFile(filepath.Join(stateDir, "env.sh"), []byte(""), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	gens, err := listProfileGenerations(profile)
+	if err != nil {
+		t.Fatalf("listProfileGenerations() failed: %v", err)
+	}
+
+	if len(gens) != 3 {
+		t.Fatalf("Expected 3 generations, got %d: %+v", len(gens), gens)
+	}
+	if gens[0].ID != 1 || gens[1].ID != 2 || gens[2].ID != 10 {
+		t.Errorf("Expected generations sorted by ID, got %+v", gens)
+	}
+	if !gens[1].Current || gens[0].Current || gens[2].Current {
+		t.Errorf("Expected generation 2 to be current, got %+v", gens)
+	}
+
+	t.Run("missing profile directory", func(t *testing.T) {
+		gens, err := listProfileGenerations(filepath.Join(t.TempDir(), "missing", "profile"))
+		if err != nil || len(gens) != 0 {
+			t.Errorf("Expected no generations and no error, got %+v, %v", gens, err)
+		}
+	})
+}
+
+func TestIgnoredFlakes(t *testing.T) {
+	user := newBackendTestUser(t, "linux")
+	user.Flakes = []Flake{
+		{Name: "tools", URL: "github:team/tools", Outputs: []FlakeOutput{{Name: "homeManagerModules.default", Type: OutputTypeHome}}},
+		{Name: "mac", URL: "github:team/mac", When: &FlakeCondition{Platform: "darwin"}, Outputs: []FlakeOutput{{Name: "darwinModules.default", Type: OutputTypeSystem}}},
+	}
+
+	ignored := IgnoredFlakes(user, BackendProfile)
+	if len(ignored) != 1 || ignored[0].Name != "tools" {
+		t.Errorf("Expected the active flake to be ignored, got %+v", ignored)
+	}
+	if ignored := IgnoredFlakes(user, BackendHomeManager); len(ignored) != 0 {
+		t.Errorf("Expected home-manager to apply every flake, got %+v", ignored)
+	}
+}
@@ -0,0 +1,527 @@
+package system
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"camp/internal/utils"
+)
+
+// nixLogPrefix starts every message of Nix's internal-json log format
+const nixLogPrefix = "@nix "
+
+// Activity types of the internal-json log format (see nix/src/libutil/logging.hh)
+const (
+	actCopyPath     = 100
+	actFileTransfer = 101
+	actRealise      = 102
+	actCopyPaths    = 103
+	actBuilds       = 104
+	actBuild        = 105
+	actSubstitute   = 108
+)
+
+// Result types of the internal-json log format
+const (
+	resSetPhase    = 104
+	resProgress    = 105
+	resSetExpected = 106
+)
+
+// Message levels of the internal-json log format. Less important levels
+// (notice, info, talkative...) are left to --verbose
+const (
+	lvlError = 0
+	lvlWarn  = 1
+)
+
+// NixLogEvent is a message of Nix's internal-json log format ("@nix {...}")
+type NixLogEvent struct {
+	Action string `json:"action"` // start, stop, result or msg
+	ID     int64  `json:"id"`     // Activity the event belongs to
+	Level  int    `json:"level"`
+	Type   int    `json:"type"` // Activity type for start, result type for result
+	Text   string `json:"text"`
+	Msg    string `json:"msg"`
+	Parent int64  `json:"parent"`
+	Fields []any  `json:"fields"` // Strings and numbers, depending on the type
+}
+
+// ansiEscapeRegex matches the color codes Nix puts in its messages
+var ansiEscapeRegex = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// message returns the text of a msg event without color codes. Errors span
+// several lines, like the last lines of a failed build log
+func (e *NixLogEvent) message() string {
+	return ansiEscapeRegex.ReplaceAllString(e.Msg, "")
+}
+
+// ParseNixLogLine parses a line of internal-json log output. It returns false
+// for lines that aren't log messages, like the output of activation scripts
+func ParseNixLogLine(line string) (*NixLogEvent, bool) {
+	data, ok := strings.CutPrefix(strings.TrimRight(line, "\r\n"), nixLogPrefix)
+	if !ok {
+		return nil, false
+	}
+	var event NixLogEvent
+	if err := json.Unmarshal([]byte(data), &event); err != nil {
+		return nil, false
+	}
+	return &event, true
+}
+
+// field returns a string field of the event, or "" if there is none
+func (e *NixLogEvent) field(i int) string {
+	if i >= len(e.Fields) {
+		return ""
+	}
+	value, _ := e.Fields[i].(string)
+	return value
+}
+
+// intField returns a numeric field of the event, or 0 if there is none
+func (e *NixLogEvent) intField(i int) int64 {
+	if i >= len(e.Fields) {
+		return 0
+	}
+	value, _ := e.Fields[i].(float64)
+	return int64(value)
+}
+
+// nixActivity is a running activity of a Nix build
+type nixActivity struct {
+	kind  int
+	name  string // Store path name the activity works on (e.g. "firefox-121.0")
+	phase string // Build phase reported by the builder (e.g. "buildPhase")
+}
+
+// expectedKey identifies the number of items of a kind an activity expects
+type expectedKey struct {
+	id   int64
+	kind int
+}
+
+// BuildProgress tracks the progress of Nix builds from internal-json log events
+type BuildProgress struct {
+	ToBuild         int      // Derivations to build
+	Built           int      // Derivations built
+	Failed          int      // Derivations that failed to build
+	ToFetch         int      // Store paths to fetch from substituters
+	Fetched         int      // Store paths fetched
+	DownloadedBytes int64    // Bytes downloaded so far
+	DownloadTotal   int64    // Bytes expected to be downloaded (0 if unknown)
+	Errors          []string // Errors reported by Nix
+
+	finishedBuilds int // Builds that stopped, including failed ones
+	running        map[int64]*nixActivity
+	order          []int64 // Running builds and substitutions, oldest first
+	started        map[int]int
+	expected       map[expectedKey]int64
+	totals         map[int][2]int64   // Done and expected builds or copies, by activity type
+	transfers      map[int64][2]int64 // Done and expected bytes of each file transfer
+}
+
+// NewBuildProgress returns an empty build progress
+func NewBuildProgress() *BuildProgress {
+	return &BuildProgress{
+		running:   map[int64]*nixActivity{},
+		started:   map[int]int{},
+		expected:  map[expectedKey]int64{},
+		totals:    map[int][2]int64{},
+		transfers: map[int64][2]int64{},
+	}
+}
+
+// Apply updates the progress with a log event
+func (p *BuildProgress) Apply(event *NixLogEvent) {
+	switch event.Action {
+	case "start":
+		activity := &nixActivity{kind: event.Type}
+		switch event.Type {
+		case actBuild:
+			activity.name = storePathName(event.field(0))
+			p.order = append(p.order, event.ID)
+		case actSubstitute:
+			activity.name = storePathName(event.field(0))
+			p.order = append(p.order, event.ID)
+		}
+		p.running[event.ID] = activity
+		p.started[event.Type]++
+
+	case "stop":
+		activity, ok := p.running[event.ID]
+		if !ok {
+			return
+		}
+		switch activity.kind {
+		case actBuild:
+			p.finishedBuilds++
+		case actSubstitute:
+			p.Fetched++
+		}
+		delete(p.running, event.ID)
+		p.removeFromOrder(event.ID)
+
+	case "result":
+		switch event.Type {
+		case resSetPhase:
+			if activity, ok := p.running[event.ID]; ok {
+				activity.phase = event.field(0)
+			}
+		case resSetExpected:
+			p.expected[expectedKey{event.ID, int(event.intField(0))}] = event.intField(1)
+		case resProgress:
+			activity, ok := p.running[event.ID]
+			if !ok {
+				break
+			}
+			switch activity.kind {
+			case actFileTransfer:
+				// Done and expected bytes
+				p.transfers[event.ID] = [2]int64{event.intField(0), event.intField(1)}
+			case actBuilds:
+				// Done, expected, running and failed builds
+				p.totals[actBuilds] = [2]int64{event.intField(0), event.intField(1)}
+				p.Failed = int(event.intField(3))
+			case actCopyPaths:
+				// Done, expected, running and failed substitutions
+				p.totals[actCopyPaths] = [2]int64{event.intField(0), event.intField(1)}
+			}
+		}
+
+	case "msg":
+		if event.Level == lvlError {
+			p.Errors = append(p.Errors, event.message())
+		}
+	}
+	p.update()
+}
+
+// update recomputes the totals from the activities seen so far. Builds and
+// substitutions are counted by the progress of their parent activity, while
+// the expected copies of the realisation are NAR bytes, not paths
+func (p *BuildProgress) update() {
+	var downloadTotal int64
+	for key, n := range p.expected {
+		if key.kind == actFileTransfer {
+			downloadTotal += n
+		}
+	}
+
+	var downloaded, transferTotal int64
+	for _, transfer := range p.transfers {
+		downloaded += transfer[0]
+		transferTotal += transfer[1]
+	}
+
+	// Activities can start before Nix announced them
+	p.ToBuild = max(int(p.totals[actBuilds][1]), p.started[actBuild])
+	p.Built = max(int(p.totals[actBuilds][0]), p.finishedBuilds-p.Failed, 0)
+	p.ToFetch = max(int(p.totals[actCopyPaths][1]), p.started[actSubstitute])
+	p.DownloadedBytes = downloaded
+	p.DownloadTotal = max(downloadTotal, transferTotal)
+}
+
+// removeFromOrder forgets a finished build or substitution
+func (p *BuildProgress) removeFromOrder(id int64) {
+	for i, running := range p.order {
+		if running == id {
+			p.order = append(p.order[:i], p.order[i+1:]...)
+			return
+		}
+	}
+}
+
+// Realising reports whether Nix is building or fetching store paths
+func (p *BuildProgress) Realising() bool {
+	for _, activity := range p.running {
+		switch activity.kind {
+		case actRealise, actBuilds, actBuild, actCopyPaths, actCopyPath, actSubstitute:
+			return true
+		}
+	}
+	return false
+}
+
+// Current describes the most recent running build or substitution (e.g. "building firefox-121.0")
+func (p *BuildProgress) Current() string {
+	if len(p.order) == 0 {
+		return ""
+	}
+	activity := p.running[p.order[len(p.order)-1]]
+	if activity.kind == actSubstitute {
+		return "fetching " + activity.name
+	}
+	if activity.phase != "" {
+		return fmt.Sprintf("building %s (%s)", activity.name, activity.phase)
+	}
+	return "building " + activity.name
+}
+
+// Summary describes the work done (e.g. "built 3 derivations, fetched 12 paths, downloaded 40.2 MiB")
+func (p *BuildProgress) Summary() string {
+	var parts []string
+	if p.Built > 0 {
+		parts = append(parts, fmt.Sprintf("built %s", plural(p.Built, "derivation")))
+	}
+	if p.Failed > 0 {
+		parts = append(parts, fmt.Sprintf("%d failed", p.Failed))
+	}
+	if p.Fetched > 0 {
+		parts = append(parts, fmt.Sprintf("fetched %s", plural(p.Fetched, "path")))
+	}
+	if p.DownloadedBytes > 0 {
+		parts = append(parts, fmt.Sprintf("downloaded %s", FormatBytes(p.DownloadedBytes)))
+	}
+	if len(parts) == 0 {
+		return "nothing to build"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// storeHashRegex matches the hash prefix of store path names
+var storeHashRegex = regexp.MustCompile(`^[0-9a-z]{32}-`)
+
+// storePathName returns the name of a store path without hash and .drv suffix
+func storePathName(path string) string {
+	name := storeHashRegex.ReplaceAllString(filepath.Base(path), "")
+	return strings.TrimSuffix(name, ".drv")
+}
+
+// plural formats a count with a noun (e.g. "1 path", "3 paths")
+func plural(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// Phases of a rebuild as seen in the Nix log
+const (
+	progressEvaluate = "evaluate"
+	progressBuild    = "build"
+	progressActivate = "activate"
+)
+
+// statusRedrawInterval limits how often the live status line is redrawn
+const statusRedrawInterval = 100 * time.Millisecond
+
+// ProgressRenderer turns the internal-json log output of Nix commands into a
+// compact summary. Completed phases, Nix errors and warnings, and other output
+// (like activation scripts) are written to out. A live status line is drawn
+// on status, usually a terminal, when it isn't nil. The log messages are kept
+// as is on raw, when it isn't nil
+type ProgressRenderer struct {
+	progress   *BuildProgress
+	out        io.Writer
+	raw        io.Writer
+	status     io.Writer
+	now        func() time.Time
+	phase      string
+	phaseStart time.Time
+	seen       bool // Whether any output was received
+	pending    []byte
+	drawnAt    time.Time
+	drawn      bool // Whether a status line is on screen
+}
+
+// NewProgressRenderer creates a renderer writing to out, with a live status line on status (may be nil)
+func NewProgressRenderer(out, status io.Writer) *ProgressRenderer {
+	return newProgressRenderer(out, status, time.Now)
+}
+
+func newProgressRenderer(out, status io.Writer, now func() time.Time) *ProgressRenderer {
+	return &ProgressRenderer{
+		progress:   NewBuildProgress(),
+		out:        out,
+		status:     status,
+		now:        now,
+		phase:      progressEvaluate,
+		phaseStart: now(),
+	}
+}
+
+// Progress returns the build progress seen so far
+func (r *ProgressRenderer) Progress() *BuildProgress {
+	return r.progress
+}
+
+// Write receives output of Nix commands, handling it line by line
+func (r *ProgressRenderer) Write(p []byte) (int, error) {
+	r.pending = append(r.pending, p...)
+	for {
+		i := bytes.IndexByte(r.pending, '\n')
+		if i < 0 {
+			break
+		}
+		r.handleLine(string(r.pending[:i]))
+		r.pending = r.pending[i+1:]
+	}
+	return len(p), nil
+}
+
+// handleLine renders a single line of output
+func (r *ProgressRenderer) handleLine(line string) {
+	r.seen = true
+	event, ok := ParseNixLogLine(line)
+	if !ok {
+		// Output of activation scripts and other tools is shown as is
+		if r.phase == progressBuild && !r.progress.Realising() {
+			r.startPhase(progressActivate)
+		}
+		r.println(line)
+		return
+	}
+	if r.raw != nil {
+		fmt.Fprintln(r.raw, line)
+	}
+
+	r.progress.Apply(event)
+	if event.Action == "start" && r.phase == progressEvaluate && r.progress.Realising() {
+		r.startPhase(progressBuild)
+	}
+	if event.Action == "msg" && event.Level <= lvlWarn {
+		r.println(event.message())
+	}
+	r.drawStatus(false)
+}
+
+// startPhase reports the completed phase and starts the next one
+func (r *ProgressRenderer) startPhase(phase string) {
+	r.println(r.phaseDone())
+	r.phase = phase
+	r.phaseStart = r.now()
+	r.drawStatus(true)
+}
+
+// phaseDone describes the completion of the current phase
+func (r *ProgressRenderer) phaseDone() string {
+	elapsed := formatElapsed(r.now().Sub(r.phaseStart))
+	switch r.phase {
+	case progressEvaluate:
+		return fmt.Sprintf("✓ Evaluated configuration (%s)", elapsed)
+	case progressBuild:
+		return fmt.Sprintf("✓ Build finished: %s (%s)", r.progress.Summary(), elapsed)
+	default:
+		return fmt.Sprintf("✓ Activated environment (%s)", elapsed)
+	}
+}
+
+// phaseFailed describes the failure of the current phase
+func (r *ProgressRenderer) phaseFailed() string {
+	elapsed := formatElapsed(r.now().Sub(r.phaseStart))
+	switch r.phase {
+	case progressEvaluate:
+		return fmt.Sprintf("✗ Evaluation failed after %s", elapsed)
+	case progressBuild:
+		return fmt.Sprintf("✗ Build failed after %s (%s)", elapsed, r.progress.Summary())
+	default:
+		return fmt.Sprintf("✗ Activation failed after %s", elapsed)
+	}
+}
+
+// drawStatus redraws the live status line, at most every statusRedrawInterval unless forced
+func (r *ProgressRenderer) drawStatus(force bool) {
+	if r.status == nil {
+		return
+	}
+	now := r.now()
+	if !force && now.Sub(r.drawnAt) < statusRedrawInterval {
+		return
+	}
+	r.drawnAt = now
+	r.drawn = true
+	fmt.Fprintf(r.status, "\r\033[K%s", r.statusLine())
+}
+
+// statusLine describes the current phase and progress on a single line
+func (r *ProgressRenderer) statusLine() string {
+	line := fmt.Sprintf("[%s %s]", r.phase, formatElapsed(r.now().Sub(r.phaseStart)))
+	if r.phase != progressBuild {
+		return line
+	}
+
+	p := r.progress
+	parts := []string{}
+	if p.ToBuild > 0 {
+		parts = append(parts, fmt.Sprintf("built %d/%d", p.Built, p.ToBuild))
+	}
+	if p.ToFetch > 0 {
+		parts = append(parts, fmt.Sprintf("fetched %d/%d", p.Fetched, p.ToFetch))
+	}
+	if p.DownloadTotal > 0 {
+		parts = append(parts, fmt.Sprintf("%s/%s", FormatBytes(p.DownloadedBytes), FormatBytes(p.DownloadTotal)))
+	}
+	if current := p.Current(); current != "" {
+		parts = append(parts, current)
+	}
+	if len(parts) == 0 {
+		return line
+	}
+	return line + " " + strings.Join(parts, " · ")
+}
+
+// println writes a line to out, clearing the status line first
+func (r *ProgressRenderer) println(line string) {
+	if r.drawn {
+		fmt.Fprint(r.status, "\r\033[K")
+		r.drawn = false
+		// Redraw right after the line
+		r.drawnAt = time.Time{}
+	}
+	fmt.Fprintln(r.out, line)
+}
+
+// Finish reports the outcome of the last phase. err is the error of the Nix command, if any
+func (r *ProgressRenderer) Finish(err error) {
+	if len(r.pending) > 0 {
+		r.handleLine(string(r.pending))
+		r.pending = nil
+	}
+	if r.drawn {
+		fmt.Fprint(r.status, "\r\033[K")
+		r.drawn = false
+	}
+	if !r.seen {
+		// The command printed nothing to summarize
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(r.out, r.phaseFailed())
+		return
+	}
+	fmt.Fprintln(r.out, r.phaseDone())
+}
+
+// formatElapsed renders a duration with a precision suited to progress output (e.g. "4.1s", "1m32s")
+func formatElapsed(d time.Duration) string {
+	if d < time.Minute {
+		return fmt.Sprintf("%.1fs", d.Seconds())
+	}
+	return d.Round(time.Second).String()
+}
+
+// WithProgress runs fn, rendering the output of the Nix commands it runs with
+// a ProgressRenderer instead of printing it as is. The log messages of Nix
+// still go to utils.RawOutput, so that operation logs keep every line of it
+func WithProgress(out, status io.Writer, fn func() error) error {
+	renderer := NewProgressRenderer(out, status)
+	renderer.raw = utils.RawOutput
+	stdout, stderr := utils.Stdout, utils.Stderr
+	utils.Stdout, utils.Stderr = renderer, renderer
+	nixLogFormat = "internal-json"
+	defer func() {
+		utils.Stdout, utils.Stderr = stdout, stderr
+		nixLogFormat = ""
+	}()
+
+	err := fn()
+	renderer.Finish(err)
+	return err
+}
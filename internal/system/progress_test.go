@@ -0,0 +1,355 @@
+package system
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"camp/internal/utils"
+)
+
+// readNixLogFixture returns the lines of an internal-json log from testdata/nix-log.
+// They follow the output of 'home-manager switch --flake <dir> --log-format internal-json -v'
+// with Nix 2.18: switch.log fetches and builds, noop.log has nothing to build
+// and failure.log fails to build a package of a flake. Record that command to refresh them
+func readNixLogFixture(t *testing.T, name string) []string {
+	t.Helper()
+	file, err := os.Open(filepath.Join("testdata", "nix-log", name))
+	if err != nil {
+		t.Fatalf("Failed to open fixture: %v", err)
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines
+}
+
+// fakeClock is a clock for the renderer that only moves when told to
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func TestParseNixLogLine(t *testing.T) {
+	tests := []struct {
+		name   string
+		line   string
+		want   *NixLogEvent
+		wantOK bool
+	}{
+		{
+			name:   "start",
+			line:   `@nix {"action":"start","fields":["/nix/store/x-hello.drv","",1,1],"id":7,"level":3,"parent":2,"text":"building","type":105}`,
+			want:   &NixLogEvent{Action: "start", ID: 7, Level: 3, Parent: 2, Text: "building", Type: 105, Fields: []any{"/nix/store/x-hello.drv", "", 1.0, 1.0}},
+			wantOK: true,
+		},
+		{
+			name:   "message",
+			line:   `@nix {"action":"msg","level":0,"msg":"error: boom"}` + "\n",
+			want:   &NixLogEvent{Action: "msg", Level: 0, Msg: "error: boom"},
+			wantOK: true,
+		},
+		{name: "plain output", line: "Starting Home Manager activation"},
+		{name: "invalid JSON", line: "@nix {not json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ParseNixLogLine(tt.line)
+			if ok != tt.wantOK {
+				t.Fatalf("ParseNixLogLine() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseNixLogLine() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildProgress(t *testing.T) {
+	tests := []struct {
+		fixture string
+		want    BuildProgress
+		summary string
+	}{
+		{
+			fixture: "switch.log",
+			want:    BuildProgress{ToBuild: 3, Built: 3, ToFetch: 3, Fetched: 3, DownloadedBytes: 3034664, DownloadTotal: 3034664},
+			summary: "built 3 derivations, fetched 3 paths, downloaded 2.9 MiB",
+		},
+		{
+			fixture: "noop.log",
+			summary: "nothing to build",
+		},
+		{
+			fixture: "failure.log",
+			want: BuildProgress{
+				ToBuild: 3,
+				Failed:  1,
+				Errors: []string{
+					"error: builder for '/nix/store/xp2kna5c94bh31kvd9pchi9br1ad4inr-team-cli-0.3.0.drv' failed with exit code 2;\n       last 10 log lines:\n" +
+						"       > build flags: SHELL=/nix/store/ajjhvpi6m9xs7ls45bbx3agmc8f655ak-bash-5.2p26/bin/bash\n" +
+						"       > cc     main.c   -o team-cli\n" +
+						"       > main.c: In function 'main':\n" +
+						"       > main.c:4:27: error: expected ';' before '}' token\n" +
+						"       >     4 |   return run(argc, argv)\n" +
+						"       >       |                           ^\n" +
+						"       >       |                           ;\n" +
+						"       >     5 | }\n" +
+						"       >       | ~                          \n" +
+						"       > make: *** [<builtin>: team-cli] Error 1\n" +
+						"       For full logs, run 'nix log /nix/store/xp2kna5c94bh31kvd9pchi9br1ad4inr-team-cli-0.3.0.drv'.",
+					"error: 1 dependencies of derivation '/nix/store/4h4skb95fkqylq2lna7f7nz07nar15pv-home-manager-path.drv' failed to build",
+					"error: 1 dependencies of derivation '/nix/store/b41ipnnpaxfbi5gp92xmawwpr4p9xfzw-home-manager-generation.drv' failed to build",
+				},
+			},
+			summary: "1 failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			progress := NewBuildProgress()
+			for _, line := range readNixLogFixture(t, tt.fixture) {
+				if event, ok := ParseNixLogLine(line); ok {
+					progress.Apply(event)
+				}
+			}
+
+			got := BuildProgress{
+				ToBuild:         progress.ToBuild,
+				Built:           progress.Built,
+				Failed:          progress.Failed,
+				ToFetch:         progress.ToFetch,
+				Fetched:         progress.Fetched,
+				DownloadedBytes: progress.DownloadedBytes,
+				DownloadTotal:   progress.DownloadTotal,
+				Errors:          progress.Errors,
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Progress = %+v, want %+v", got, tt.want)
+			}
+			if summary := progress.Summary(); summary != tt.summary {
+				t.Errorf("Summary() = %q, want %q", summary, tt.summary)
+			}
+			if progress.Realising() || progress.Current() != "" {
+				t.Errorf("Expected no running activity at the end, got %q", progress.Current())
+			}
+		})
+	}
+}
+
+func TestBuildProgressCurrent(t *testing.T) {
+	lines := readNixLogFixture(t, "switch.log")
+	progress := NewBuildProgress()
+	var seen []string
+	for _, line := range lines {
+		if event, ok := ParseNixLogLine(line); ok {
+			progress.Apply(event)
+		}
+		if current := progress.Current(); current != "" && (len(seen) == 0 || seen[len(seen)-1] != current) {
+			seen = append(seen, current)
+		}
+	}
+
+	expected := []string{
+		"fetching ripgrep-14.1.0",
+		"fetching fd-10.1.0",
+		"fetching jq-1.7.1-bin",
+		"building team-cli-0.3.0",
+		"building team-cli-0.3.0 (unpackPhase)",
+		"building team-cli-0.3.0 (patchPhase)",
+		"building team-cli-0.3.0 (updateAutotoolsGnuConfigScriptsPhase)",
+		"building team-cli-0.3.0 (configurePhase)",
+		"building team-cli-0.3.0 (buildPhase)",
+		"building team-cli-0.3.0 (installPhase)",
+		"building team-cli-0.3.0 (fixupPhase)",
+		"building home-manager-path",
+		"building home-manager-generation",
+	}
+	if !reflect.DeepEqual(seen, expected) {
+		t.Errorf("Current activities = %v, want %v", seen, expected)
+	}
+}
+
+func TestProgressRenderer(t *testing.T) {
+	tests := []struct {
+		fixture  string
+		err      error
+		expected []string
+	}{
+		{
+			fixture: "switch.log",
+			expected: []string{
+				"warning: ignoring untrusted substituter 'https://nix-community.cachix.org', you are not a trusted user.",
+				"Run `man nix.conf` for more information on the `substituters` configuration option.",
+				"✓ Evaluated configuration (2.4s)",
+				"✓ Build finished: built 3 derivations, fetched 3 paths, downloaded 2.9 MiB (",
+				"Starting Home Manager activation",
+				"Activating checkFilesChanged",
+				"Activating checkLinkTargets",
+				"Activating writeBoundary",
+				"Activating installPackages",
+				"replacing old 'home-manager-path'",
+				"installing 'home-manager-path'",
+				"Activating linkGeneration",
+				"Cleaning up orphan links from /home/alice",
+				"Creating profile generation 42",
+				"Creating home file links in /home/alice",
+				"Activating onFilesChange",
+				"Activating reloadSystemd",
+				"✓ Activated environment (",
+			},
+		},
+		{
+			fixture: "noop.log",
+			expected: []string{
+				"✓ Evaluated configuration (",
+				"✓ Build finished: nothing to build (",
+				"Starting Home Manager activation",
+				"Activating checkFilesChanged",
+				"Activating checkLinkTargets",
+				"Activating writeBoundary",
+				"Activating installPackages",
+				"Activating linkGeneration",
+				"Cleaning up orphan links from /home/alice",
+				"No change so reusing latest profile generation 42",
+				"Creating home file links in /home/alice",
+				"Activating onFilesChange",
+				"Activating reloadSystemd",
+				"✓ Activated environment (",
+			},
+		},
+		{
+			fixture: "failure.log",
+			err:     errors.New("exit status 1"),
+			expected: []string{
+				"✓ Evaluated configuration (",
+				"error: builder for '/nix/store/xp2kna5c94bh31kvd9pchi9br1ad4inr-team-cli-0.3.0.drv' failed with exit code 2;",
+				"       last 10 log lines:",
+				"       > build flags: SHELL=",
+				"       > cc     main.c   -o team-cli",
+				"       > main.c: In function 'main':",
+				"       > main.c:4:27: error: expected ';' before '}' token",
+				"       >     4 |   return run(argc, argv)",
+				"       >       |                           ^",
+				"       >       |                           ;",
+				"       >     5 | }",
+				"       >       | ~",
+				"       > make: *** [<builtin>: team-cli] Error 1",
+				"       For full logs, run 'nix log /nix/store/xp2kna5c94bh31kvd9pchi9br1ad4inr-team-cli-0.3.0.drv'.",
+				"error: 1 dependencies of derivation '/nix/store/4h4skb95fkqylq2lna7f7nz07nar15pv-home-manager-path.drv' failed to build",
+				"error: 1 dependencies of derivation '/nix/store/b41ipnnpaxfbi5gp92xmawwpr4p9xfzw-home-manager-generation.drv' failed to build",
+				"✗ Build failed after 9.2s (1 failed)",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			clock := &fakeClock{now: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)}
+			var out, status bytes.Buffer
+			renderer := newProgressRenderer(&out, &status, clock.Now)
+			for _, line := range readNixLogFixture(t, tt.fixture) {
+				clock.now = clock.now.Add(200 * time.Millisecond)
+				renderer.Write([]byte(line + "\n"))
+			}
+			renderer.Finish(tt.err)
+
+			lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+			if len(lines) != len(tt.expected) {
+				t.Fatalf("Expected %d lines, got:\n%s", len(tt.expected), out.String())
+			}
+			for i, prefix := range tt.expected {
+				if !strings.HasPrefix(lines[i], prefix) {
+					t.Errorf("Line %d = %q, want prefix %q", i, lines[i], prefix)
+				}
+			}
+			if strings.Contains(out.String(), "@nix") {
+				t.Errorf("Expected log messages not to be printed, got:\n%s", out.String())
+			}
+			if !strings.HasSuffix(status.String(), "\r\033[K") {
+				t.Errorf("Expected the status line to be cleared at the end, got %q", status.String())
+			}
+		})
+	}
+}
+
+func TestProgressRendererStatusLine(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)}
+	var out, status bytes.Buffer
+	renderer := newProgressRenderer(&out, &status, clock.Now)
+
+	// Stop right after the first download made progress
+	for _, line := range readNixLogFixture(t, "switch.log")[:26] {
+		renderer.Write([]byte(line + "\n"))
+	}
+	clock.now = clock.now.Add(3 * time.Second)
+
+	expected := "[build 3.0s] built 0/3 · fetched 0/3 · 543.1 KiB/2.9 MiB · fetching ripgrep-14.1.0"
+	if line := renderer.statusLine(); line != expected {
+		t.Errorf("statusLine() = %q, want %q", line, expected)
+	}
+}
+
+func TestProgressRendererWithoutStatus(t *testing.T) {
+	var out bytes.Buffer
+	renderer := NewProgressRenderer(&out, nil)
+	renderer.Write([]byte("partial line without newline"))
+	renderer.Finish(nil)
+	if !strings.HasPrefix(out.String(), "partial line without newline\n✓ Evaluated configuration") {
+		t.Errorf("Expected pending output to be flushed, got:\n%s", out.String())
+	}
+
+	out.Reset()
+	NewProgressRenderer(&out, nil).Finish(nil)
+	if out.Len() != 0 {
+		t.Errorf("Expected no summary without output, got:\n%s", out.String())
+	}
+}
+
+func TestWithProgress(t *testing.T) {
+	recorded := stubCommands(t, "")
+	user := newBackendTestUser(t, "linux")
+	backend := &homeManagerBackend{}
+
+	var out bytes.Buffer
+	err := WithProgress(&out, nil, func() error {
+		utils.Stderr.Write([]byte(`@nix {"action":"msg","level":0,"msg":"error: boom"}` + "\n"))
+		return backend.Switch(user)
+	})
+	if err != nil {
+		t.Fatalf("WithProgress() failed: %v", err)
+	}
+
+	if got := recorded.Calls[0].String(); !strings.HasSuffix(got, "--log-format internal-json") {
+		t.Errorf("Expected switch to use the internal-json log format, got %q", got)
+	}
+	if !strings.Contains(out.String(), "error: boom") {
+		t.Errorf("Expected Nix errors to be printed, got:\n%s", out.String())
+	}
+
+	// Commands run afterwards print their output as is
+	if err := backend.Switch(user); err != nil {
+		t.Fatalf("Switch() failed: %v", err)
+	}
+	if got := recorded.Calls[1].String(); strings.Contains(got, "--log-format") {
+		t.Errorf("Expected --log-format to be reset, got %q", got)
+	}
+	if _, ok := utils.Stderr.(*ProgressRenderer); ok {
+		t.Error("Expected utils.Stderr to be restored")
+	}
+}
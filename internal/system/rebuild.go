@@ -122,56 +122,17 @@ func CompileTemplates(user *User) error {
 	return nil
 }
 
-// ExecuteRebuild runs the platform-specific rebuild command
+// ExecuteRebuild runs the rebuild (switch) of the backend selected for the user
 func ExecuteRebuild(user *User) error {
-	nixDir := filepath.Join(user.HomeDir, ".camp", "nix")
-
 	// Check if nix directory exists
-	if _, err := os.Stat(nixDir); os.IsNotExist(err) {
-		return fmt.Errorf("nix directory does not exist: %s", nixDir)
-	}
-
-	var cmd string
-	var args []string
-
-	switch user.Platform {
-	case "darwin":
-		// macOS: use nix-darwin
-		// Note: nix-darwin may require sudo for system activation
-		cmd = "sudo"
-		args = []string{
-			"nix",
-			"--extra-experimental-features",
-			"nix-command flakes",
-			"run",
-			"nix-darwin#darwin-rebuild",
-			"--", // Separator: everything after this goes to darwin-rebuild
-			"switch",
-			"--impure",
-			"--flake",
-			fmt.Sprintf("%s#%s", nixDir, user.HostName),
-		}
-
-	case "linux":
-		// Linux: use home-manager
-		cmd = "home-manager"
-		args = []string{
-			"switch",
-			"--impure",
-			"-b",
-			"backup",
-			"--flake",
-			fmt.Sprintf("%s#%s", nixDir, user.Name),
-		}
-
-	default:
-		return fmt.Errorf("unsupported platform: %s", user.Platform)
+	if err := ensureNixDir(user); err != nil {
+		return err
 	}
 
-	// Execute rebuild command
-	if err := utils.RunCommand(cmd, args...); err != nil {
-		return fmt.Errorf("rebuild command failed: %w", err)
+	backend, err := SelectBackend(user)
+	if err != nil {
+		return err
 	}
 
-	return nil
+	return backend.Switch(user)
 }
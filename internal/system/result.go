@@ -0,0 +1,85 @@
+package system
+
+import "time"
+
+// Phase statuses reported in operation results
+const (
+	PhaseOK      = "ok"      // The phase succeeded
+	PhaseWarning = "warning" // The phase failed but the operation continued
+	PhaseFailed  = "failed"  // The phase failed and aborted the operation
+	PhaseSkipped = "skipped" // The phase wasn't needed
+)
+
+// PhaseResult is the outcome of one phase of an operation (e.g. "prepare")
+type PhaseResult struct {
+	Name     string  `json:"name"`
+	Status   string  `json:"status"`
+	Duration float64 `json:"duration_seconds"`
+	Error    string  `json:"error,omitempty"`
+}
+
+// OperationResult is the machine-readable outcome of a camp operation
+// like a rebuild, printed with --output json
+type OperationResult struct {
+	Command  string        `json:"command"`
+	Backend  string        `json:"backend,omitempty"`
+	Phases   []PhaseResult `json:"phases"`
+	Changes  *ClosureDiff  `json:"changes,omitempty"` // Package changes made by a rebuild
+	Inputs   []InputChange `json:"inputs,omitempty"`  // flake.lock changes made (or previewed) by an update
+	Hints    []Hint        `json:"hints,omitempty"`   // Known causes of the failure and how to fix them
+	Success  bool          `json:"success"`
+	Error    string        `json:"error,omitempty"`
+	ExitCode int           `json:"exit_code"`
+}
+
+// NewOperationResult creates the result of an operation
+func NewOperationResult(command string) *OperationResult {
+	return &OperationResult{Command: command, Phases: []PhaseResult{}}
+}
+
+// RunPhase runs fn as a phase of the operation and records its outcome
+func (r *OperationResult) RunPhase(name string, fn func() error) error {
+	start := time.Now()
+	err := fn()
+	status := PhaseOK
+	if err != nil {
+		status = PhaseFailed
+	}
+	r.addPhase(name, status, time.Since(start), err)
+	return err
+}
+
+// AddWarning records a phase that failed without aborting the operation
+func (r *OperationResult) AddWarning(name string, err error) {
+	r.addPhase(name, PhaseWarning, 0, err)
+}
+
+// AddSkipped records a phase that was skipped because it wasn't needed
+func (r *OperationResult) AddSkipped(name string) {
+	r.addPhase(name, PhaseSkipped, 0, nil)
+}
+
+func (r *OperationResult) addPhase(name, status string, duration time.Duration, err error) {
+	phase := PhaseResult{Name: name, Status: status, Duration: duration.Seconds()}
+	if err != nil {
+		phase.Error = err.Error()
+	}
+	r.Phases = append(r.Phases, phase)
+}
+
+// Finish records the outcome of the operation
+func (r *OperationResult) Finish(err error) {
+	r.Success = err == nil
+	r.ExitCode = ExitCode(err)
+	if err != nil {
+		r.Error = err.Error()
+	}
+}
+
+// EnvironmentInfo is the machine-readable output of camp env
+type EnvironmentInfo struct {
+	OS           string   `json:"os"`
+	Architecture string   `json:"architecture"`
+	Distribution string   `json:"distribution,omitempty"`
+	DirenvVars   []EnvVar `json:"direnv_vars"`
+}
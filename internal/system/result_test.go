@@ -0,0 +1,65 @@
+package system
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"testing"
+)
+
+func TestOperationResult(t *testing.T) {
+	result := NewOperationResult("rebuild")
+	if err := result.RunPhase("prepare", func() error { return nil }); err != nil {
+		t.Fatalf("Expected phase to succeed, got: %v", err)
+	}
+	result.AddWarning("cleanup", errors.New("some files were kept"))
+	switchErr := errors.New("boom")
+	if err := result.RunPhase("switch", func() error { return switchErr }); err != switchErr {
+		t.Fatalf("Expected phase error to be returned, got: %v", err)
+	}
+	result.Finish(fmt.Errorf("rebuild failed: %w", switchErr))
+
+	expected := []PhaseResult{
+		{Name: "prepare", Status: PhaseOK},
+		{Name: "cleanup", Status: PhaseWarning, Error: "some files were kept"},
+		{Name: "switch", Status: PhaseFailed, Error: "boom"},
+	}
+	if len(result.Phases) != len(expected) {
+		t.Fatalf("Expected %d phases, got %+v", len(expected), result.Phases)
+	}
+	for i, phase := range result.Phases {
+		if phase.Name != expected[i].Name || phase.Status != expected[i].Status || phase.Error != expected[i].Error {
+			t.Errorf("Expected phase %+v, got %+v", expected[i], phase)
+		}
+	}
+	if result.Success || result.ExitCode != ExitFailure || result.Error != "rebuild failed: boom" {
+		t.Errorf("Unexpected outcome: %+v", result)
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	commandErr := exec.Command("sh", "-c", "exit 3").Run()
+	_, missingErr := exec.LookPath("camp-test-missing-tool")
+
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"success", nil, ExitSuccess},
+		{"generic failure", errors.New("boom"), ExitFailure},
+		{"invalid config", fmt.Errorf("load: %w", &ConfigError{Err: errors.New("invalid")}), ExitConfig},
+		{"missing tool", fmt.Errorf("rebuild failed: %w", missingErr), ExitMissingTool},
+		{"failing command", fmt.Errorf("rebuild failed: %w", commandErr), ExitCommandFailed},
+		{"failing hook", &HookError{Stage: HookPreRebuild, Command: "exit 3", Err: commandErr}, ExitHookFailed},
+		{"locked", fmt.Errorf("rebuild failed: %w", &LockError{Holder: LockInfo{PID: 42, Command: "camp env update"}}), ExitLocked},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExitCode(tt.err); got != tt.want {
+				t.Errorf("Expected exit code %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
@@ -1,10 +1,16 @@
 package system
 
 import (
+	"bufio"
+	"os"
 	"os/exec"
 	"strings"
 )
 
+// osReleasePath is the file identifying the Linux distribution.
+// It can be overridden in tests
+var osReleasePath = "/etc/os-release"
+
 // GetSystemInfo retrieves system information
 func GetSystemInfo() (*System, error) {
 	arch, err := getMachineArchitecture()
@@ -20,6 +26,7 @@ func GetSystemInfo() (*System, error) {
 	return &System{
 		OS:           os,
 		Architecture: arch,
+		Distribution: getDistribution(),
 	}, nil
 }
 
@@ -44,3 +51,27 @@ func getOperatingSystem() (string, error) {
 	osName := strings.TrimSpace(strings.ToLower(string(output)))
 	return osName, nil
 }
+
+// getDistribution gets the distribution ID from /etc/os-release (e.g. "nixos", "ubuntu").
+// Returns an empty string when the file is not available, as on macOS
+func getDistribution() string {
+	file, err := os.Open(osReleasePath)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key, value, found := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if found && key == "ID" {
+			return strings.ToLower(strings.Trim(value, `"'`))
+		}
+	}
+	return ""
+}
+
+// IsNixOS reports whether the current machine runs NixOS
+func IsNixOS() bool {
+	return getDistribution() == "nixos"
+}
@@ -1,6 +1,10 @@
 package system
 
-import "testing"
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
 
 func TestGetSystemInfo(t *testing.T) {
 	sysInfo, err := GetSystemInfo()
@@ -68,3 +72,56 @@ func TestGetOperatingSystem(t *testing.T) {
 		t.Error("Expected operating system to not be empty")
 	}
 }
+
+func TestGetDistribution(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name:    "nixos",
+			content: "NAME=NixOS\nID=nixos\nVERSION_ID=\"24.11\"\n",
+			want:    "nixos",
+		},
+		{
+			name:    "quoted id",
+			content: "NAME=\"Ubuntu\"\nID=\"ubuntu\"\nID_LIKE=debian\n",
+			want:    "ubuntu",
+		},
+		{
+			name:    "no id",
+			content: "NAME=Unknown\n",
+			want:    "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "os-release")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("Failed to write os-release: %v", err)
+			}
+			withOSRelease(t, path)
+
+			if got := getDistribution(); got != tt.want {
+				t.Errorf("getDistribution() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		withOSRelease(t, filepath.Join(t.TempDir(), "missing"))
+		if got := getDistribution(); got != "" {
+			t.Errorf("getDistribution() = %q, want empty string", got)
+		}
+	})
+}
+
+// withOSRelease points osReleasePath to the given file for the duration of a test
+func withOSRelease(t *testing.T, path string) {
+	t.Helper()
+	original := osReleasePath
+	osReleasePath = path
+	t.Cleanup(func() { osReleasePath = original })
+}
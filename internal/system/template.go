@@ -15,6 +15,7 @@ type TemplateData struct {
 	HostName     string            // Machine hostname
 	Platform     string            // OS (darwin/linux)
 	Architecture string            // CPU arch (amd64/arm64)
+	Backend      string            // Resolved rebuild backend (darwin/home-manager/nixos)
 	HomeDir      string            // User's home directory
 	EnvVars      map[string]string // Custom environment variables
 	Packages     []string          // Nix packages to install
@@ -23,15 +24,35 @@ type TemplateData struct {
 
 // NewTemplateData creates template data from a User
 func NewTemplateData(user *User) *TemplateData {
+	// An unresolvable backend renders no configuration; rebuild reports the error
+	backend, _ := ResolveBackendName(user)
+
+	// Disabled flakes and those meant for other machines aren't rendered, not even as inputs.
+	// Flakes under development use their local checkout (camp flake develop)
+	flakes := developedFlakes(user)
+
+	// Arguments left out of camp.yml get the defaults declared by their flake.
+	// Only cached schemas are used, 'camp env check' fetches them
+	schemas := CachedArgSchemas(user)
+	for i, flake := range flakes {
+		if schema, ok := schemas[flake.Name]; ok {
+			flakes[i].Args = schema.WithDefaults(flake.Args)
+		}
+	}
+
+	// Complete follows with defaultFollows, leaving out inputs not declared on this machine
+	renderedFollows(flakes, user.DefaultFollows)
+
 	return &TemplateData{
 		Name:         user.Name,
 		HostName:     user.HostName,
 		Platform:     user.Platform,
 		Architecture: user.Architecture,
+		Backend:      backend,
 		HomeDir:      user.HomeDir,
 		EnvVars:      user.EnvVars,
 		Packages:     user.Packages,
-		Flakes:       user.Flakes,
+		Flakes:       flakes,
 	}
 }
 
@@ -421,6 +421,30 @@ func TestCompileTemplate_WithFlakeFollows(t *testing.T) {
 	}
 }
 
+func TestCompileTemplate_WithFlakeURLFields(t *testing.T) {
+	tmpDir := t.TempDir()
+	templatePath := filepath.Join(tmpDir, "test.tmpl")
+	if err := os.WriteFile(templatePath, []byte(`{{range .Flakes}}{{.Name}}={{.FlakeURL}}{{end}}`), 0644); err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+
+	// The rev and dir fields of camp.yml are rendered into the URL
+	data := &TemplateData{
+		Flakes: []Flake{
+			{Name: "tools", URL: "github:team/tools/main", Rev: "0123456789abcdef0123456789abcdef01234567", Dir: "nix"},
+		},
+	}
+
+	result, err := CompileTemplate(templatePath, data)
+	if err != nil {
+		t.Fatalf("CompileTemplate() failed: %v", err)
+	}
+	want := "tools=github:team/tools/0123456789abcdef0123456789abcdef01234567?dir=nix"
+	if string(result) != want {
+		t.Errorf("Expected %s, got %s", want, result)
+	}
+}
+
 func TestCompileTemplate_WithSystemAndHomeOutputs(t *testing.T) {
 	// Create temporary directory
 	tmpDir := t.TempDir()
@@ -951,3 +975,221 @@ func TestCompileTemplate_PackagesInFlakeTemplate(t *testing.T) {
 		t.Error("Expected EDITOR env var in result")
 	}
 }
+
+// ============================================================================
+// Backend Template Tests
+// ============================================================================
+
+// flakeTemplatePath is the real flake.nix template relative to this package
+const flakeTemplatePath = "../../templates/files/flake.nix"
+
+func TestCompileTemplate_NixOSBackend(t *testing.T) {
+	if _, err := os.Stat(flakeTemplatePath); os.IsNotExist(err) {
+		t.Skip("Skipping test: flake.nix template not found")
+	}
+
+	data := &TemplateData{
+		Name:     "testuser",
+		HostName: "testhost",
+		Platform: "linux",
+		HomeDir:  "/home/testuser",
+		Backend:  BackendNixOS,
+		Flakes: []Flake{
+			{
+				Name: "team",
+				URL:  "github:team/config",
+				Outputs: []FlakeOutput{
+					{Name: "nixosModules.default", Type: OutputTypeSystem},
+					{Name: "homeManagerModules.default", Type: OutputTypeHome},
+				},
+			},
+		},
+	}
+
+	result, err := CompileTemplate(flakeTemplatePath, data)
+	if err != nil {
+		t.Fatalf("CompileTemplate() failed: %v", err)
+	}
+	resultStr := string(result)
+
+	if !strings.Contains(resultStr, `backend = "nixos";`) {
+		t.Error("Expected rendered flake to contain the backend")
+	}
+
+	nixosStart := strings.Index(resultStr, "nixosConfigurations = if useNixOS")
+	if nixosStart == -1 {
+		t.Fatal("Expected rendered flake to contain nixosConfigurations")
+	}
+	nixosSection := resultStr[nixosStart:]
+
+	if !strings.Contains(nixosSection, "nixpkgs.lib.nixosSystem") {
+		t.Error("Expected nixosConfigurations to use nixpkgs.lib.nixosSystem")
+	}
+	if !strings.Contains(nixosSection, "home-manager.nixosModules.home-manager") {
+		t.Error("Expected nixosConfigurations to import home-manager as a NixOS module")
+	}
+	if !strings.Contains(nixosSection, "(team.nixosModules.default {") {
+		t.Error("Expected system outputs to be applied as NixOS modules")
+	}
+	if !strings.Contains(nixosSection, "(team.homeManagerModules.default {") {
+		t.Error("Expected home outputs to be applied through home-manager")
+	}
+}
+
+func TestCompileTemplate_ProfileBackend(t *testing.T) {
+	if _, err := os.Stat(flakeTemplatePath); os.IsNotExist(err) {
+		t.Skip("Skipping test: flake.nix template not found")
+	}
+
+	data := &TemplateData{
+		Name:     "testuser",
+		HostName: "testhost",
+		Platform: "linux",
+		HomeDir:  "/home/testuser",
+		Backend:  BackendProfile,
+		Packages: []string{"ripgrep", "jq"},
+	}
+
+	result, err := CompileTemplate(flakeTemplatePath, data)
+	if err != nil {
+		t.Fatalf("CompileTemplate() failed: %v", err)
+	}
+	resultStr := string(result)
+
+	if !strings.Contains(resultStr, "packages = if useProfile then {") {
+		t.Error("Expected rendered flake to expose the profile package")
+	}
+	if !strings.Contains(resultStr, "${system}.camp-profile") {
+		t.Error("Expected rendered flake to define camp-profile")
+	}
+	if !strings.Contains(resultStr, "pkgs.buildEnv") {
+		t.Error("Expected camp-profile to be a buildEnv")
+	}
+	if !strings.Contains(resultStr, `"ripgrep"`) || !strings.Contains(resultStr, `"jq"`) {
+		t.Error("Expected packages to be rendered into customPackages")
+	}
+}
+
+func TestCompileTemplate_PlainModulesAndOutputArgs(t *testing.T) {
+	if _, err := os.Stat(flakeTemplatePath); os.IsNotExist(err) {
+		t.Skip("Skipping test: flake.nix template not found")
+	}
+
+	noCall := false
+	flake := Flake{
+		Name: "team",
+		URL:  "github:team/config",
+		Args: map[string]interface{}{"fontSize": 12},
+		Outputs: []FlakeOutput{
+			{Name: "darwinModules.default", Type: OutputTypeSystem, Args: map[string]interface{}{"fontSize": 16}},
+			{Name: "nixosModules.default", Type: OutputTypeSystem, Args: map[string]interface{}{"fontSize": 16}},
+			{Name: "darwinModules.plain", Type: OutputTypeSystem, Call: &noCall},
+			{Name: "nixosModules.plain", Type: OutputTypeSystem, Call: &noCall},
+			{Name: "homeManagerModules.default", Type: OutputTypeHome},
+			{Name: "homeManagerModules.plain", Type: OutputTypeHome, Call: &noCall},
+		},
+	}
+
+	tests := []struct {
+		backend string
+		section string // Start of the configuration of the backend
+		system  string // Prefix of the system outputs of the backend, empty without system configuration
+	}{
+		{backend: BackendDarwin, section: "darwinConfigurations = if useDarwin", system: "darwinModules"},
+		{backend: BackendHomeManager, section: "homeConfigurations = if useHomeManager"},
+		{backend: BackendNixOS, section: "nixosConfigurations = if useNixOS", system: "nixosModules"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.backend, func(t *testing.T) {
+			data := &TemplateData{Name: "testuser", HostName: "testhost", HomeDir: "/home/testuser", Backend: tt.backend, Flakes: []Flake{flake}}
+			result, err := CompileTemplate(flakeTemplatePath, data)
+			if err != nil {
+				t.Fatalf("CompileTemplate() failed: %v", err)
+			}
+			section := string(result)[strings.Index(string(result), tt.section):]
+			section = section[:strings.Index(section, "} else null;")]
+
+			// Called outputs get camp's arguments, and their own args over the flake ones
+			home := moduleCall(t, section, "team.homeManagerModules.default")
+			if !strings.Contains(home, `userName = "testuser";`) || !strings.Contains(home, "fontSize = 12;") {
+				t.Errorf("Expected the home output to be called with the flake args, got:\n%s", home)
+			}
+			// Plain modules are imported as-is
+			if !containsLine(section, "team.homeManagerModules.plain") || strings.Contains(section, "(team.homeManagerModules.plain {") {
+				t.Errorf("Expected the plain home module to be imported as-is, got:\n%s", section)
+			}
+
+			if tt.system == "" {
+				return
+			}
+			system := moduleCall(t, section, "team."+tt.system+".default")
+			if !strings.Contains(system, `hostName = "testhost";`) || !strings.Contains(system, "fontSize = 16;") || strings.Contains(system, "fontSize = 12;") {
+				t.Errorf("Expected the system output args to override the flake args, got:\n%s", system)
+			}
+			if !containsLine(section, "team."+tt.system+".plain") || strings.Contains(section, "(team."+tt.system+".plain {") {
+				t.Errorf("Expected the plain system module to be imported as-is, got:\n%s", section)
+			}
+		})
+	}
+}
+
+// moduleCall returns the call of a flake output rendered in a configuration
+func moduleCall(t *testing.T, section, output string) string {
+	t.Helper()
+	start := strings.Index(section, "("+output+" {")
+	if start == -1 {
+		t.Fatalf("Expected %s to be called, got:\n%s", output, section)
+	}
+	return section[start : start+strings.Index(section[start:], "})")]
+}
+
+// containsLine reports whether text has a line holding only s, ignoring indentation
+func containsLine(text, s string) bool {
+	for _, line := range strings.Split(text, "\n") {
+		if strings.TrimSpace(line) == s {
+			return true
+		}
+	}
+	return false
+}
+
+func TestCompileTemplate_InactiveFlakes(t *testing.T) {
+	if _, err := os.Stat(flakeTemplatePath); os.IsNotExist(err) {
+		t.Skip("Skipping test: flake.nix template not found")
+	}
+
+	disabled := false
+	user := &User{
+		Name:     "testuser",
+		HostName: "laptop",
+		Platform: "linux",
+		HomeDir:  "/home/testuser",
+		Flakes: []Flake{
+			{Name: "tools", URL: "github:team/tools", Outputs: []FlakeOutput{
+				{Name: "homeManagerModules.default", Type: OutputTypeHome},
+				{Name: "homeManagerModules.gui", Type: OutputTypeHome, When: &FlakeCondition{HostName: "desktop-*"}},
+			}},
+			{Name: "old-tools", URL: "github:team/old-tools", Enabled: &disabled, Outputs: []FlakeOutput{{Name: "homeManagerModules.default", Type: OutputTypeHome}}},
+			{Name: "mac-tools", URL: "github:team/mac-tools", When: &FlakeCondition{Platform: "darwin"}, Outputs: []FlakeOutput{{Name: "darwinModules.default", Type: OutputTypeSystem}}},
+		},
+	}
+
+	result, err := CompileTemplate(flakeTemplatePath, NewTemplateData(user))
+	if err != nil {
+		t.Fatalf("CompileTemplate() failed: %v", err)
+	}
+	resultStr := string(result)
+
+	if !strings.Contains(resultStr, "tools = {") || !strings.Contains(resultStr, "(tools.homeManagerModules.default {") {
+		t.Error("Expected the active flake to be rendered")
+	}
+	if strings.Contains(resultStr, "tools.homeManagerModules.gui") {
+		t.Error("Expected the output for other hosts to be left out")
+	}
+	for _, name := range []string{"old-tools", "mac-tools"} {
+		if strings.Contains(resultStr, name) {
+			t.Errorf("Expected inactive flake %s to be left out, even from the inputs", name)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 	"os/exec"
 	"os/user"
+	"path/filepath"
 	"runtime"
 	"strings"
 )
@@ -13,6 +14,7 @@ import (
 type System struct {
 	OS           string
 	Architecture string
+	Distribution string // Linux distribution ID from /etc/os-release (empty on macOS)
 }
 
 // Home represents home directory information
@@ -33,6 +35,12 @@ type User struct {
 	EnvVars      map[string]string // Custom environment variables from camp.yml
 	Packages     []string          // Nix packages to install from camp.yml
 	Flakes       []Flake           // External Nix flakes from camp.yml
+	Backend      string            // Rebuild backend from camp.yml (empty means auto-detect)
+	Hooks        Hooks             // Commands run around camp operations from camp.yml
+	Logs         LogsConfig        // Rotation of operation logs from camp.yml
+	LockHistory  LockHistoryConfig // Pruning of flake.lock snapshots from camp.yml
+	// Follows applied to every flake from camp.yml
+	DefaultFollows map[string]string
 }
 
 // getRuntimeArchitecture detects the actual system architecture at runtime
@@ -113,14 +121,31 @@ func (u *User) Reload() error {
 		u.Flakes = []Flake{}
 	}
 
+	// Update Backend, Hooks, Logs, LockHistory and DefaultFollows from config
+	u.Backend = config.Backend
+	u.Hooks = config.Hooks
+	u.Logs = config.Logs
+	u.LockHistory = config.LockHistory
+	u.DefaultFollows = config.DefaultFollows
+
 	return nil
 }
 
+// NixDir returns the directory holding the rendered Nix configuration
+func (u *User) NixDir() string {
+	return filepath.Join(u.HomeDir, ".camp", "nix")
+}
+
+// StateDir returns the directory holding camp's runtime state (build results, profiles, ...)
+func (u *User) StateDir() string {
+	return filepath.Join(u.HomeDir, ".camp", "state")
+}
+
 // FlakeOutputType defines the allowed types for a flake's output
 type FlakeOutputType string
 
 const (
-	// OutputTypeSystem indicates the output should be applied at system level (nix-darwin)
+	// OutputTypeSystem indicates the output should be applied at system level (nix-darwin or NixOS)
 	OutputTypeSystem FlakeOutputType = "system"
 	// OutputTypeHome indicates the output should be applied at user level (home-manager)
 	OutputTypeHome FlakeOutputType = "home"
@@ -128,23 +153,65 @@ const (
 
 // FlakeOutput represents a specific output from a flake
 type FlakeOutput struct {
-	Name string          `yaml:"name"` // Output name (e.g., "packages", "homeManagerModules.default")
-	Type FlakeOutputType `yaml:"type"` // Where to apply: "system" or "home"
+	Name    string                 `yaml:"name"`              // Output name (e.g., "packages", "homeManagerModules.default")
+	Type    FlakeOutputType        `yaml:"type"`              // Where to apply: "system" or "home"
+	Call    *bool                  `yaml:"call,omitempty"`    // Whether to call the output with camp's arguments (default: true); false imports a plain module as-is
+	Args    map[string]interface{} `yaml:"args,omitempty"`    // Arguments overriding the flake-level ones for this output
+	Enabled *bool                  `yaml:"enabled,omitempty"` // Whether to import the output (default: true)
+	When    *FlakeCondition        `yaml:"when,omitempty"`    // Machines to import the output on (default: all)
+}
+
+// Calls reports whether the output is a function to call with camp's arguments,
+// rather than a plain module imported as-is
+func (o FlakeOutput) Calls() bool {
+	return o.Call == nil || *o.Call
+}
+
+// callsOutputs reports whether any output of the flake is called with camp's arguments
+func (f Flake) callsOutputs() bool {
+	for _, output := range f.Outputs {
+		if output.Calls() {
+			return true
+		}
+	}
+	return false
+}
+
+// OutputArgs returns the arguments an output is called with: the flake-level
+// arguments, overridden by those of the output
+func (f Flake) OutputArgs(output FlakeOutput) map[string]interface{} {
+	if len(output.Args) == 0 {
+		return f.Args
+	}
+	args := make(map[string]interface{}, len(f.Args)+len(output.Args))
+	for name, value := range f.Args {
+		args[name] = value
+	}
+	for name, value := range output.Args {
+		args[name] = value
+	}
+	return args
 }
 
 // Flake represents an external Nix flake reference
 type Flake struct {
-	Name    string                 `yaml:"name"`    // Unique identifier for the flake
-	URL     string                 `yaml:"url"`     // Flake URL (github:user/repo, git+ssh://..., path:/..., etc.)
-	Follows map[string]string      `yaml:"follows"` // Input dependency overrides (e.g., nixpkgs: "nixpkgs")
-	Args    map[string]interface{} `yaml:"args"`    // Custom arguments to pass to flake outputs (types inferred from YAML)
-	Outputs []FlakeOutput          `yaml:"outputs"` // Which outputs to import
+	Name    string                 `yaml:"name"`              // Unique identifier for the flake
+	URL     string                 `yaml:"url"`               // Flake URL (github:user/repo, git+ssh://..., path:/..., etc.)
+	Rev     string                 `yaml:"rev,omitempty"`     // Commit to pin, added to the URL
+	Ref     string                 `yaml:"ref,omitempty"`     // Branch or tag to follow, added to the URL
+	Dir     string                 `yaml:"dir,omitempty"`     // Subdirectory holding flake.nix, added to the URL
+	Host    string                 `yaml:"host,omitempty"`    // Self-hosted GitHub or GitLab instance, added to the URL
+	Follows map[string]string      `yaml:"follows"`           // Input dependency overrides (e.g., nixpkgs: "nixpkgs")
+	Args    map[string]interface{} `yaml:"args"`              // Custom arguments to pass to flake outputs (types inferred from YAML)
+	Outputs []FlakeOutput          `yaml:"outputs"`           // Which outputs to import
+	Enabled *bool                  `yaml:"enabled,omitempty"` // Whether to integrate the flake (default: true)
+	When    *FlakeCondition        `yaml:"when,omitempty"`    // Machines to integrate the flake on (default: all)
 }
 
 // EnvVar represents an environment variable
 type EnvVar struct {
-	Name  string
-	Value string
+	Name  string `json:"name"`
+	Value string `json:"value"`
 }
 
 // Application represents an application to be installed
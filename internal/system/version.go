@@ -0,0 +1,5 @@
+package system
+
+// Version is the version of camp, set at build time with
+// -ldflags "-X camp/internal/system.Version=..."
+var Version = "dev"
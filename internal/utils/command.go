@@ -1,29 +1,66 @@
 package utils
 
 import (
+	"context"
+	"io"
 	"os"
-	"os/exec"
 )
 
+// Stdout and Stderr receive the output of commands run with RunCommand and RunCommandIn.
+// They can be replaced to capture that output, e.g. to record it in operation logs.
+var (
+	Stdout io.Writer = os.Stdout
+	Stderr io.Writer = os.Stderr
+)
+
+// RawOutput, when set, receives the output of commands that the writers
+// replacing Stdout and Stderr don't show as is (e.g. the Nix log messages
+// turned into a progress summary). Operation logs record it to keep the raw output.
+var RawOutput io.Writer
+
+// TeeRawOutput adds w to the writers receiving RawOutput and returns a
+// function restoring the previous ones
+func TeeRawOutput(w io.Writer) (restore func()) {
+	previous := RawOutput
+	if previous == nil {
+		RawOutput = w
+	} else {
+		RawOutput = io.MultiWriter(previous, w)
+	}
+	return func() { RawOutput = previous }
+}
+
 // RunCommand runs a shell command and returns an error if the command fails.
 // The command is expected to be in the format of "command arg1 arg2 ..."
 // This function is particularly useful for running commands that can't be replaced by Go code.
+// The command can read stdin, so it may prompt the user.
 func RunCommand(comm string, args ...string) error {
-	cmd := exec.Command(comm, args...)
-	cmd.Stdin = os.Stdin
-	cmd.Stderr = os.Stderr
-	cmd.Stdout = os.Stdout
+	_, err := Run(context.Background(), Command{Name: comm, Args: args, Interactive: true})
+	return err
+}
 
-	return cmd.Run()
+// RunCommandIn runs a shell command like RunCommand, using dir as the working directory.
+// Useful for commands that leave files (like a ./result link) in the current directory.
+func RunCommandIn(dir string, comm string, args ...string) error {
+	_, err := Run(context.Background(), Command{Name: comm, Args: args, Dir: dir, Interactive: true})
+	return err
 }
 
 // RunCommands runs a list of shell commands in order and returns the first error encountered
 // or nil if all commands succeed.
 // The commands are expected to be in the format of []string{"command", "arg1", "arg2", ...}
 func RunCommands(cmds [][]string) error {
+	return RunCommandsContext(context.Background(), DefaultRunner, cmds)
+}
+
+// RunCommandsContext runs a list of commands in order with runner, like RunCommands.
+// Cancelling ctx stops the running command and skips the remaining ones.
+func RunCommandsContext(ctx context.Context, runner Runner, cmds [][]string) error {
 	for _, cmd := range cmds {
-		err := RunCommand(cmd[0], cmd[1:]...)
-		if err != nil {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if _, err := runner.Run(ctx, Command{Name: cmd[0], Args: cmd[1:], Interactive: true}); err != nil {
 			return err
 		}
 	}
@@ -33,10 +70,16 @@ func RunCommands(cmds [][]string) error {
 // CommandReturn runs a shell command and returns the output as a string.
 // Useful for when the output of the command is needed for further processing.
 func CommandReturn(comm string, args ...string) (string, error) {
-	cmd := exec.Command(comm, args...)
-	out, err := cmd.Output()
+	result, err := Run(context.Background(), Command{Name: comm, Args: args, Capture: true})
 	if err != nil {
 		return "", err
 	}
-	return string(out), nil
+	return result.Stdout, nil
+}
+
+// CommandCombinedOutput runs a shell command and returns its combined stdout and stderr.
+// Useful for commands whose diagnostics (like Nix evaluation errors) are printed on stderr.
+func CommandCombinedOutput(comm string, args ...string) (string, error) {
+	result, err := Run(context.Background(), Command{Name: comm, Args: args, Capture: true})
+	return result.Output, err
 }
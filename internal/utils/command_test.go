@@ -41,3 +41,13 @@ func TestCommandReturn(t *testing.T) {
 		})
 	}
 }
+
+func TestCommandCombinedOutput(t *testing.T) {
+	got, err := CommandCombinedOutput("sh", "-c", "echo out; echo err >&2; exit 1")
+	if err == nil {
+		t.Error("CommandCombinedOutput() should return the command error")
+	}
+	if got != "out\nerr\n" {
+		t.Errorf("CommandCombinedOutput() = %q, want %q", got, "out\nerr\n")
+	}
+}
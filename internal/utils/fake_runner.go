@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"context"
+	"io"
+)
+
+// FakeRunner is a Runner recording commands instead of running them. Useful in tests
+type FakeRunner struct {
+	// Calls holds the commands run, in order
+	Calls []Command
+	// Output is the output of every command, unless Respond is set
+	Output string
+	// Err is the error of every command, unless Respond is set
+	Err error
+	// Respond, when set, returns the output and error of each command
+	Respond func(command Command) (string, error)
+}
+
+// Run records the command and writes its configured output
+func (r *FakeRunner) Run(ctx context.Context, command Command) (*Result, error) {
+	r.Calls = append(r.Calls, command)
+
+	output, err := r.Output, r.Err
+	if r.Respond != nil {
+		output, err = r.Respond(command)
+	}
+
+	result := &Result{}
+	if command.Capture {
+		result.Stdout, result.Output = output, output
+	}
+	if command.Stdout != nil {
+		io.WriteString(command.Stdout, output)
+	} else if !command.Capture {
+		io.WriteString(Stdout, output)
+	}
+	return result, err
+}
+
+// Commands returns the command lines of the recorded calls
+func (r *FakeRunner) Commands() []string {
+	commands := make([]string, len(r.Calls))
+	for i, call := range r.Calls {
+		commands[i] = call.String()
+	}
+	return commands
+}
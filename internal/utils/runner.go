@@ -0,0 +1,214 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// killGracePeriod is how long a cancelled command has to exit after SIGTERM before it is killed
+const killGracePeriod = 5 * time.Second
+
+// Command describes an external command to run with a Runner
+type Command struct {
+	Name string
+	Args []string
+	// Dir is the working directory of the command. Empty means the current directory
+	Dir string
+	// Env holds "KEY=value" entries added to the environment of camp
+	Env []string
+	// Stdout and Stderr receive the output of the command.
+	// When nil, the output goes to utils.Stdout and utils.Stderr, unless Capture is set
+	Stdout io.Writer
+	Stderr io.Writer
+	// Capture records the output of the command in the Result.
+	// Output is then only written to Stdout and Stderr when they are set explicitly
+	Capture bool
+	// Timeout stops the command once elapsed. Zero means no timeout
+	Timeout time.Duration
+	// Interactive commands read camp's stdin and stay in its process group,
+	// so they can prompt on the terminal (e.g. sudo asking for a password).
+	// Under a terminal, every command stays in camp's process group
+	Interactive bool
+}
+
+// String returns the command line, as it would be typed in a shell
+func (c Command) String() string {
+	return strings.TrimSpace(c.Name + " " + strings.Join(c.Args, " "))
+}
+
+// Result holds the output captured from a command
+type Result struct {
+	Stdout string
+	Stderr string
+	// Output is stdout and stderr interleaved in the order they were written
+	Output string
+}
+
+// Runner runs external commands.
+// Implementations return the exec error of failed commands unwrapped,
+// so their exit code can be inspected with errors.As.
+type Runner interface {
+	Run(ctx context.Context, command Command) (*Result, error)
+}
+
+// DefaultRunner is the Runner used to run every external command of camp.
+// It can be replaced, e.g. by a FakeRunner in tests
+var DefaultRunner Runner = &ExecRunner{}
+
+// hasTerminal reports whether camp runs under a terminal. It can be overridden in tests
+var hasTerminal = sync.OnceValue(controllingTerminal)
+
+// ExecRunner runs commands as child processes.
+//
+// Without a terminal, non-interactive commands run in their own process group.
+// SIGINT and SIGTERM received by camp are forwarded to the whole group, so the
+// processes spawned by the command (like Nix builders) stop along with it.
+// Under a terminal, commands stay in camp's foreground process group instead:
+// in a background group, anything opening /dev/tty to prompt (ssh asking for a
+// passphrase while fetching a git+ssh flake, sudo asking for a password) would
+// be stopped by SIGTTIN. They get the Ctrl-C of the terminal along with camp,
+// and SIGTERM is forwarded to them.
+//
+// Cancelling the context or reaching the timeout sends SIGTERM to the group, or
+// the command alone when it shares camp's group, then kills it after a grace period.
+type ExecRunner struct{}
+
+// Run runs the command and waits for it to exit
+func (r *ExecRunner) Run(ctx context.Context, command Command) (*Result, error) {
+	if command.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, command.Timeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, command.Name, command.Args...)
+	cmd.Dir = command.Dir
+	if len(command.Env) > 0 {
+		cmd.Env = append(os.Environ(), command.Env...)
+	}
+	if command.Interactive {
+		cmd.Stdin = os.Stdin
+	}
+
+	// Wire the output to the configured writers and to the capture buffers
+	var stdout, stderr bytes.Buffer
+	output := &syncBuffer{}
+	cmd.Stdout = outputWriter(command.Stdout, Stdout, command.Capture, &stdout, output)
+	cmd.Stderr = outputWriter(command.Stderr, Stderr, command.Capture, &stderr, output)
+
+	ownGroup := !command.Interactive && !hasTerminal()
+	if ownGroup {
+		setProcessGroup(cmd)
+	}
+	if !command.Interactive {
+		cmd.Cancel = func() error { return signalProcessGroup(cmd.Process, syscall.SIGTERM) }
+		cmd.WaitDelay = killGracePeriod
+	}
+
+	// Catch interrupts while the command runs, so camp outlives its child and reports its failure.
+	// Commands sharing camp's process group already get the SIGINT of the terminal
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	if err := cmd.Start(); err != nil {
+		return &Result{}, err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case sig := <-signals:
+				if !ownGroup && sig == os.Interrupt {
+					continue
+				}
+				_ = signalProcessGroup(cmd.Process, sig)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	err := cmd.Wait()
+	result := &Result{Stdout: stdout.String(), Stderr: stderr.String(), Output: output.String()}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) && command.Timeout > 0 {
+		return result, fmt.Errorf("timed out after %s", command.Timeout)
+	}
+	if err != nil && ctx.Err() != nil {
+		return result, fmt.Errorf("%s: %w", command.Name, ctx.Err())
+	}
+	return result, err
+}
+
+// outputWriter returns where a command output stream is written
+func outputWriter(explicit, fallback io.Writer, capture bool, stream *bytes.Buffer, output *syncBuffer) io.Writer {
+	if !capture {
+		if explicit != nil {
+			return explicit
+		}
+		return fallback
+	}
+
+	writers := []io.Writer{stream, output}
+	if explicit != nil {
+		writers = append(writers, explicit)
+	}
+	return io.MultiWriter(writers...)
+}
+
+// syncBuffer is a bytes.Buffer safe to write from the stdout and stderr copying goroutines
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// DryRunner records commands and prints them instead of running them
+type DryRunner struct {
+	Out      io.Writer
+	Commands []Command
+}
+
+// NewDryRunner creates a DryRunner printing the commands to out
+func NewDryRunner(out io.Writer) *DryRunner {
+	return &DryRunner{Out: out}
+}
+
+// Run records the command and prints it
+func (r *DryRunner) Run(ctx context.Context, command Command) (*Result, error) {
+	r.Commands = append(r.Commands, command)
+	if command.Dir != "" {
+		fmt.Fprintf(r.Out, "[DRY RUN] Would execute in %s: %s\n", command.Dir, command)
+	} else {
+		fmt.Fprintf(r.Out, "[DRY RUN] Would execute: %s\n", command)
+	}
+	return &Result{}, nil
+}
+
+// Run runs a command with the DefaultRunner
+func Run(ctx context.Context, command Command) (*Result, error) {
+	return DefaultRunner.Run(ctx, command)
+}
@@ -0,0 +1,22 @@
+//go:build !unix
+
+package utils
+
+import (
+	"os"
+	"os/exec"
+)
+
+// controllingTerminal reports false, commands always run as they would without process groups
+func controllingTerminal() bool { return false }
+
+// setProcessGroup is a no-op on platforms without process groups
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// signalProcessGroup sends sig to the process alone on platforms without process groups
+func signalProcessGroup(process *os.Process, sig os.Signal) error {
+	if process == nil {
+		return nil
+	}
+	return process.Signal(sig)
+}
@@ -0,0 +1,183 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExecRunner(t *testing.T) {
+	runner := &ExecRunner{}
+
+	tests := []struct {
+		name       string
+		command    Command
+		wantStdout string
+		wantStderr string
+		wantOutput string
+		wantErr    bool
+	}{
+		{
+			name:       "captures stdout and stderr",
+			command:    Command{Name: "sh", Args: []string{"-c", "echo out; echo err >&2"}, Capture: true},
+			wantStdout: "out\n",
+			wantStderr: "err\n",
+			wantOutput: "out\nerr\n",
+		},
+		{
+			name:       "adds env to the environment",
+			command:    Command{Name: "sh", Args: []string{"-c", "echo $CAMP_TEST-${HOME:+home}"}, Env: []string{"CAMP_TEST=value"}, Capture: true},
+			wantStdout: "value-home\n",
+			wantOutput: "value-home\n",
+		},
+		{
+			name:       "runs in dir",
+			command:    Command{Name: "pwd", Dir: "/", Capture: true},
+			wantStdout: "/\n",
+			wantOutput: "/\n",
+		},
+		{
+			name:    "returns the exit error",
+			command: Command{Name: "sh", Args: []string{"-c", "exit 3"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := runner.Run(context.Background(), tt.command)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Run() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if result.Stdout != tt.wantStdout || result.Stderr != tt.wantStderr || result.Output != tt.wantOutput {
+				t.Errorf("Run() = %+v, want stdout %q, stderr %q, output %q", result, tt.wantStdout, tt.wantStderr, tt.wantOutput)
+			}
+		})
+	}
+
+	t.Run("exit error can be inspected", func(t *testing.T) {
+		_, err := runner.Run(context.Background(), Command{Name: "sh", Args: []string{"-c", "exit 3"}})
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) || exitErr.ExitCode() != 3 {
+			t.Errorf("Expected exit status 3, got %v", err)
+		}
+	})
+
+	t.Run("tees captured output", func(t *testing.T) {
+		var stdout bytes.Buffer
+		result, err := runner.Run(context.Background(), Command{Name: "echo", Args: []string{"hello"}, Stdout: &stdout, Capture: true})
+		if err != nil {
+			t.Fatalf("Run() failed: %v", err)
+		}
+		if stdout.String() != "hello\n" || result.Stdout != "hello\n" {
+			t.Errorf("Expected output written and captured, got %q and %q", stdout.String(), result.Stdout)
+		}
+	})
+
+	t.Run("writes to utils.Stdout by default", func(t *testing.T) {
+		var stdout bytes.Buffer
+		original := Stdout
+		Stdout = &stdout
+		t.Cleanup(func() { Stdout = original })
+
+		if _, err := runner.Run(context.Background(), Command{Name: "echo", Args: []string{"hello"}}); err != nil {
+			t.Fatalf("Run() failed: %v", err)
+		}
+		if stdout.String() != "hello\n" {
+			t.Errorf("Expected output in utils.Stdout, got %q", stdout.String())
+		}
+	})
+}
+
+func TestExecRunnerStops(t *testing.T) {
+	runner := &ExecRunner{}
+	// The background sleep checks the whole process group is stopped, not only sh
+	script := Command{Name: "sh", Args: []string{"-c", "sleep 10 & wait"}}
+
+	t.Run("timeout", func(t *testing.T) {
+		command := script
+		command.Timeout = 100 * time.Millisecond
+
+		start := time.Now()
+		_, err := runner.Run(context.Background(), command)
+		if err == nil || err.Error() != "timed out after 100ms" {
+			t.Errorf("Expected timeout error, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > 3*time.Second {
+			t.Errorf("Expected the command to stop quickly, took %s", elapsed)
+		}
+	})
+
+	t.Run("cancelled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(100*time.Millisecond, cancel)
+
+		start := time.Now()
+		_, err := runner.Run(ctx, script)
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > 3*time.Second {
+			t.Errorf("Expected the command to stop quickly, took %s", elapsed)
+		}
+	})
+
+	t.Run("missing command", func(t *testing.T) {
+		_, err := runner.Run(context.Background(), Command{Name: "camp-test-missing-tool"})
+		if !errors.Is(err, exec.ErrNotFound) {
+			t.Errorf("Expected exec.ErrNotFound, got %v", err)
+		}
+	})
+}
+
+func TestDryRunner(t *testing.T) {
+	var out bytes.Buffer
+	runner := NewDryRunner(&out)
+
+	if _, err := runner.Run(context.Background(), Command{Name: "npm", Args: []string{"install"}}); err != nil {
+		t.Fatalf("Run() failed: %v", err)
+	}
+	if _, err := runner.Run(context.Background(), Command{Name: "make", Args: []string{"test"}, Dir: "/src"}); err != nil {
+		t.Fatalf("Run() failed: %v", err)
+	}
+
+	want := "[DRY RUN] Would execute: npm install\n[DRY RUN] Would execute in /src: make test\n"
+	if out.String() != want {
+		t.Errorf("Expected %q, got %q", want, out.String())
+	}
+	if len(runner.Commands) != 2 {
+		t.Errorf("Expected 2 recorded commands, got %d", len(runner.Commands))
+	}
+}
+
+func TestFakeRunner(t *testing.T) {
+	runner := &FakeRunner{Output: "1.0\n"}
+	original := DefaultRunner
+	DefaultRunner = runner
+	t.Cleanup(func() { DefaultRunner = original })
+
+	got, err := CommandReturn("nix", "--version")
+	if err != nil || got != "1.0\n" {
+		t.Errorf("CommandReturn() = %q, %v, want the fake output", got, err)
+	}
+
+	runner.Respond = func(command Command) (string, error) {
+		if command.Name == "false" {
+			return "", errors.New("exit status 1")
+		}
+		return "", nil
+	}
+	err = RunCommands([][]string{{"true"}, {"false", "-x"}, {"never"}})
+	if err == nil {
+		t.Error("RunCommands() should return the failing command error")
+	}
+
+	want := []string{"nix --version", "true", "false -x"}
+	if got := runner.Commands(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected commands %v, got %v", want, got)
+	}
+}
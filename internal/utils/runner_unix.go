@@ -0,0 +1,41 @@
+//go:build unix
+
+package utils
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// controllingTerminal reports whether camp has a controlling terminal, that
+// the commands it runs may open to prompt (e.g. ssh asking for a passphrase)
+func controllingTerminal() bool {
+	tty, err := os.Open("/dev/tty")
+	if err != nil {
+		return false
+	}
+	tty.Close()
+	return true
+}
+
+// setProcessGroup makes the command the leader of a new process group
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// signalProcessGroup sends sig to the process group led by process
+func signalProcessGroup(process *os.Process, sig os.Signal) error {
+	if process == nil {
+		return nil
+	}
+	signum, ok := sig.(syscall.Signal)
+	if !ok {
+		return process.Signal(sig)
+	}
+	// Fall back to the process alone when it is not a group leader (commands sharing camp's group)
+	if err := syscall.Kill(-process.Pid, signum); err != nil {
+		return process.Signal(sig)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+//go:build unix
+
+package utils
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// withTerminal makes the runner behave as if camp ran under a terminal, or not
+func withTerminal(t *testing.T, terminal bool) {
+	t.Helper()
+	original := hasTerminal
+	hasTerminal = func() bool { return terminal }
+	t.Cleanup(func() { hasTerminal = original })
+}
+
+func TestExecRunnerProcessGroup(t *testing.T) {
+	runner := &ExecRunner{}
+	campGroup := strconv.Itoa(syscall.Getpgrp())
+
+	tests := []struct {
+		name         string
+		terminal     bool
+		wantOwnGroup bool
+	}{
+		// A background group can't prompt on the terminal, commands stay in camp's group
+		{name: "under a terminal", terminal: true},
+		{name: "without terminal", wantOwnGroup: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withTerminal(t, tt.terminal)
+			result, err := runner.Run(context.Background(), Command{Name: "sh", Args: []string{"-c", "ps -o pgid= -p $$"}, Capture: true})
+			if err != nil {
+				t.Skipf("ps is not available: %v", err)
+			}
+			group := strings.TrimSpace(result.Stdout)
+			if ownGroup := group != campGroup; ownGroup != tt.wantOwnGroup {
+				t.Errorf("Expected own process group=%v, got group %s (camp's: %s)", tt.wantOwnGroup, group, campGroup)
+			}
+		})
+	}
+}
+
+func TestExecRunnerStopsUnderTerminal(t *testing.T) {
+	withTerminal(t, true)
+	runner := &ExecRunner{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := runner.Run(ctx, Command{Name: "sh", Args: []string{"-c", "exec sleep 10"}})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("Expected the command to stop quickly, took %s", elapsed)
+	}
+}
@@ -0,0 +1,27 @@
+package utils
+
+// TailBuffer is an io.Writer keeping only the last bytes written to it.
+// Useful to inspect the end of a long command output without holding all of it.
+type TailBuffer struct {
+	limit int
+	data  []byte
+}
+
+// NewTailBuffer creates a buffer keeping at most limit bytes
+func NewTailBuffer(limit int) *TailBuffer {
+	return &TailBuffer{limit: limit}
+}
+
+// Write appends p, dropping the oldest bytes beyond the limit
+func (b *TailBuffer) Write(p []byte) (int, error) {
+	b.data = append(b.data, p...)
+	if len(b.data) > b.limit {
+		b.data = append([]byte(nil), b.data[len(b.data)-b.limit:]...)
+	}
+	return len(p), nil
+}
+
+// String returns the bytes kept by the buffer
+func (b *TailBuffer) String() string {
+	return string(b.data)
+}
@@ -0,0 +1,16 @@
+package utils
+
+import "testing"
+
+func TestTailBuffer(t *testing.T) {
+	buffer := NewTailBuffer(8)
+	buffer.Write([]byte("hello"))
+	if got := buffer.String(); got != "hello" {
+		t.Errorf("Expected 'hello', got %q", got)
+	}
+
+	buffer.Write([]byte(" world"))
+	if got := buffer.String(); got != "lo world" {
+		t.Errorf("Expected the last 8 bytes, got %q", got)
+	}
+}
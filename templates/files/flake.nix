@@ -16,7 +16,7 @@
     # Custom user-defined flakes
     {{- range .Flakes }}
     {{ .Name }} = {
-      url = "{{ .URL }}";
+      url = "{{ .FlakeURL }}";
       {{- range $key, $value := .Follows }}
       inputs.{{ $key }}.follows = "{{ $value }}";
       {{- end }}
@@ -34,16 +34,22 @@
     platform = "{{.Platform}}";
     usersPath = "{{.HomeDir}}";
     architecture = "{{.Architecture}}";
+    backend = "{{.Backend}}";
 
     # Conditional logic to determine the system (darwin or linux)
     isDarwin = platform == "darwin";
-    isLinux = !isDarwin;
     system = if isDarwin
       then "aarch64-darwin"
       else if architecture == "arm64"
         then "aarch64-linux"
         else "x86_64-linux";
 
+    # The rebuild backend decides which configuration is exposed
+    useDarwin = backend == "darwin";
+    useHomeManager = backend == "home-manager";
+    useNixOS = backend == "nixos";
+    useProfile = backend == "profile";
+
     # Define variables that will be injected in other templates
     specialArgs = {
       inherit hostName user usersPath;
@@ -61,8 +67,8 @@
 
   in
   {
-    # macOS setup using nix-darwin (only if isDarwin is true)
-    darwinConfigurations = if isDarwin then {
+    # macOS setup using nix-darwin (only with the darwin backend)
+    darwinConfigurations = if useDarwin then {
       ${hostName} = nix-darwin.lib.darwinSystem {
         inherit specialArgs system;
         modules = [
@@ -79,14 +85,18 @@
           {{- range $flake := .Flakes }}
             {{- range .Outputs }}
               {{- if eq .Type "system" }}
+                {{- if .Calls }}
           ({{ $flake.Name }}.{{ .Name }} {
             userName = "{{ $.Name }}";
             hostName = "{{ $.HostName }}";
             home = "{{ $.HomeDir }}";
-            {{- range $key, $value := $flake.Args }}
+            {{- range $key, $value := $flake.OutputArgs . }}
             {{ $key }} = {{ renderNixValue $value }};
             {{- end }}
           })
+                {{- else }}
+          {{ $flake.Name }}.{{ .Name }}
+                {{- end }}
               {{- end }}
             {{- end }}
           {{- end }}
@@ -102,14 +112,18 @@
                 {{- range $flake := .Flakes }}
                   {{- range .Outputs }}
                     {{- if eq .Type "home" }}
+                      {{- if .Calls }}
                 ({{ $flake.Name }}.{{ .Name }} {
                   userName = "{{ $.Name }}";
                   hostName = "{{ $.HostName }}";
                   home = "{{ $.HomeDir }}";
-                  {{- range $key, $value := $flake.Args }}
+                  {{- range $key, $value := $flake.OutputArgs . }}
                   {{ $key }} = {{ renderNixValue $value }};
                   {{- end }}
                 })
+                      {{- else }}
+                {{ $flake.Name }}.{{ .Name }}
+                      {{- end }}
                     {{- end }}
                   {{- end }}
                 {{- end }}
@@ -122,8 +136,8 @@
       };
     } else null;
 
-    # Linux (Ubuntu) setup (only if isLinux is true)
-    homeConfigurations = if isLinux then {
+    # Standalone home-manager setup (only with the home-manager backend)
+    homeConfigurations = if useHomeManager then {
       "${user}" = home-manager.lib.homeManagerConfiguration {
         # Use nixpkgs with the correct system
         pkgs = import nixpkgs {
@@ -140,23 +154,100 @@
           {{- range $flake := .Flakes }}
             {{- range .Outputs }}
               {{- if eq .Type "home" }}
+                {{- if .Calls }}
+          ({{ $flake.Name }}.{{ .Name }} {
+            userName = "{{ $.Name }}";
+            hostName = "{{ $.HostName }}";
+            home = "{{ $.HomeDir }}";
+            {{- range $key, $value := $flake.OutputArgs . }}
+            {{ $key }} = {{ renderNixValue $value }};
+            {{- end }}
+          })
+                {{- else }}
+          {{ $flake.Name }}.{{ .Name }}
+                {{- end }}
+              {{- end }}
+            {{- end }}
+          {{- end }}
+        ];
+      };
+    } else null;
+
+    # NixOS setup using nixos-rebuild (only with the nixos backend)
+    nixosConfigurations = if useNixOS then {
+      ${hostName} = nixpkgs.lib.nixosSystem {
+        inherit specialArgs system;
+        modules = [
+          ./nixos.nix
+
+          # Custom system-level flake modules (NixOS)
+          {{- range $flake := .Flakes }}
+            {{- range .Outputs }}
+              {{- if eq .Type "system" }}
+                {{- if .Calls }}
           ({{ $flake.Name }}.{{ .Name }} {
             userName = "{{ $.Name }}";
             hostName = "{{ $.HostName }}";
             home = "{{ $.HomeDir }}";
-            {{- range $key, $value := $flake.Args }}
+            {{- range $key, $value := $flake.OutputArgs . }}
             {{ $key }} = {{ renderNixValue $value }};
             {{- end }}
           })
+                {{- else }}
+          {{ $flake.Name }}.{{ .Name }}
+                {{- end }}
               {{- end }}
             {{- end }}
           {{- end }}
+
+          home-manager.nixosModules.home-manager {
+            home-manager.useGlobalPkgs = true;
+            home-manager.useUserPackages = true;
+            home-manager.users.${user} = {
+              imports = [
+                ./modules/common.nix
+
+                # Custom home-level flake modules
+                {{- range $flake := .Flakes }}
+                  {{- range .Outputs }}
+                    {{- if eq .Type "home" }}
+                      {{- if .Calls }}
+                ({{ $flake.Name }}.{{ .Name }} {
+                  userName = "{{ $.Name }}";
+                  hostName = "{{ $.HostName }}";
+                  home = "{{ $.HomeDir }}";
+                  {{- range $key, $value := $flake.OutputArgs . }}
+                  {{ $key }} = {{ renderNixValue $value }};
+                  {{- end }}
+                })
+                      {{- else }}
+                {{ $flake.Name }}.{{ .Name }}
+                      {{- end }}
+                    {{- end }}
+                  {{- end }}
+                {{- end }}
+              ];
+            };
+            home-manager.extraSpecialArgs = specialArgs;
+            home-manager.backupFileExtension = "backup";
+          }
         ];
       };
     } else null;
 
-    # Expose the package set for both darwin and linux for convenience
-    darwinPackages = if isDarwin then self.darwinConfigurations.${hostName}.pkgs else null;
-    linuxPackages = if isLinux then self.homeConfigurations.${user}.pkgs else null;
+    # Package environment installed with nix profile (only with the profile backend)
+    packages = if useProfile then {
+      ${system}.camp-profile = let
+        pkgs = import nixpkgs { inherit system; };
+      in pkgs.buildEnv {
+        name = "camp-profile";
+        paths = map (name: pkgs.${name}) specialArgs.customPackages;
+      };
+    } else {};
+
+    # Expose the package set of the active configuration for convenience
+    darwinPackages = if useDarwin then self.darwinConfigurations.${hostName}.pkgs else null;
+    linuxPackages = if useHomeManager then self.homeConfigurations.${user}.pkgs else null;
+    nixosPackages = if useNixOS then self.nixosConfigurations.${hostName}.pkgs else null;
   };
 }
@@ -0,0 +1,15 @@
+# NixOS system specific configurations go here.
+{ config, pkgs, user, usersPath, ... }:
+
+{
+  # Keep the host's own configuration (hardware, boot loader, networking).
+  # Importing it requires --impure, which camp always passes to nixos-rebuild.
+  imports = [
+    /etc/nixos/configuration.nix
+  ];
+
+  users.users.${user} = {
+    home = usersPath;
+  };
+  nix.settings.experimental-features = [ "nix-command" "flakes" ];
+}